@@ -0,0 +1,210 @@
+// Package charts opens the Helm charts in a hauler store so they can be
+// reviewed before publishing: their Chart.yaml metadata, dependencies and
+// whether the haul holds them, default values, templates and README. Charts
+// are read with Helm's own loader, straight from the chart layer's blob.
+package charts
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// ErrNotChart is returned when a digest names no chart in the store.
+var ErrNotChart = errors.New("not a chart in this haul")
+
+// Info describes a chart for review.
+type Info struct {
+	Name     string          `json:"name"`
+	Version  string          `json:"version"`
+	Digest   string          `json:"digest"` // the chart's manifest in the store
+	Metadata *chart.Metadata `json:"metadata"`
+	// ChartYAML and Values are the files as packaged, comments and all.
+	ChartYAML    string       `json:"chartYaml"`
+	Values       string       `json:"values"`
+	Dependencies []Dependency `json:"dependencies"`
+	// MissingDependencies counts dependencies neither vendored nor in the
+	// haul, which cannot be resolved offline.
+	MissingDependencies int        `json:"missingDependencies"`
+	Templates           []Template `json:"templates"`
+	Readme              string     `json:"readme,omitempty"`
+	HasSchema           bool       `json:"hasSchema,omitempty"` // ships values.schema.json
+}
+
+// Dependency is a chart dependency and where it can be found.
+type Dependency struct {
+	Name       string `json:"name"`
+	Version    string `json:"version,omitempty"` // a version or semver range
+	Repository string `json:"repository,omitempty"`
+	Alias      string `json:"alias,omitempty"`
+	Condition  string `json:"condition,omitempty"`
+	// Vendored is set when the dependency is packaged in the chart's charts/
+	// directory, at VendoredVersion.
+	Vendored        bool   `json:"vendored"`
+	VendoredVersion string `json:"vendoredVersion,omitempty"`
+	// InHaul is set when the haul holds a chart of this name at a version
+	// Version allows; HaulVersion is the newest such version.
+	InHaul      bool   `json:"inHaul"`
+	HaulVersion string `json:"haulVersion,omitempty"`
+	// HaulVersions lists every version of the chart in the haul.
+	HaulVersions []string `json:"haulVersions,omitempty"`
+}
+
+// Template is one file of the chart's templates/ directory.
+type Template struct {
+	Name string `json:"name"`
+	Size int    `json:"size"`
+}
+
+// Open loads the chart whose manifest has the given digest.
+func Open(st *ocistore.Store, digest string) (*chart.Chart, error) {
+	a, ok := st.Artifact(digest)
+	if !ok || a.Kind != ocistore.KindChart {
+		return nil, ErrNotChart
+	}
+	layer, ok := chartLayer(a)
+	if !ok {
+		return nil, fmt.Errorf("chart %s has no chart layer", a.Name)
+	}
+	f, err := os.Open(st.BlobPath(layer.Digest))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ch, err := loader.LoadArchive(f)
+	if err != nil {
+		return nil, fmt.Errorf("loading chart %s: %w", a.Name, err)
+	}
+	return ch, nil
+}
+
+// chartLayer finds the packaged chart among an artifact's layers.
+func chartLayer(a *ocistore.Artifact) (ocistore.Descriptor, bool) {
+	for _, l := range a.Layers {
+		if l.MediaType == ocistore.MediaTypeChartLayer {
+			return l, true
+		}
+	}
+	for _, l := range a.Layers {
+		if strings.HasSuffix(l.Annotations[ocistore.AnnotationTitle], ".tgz") {
+			return l, true
+		}
+	}
+	return ocistore.Descriptor{}, false
+}
+
+// Versions returns the versions of each chart in the store, by chart name.
+func Versions(st *ocistore.Store) map[string][]string {
+	out := map[string][]string{}
+	for _, a := range st.Artifacts {
+		if a.Kind == ocistore.KindChart && a.ChartName != "" {
+			out[a.ChartName] = append(out[a.ChartName], a.ChartVersion)
+		}
+	}
+	return out
+}
+
+// Inspect describes a chart. available lists the chart versions in the
+// haul by name, as from Versions.
+func Inspect(ch *chart.Chart, available map[string][]string) *Info {
+	info := &Info{
+		Name:         ch.Name(),
+		Metadata:     ch.Metadata,
+		Dependencies: []Dependency{},
+		Templates:    []Template{},
+	}
+	if ch.Metadata != nil {
+		info.Version = ch.Metadata.Version
+	}
+	for _, f := range ch.Raw {
+		switch f.Name {
+		case "Chart.yaml":
+			info.ChartYAML = string(f.Data)
+		case "values.yaml":
+			info.Values = string(f.Data)
+		}
+	}
+	for _, f := range ch.Files {
+		if strings.EqualFold(f.Name, "README.md") {
+			info.Readme = string(f.Data)
+		}
+	}
+	info.HasSchema = len(ch.Schema) > 0
+	for _, t := range ch.Templates {
+		info.Templates = append(info.Templates, Template{Name: t.Name, Size: len(t.Data)})
+	}
+	sort.Slice(info.Templates, func(i, j int) bool { return info.Templates[i].Name < info.Templates[j].Name })
+
+	vendored := map[string]string{}
+	for _, sub := range ch.Dependencies() {
+		if sub.Metadata != nil {
+			vendored[sub.Metadata.Name] = sub.Metadata.Version
+		}
+	}
+	if ch.Metadata != nil {
+		for _, d := range ch.Metadata.Dependencies {
+			dep := Dependency{
+				Name: d.Name, Version: d.Version, Repository: d.Repository,
+				Alias: d.Alias, Condition: d.Condition,
+			}
+			if v, ok := vendored[d.Name]; ok && versionAllowed(d.Version, v) {
+				dep.Vendored, dep.VendoredVersion = true, v
+			}
+			dep.HaulVersions = available[d.Name]
+			dep.HaulVersion = newestAllowed(d.Version, dep.HaulVersions)
+			dep.InHaul = dep.HaulVersion != ""
+			if !dep.Vendored && !dep.InHaul {
+				info.MissingDependencies++
+			}
+			info.Dependencies = append(info.Dependencies, dep)
+		}
+	}
+	return info
+}
+
+// versionAllowed reports whether version satisfies constraint, a semver
+// range; an unparsable constraint must match exactly.
+func versionAllowed(constraint, version string) bool {
+	if constraint == "" {
+		return true
+	}
+	c, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return constraint == version
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return constraint == version
+	}
+	return c.Check(v)
+}
+
+// newestAllowed returns the newest of versions that constraint allows.
+func newestAllowed(constraint string, versions []string) string {
+	var best *semver.Version
+	bestRaw := ""
+	for _, raw := range versions {
+		if !versionAllowed(constraint, raw) {
+			continue
+		}
+		v, err := semver.NewVersion(raw)
+		if err != nil {
+			if bestRaw == "" {
+				bestRaw = raw
+			}
+			continue
+		}
+		if best == nil || v.GreaterThan(best) {
+			best, bestRaw = v, raw
+		}
+	}
+	return bestRaw
+}
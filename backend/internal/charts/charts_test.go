@@ -0,0 +1,157 @@
+package charts
+
+import (
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestInspectDependencies(t *testing.T) {
+	common := &chart.Chart{Metadata: &chart.Metadata{Name: "common", Version: "2.4.0"}}
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{
+			APIVersion: "v2", Name: "app", Version: "1.2.3",
+			Dependencies: []*chart.Dependency{
+				{Name: "redis", Version: "~17.3.0", Repository: "https://charts.bitnami.com/bitnami"},
+				{Name: "postgresql", Version: "12.x.x", Repository: "oci://registry-1.docker.io/bitnamicharts"},
+				{Name: "common", Version: "2.x.x", Repository: "file://../common"},
+			},
+		},
+		Raw: []*chart.File{
+			{Name: "Chart.yaml", Data: []byte("apiVersion: v2\nname: app\n")},
+			{Name: "values.yaml", Data: []byte("# replicas to run\nreplicaCount: 1\n")},
+		},
+		Templates: []*chart.File{
+			{Name: "templates/service.yaml", Data: []byte("kind: Service")},
+			{Name: "templates/_helpers.tpl", Data: []byte("{{- define \"x\" }}{{ end }}")},
+		},
+		Files: []*chart.File{{Name: "README.md", Data: []byte("# app")}},
+	}
+	ch.SetDependencies(common)
+
+	info := Inspect(ch, map[string][]string{"redis": {"17.2.0", "17.3.1", "17.3.4", "18.0.0"}, "postgresql": {"11.9.0"}})
+	if info.Name != "app" || info.Version != "1.2.3" || info.Readme != "# app" || info.Values != "# replicas to run\nreplicaCount: 1\n" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	if len(info.Templates) != 2 || info.Templates[0].Name != "templates/_helpers.tpl" {
+		t.Errorf("templates = %+v", info.Templates)
+	}
+	deps := map[string]Dependency{}
+	for _, d := range info.Dependencies {
+		deps[d.Name] = d
+	}
+	if d := deps["redis"]; !d.InHaul || d.HaulVersion != "17.3.4" || d.Vendored {
+		t.Errorf("redis = %+v", d)
+	}
+	if d := deps["postgresql"]; d.InHaul || len(d.HaulVersions) != 1 {
+		t.Errorf("postgresql = %+v", d)
+	}
+	if d := deps["common"]; !d.Vendored || d.VendoredVersion != "2.4.0" || d.InHaul {
+		t.Errorf("common = %+v", d)
+	}
+	if info.MissingDependencies != 1 {
+		t.Errorf("missing = %d, want 1", info.MissingDependencies)
+	}
+}
+
+func TestFindImages(t *testing.T) {
+	// Rendering drops disabled dependencies, so each render gets a new chart.
+	newChart := func() *chart.Chart {
+		sub := &chart.Chart{
+			Metadata: &chart.Metadata{APIVersion: "v2", Name: "cache", Version: "1.0.0"},
+			Values:   map[string]interface{}{"image": "redis:7"},
+			Templates: []*chart.File{
+				{Name: "templates/cache.yaml", Data: []byte("kind: Pod\nspec:\n  containers:\n  - name: cache\n    image: {{ .Values.image }}\n")},
+			},
+		}
+		ch := &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion: "v2", Name: "app", Version: "1.2.3",
+				Dependencies: []*chart.Dependency{{Name: "cache", Version: "1.x", Condition: "cache.enabled"}},
+			},
+			Values: map[string]interface{}{
+				"image": map[string]interface{}{"repository": "rancher/app", "tag": "v1"},
+				"cache": map[string]interface{}{"enabled": false},
+			},
+			Templates: []*chart.File{
+				{Name: "templates/deployment.yaml", Data: []byte(`kind: Deployment
+metadata:
+  name: {{ .Release.Name }}
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: busybox
+      containers:
+      - name: app
+        image: "{{ .Values.image.repository }}:{{ .Values.image.tag }}"
+---
+kind: CronJob
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: job
+            image: {{ .Values.image.repository }}:{{ .Values.image.tag }}
+`)},
+				{Name: "templates/NOTES.txt", Data: []byte("containers:\n- image: nope\n")},
+			},
+		}
+		ch.SetDependencies(sub)
+		return ch
+	}
+
+	report, err := FindImages(newChart(), RenderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, img := range report.Images {
+		names = append(names, img.Name)
+	}
+	if strings.Join(names, " ") != "docker.io/library/busybox:latest docker.io/rancher/app:v1" {
+		t.Errorf("images = %v", names)
+	}
+	if len(report.Images[1].Templates) != 1 || report.Images[1].Templates[0] != "app/templates/deployment.yaml" {
+		t.Errorf("templates = %v", report.Images[1].Templates)
+	}
+
+	// Supplied values override the defaults and can enable a dependency.
+	report, err = FindImages(newChart(), RenderOptions{Values: "image:\n  tag: v2\ncache:\n  enabled: true\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, img := range report.Images {
+		names = append(names, img.Ref)
+	}
+	if strings.Join(names, " ") != "busybox redis:7 rancher/app:v2" {
+		t.Errorf("images with values = %v", names)
+	}
+
+	if _, err := FindImages(newChart(), RenderOptions{Values: "image: [unclosed"}); err == nil {
+		t.Error("expected invalid values to fail")
+	}
+}
+
+func TestNormalizeImage(t *testing.T) {
+	for ref, want := range map[string]string{
+		"nginx":                          "docker.io/library/nginx:latest",
+		"nginx:1.25":                     "docker.io/library/nginx:1.25",
+		"rancher/shell:v1":               "docker.io/rancher/shell:v1",
+		"index.docker.io/library/alpine": "docker.io/library/alpine:latest",
+		"ghcr.io/org/app:1.0":            "ghcr.io/org/app:1.0",
+		"localhost/app":                  "localhost/app:latest",
+		"registry.local:5000/app":        "registry.local:5000/app:latest",
+		"quay.io/app@sha256:abc":         "quay.io/app@sha256:abc",
+		"app:1.0@sha256:abc":             "docker.io/library/app:1.0@sha256:abc",
+	} {
+		if got := NormalizeImage(ref); got != want {
+			t.Errorf("NormalizeImage(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package charts
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	yamlutil "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// RenderOptions are the inputs to rendering a chart's templates.
+type RenderOptions struct {
+	// Values is a values file, in YAML, merged over the chart's defaults.
+	Values      string `json:"values,omitempty"`
+	ReleaseName string `json:"releaseName,omitempty"` // default "release-name", as helm template
+	Namespace   string `json:"namespace,omitempty"`   // default "default"
+}
+
+// Image is a container image a rendered chart refers to.
+type Image struct {
+	Ref string `json:"ref"` // as written in the templates
+	// Name is Ref normalized, e.g. "nginx" is docker.io/library/nginx:latest.
+	Name      string   `json:"name"`
+	Templates []string `json:"templates"` // the templates that use it
+	// InHaul is set when the haul holds the image, under HaulRef.
+	InHaul  bool   `json:"inHaul"`
+	HaulRef string `json:"haulRef,omitempty"`
+}
+
+// ImageReport is what rendering a chart found.
+type ImageReport struct {
+	Chart   string  `json:"chart"`
+	Version string  `json:"version"`
+	Images  []Image `json:"images"`
+	// Missing lists the images the haul lacks; Manifest is a hauler Images
+	// manifest adding them, empty when none are missing.
+	Missing  []string `json:"missing"`
+	Manifest string   `json:"manifest,omitempty"`
+	// Warnings note rendered files that could not be parsed.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// FindImages renders a chart's templates, and those of its enabled vendored
+// dependencies, the way helm template does, and collects the images of
+// every container, init container and ephemeral container they declare.
+// Images chosen at install time through lookup or the cluster are not seen.
+// Like helm install, it drops disabled dependencies from ch, so render a
+// chart once.
+func FindImages(ch *chart.Chart, opts RenderOptions) (*ImageReport, error) {
+	supplied := map[string]interface{}{}
+	if strings.TrimSpace(opts.Values) != "" {
+		v, err := chartutil.ReadValues([]byte(opts.Values))
+		if err != nil {
+			return nil, fmt.Errorf("parsing values: %w", err)
+		}
+		supplied = v
+	}
+	if err := chartutil.ProcessDependenciesWithMerge(ch, supplied); err != nil {
+		return nil, fmt.Errorf("processing dependencies: %w", err)
+	}
+	release := chartutil.ReleaseOptions{Name: opts.ReleaseName, Namespace: opts.Namespace, Revision: 1, IsInstall: true}
+	if release.Name == "" {
+		release.Name = "release-name"
+	}
+	if release.Namespace == "" {
+		release.Namespace = "default"
+	}
+	vals, err := chartutil.ToRenderValues(ch, supplied, release, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := engine.Render(ch, vals)
+	if err != nil {
+		return nil, fmt.Errorf("rendering: %w", err)
+	}
+
+	report := &ImageReport{Chart: ch.Name(), Images: []Image{}, Missing: []string{}}
+	if ch.Metadata != nil {
+		report.Version = ch.Metadata.Version
+	}
+	byRef := map[string]*Image{}
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ext := path.Ext(name); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue // NOTES.txt and the like
+		}
+		refs, err := manifestImages(rendered[name])
+		if err != nil {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: %v", name, err))
+		}
+		for _, ref := range refs {
+			img, ok := byRef[ref]
+			if !ok {
+				img = &Image{Ref: ref, Name: NormalizeImage(ref)}
+				byRef[ref] = img
+			}
+			if len(img.Templates) == 0 || img.Templates[len(img.Templates)-1] != name {
+				img.Templates = append(img.Templates, name)
+			}
+		}
+	}
+	for _, img := range byRef {
+		report.Images = append(report.Images, *img)
+	}
+	sort.Slice(report.Images, func(i, j int) bool { return report.Images[i].Name < report.Images[j].Name })
+	return report, nil
+}
+
+// manifestImages returns the container images of the Kubernetes objects in
+// a rendered template, which may hold several YAML documents.
+func manifestImages(rendered string) ([]string, error) {
+	var refs []string
+	r := yamlutil.NewYAMLReader(bufio.NewReader(strings.NewReader(rendered)))
+	for {
+		doc, err := r.Read()
+		if err == io.EOF {
+			return refs, nil
+		}
+		if err != nil {
+			return refs, err
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		var obj interface{}
+		if err := yaml.Unmarshal(doc, &obj); err != nil {
+			return refs, err
+		}
+		refs = appendContainerImages(refs, obj, "")
+	}
+}
+
+// appendContainerImages walks a decoded object for the image of each
+// container, wherever the pod spec sits (a Pod, a workload's template, a
+// CronJob's jobTemplate, or a custom resource shaped alike).
+func appendContainerImages(refs []string, obj interface{}, key string) []string {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			refs = appendContainerImages(refs, child, k)
+		}
+	case []interface{}:
+		containers := key == "containers" || key == "initContainers" || key == "ephemeralContainers"
+		for _, child := range v {
+			if c, ok := child.(map[string]interface{}); ok && containers {
+				if image, ok := c["image"].(string); ok && strings.TrimSpace(image) != "" {
+					refs = append(refs, strings.TrimSpace(image))
+				}
+			}
+			refs = appendContainerImages(refs, child, key)
+		}
+	}
+	return refs
+}
+
+// NormalizeImage expands an image reference the way container runtimes do:
+// "nginx" is docker.io/library/nginx:latest and "rancher/shell:v1" is
+// docker.io/rancher/shell:v1. A reference with a digest keeps it and gains
+// no tag.
+func NormalizeImage(ref string) string {
+	name, digest, _ := strings.Cut(ref, "@")
+	tag := ""
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, tag = name[:i], name[i+1:]
+	}
+	first, rest, ok := strings.Cut(name, "/")
+	if !ok || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		first, rest = "docker.io", name
+	}
+	if first == "index.docker.io" {
+		first = "docker.io"
+	}
+	if first == "docker.io" && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	out := first + "/" + rest
+	if tag != "" {
+		out += ":" + tag
+	} else if digest == "" {
+		out += ":latest"
+	}
+	if digest != "" {
+		out += "@" + digest
+	}
+	return out
+}
+
+// Compare marks the images the store holds and lists the rest, with a
+// manifest that adds them. An image matches an image artifact of the same
+// normalized name, or, when pinned by digest, any image with that digest.
+func (r *ImageReport) Compare(st *ocistore.Store) {
+	names := map[string]string{}
+	digests := map[string]string{}
+	for _, a := range st.Artifacts {
+		if a.Kind != ocistore.KindImage || a.Error != "" {
+			continue
+		}
+		if _, ok := names[NormalizeImage(a.Name)]; !ok {
+			names[NormalizeImage(a.Name)] = a.Name
+		}
+		if _, ok := digests[a.Digest]; !ok {
+			digests[a.Digest] = a.Name
+		}
+	}
+	r.Missing = []string{}
+	for i := range r.Images {
+		img := &r.Images[i]
+		img.InHaul, img.HaulRef = false, ""
+		name, digest, _ := strings.Cut(img.Name, "@")
+		switch {
+		case digest != "" && digests[digest] != "":
+			img.HaulRef = digests[digest]
+		case digest == "" && names[name] != "":
+			img.HaulRef = names[name]
+		}
+		img.InHaul = img.HaulRef != ""
+		if !img.InHaul {
+			r.Missing = append(r.Missing, img.Ref)
+		}
+	}
+	r.Manifest = ""
+	if len(r.Missing) > 0 {
+		r.Manifest = ImagesManifest(r.Chart+"-images", r.Missing)
+	}
+}
+
+// ImagesManifest writes a hauler Images manifest listing refs, ready to be
+// saved as a manifest and synced into a haul.
+func ImagesManifest(name string, refs []string) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: content.hauler.cattle.io/v1\n")
+	b.WriteString("kind: Images\n")
+	b.WriteString("metadata:\n")
+	fmt.Fprintf(&b, "  name: %s\n", name)
+	b.WriteString("spec:\n")
+	b.WriteString("  images:\n")
+	for _, ref := range refs {
+		fmt.Fprintf(&b, "    - name: %s\n", ref)
+	}
+	return b.String()
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds the application configuration
@@ -27,6 +30,56 @@ type Config struct {
 
 	// UIPassword is the optional password for UI access (default: empty, no auth)
 	UIPassword string
+
+	// DataReserveBytes is free space on the DataDir volume that store jobs may
+	// never consume, so one runaway haul cannot fill the disk (default: 1G)
+	DataReserveBytes int64
+
+	// TrashRetention is how long a deleted haul stays restorable in the trash
+	// before the purger removes it for good; 0 keeps it until purged by hand
+	// (default: 7d)
+	TrashRetention time.Duration
+
+	// SigningKeyPath is the ed25519 private key (PEM) that signs saved
+	// archives' content manifests; generated on first use
+	// (default: /data/keys/archive-signing.pem)
+	SigningKeyPath string
+
+	// TrustedKeysDir holds extra PEM public keys (*.pub, *.pem) trusted when
+	// verifying imported archives, besides the server's own key
+	// (default: /data/keys/trusted)
+	TrustedKeysDir string
+
+	// CosignKeysDir holds PEM public keys (*.pub, *.pem; ECDSA, RSA or
+	// ed25519, e.g. cosign.pub) that image signatures and attestations in
+	// the store are verified against (default: /data/keys/cosign)
+	CosignKeysDir string
+
+	// KeystorePassword encrypts the private keys of the cosign signing keys
+	// held by the server. When empty, a random secret is generated in
+	// keys/keystore.secret beside the archive signing key; set it so a copy
+	// of the database and data volume alone cannot reveal the keys. Keys
+	// stored under the generated secret are re-encrypted with it on startup
+	// (default: none)
+	KeystorePassword string
+
+	// RequireSignedImports rejects archive imports that do not come with a
+	// content manifest signed by a trusted key (default: false)
+	RequireSignedImports bool
+
+	// UploadExpiry is how long a resumable upload may sit idle before its
+	// partial data is removed (default: 24h)
+	UploadExpiry time.Duration
+
+	// ImportTimeout bounds how long a single-request archive import may take
+	// to arrive; larger or slower transfers use the resumable uploads API
+	// (default: 1h)
+	ImportTimeout time.Duration
+
+	// ImportRoots are the server-side directories (e.g. mounted media) whose
+	// archives may be browsed and imported; empty disables path imports
+	// (default: none)
+	ImportRoots []string
 }
 
 // Load returns the application configuration from environment variables
@@ -44,6 +97,18 @@ func Load() *Config {
 		DatabasePath:   getEnv("DATABASE_PATH", filepath.Join(haulerDir, "app.db")),
 		DataDir:        haulerDir,
 		UIPassword:     getEnv("HAULER_UI_PASSWORD", ""),
+
+		DataReserveBytes: ParseBytes(getEnv("HAULER_UI_DATA_RESERVE", "1G")),
+		TrashRetention:   parseDuration(getEnv("HAULER_UI_TRASH_RETENTION", "7d")),
+
+		SigningKeyPath:       getEnv("HAULER_UI_SIGNING_KEY", filepath.Join(haulerDir, "keys", "archive-signing.pem")),
+		TrustedKeysDir:       getEnv("HAULER_UI_TRUSTED_KEYS", filepath.Join(haulerDir, "keys", "trusted")),
+		CosignKeysDir:        getEnv("HAULER_UI_COSIGN_KEYS", filepath.Join(haulerDir, "keys", "cosign")),
+		KeystorePassword:     getEnv("HAULER_UI_KEYSTORE_PASSWORD", ""),
+		RequireSignedImports: getEnv("HAULER_UI_REQUIRE_SIGNED_IMPORTS", "false") == "true",
+		UploadExpiry:         parseDuration(getEnv("HAULER_UI_UPLOAD_EXPIRY", "24h")),
+		ImportTimeout:        parseDuration(getEnv("HAULER_UI_IMPORT_TIMEOUT", "1h")),
+		ImportRoots:          parsePaths(getEnv("HAULER_UI_IMPORT_ROOTS", "")),
 	}
 }
 
@@ -55,20 +120,98 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// ParseBytes parses a size such as "512M", "20G" or "1073741824" into bytes.
+// Suffixes are binary (K=1024). Invalid values yield 0.
+func ParseBytes(v string) int64 {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+	mult := int64(1)
+	if n := len(v); n > 0 {
+		switch v[n-1] {
+		case 'K':
+			mult = 1 << 10
+		case 'M':
+			mult = 1 << 20
+		case 'G':
+			mult = 1 << 30
+		case 'T':
+			mult = 1 << 40
+		}
+		if mult > 1 {
+			v = v[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return int64(n * float64(mult))
+}
+
+// parseDuration parses a Go duration such as "36h" or a whole number of days
+// such as "7d". Invalid or negative values yield 0.
+func parseDuration(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0
+		}
+		return time.Duration(n) * 24 * time.Hour
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
+
+// parsePaths splits a comma-separated list of absolute directories, dropping
+// blanks and relative paths.
+func parsePaths(v string) []string {
+	var paths []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); filepath.IsAbs(p) {
+			paths = append(paths, filepath.Clean(p))
+		}
+	}
+	return paths
+}
+
 // ToMap returns a map representation of the config for JSON serialization
 func (c *Config) ToMap() map[string]string {
 	return map[string]string{
-		"haulerDir":       c.HaulerDir,
-		"haulerStoreDir":  c.HaulerStoreDir,
-		"haulerTempDir":   c.HaulerTempDir,
-		"dockerAuthPath":  c.DockerAuthPath,
-		"databasePath":    c.DatabasePath,
-		"haulerDirEnv":    "HAULER_DIR",
-		"haulerStoreEnv":  "HAULER_STORE_DIR",
-		"haulerTempEnv":   "HAULER_TEMP_DIR",
-		"dockerConfigEnv": "DOCKER_CONFIG",
-		"databasePathEnv": "DATABASE_PATH",
-		"authEnabled":     boolToString(c.UIPassword != ""),
+		"haulerDir":               c.HaulerDir,
+		"haulerStoreDir":          c.HaulerStoreDir,
+		"haulerTempDir":           c.HaulerTempDir,
+		"dockerAuthPath":          c.DockerAuthPath,
+		"databasePath":            c.DatabasePath,
+		"haulerDirEnv":            "HAULER_DIR",
+		"haulerStoreEnv":          "HAULER_STORE_DIR",
+		"haulerTempEnv":           "HAULER_TEMP_DIR",
+		"dockerConfigEnv":         "DOCKER_CONFIG",
+		"databasePathEnv":         "DATABASE_PATH",
+		"authEnabled":             boolToString(c.UIPassword != ""),
+		"dataReserve":             strconv.FormatInt(c.DataReserveBytes, 10),
+		"dataReserveEnv":          "HAULER_UI_DATA_RESERVE",
+		"trashRetention":          c.TrashRetention.String(),
+		"trashRetentionEnv":       "HAULER_UI_TRASH_RETENTION",
+		"signingKeyPath":          c.SigningKeyPath,
+		"signingKeyEnv":           "HAULER_UI_SIGNING_KEY",
+		"trustedKeysDir":          c.TrustedKeysDir,
+		"trustedKeysEnv":          "HAULER_UI_TRUSTED_KEYS",
+		"cosignKeysDir":           c.CosignKeysDir,
+		"cosignKeysEnv":           "HAULER_UI_COSIGN_KEYS",
+		"keystorePasswordSet":     boolToString(c.KeystorePassword != ""),
+		"keystorePasswordEnv":     "HAULER_UI_KEYSTORE_PASSWORD",
+		"requireSignedImports":    boolToString(c.RequireSignedImports),
+		"requireSignedImportsEnv": "HAULER_UI_REQUIRE_SIGNED_IMPORTS",
+		"uploadExpiry":            c.UploadExpiry.String(),
+		"uploadExpiryEnv":         "HAULER_UI_UPLOAD_EXPIRY",
+		"importTimeout":           c.ImportTimeout.String(),
+		"importTimeoutEnv":        "HAULER_UI_IMPORT_TIMEOUT",
+		"importRoots":             strings.Join(c.ImportRoots, ","),
+		"importRootsEnv":          "HAULER_UI_IMPORT_ROOTS",
 	}
 }
 
@@ -0,0 +1,242 @@
+package hauls
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// AdoptMode controls how an existing store directory becomes a haul's store.
+type AdoptMode string
+
+const (
+	// AdoptLink leaves the store where it is and points the haul at it through
+	// a symlink. Deleting the haul removes the link, never the source.
+	AdoptLink AdoptMode = "link"
+	// AdoptMove renames the store into the haul directory (same filesystem only).
+	AdoptMove AdoptMode = "move"
+	// AdoptHardlink mirrors the store into the haul directory with hardlinks, so
+	// no blob data is duplicated and the source remains usable by the CLI.
+	AdoptHardlink AdoptMode = "hardlink"
+)
+
+// AdoptOptions describes an existing hauler store to register as a haul.
+type AdoptOptions struct {
+	Name        string
+	Description string
+	SourceDir   string
+	Mode        AdoptMode
+	// ImportArchives pulls loose .tar.zst files sitting next to the source
+	// store into the haul's archives directory (hardlinked when possible).
+	ImportArchives bool
+	// Writable lets jobs (add, sync, load, gc, prune, retag, sign) change a
+	// linked store, which lives outside the data directory, in place. A
+	// linked haul is otherwise frozen on adoption, by Actor.
+	Writable bool
+	Actor    string
+}
+
+// ValidateLayout checks that dir is a usable OCI image layout: an oci-layout
+// marker, a parseable index.json, and a blob for every manifest it lists.
+func ValidateLayout(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("store directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	layoutData, err := os.ReadFile(filepath.Join(dir, "oci-layout"))
+	if err != nil {
+		return fmt.Errorf("missing oci-layout: %w", err)
+	}
+	var layout struct {
+		ImageLayoutVersion string `json:"imageLayoutVersion"`
+	}
+	if err := json.Unmarshal(layoutData, &layout); err != nil || layout.ImageLayoutVersion == "" {
+		return fmt.Errorf("invalid oci-layout file")
+	}
+
+	if info, err := os.Stat(filepath.Join(dir, "blobs")); err != nil || !info.IsDir() {
+		return fmt.Errorf("missing blobs directory")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		return fmt.Errorf("missing index.json: %w", err)
+	}
+	st, err := ocistore.Open(dir)
+	if err != nil {
+		return err
+	}
+	for _, m := range st.Index.Manifests {
+		if !ocistore.ValidDigest(m.Digest) {
+			return fmt.Errorf("index.json lists unsupported digest %q", m.Digest)
+		}
+		blob, err := os.Stat(st.BlobPath(m.Digest))
+		if err != nil {
+			return fmt.Errorf("manifest %s listed in index.json has no blob", m.Digest)
+		}
+		if m.Size > 0 && blob.Size() != m.Size {
+			return fmt.Errorf("manifest %s is %d bytes, index.json declares %d", m.Digest, blob.Size(), m.Size)
+		}
+	}
+	return nil
+}
+
+// Adopt registers an existing hauler store as a new haul. The store is linked,
+// moved, or hardlinked into <DataDir>/hauls/<slug>/store so every haul keeps
+// the same on-disk shape. It returns the names of any archives imported.
+func (s *Service) Adopt(ctx context.Context, opts AdoptOptions) (*Haul, []string, error) {
+	name := strings.TrimSpace(opts.Name)
+	if name == "" {
+		return nil, nil, fmt.Errorf("name is required")
+	}
+	if err := s.checkNameFree(ctx, name); err != nil {
+		return nil, nil, err
+	}
+	source, err := ResolveImportPath(s.cfg.ImportRoots, opts.SourceDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if within(source, s.baseDir()) {
+		return nil, nil, fmt.Errorf("%s already belongs to a haul", source)
+	}
+	mode := opts.Mode
+	if mode == "" {
+		mode = AdoptLink
+	}
+	if mode != AdoptLink && mode != AdoptMove && mode != AdoptHardlink {
+		return nil, nil, fmt.Errorf("unknown adopt mode %q", mode)
+	}
+	if err := ValidateLayout(source); err != nil {
+		return nil, nil, err
+	}
+
+	slug, err := s.uniqueSlug(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	haulDir := filepath.Join(s.baseDir(), slug)
+	storeDir := filepath.Join(haulDir, "store")
+	archivesDir := filepath.Join(haulDir, "archives")
+	if err := os.MkdirAll(archivesDir, 0755); err != nil {
+		return nil, nil, fmt.Errorf("creating archives directory: %w", err)
+	}
+
+	// Clean up the half-built haul directory on any failure below. A moved
+	// store is put back first so the source is never lost.
+	ok := false
+	defer func() {
+		if ok {
+			return
+		}
+		if mode == AdoptMove {
+			_ = os.Rename(storeDir, source)
+		}
+		_ = os.RemoveAll(haulDir)
+	}()
+
+	switch mode {
+	case AdoptLink:
+		err = os.Symlink(source, storeDir)
+	case AdoptMove:
+		err = os.Rename(source, storeDir)
+		if errors.Is(err, syscall.EXDEV) {
+			err = fmt.Errorf("%s is on a different filesystem; use link mode instead", source)
+		}
+	case AdoptHardlink:
+		err = hardlinkTree(source, storeDir)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("adopting store: %w", err)
+	}
+
+	var imported []string
+	if opts.ImportArchives {
+		imported, err = importArchives(filepath.Dir(source), archivesDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("importing archives: %w", err)
+		}
+	}
+
+	haul, err := s.insert(ctx, name, slug, opts.Description, storeDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode == AdoptLink && !opts.Writable {
+		reason := fmt.Sprintf("linked to %s; unfreeze to let jobs change it in place", source)
+		frozen, err := s.Freeze(ctx, haul.ID, opts.Actor, "adopt", reason)
+		if err != nil {
+			_, _ = s.db.ExecContext(ctx, `DELETE FROM hauls WHERE id = ?`, haul.ID)
+			return nil, nil, fmt.Errorf("freezing linked haul: %w", err)
+		}
+		haul = frozen
+	}
+	ok = true
+	return haul, imported, nil
+}
+
+// within reports whether path is dir or lives underneath it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// hardlinkTree recreates src's directory structure under dst, hardlinking
+// every regular file. Both trees must live on the same filesystem.
+func hardlinkTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err := os.Link(path, target); err != nil {
+			if errors.Is(err, syscall.EXDEV) {
+				return fmt.Errorf("%s is on a different filesystem; use link mode instead", src)
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// importArchives hardlinks (or copies, across filesystems) every .tar.zst in
+// dir into archivesDir and returns the imported file names.
+func importArchives(dir, archivesDir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var imported []string
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !strings.HasSuffix(strings.ToLower(e.Name()), ".tar.zst") {
+			continue
+		}
+		if err := ocistore.LinkOrCopy(filepath.Join(dir, e.Name()), filepath.Join(archivesDir, e.Name())); err != nil {
+			return imported, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		imported = append(imported, e.Name())
+	}
+	return imported, nil
+}
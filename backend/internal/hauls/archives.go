@@ -0,0 +1,136 @@
+package hauls
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChecksumFile is the sidecar in a haul's archives directory listing the
+// SHA-256 of every archive, in sha256sum(1) format.
+const ChecksumFile = "SHA256SUMS"
+
+// ManifestName is the sidecar holding an archive's signed content manifest,
+// and SignatureName the sidecar holding its base64 signature.
+func ManifestName(archive string) string  { return archive + ".manifest.json" }
+func SignatureName(archive string) string { return ManifestName(archive) + ".sig" }
+
+// sumsMu serializes rewrites of checksum files.
+var sumsMu sync.Mutex
+
+// WriteChecksum records (or replaces) an archive's SHA-256 in dir's
+// SHA256SUMS; an empty sum removes the archive's line.
+func WriteChecksum(dir, archive, sum string) error {
+	sumsMu.Lock()
+	defer sumsMu.Unlock()
+
+	path := filepath.Join(dir, ChecksumFile)
+	sums, err := readChecksums(path)
+	if err != nil {
+		return err
+	}
+	if sum == "" {
+		delete(sums, archive)
+	} else {
+		sums[archive] = sum
+	}
+
+	names := make([]string, 0, len(sums))
+	for n := range sums {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		fmt.Fprintf(&b, "%s  %s\n", sums[n], n)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LookupChecksum returns the sha256 that dir's SHA256SUMS lists for name.
+func LookupChecksum(dir, name string) (string, bool) {
+	sums, err := readChecksums(filepath.Join(dir, ChecksumFile))
+	if err != nil {
+		return "", false
+	}
+	sum, ok := sums[name]
+	return sum, ok
+}
+
+// FileSHA256 returns the hex SHA-256 and size of a file.
+func FileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// readChecksums parses a sha256sum(1) file; a missing file lists nothing.
+// Names in binary mode ("<sum> *<name>") are accepted too.
+func readChecksums(path string) (map[string]string, error) {
+	sums := map[string]string{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		sum, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+		if ok && len(name) > 1 && (name[0] == ' ' || name[0] == '*') {
+			sums[name[1:]] = strings.ToLower(sum)
+		}
+	}
+	return sums, nil
+}
+
+// sidecarName reports whether name is a checksum, manifest or volume file of
+// an archive, which may be downloaded but not deleted on its own.
+func sidecarName(name string) bool {
+	if name == ChecksumFile {
+		return true
+	}
+	for _, suffix := range []string{".manifest.json", ".manifest.json.sig", ".volumes.json"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			return safeArchiveName(base)
+		}
+	}
+	if i := strings.LastIndex(name, "."); i > 0 && len(name)-i == 4 && strings.Trim(name[i+1:], "0123456789") == "" {
+		return safeArchiveName(name[:i])
+	}
+	return false
+}
+
+// removeArchive deletes an archive, or its volume set, together with its
+// sidecars.
+func removeArchive(dir, archive string) error {
+	if idx, err := ReadVolumeIndex(dir, archive); err == nil {
+		if err := removeVolumes(dir, idx); err != nil {
+			return err
+		}
+	} else if err := os.Remove(filepath.Join(dir, archive)); err != nil {
+		return err
+	}
+	for _, sidecar := range []string{ManifestName(archive), SignatureName(archive)} {
+		_ = os.Remove(filepath.Join(dir, sidecar))
+	}
+	return WriteChecksum(dir, archive, "")
+}
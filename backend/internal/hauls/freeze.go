@@ -0,0 +1,155 @@
+package hauls
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrFrozen is returned when a mutating operation targets a frozen haul.
+var ErrFrozen = errors.New("haul is frozen")
+
+// FreezeEvent is one entry in a haul's freeze/unfreeze audit trail.
+type FreezeEvent struct {
+	ID          int64     `json:"id"`
+	Action      string    `json:"action"`         // "freeze" or "unfreeze"
+	Actor       string    `json:"actor"`          // the client's address
+	Note        string    `json:"note,omitempty"` // who the client said it was
+	Reason      string    `json:"reason"`
+	IndexDigest string    `json:"indexDigest,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// Writable returns an error wrapping ErrFrozen if the haul is frozen.
+func (h *Haul) Writable() error {
+	if !h.Frozen {
+		return nil
+	}
+	why := ""
+	if h.FrozenReason != "" {
+		why = " (" + h.FrozenReason + ")"
+	}
+	return fmt.Errorf("%w: %q is read-only%s; unfreeze it before changing its contents", ErrFrozen, h.Name, why)
+}
+
+// IndexDigest returns the sha256 digest of a haul store's index.json, or "" for
+// a store that has no index yet.
+func IndexDigest(haul *Haul) (string, error) {
+	data, err := os.ReadFile(filepath.Join(haul.StoreDir, "index.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Freeze marks a haul read-only, recording who froze it, why, and the digest
+// of its index.json so later drift can be detected. A haul whose write lock
+// is held or that has queued or running jobs cannot be frozen, since they
+// would change the index after its digest is taken.
+func (s *Service) Freeze(ctx context.Context, id int64, actor, note, reason string) (*Haul, error) {
+	haul, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if haul.Frozen {
+		return nil, fmt.Errorf("%w: %q is already frozen", ErrFrozen, haul.Name)
+	}
+	if err := s.Locked(id); err != nil {
+		return nil, err
+	}
+	active, err := s.activeJobs(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if active > 0 {
+		return nil, fmt.Errorf("%w: %q has %d queued or running job(s)", ErrBusy, haul.Name, active)
+	}
+	digest, err := IndexDigest(haul)
+	if err != nil {
+		return nil, fmt.Errorf("hashing index.json: %w", err)
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE hauls SET frozen = 1, frozen_at = CURRENT_TIMESTAMP, frozen_by = ?,
+		       frozen_reason = ?, frozen_index_digest = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, actor, reason, digest, id); err != nil {
+		return nil, err
+	}
+	if err := s.recordFreezeEvent(ctx, id, "freeze", actor, note, reason, digest); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Unfreeze makes a frozen haul writable again and records who did it and why.
+func (s *Service) Unfreeze(ctx context.Context, id int64, actor, note, reason string) (*Haul, error) {
+	haul, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !haul.Frozen {
+		return nil, fmt.Errorf("haul %q is not frozen", haul.Name)
+	}
+	digest, _ := IndexDigest(haul)
+
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE hauls SET frozen = 0, frozen_at = NULL, frozen_by = NULL,
+		       frozen_reason = NULL, frozen_index_digest = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, id); err != nil {
+		return nil, err
+	}
+	if err := s.recordFreezeEvent(ctx, id, "unfreeze", actor, note, reason, digest); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func (s *Service) recordFreezeEvent(ctx context.Context, id int64, action, actor, note, reason, digest string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO haul_freeze_events (haul_id, action, actor, note, reason, index_digest)
+		VALUES (?, ?, ?, ?, ?, ?)`, id, action, actor, note, reason, digest)
+	return err
+}
+
+// FreezeHistory returns a haul's freeze/unfreeze events, newest first.
+func (s *Service) FreezeHistory(ctx context.Context, id int64) ([]FreezeEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, action, COALESCE(actor, ''), COALESCE(note, ''), COALESCE(reason, ''), COALESCE(index_digest, ''), created_at
+		FROM haul_freeze_events WHERE haul_id = ? ORDER BY created_at DESC, id DESC`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []FreezeEvent{}
+	for rows.Next() {
+		var e FreezeEvent
+		if err := rows.Scan(&e.ID, &e.Action, &e.Actor, &e.Note, &e.Reason, &e.IndexDigest, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// Drifted reports whether a frozen haul's index.json no longer matches the
+// digest recorded when it was frozen. Unfrozen hauls never drift.
+func Drifted(haul *Haul) (bool, error) {
+	if !haul.Frozen {
+		return false, nil
+	}
+	digest, err := IndexDigest(haul)
+	if err != nil {
+		return false, err
+	}
+	return digest != haul.FrozenIndexDigest, nil
+}
@@ -0,0 +1,72 @@
+package hauls
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFreezeRefusesBusyHaul(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+	haul, err := svc.Create(ctx, "Release", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := svc.Lock(haul.ID, "gc job 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Freeze(ctx, haul.ID, "127.0.0.1:1", "", ""); !errors.Is(err, ErrLocked) {
+		t.Errorf("expected a locked haul not to freeze, got %v", err)
+	}
+	unlock()
+
+	if _, err := svc.db.ExecContext(ctx, `INSERT INTO jobs (command, status, haul_id) VALUES ('hauler', 'running', ?)`, haul.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Freeze(ctx, haul.ID, "127.0.0.1:1", "", ""); !errors.Is(err, ErrBusy) {
+		t.Errorf("expected a haul with a running job not to freeze, got %v", err)
+	}
+	if _, err := svc.db.ExecContext(ctx, `UPDATE jobs SET status = 'succeeded'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Freeze(ctx, haul.ID, "127.0.0.1:1", "", ""); err != nil {
+		t.Errorf("expected an idle haul to freeze, got %v", err)
+	}
+}
+
+func TestFreezeRecordsClientAddress(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+	haul, err := svc.Create(ctx, "Release", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	NewHandler(svc).RegisterRoutes(mux)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/hauls/"+strconv.FormatInt(haul.ID, 10)+"/freeze", strings.NewReader(`{"by":"admin","reason":"release"}`))
+	r.RemoteAddr = "10.0.0.7:5555"
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("freeze: %d %s", w.Code, w.Body.String())
+	}
+	history, err := svc.FreezeHistory(ctx, haul.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Actor != "10.0.0.7:5555" || history[0].Note != "admin" || history[0].Reason != "release" {
+		t.Errorf("unexpected freeze event %+v", history)
+	}
+	if frozen, _ := svc.Get(ctx, haul.ID); frozen.FrozenBy != "10.0.0.7:5555" {
+		t.Errorf("expected the haul frozen by the client address, got %q", frozen.FrozenBy)
+	}
+}
@@ -1,7 +1,10 @@
 package hauls
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,11 +14,20 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
 )
 
 // Handler exposes the haul resource over HTTP.
 type Handler struct {
 	svc *Service
+
+	// SyncManifests, when set, starts a sync of a haul's saved manifests and
+	// returns the job id. It runs a template's initial sync.
+	SyncManifests func(ctx context.Context, haul *Haul) (int64, error)
+	// Publish, when set, publishes a haul under hostname ("" for the default).
+	// It runs a template's auto-publish.
+	Publish func(ctx context.Context, haul *Haul, hostname string) error
 }
 
 // NewHandler creates a new haul HTTP handler.
@@ -31,6 +43,8 @@ type Summary struct {
 	FileCount    int   `json:"fileCount"`
 	ArchiveCount int   `json:"archiveCount"`
 	ArchiveBytes int64 `json:"archiveBytes"`
+	UsageBytes   int64 `json:"usageBytes"`             // store + archives, compared against QuotaBytes
+	IndexDrifted bool  `json:"indexDrifted,omitempty"` // frozen haul's index.json changed since freezing
 }
 
 // Archive describes a built .tar.zst file belonging to a haul.
@@ -38,6 +52,8 @@ type Archive struct {
 	Name     string    `json:"name"`
 	Size     int64     `json:"size"`
 	Modified time.Time `json:"modified"`
+	Signed   bool      `json:"signed"`            // has a signed content manifest sidecar
+	Volumes  int       `json:"volumes,omitempty"` // split into this many volumes
 }
 
 // RegisterRoutes wires the haul endpoints into the mux.
@@ -53,6 +69,8 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 		}
 	})
 	mux.HandleFunc("/api/hauls/", h.routeByID)
+	mux.HandleFunc("/api/haul-templates", h.handleTemplates)
+	mux.HandleFunc("/api/haul-templates/", h.handleTemplates)
 }
 
 // routeByID dispatches /api/hauls/{id} and /api/hauls/{id}/archives[/{file}].
@@ -64,14 +82,29 @@ func (h *Handler) routeByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/hauls/trash[/{id}[/restore]]
+	if parts[0] == "trash" {
+		h.handleTrash(w, r, parts)
+		return
+	}
+
 	id, err := strconv.ParseInt(parts[0], 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid haul id", http.StatusBadRequest)
 		return
 	}
 
-	// /api/hauls/{id}/archives and /api/hauls/{id}/archives/{file}
+	// /api/hauls/{id}/archives, /api/hauls/{id}/archives/{file} and
+	// /api/hauls/{id}/archives/{file}/contents
 	if len(parts) >= 2 && parts[1] == "archives" {
+		if len(parts) == 4 && parts[3] == "contents" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h.ArchiveContents(w, r, id, parts[2])
+			return
+		}
 		if len(parts) >= 3 && parts[2] != "" {
 			h.handleArchiveFile(w, r, id, parts[2])
 			return
@@ -84,6 +117,32 @@ func (h *Handler) routeByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// /api/hauls/{id}/artifacts/{digest}
+	if len(parts) == 3 && parts[1] == "artifacts" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.GetArtifact(w, r, id, parts[2])
+		return
+	}
+
+	// /api/hauls/{id}/sizes
+	if len(parts) == 2 && parts[1] == "sizes" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.Sizes(w, r, id)
+		return
+	}
+
+	// /api/hauls/{id}/freeze and /api/hauls/{id}/unfreeze
+	if len(parts) == 2 && (parts[1] == "freeze" || parts[1] == "unfreeze") {
+		h.handleFreeze(w, r, id, parts[1])
+		return
+	}
+
 	// /api/hauls/{id}
 	switch r.Method {
 	case http.MethodGet:
@@ -130,9 +189,28 @@ func (h *Handler) Get(w http.ResponseWriter, r *http.Request, id int64) {
 type haulRequest struct {
 	Name        *string `json:"name"`
 	Description *string `json:"description"`
+	QuotaBytes  *int64  `json:"quotaBytes"`
+	Settings
+
+	// Create only: instantiate from a template, optionally overriding whether
+	// the template's manifests are synced right away.
+	TemplateID *int64 `json:"templateId"`
+	AutoSync   *bool  `json:"autoSync"`
 }
 
-// Create makes a new haul.
+func (req *haulRequest) hasSettings() bool {
+	return req.Defaults != nil || req.Labels != nil || req.PublishHostname != nil
+}
+
+// createResponse is a new haul's summary plus what a template kicked off.
+type createResponse struct {
+	Summary
+	SyncJobID *int64   `json:"syncJobId,omitempty"`
+	Published bool     `json:"published,omitempty"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+// Create makes a new haul, optionally from a template.
 func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 	var req haulRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -143,19 +221,80 @@ func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
+	if req.QuotaBytes != nil && *req.QuotaBytes < 0 {
+		http.Error(w, "quotaBytes must not be negative", http.StatusBadRequest)
+		return
+	}
 	desc := ""
 	if req.Description != nil {
 		desc = *req.Description
 	}
-	haul, err := h.svc.Create(r.Context(), *req.Name, desc)
+
+	ctx := r.Context()
+	var (
+		haul *Haul
+		tmpl *Template
+		err  error
+	)
+	if req.TemplateID != nil {
+		haul, tmpl, err = h.svc.Instantiate(ctx, *req.TemplateID, *req.Name, desc)
+	} else {
+		haul, err = h.svc.Create(ctx, *req.Name, desc)
+	}
 	if err != nil {
-		http.Error(w, "Failed to create haul: "+err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrTemplateNotFound) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, "Failed to create haul: "+err.Error(), status)
 		return
 	}
-	writeJSON(w, http.StatusCreated, h.summarize(r, haul))
+
+	// Explicit settings and quota override the template's. A haul left
+	// half-configured is removed so a retry does not hit its name.
+	created := haul
+	if req.hasSettings() {
+		if haul, err = h.svc.SetSettings(ctx, haul.ID, req.Settings); err != nil {
+			h.svc.discard(ctx, created)
+			http.Error(w, "Failed to apply haul settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.QuotaBytes != nil {
+		if haul, err = h.svc.SetQuota(ctx, haul.ID, *req.QuotaBytes); err != nil {
+			h.svc.discard(ctx, created)
+			http.Error(w, "Failed to set quota: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	resp := createResponse{Summary: h.summarize(r, haul)}
+	autoSync := tmpl != nil && tmpl.AutoSync
+	if req.AutoSync != nil {
+		autoSync = *req.AutoSync
+	}
+	if autoSync {
+		if h.SyncManifests == nil {
+			resp.Warnings = append(resp.Warnings, "initial sync is not available")
+		} else if jobID, err := h.SyncManifests(ctx, haul); err != nil {
+			resp.Warnings = append(resp.Warnings, "initial sync not started: "+err.Error())
+		} else {
+			resp.SyncJobID = &jobID
+		}
+	}
+	if tmpl != nil && tmpl.Publish.AutoPublish {
+		if h.Publish == nil {
+			resp.Warnings = append(resp.Warnings, "publishing is not available")
+		} else if err := h.Publish(ctx, haul, haul.PublishHostname); err != nil {
+			resp.Warnings = append(resp.Warnings, "auto-publish failed: "+err.Error())
+		} else {
+			resp.Published = true
+		}
+	}
+	writeJSON(w, http.StatusCreated, resp)
 }
 
-// Update renames or re-describes a haul.
+// Update renames or re-describes a haul and changes its quota and settings.
 func (h *Handler) Update(w http.ResponseWriter, r *http.Request, id int64) {
 	var req haulRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -167,16 +306,266 @@ func (h *Handler) Update(w http.ResponseWriter, r *http.Request, id int64) {
 		http.Error(w, "Failed to update haul: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if req.QuotaBytes != nil {
+		if haul, err = h.svc.SetQuota(r.Context(), id, *req.QuotaBytes); err != nil {
+			http.Error(w, "Failed to update quota: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.hasSettings() {
+		if haul, err = h.svc.SetSettings(r.Context(), id, req.Settings); err != nil {
+			http.Error(w, "Failed to update haul settings: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	writeJSON(w, http.StatusOK, h.summarize(r, haul))
 }
 
-// Delete removes a haul and all of its content.
+// templateRequest is a template plus saved manifests to copy into it.
+type templateRequest struct {
+	Template
+	ManifestIDs []int64 `json:"manifestIds"`
+}
+
+// handleTemplates serves haul templates:
+//
+//	GET    /api/haul-templates       -> list templates
+//	POST   /api/haul-templates       -> create a template
+//	GET    /api/haul-templates/{id}  -> one template
+//	PUT    /api/haul-templates/{id}  -> replace a template
+//	DELETE /api/haul-templates/{id}  -> delete a template
+func (h *Handler) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/haul-templates"), "/")
+
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			templates, err := h.svc.ListTemplates(ctx)
+			if err != nil {
+				http.Error(w, "Failed to list templates: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]interface{}{"templates": templates})
+		case http.MethodPost:
+			t, ok := h.decodeTemplate(w, r)
+			if !ok {
+				return
+			}
+			created, err := h.svc.CreateTemplate(ctx, t)
+			if err != nil {
+				http.Error(w, "Failed to create template: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			writeJSON(w, http.StatusCreated, created)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	id, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid template id", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		t, err := h.svc.GetTemplate(ctx, id)
+		if err != nil {
+			http.Error(w, "Template not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+	case http.MethodPut, http.MethodPatch:
+		t, ok := h.decodeTemplate(w, r)
+		if !ok {
+			return
+		}
+		updated, err := h.svc.UpdateTemplate(ctx, id, t)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Template not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to update template: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	case http.MethodDelete:
+		if err := h.svc.DeleteTemplate(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Template not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to delete template: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Template deleted"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// decodeTemplate reads a template request body, appending copies of any
+// referenced saved manifests. It writes a 400 and returns false on failure.
+func (h *Handler) decodeTemplate(w http.ResponseWriter, r *http.Request) (*Template, bool) {
+	var req templateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(req.ManifestIDs) > 0 {
+		saved, err := h.svc.SavedManifests(r.Context(), req.ManifestIDs)
+		if err != nil {
+			http.Error(w, "Failed to load manifests: "+err.Error(), http.StatusBadRequest)
+			return nil, false
+		}
+		req.Manifests = append(req.Manifests, saved...)
+	}
+	return &req.Template, true
+}
+
+// Delete moves a haul to the trash, where it stays restorable until purged.
 func (h *Handler) Delete(w http.ResponseWriter, r *http.Request, id int64) {
 	if err := h.svc.Delete(r.Context(), id); err != nil {
-		http.Error(w, "Failed to delete haul: "+err.Error(), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Haul not found", http.StatusNotFound)
+		case errors.Is(err, ErrFrozen), errors.Is(err, ErrBusy):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Failed to delete haul: "+err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Haul deleted"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Haul moved to trash"})
+}
+
+// handleTrash serves the trash of soft-deleted hauls:
+//
+//	GET    /api/hauls/trash              -> trashed hauls with size and purge time
+//	POST   /api/hauls/trash/{id}/restore -> move a haul back out of the trash
+//	DELETE /api/hauls/trash/{id}         -> purge a haul permanently, now
+func (h *Handler) handleTrash(w http.ResponseWriter, r *http.Request, parts []string) {
+	ctx := r.Context()
+	if len(parts) == 1 || parts[1] == "" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		entries, err := h.svc.ListTrash(ctx)
+		if err != nil {
+			http.Error(w, "Failed to list trash: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"hauls": entries})
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid haul id", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case len(parts) == 3 && parts[2] == "restore" && r.Method == http.MethodPost:
+		haul, err := h.svc.Restore(ctx, id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Haul not found in trash", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to restore haul: "+err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, h.summarize(r, haul))
+	case len(parts) == 2 && r.Method == http.MethodDelete:
+		if err := h.svc.Purge(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Haul not found in trash", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to purge haul: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Haul purged"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type freezeRequest struct {
+	// By is who the client says it is. It is unverified, so it is kept as a
+	// note beside the actor, the client's address.
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// handleFreeze serves the freeze lifecycle of a haul:
+//
+//	GET  /api/hauls/{id}/freeze   -> current state, index drift, and audit trail
+//	POST /api/hauls/{id}/freeze   -> make the haul read-only
+//	POST /api/hauls/{id}/unfreeze -> make it writable again
+func (h *Handler) handleFreeze(w http.ResponseWriter, r *http.Request, id int64, action string) {
+	ctx := r.Context()
+	if r.Method == http.MethodGet && action == "freeze" {
+		haul, err := h.svc.Get(ctx, id)
+		if err != nil {
+			http.Error(w, "Haul not found", http.StatusNotFound)
+			return
+		}
+		history, err := h.svc.FreezeHistory(ctx, id)
+		if err != nil {
+			http.Error(w, "Failed to load freeze history: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		current, _ := IndexDigest(haul)
+		drifted, _ := Drifted(haul)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"frozen":             haul.Frozen,
+			"frozenAt":           haul.FrozenAt,
+			"frozenBy":           haul.FrozenBy,
+			"frozenReason":       haul.FrozenReason,
+			"frozenIndexDigest":  haul.FrozenIndexDigest,
+			"currentIndexDigest": current,
+			"indexDrifted":       drifted,
+			"history":            history,
+		})
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req freezeRequest
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	actor, note := r.RemoteAddr, strings.TrimSpace(req.By)
+
+	var (
+		haul *Haul
+		err  error
+	)
+	if action == "freeze" {
+		haul, err = h.svc.Freeze(ctx, id, actor, note, req.Reason)
+	} else {
+		haul, err = h.svc.Unfreeze(ctx, id, actor, note, req.Reason)
+	}
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Haul not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to "+action+" haul: "+err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, http.StatusOK, h.summarize(r, haul))
 }
 
 // ListArchives returns the built archives for a haul.
@@ -189,14 +578,69 @@ func (h *Handler) ListArchives(w http.ResponseWriter, r *http.Request, id int64)
 	writeJSON(w, http.StatusOK, map[string]interface{}{"archives": listArchives(haul)})
 }
 
+// ArchiveArtifact is one artifact found inside an archive.
+type ArchiveArtifact struct {
+	Type      string   `json:"type"`
+	Ref       string   `json:"ref"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	Platforms []string `json:"platforms,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// ArchiveContents lists the artifacts in one of a haul's archives without
+// loading it, by stream-decompressing the archive and reading its index.json
+// and manifests. Scans are cached until the file's mtime or size changes.
+func (h *Handler) ArchiveContents(w http.ResponseWriter, r *http.Request, id int64, filename string) {
+	haul, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Haul not found", http.StatusNotFound)
+		return
+	}
+	if !safeArchiveName(filename) {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+	path := filepath.Join(haul.ArchivesDir(), filename)
+	if _, err := os.Stat(path); err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	st, err := ocistore.LoadArchive(path)
+	if err != nil {
+		http.Error(w, "Failed to read archive: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	artifacts := make([]ArchiveArtifact, 0, len(st.Artifacts))
+	var total int64
+	for _, a := range st.Artifacts {
+		artifacts = append(artifacts, ArchiveArtifact{
+			Type: string(a.Kind), Ref: a.Name, Digest: a.Digest, Size: a.Size,
+			Platforms: a.Platforms(), Error: a.Error,
+		})
+	}
+	for _, size := range st.Blobs() {
+		total += size
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"archive":   filename,
+		"artifacts": artifacts,
+		"totalSize": total,
+	})
+}
+
 // handleArchiveFile serves (GET) or deletes (DELETE) a single archive file.
+// An archive's checksum and manifest sidecars can be downloaded too; they are
+// deleted along with the archive.
 func (h *Handler) handleArchiveFile(w http.ResponseWriter, r *http.Request, id int64, filename string) {
 	haul, err := h.svc.Get(r.Context(), id)
 	if err != nil {
 		http.Error(w, "Haul not found", http.StatusNotFound)
 		return
 	}
-	if !safeArchiveName(filename) {
+	sidecar := sidecarName(filename)
+	if !safeArchiveName(filename) && !(sidecar && r.Method == http.MethodGet) {
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
@@ -204,7 +648,7 @@ func (h *Handler) handleArchiveFile(w http.ResponseWriter, r *http.Request, id i
 
 	switch r.Method {
 	case http.MethodDelete:
-		if err := os.Remove(path); err != nil {
+		if err := removeArchive(haul.ArchivesDir(), filename); err != nil {
 			if os.IsNotExist(err) {
 				http.Error(w, "File not found", http.StatusNotFound)
 				return
@@ -212,6 +656,7 @@ func (h *Handler) handleArchiveFile(w http.ResponseWriter, r *http.Request, id i
 			http.Error(w, "Failed to delete archive", http.StatusInternalServerError)
 			return
 		}
+		ocistore.ForgetArchive(path)
 		writeJSON(w, http.StatusOK, map[string]interface{}{"message": "Archive deleted", "filename": filename})
 	case http.MethodGet:
 		info, err := os.Stat(path)
@@ -236,6 +681,51 @@ func (h *Handler) handleArchiveFile(w http.ResponseWriter, r *http.Request, id i
 	}
 }
 
+// GetArtifact describes one artifact in a haul's store: an image index is
+// resolved to its platform manifests, each with its layers and parsed config.
+func (h *Handler) GetArtifact(w http.ResponseWriter, r *http.Request, id int64, digest string) {
+	haul, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Haul not found", http.StatusNotFound)
+		return
+	}
+	if !ocistore.ValidDigest(digest) {
+		http.Error(w, "Invalid digest", http.StatusBadRequest)
+		return
+	}
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	detail, ok, err := st.Describe(digest)
+	if !ok {
+		http.Error(w, "Artifact not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read artifact: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// Sizes reports, for each artifact in a haul's store, its total bytes and how
+// many are shared with other artifacts or unique to it, plus haul totals.
+func (h *Handler) Sizes(w http.ResponseWriter, r *http.Request, id int64) {
+	haul, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		http.Error(w, "Haul not found", http.StatusNotFound)
+		return
+	}
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, st.Sizes())
+}
+
 // summarize computes aggregate counts for a haul.
 func (h *Handler) summarize(r *http.Request, haul *Haul) Summary {
 	s := Summary{Haul: *haul}
@@ -265,6 +755,12 @@ func (h *Handler) summarize(r *http.Request, haul *Haul) Summary {
 		s.ArchiveCount++
 		s.ArchiveBytes += a.Size
 	}
+	if used, err := h.svc.Usage(haul); err == nil {
+		s.UsageBytes = used
+	}
+	if drifted, err := Drifted(haul); err == nil {
+		s.IndexDrifted = drifted
+	}
 	return s
 }
 
@@ -276,14 +772,26 @@ func listArchives(haul *Haul) []Archive {
 	}
 	archives := make([]Archive, 0, len(entries))
 	for _, e := range entries {
-		if e.IsDir() || !strings.HasSuffix(strings.ToLower(e.Name()), ".tar.zst") {
+		if e.IsDir() {
 			continue
 		}
 		info, err := e.Info()
 		if err != nil {
 			continue
 		}
-		archives = append(archives, Archive{Name: e.Name(), Size: info.Size(), Modified: info.ModTime()})
+		a := Archive{Name: e.Name(), Size: info.Size(), Modified: info.ModTime()}
+		if name, ok := strings.CutSuffix(e.Name(), ".volumes.json"); ok {
+			idx, err := ReadVolumeIndex(haul.ArchivesDir(), name)
+			if err != nil {
+				continue
+			}
+			a.Name, a.Size, a.Volumes = name, idx.Size, len(idx.Volumes)
+		} else if !strings.HasSuffix(strings.ToLower(e.Name()), ".tar.zst") {
+			continue
+		}
+		_, err = os.Stat(filepath.Join(haul.ArchivesDir(), SignatureName(a.Name)))
+		a.Signed = err == nil
+		archives = append(archives, a)
 	}
 	// Newest first.
 	for i := 0; i < len(archives); i++ {
@@ -6,11 +6,13 @@ package hauls
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hauler-ui/hauler-ui/backend/internal/config"
@@ -23,8 +25,29 @@ type Haul struct {
 	Slug        string    `json:"slug"`
 	Description string    `json:"description"`
 	StoreDir    string    `json:"storeDir"`
+	QuotaBytes  int64     `json:"quotaBytes"` // 0 means unlimited
 	CreatedAt   time.Time `json:"createdAt"`
 	UpdatedAt   time.Time `json:"updatedAt"`
+
+	// Frozen hauls refuse store mutations and manifest edits.
+	Frozen            bool       `json:"frozen"`
+	FrozenAt          *time.Time `json:"frozenAt,omitempty"`
+	FrozenBy          string     `json:"frozenBy,omitempty"`
+	FrozenReason      string     `json:"frozenReason,omitempty"`
+	FrozenIndexDigest string     `json:"frozenIndexDigest,omitempty"`
+
+	// Settings typically configured by a template; see Template.
+	Defaults        RequestDefaults   `json:"defaults"`
+	Labels          map[string]string `json:"labels"`
+	PublishHostname string            `json:"publishHostname,omitempty"`
+	TemplateID      *int64            `json:"templateId,omitempty"`
+
+	// LastVerified is the outcome of the most recent store integrity check.
+	LastVerified *Verification `json:"lastVerified,omitempty"`
+
+	// DeletedAt is set while the haul sits in the trash awaiting restore or purge.
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	trashDir  string
 }
 
 // ArchivesDir returns the directory where this haul's built .tar.zst archives live.
@@ -33,15 +56,37 @@ func (h *Haul) ArchivesDir() string {
 	return filepath.Join(filepath.Dir(h.StoreDir), "archives")
 }
 
+// SBOMDir returns the directory holding SBOMs generated for this haul's images.
+func (h *Haul) SBOMDir() string {
+	return filepath.Join(filepath.Dir(h.StoreDir), "sboms")
+}
+
+// VulnReportPath returns the file holding the haul's latest vulnerability
+// report.
+func (h *Haul) VulnReportPath() string {
+	return filepath.Join(filepath.Dir(h.StoreDir), "vulnerabilities.json")
+}
+
 // Service provides CRUD and filesystem management for hauls.
 type Service struct {
 	db  *sql.DB
 	cfg *config.Config
+
+	// onDelete hooks run after a haul is moved to the trash, e.g. to unpublish it.
+	onDelete []func(ctx context.Context, haul *Haul)
+
+	// locks holds the write locks taken by maintenance jobs, keyed by haul id.
+	locksMu sync.Mutex
+	locks   map[int64]string
+
+	// storeSizes caches the size of each haul's store, keyed by haul id.
+	storeSizesMu sync.Mutex
+	storeSizes   map[int64]storeUsage
 }
 
 // NewService creates a haul service.
 func NewService(db *sql.DB, cfg *config.Config) *Service {
-	return &Service{db: db, cfg: cfg}
+	return &Service{db: db, cfg: cfg, locks: make(map[int64]string), storeSizes: make(map[int64]storeUsage)}
 }
 
 // baseDir is the root under which all per-haul directories are created.
@@ -64,7 +109,8 @@ func slugify(name string) string {
 }
 
 // EnsureDefault guarantees at least one haul exists, creating a "Default" haul
-// on first boot so the app is never empty.
+// on first boot so the app is never empty. When the last haul was trashed
+// and still holds the name, the new one is "Default 2" and so on.
 func (s *Service) EnsureDefault(ctx context.Context) (*Haul, error) {
 	hauls, err := s.List(ctx)
 	if err != nil {
@@ -73,25 +119,77 @@ func (s *Service) EnsureDefault(ctx context.Context) (*Haul, error) {
 	if len(hauls) > 0 {
 		return &hauls[0], nil
 	}
-	return s.Create(ctx, "Default", "Default haul workspace")
+	name := "Default"
+	for i := 2; ; i++ {
+		var taken int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM hauls WHERE name = ?`, name).Scan(&taken); err != nil {
+			return nil, err
+		}
+		if taken == 0 {
+			break
+		}
+		name = fmt.Sprintf("Default %d", i)
+	}
+	return s.Create(ctx, name, "Default haul workspace")
 }
 
+// haulColumns is the column list scanHaul expects, in order.
+const haulColumns = `id, name, slug, description, store_dir, quota_bytes, created_at, updated_at,
+	frozen, frozen_at, frozen_by, frozen_reason, frozen_index_digest, deleted_at, trash_dir,
+	defaults, labels, publish_hostname, template_id,
+	verified_at, verify_ok, verify_problems, verify_job_id`
+
 // scanHaul reads a single Haul row from the given scanner.
 func scanHaul(row interface{ Scan(...any) error }) (*Haul, error) {
 	var h Haul
-	var desc sql.NullString
-	if err := row.Scan(&h.ID, &h.Name, &h.Slug, &desc, &h.StoreDir, &h.CreatedAt, &h.UpdatedAt); err != nil {
+	var desc, frozenBy, frozenReason, frozenDigest, trashDir sql.NullString
+	var defaults, labels, publishHostname sql.NullString
+	var frozenAt, deletedAt sql.NullTime
+	var templateID sql.NullInt64
+	var verifiedAt sql.NullTime
+	var verifyOK sql.NullBool
+	var verifyProblems, verifyJobID sql.NullInt64
+	if err := row.Scan(&h.ID, &h.Name, &h.Slug, &desc, &h.StoreDir, &h.QuotaBytes, &h.CreatedAt, &h.UpdatedAt,
+		&h.Frozen, &frozenAt, &frozenBy, &frozenReason, &frozenDigest, &deletedAt, &trashDir,
+		&defaults, &labels, &publishHostname, &templateID,
+		&verifiedAt, &verifyOK, &verifyProblems, &verifyJobID); err != nil {
 		return nil, err
 	}
+	if verifiedAt.Valid {
+		h.LastVerified = &Verification{
+			At: verifiedAt.Time, OK: verifyOK.Bool, Problems: int(verifyProblems.Int64), JobID: verifyJobID.Int64,
+		}
+	}
+	if defaults.Valid {
+		_ = json.Unmarshal([]byte(defaults.String), &h.Defaults)
+	}
+	h.Labels = map[string]string{}
+	if labels.Valid {
+		_ = json.Unmarshal([]byte(labels.String), &h.Labels)
+	}
+	h.PublishHostname = publishHostname.String
+	if templateID.Valid {
+		h.TemplateID = &templateID.Int64
+	}
 	h.Description = desc.String
+	if frozenAt.Valid {
+		h.FrozenAt = &frozenAt.Time
+	}
+	h.FrozenBy = frozenBy.String
+	h.FrozenReason = frozenReason.String
+	h.FrozenIndexDigest = frozenDigest.String
+	if deletedAt.Valid {
+		h.DeletedAt = &deletedAt.Time
+	}
+	h.trashDir = trashDir.String
 	return &h, nil
 }
 
-// List returns all hauls, newest first.
+// List returns all live (not trashed) hauls, newest first.
 func (s *Service) List(ctx context.Context) ([]Haul, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, name, slug, description, store_dir, created_at, updated_at
-		 FROM hauls ORDER BY created_at DESC`)
+		`SELECT `+haulColumns+`
+		 FROM hauls WHERE deleted_at IS NULL ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -108,19 +206,19 @@ func (s *Service) List(ctx context.Context) ([]Haul, error) {
 	return hauls, rows.Err()
 }
 
-// Get returns a single haul by id.
+// Get returns a single live haul by id. Trashed hauls are not found.
 func (s *Service) Get(ctx context.Context, id int64) (*Haul, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, name, slug, description, store_dir, created_at, updated_at
-		 FROM hauls WHERE id = ?`, id)
+		`SELECT `+haulColumns+`
+		 FROM hauls WHERE id = ? AND deleted_at IS NULL`, id)
 	return scanHaul(row)
 }
 
-// GetBySlug returns a single haul by its filesystem-safe slug.
+// GetBySlug returns a single live haul by its filesystem-safe slug.
 func (s *Service) GetBySlug(ctx context.Context, slug string) (*Haul, error) {
 	row := s.db.QueryRowContext(ctx,
-		`SELECT id, name, slug, description, store_dir, created_at, updated_at
-		 FROM hauls WHERE slug = ?`, slug)
+		`SELECT `+haulColumns+`
+		 FROM hauls WHERE slug = ? AND deleted_at IS NULL`, slug)
 	return scanHaul(row)
 }
 
@@ -130,19 +228,13 @@ func (s *Service) Create(ctx context.Context, name, description string) (*Haul,
 	if name == "" {
 		return nil, fmt.Errorf("name is required")
 	}
+	if err := s.checkNameFree(ctx, name); err != nil {
+		return nil, err
+	}
 
-	// Derive a unique slug.
-	base := slugify(name)
-	slug := base
-	for i := 2; ; i++ {
-		var exists int
-		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM hauls WHERE slug = ?`, slug).Scan(&exists); err != nil {
-			return nil, err
-		}
-		if exists == 0 {
-			break
-		}
-		slug = fmt.Sprintf("%s-%d", base, i)
+	slug, err := s.uniqueSlug(ctx, name)
+	if err != nil {
+		return nil, err
 	}
 
 	storeDir := filepath.Join(s.baseDir(), slug, "store")
@@ -154,6 +246,41 @@ func (s *Service) Create(ctx context.Context, name, description string) (*Haul,
 		return nil, fmt.Errorf("creating archives directory: %w", err)
 	}
 
+	return s.insert(ctx, name, slug, description, storeDir)
+}
+
+// checkNameFree reports a clear error when name is held by a trashed haul,
+// which keeps its name (and slug) reserved until it is restored or purged.
+func (s *Service) checkNameFree(ctx context.Context, name string) error {
+	var trashed int
+	if err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(1) FROM hauls WHERE name = ? AND deleted_at IS NOT NULL`, name).Scan(&trashed); err != nil {
+		return err
+	}
+	if trashed > 0 {
+		return fmt.Errorf("a haul named %q is in the trash; restore or purge it first", name)
+	}
+	return nil
+}
+
+// uniqueSlug derives a slug from name that no existing haul uses yet.
+func (s *Service) uniqueSlug(ctx context.Context, name string) (string, error) {
+	base := slugify(name)
+	slug := base
+	for i := 2; ; i++ {
+		var exists int
+		if err := s.db.QueryRowContext(ctx, `SELECT COUNT(1) FROM hauls WHERE slug = ?`, slug).Scan(&exists); err != nil {
+			return "", err
+		}
+		if exists == 0 {
+			return slug, nil
+		}
+		slug = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// insert records a haul row whose directories have already been prepared.
+func (s *Service) insert(ctx context.Context, name, slug, description, storeDir string) (*Haul, error) {
 	var id int64
 	err := s.db.QueryRowContext(ctx,
 		`INSERT INTO hauls (name, slug, description, store_dir)
@@ -191,26 +318,118 @@ func (s *Service) Update(ctx context.Context, id int64, name, description *strin
 	return s.Get(ctx, id)
 }
 
-// Delete removes a haul, its store directory, archives, and tracked contents.
+// Settings are the per-haul options a template configures. Nil fields are
+// left unchanged by SetSettings.
+type Settings struct {
+	Defaults        *RequestDefaults   `json:"defaults,omitempty"`
+	Labels          *map[string]string `json:"labels,omitempty"`
+	PublishHostname *string            `json:"publishHostname,omitempty"`
+}
+
+// SetSettings updates a haul's request defaults, labels and publish hostname.
+func (s *Service) SetSettings(ctx context.Context, id int64, settings Settings) (*Haul, error) {
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	defaults, labels, hostname := existing.Defaults, existing.Labels, existing.PublishHostname
+	if settings.Defaults != nil {
+		defaults = *settings.Defaults
+	}
+	if settings.Labels != nil {
+		labels = *settings.Labels
+	}
+	if settings.PublishHostname != nil {
+		hostname = strings.ToLower(strings.TrimSpace(*settings.PublishHostname))
+	}
+	defaultsJSON, _ := json.Marshal(defaults)
+	labelsJSON, _ := json.Marshal(labels)
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE hauls SET defaults = ?, labels = ?, publish_hostname = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		string(defaultsJSON), string(labelsJSON), hostname, id); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// SetQuota changes a haul's size quota in bytes; 0 removes the limit.
+func (s *Service) SetQuota(ctx context.Context, id int64, quotaBytes int64) (*Haul, error) {
+	if quotaBytes < 0 {
+		return nil, fmt.Errorf("quotaBytes must not be negative")
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE hauls SET quota_bytes = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, quotaBytes, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.Get(ctx, id)
+}
+
+// OnDelete registers a hook that runs after a haul is moved to the trash.
+// Hooks are expected to be registered at startup.
+func (s *Service) OnDelete(fn func(ctx context.Context, haul *Haul)) {
+	s.onDelete = append(s.onDelete, fn)
+}
+
+// Delete soft-deletes a haul: its directory tree (store + archives) is moved
+// into the trash and the row is marked deleted. It stays restorable until the
+// trash retention period lapses; see Restore and Purge.
 func (s *Service) Delete(ctx context.Context, id int64) error {
 	h, err := s.Get(ctx, id)
 	if err != nil {
 		return err
 	}
-	// Remove the haul's directory tree (store + archives).
-	haulDir := filepath.Dir(h.StoreDir)
-	if err := os.RemoveAll(haulDir); err != nil {
-		return fmt.Errorf("removing haul directory: %w", err)
+	if err := h.Writable(); err != nil {
+		return err
 	}
-	if _, err := s.db.ExecContext(ctx, `DELETE FROM store_contents WHERE haul_id = ?`, id); err != nil {
+	active, err := s.activeJobs(ctx, id)
+	if err != nil {
 		return err
 	}
-	if _, err := s.db.ExecContext(ctx, `DELETE FROM hauls WHERE id = ?`, id); err != nil {
+	if active > 0 {
+		return fmt.Errorf("%w: %q has %d queued or running job(s)", ErrBusy, h.Name, active)
+	}
+
+	// An adopted store that is a symlink moves with the haul directory; its
+	// target is left untouched.
+	haulDir := filepath.Dir(h.StoreDir)
+	trashDir := filepath.Join(s.trashBaseDir(), fmt.Sprintf("%d-%s", h.ID, h.Slug))
+	if err := os.MkdirAll(s.trashBaseDir(), 0755); err != nil {
+		return fmt.Errorf("creating trash directory: %w", err)
+	}
+	// A haul whose directory is already gone keeps no trash directory;
+	// restoring it recreates an empty layout.
+	var recorded interface{} = trashDir
+	if err := os.Rename(haulDir, trashDir); err != nil {
+		if !os.IsNotExist(err) {
+			return fmt.Errorf("moving haul to trash: %w", err)
+		}
+		recorded = nil
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE hauls SET deleted_at = CURRENT_TIMESTAMP, trash_dir = ? WHERE id = ?`, recorded, id); err != nil {
+		// Put the directory back so the haul is not left half-deleted.
+		_ = os.Rename(trashDir, haulDir)
 		return err
 	}
+
+	for _, fn := range s.onDelete {
+		fn(ctx, h)
+	}
 	return nil
 }
 
+// activeJobs counts a haul's queued and running jobs.
+func (s *Service) activeJobs(ctx context.Context, id int64) (int, error) {
+	var active int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(1) FROM jobs WHERE haul_id = ? AND status IN ('queued', 'running')`, id).Scan(&active)
+	return active, err
+}
+
 // initStoreDir creates an empty OCI layout so hauler can operate on a fresh haul.
 func initStoreDir(storeDir string) error {
 	blobsDir := filepath.Join(storeDir, "blobs", "sha256")
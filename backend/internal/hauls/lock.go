@@ -0,0 +1,36 @@
+package hauls
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLocked is returned when a haul's write lock is held by another operation.
+var ErrLocked = errors.New("haul is locked")
+
+// Lock takes a haul's write lock on behalf of holder (e.g. "gc job 12") and
+// returns the func that releases it. While the lock is held, store writes to
+// the haul are refused. It fails with ErrLocked if the lock is already held.
+func (s *Service) Lock(id int64, holder string) (func(), error) {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+	if by, held := s.locks[id]; held {
+		return nil, fmt.Errorf("%w by %s", ErrLocked, by)
+	}
+	s.locks[id] = holder
+	return func() {
+		s.locksMu.Lock()
+		delete(s.locks, id)
+		s.locksMu.Unlock()
+	}, nil
+}
+
+// Locked returns an error wrapping ErrLocked if the haul's write lock is held.
+func (s *Service) Locked(id int64) error {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+	if by, held := s.locks[id]; held {
+		return fmt.Errorf("%w by %s; retry when it finishes", ErrLocked, by)
+	}
+	return nil
+}
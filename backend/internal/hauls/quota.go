@@ -0,0 +1,210 @@
+package hauls
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// storeSizeMaxAge bounds how long a cached store size is trusted. A blob
+// being downloaded grows in place without changing the store's fingerprint,
+// so a running job's store is re-measured at least this often.
+const storeSizeMaxAge = 30 * time.Second
+
+// CapacityError reports that an operation would push a haul past its quota or
+// eat into the data directory's free-space reserve.
+type CapacityError struct {
+	Reason string
+}
+
+func (e *CapacityError) Error() string { return e.Reason }
+
+// Usage returns the bytes a haul occupies on disk: its store plus its
+// archives directory. The store's size is cached until a blob is added or
+// removed, index.json is rewritten, or storeSizeMaxAge passes, so summaries
+// and the checks of running jobs do not walk the whole store each time.
+func (s *Service) Usage(haul *Haul) (int64, error) {
+	return s.usage(haul, false)
+}
+
+// usage is Usage, walking the store afresh when fresh is set.
+func (s *Service) usage(haul *Haul, fresh bool) (int64, error) {
+	store, err := s.cachedStoreBytes(haul, fresh)
+	if err != nil {
+		return 0, err
+	}
+	archives, err := dirSize(haul.ArchivesDir())
+	if err != nil {
+		return 0, err
+	}
+	return store + archives, nil
+}
+
+// StoreBytes returns the size of a haul's store directory, following the
+// symlink of an adopted store.
+func (s *Service) StoreBytes(haul *Haul) (int64, error) {
+	return s.cachedStoreBytes(haul, true)
+}
+
+// storeUsage is the cached size of a haul's store.
+type storeUsage struct {
+	fingerprint string
+	bytes       int64
+	measured    time.Time
+}
+
+// cachedStoreBytes returns the size of a haul's store, from the cache unless
+// fresh is set, the store has changed since it was measured, or the
+// measurement is older than storeSizeMaxAge.
+func (s *Service) cachedStoreBytes(haul *Haul, fresh bool) (int64, error) {
+	storeDir, err := filepath.EvalSymlinks(haul.StoreDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	fingerprint := storeFingerprint(storeDir)
+	s.storeSizesMu.Lock()
+	cached, ok := s.storeSizes[haul.ID]
+	s.storeSizesMu.Unlock()
+	if ok && !fresh && fingerprint != "" && cached.fingerprint == fingerprint &&
+		time.Since(cached.measured) < storeSizeMaxAge {
+		return cached.bytes, nil
+	}
+	n, err := dirSize(storeDir)
+	if err != nil {
+		return 0, err
+	}
+	s.storeSizesMu.Lock()
+	s.storeSizes[haul.ID] = storeUsage{fingerprint: fingerprint, bytes: n, measured: time.Now()}
+	s.storeSizesMu.Unlock()
+	return n, nil
+}
+
+// storeFingerprint identifies the state of a store by the modification times
+// of index.json and of the blob directories, which change whenever a blob is
+// added or removed. It is "" if the store cannot be read, which disables
+// the cache.
+func storeFingerprint(storeDir string) string {
+	var b strings.Builder
+	paths := []string{filepath.Join(storeDir, "index.json"), filepath.Join(storeDir, "blobs")}
+	if algos, err := os.ReadDir(filepath.Join(storeDir, "blobs")); err == nil {
+		for _, a := range algos {
+			paths = append(paths, filepath.Join(storeDir, "blobs", a.Name()))
+		}
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(&b, "%s -;", p)
+		case err != nil:
+			return ""
+		default:
+			fmt.Fprintf(&b, "%s %d %d;", p, info.ModTime().UnixNano(), info.Size())
+		}
+	}
+	return b.String()
+}
+
+// FreeBytes returns the space available to unprivileged writers on the volume
+// holding the data directory.
+func (s *Service) FreeBytes() (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(s.cfg.DataDir, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
+
+// CheckCapacity verifies that writing incoming more bytes into haul keeps it
+// within its quota and leaves the configured reserve free on the data volume.
+// It returns a *CapacityError when a limit would be crossed. An incoming of 0
+// checks whether a limit has already been crossed; a nil haul checks only the
+// global reserve. The haul's store is measured afresh, as before a job.
+func (s *Service) CheckCapacity(ctx context.Context, haul *Haul, incoming int64) error {
+	return s.checkCapacity(ctx, haul, incoming, true)
+}
+
+// CheckRunningCapacity is CheckCapacity for the periodic checks of a running
+// job: it uses the cached size of the haul's store, re-measured when blobs
+// are added or removed and at least every storeSizeMaxAge while a blob grows.
+func (s *Service) CheckRunningCapacity(ctx context.Context, haul *Haul) error {
+	return s.checkCapacity(ctx, haul, 0, false)
+}
+
+func (s *Service) checkCapacity(ctx context.Context, haul *Haul, incoming int64, fresh bool) error {
+	// Re-read the quota so limits changed after a job started still apply.
+	if haul != nil {
+		if current, err := s.Get(ctx, haul.ID); err == nil {
+			haul = current
+		}
+	}
+
+	if haul != nil && haul.QuotaBytes > 0 {
+		used, err := s.usage(haul, fresh)
+		if err != nil {
+			return fmt.Errorf("measuring haul usage: %w", err)
+		}
+		if used+incoming > haul.QuotaBytes {
+			return &CapacityError{Reason: fmt.Sprintf(
+				"haul %q would use %s of its %s quota", haul.Name,
+				formatBytes(used+incoming), formatBytes(haul.QuotaBytes))}
+		}
+	}
+
+	if reserve := s.cfg.DataReserveBytes; reserve > 0 {
+		free, err := s.FreeBytes()
+		if err != nil {
+			return fmt.Errorf("measuring free space: %w", err)
+		}
+		if free-incoming < reserve {
+			return &CapacityError{Reason: fmt.Sprintf(
+				"data volume has %s free; %s must stay in reserve", formatBytes(free), formatBytes(reserve))}
+		}
+	}
+	return nil
+}
+
+// dirSize sums the sizes of regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil // removed mid-walk
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+// formatBytes renders a byte count with a binary unit for error messages.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
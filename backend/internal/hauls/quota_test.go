@@ -0,0 +1,85 @@
+package hauls
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUsageCachesStoreSize(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+	haul, err := svc.Create(ctx, "Release", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blobs := filepath.Join(haul.StoreDir, "blobs", "sha256")
+	if err := os.WriteFile(filepath.Join(blobs, "a"), make([]byte, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	base, err := svc.Usage(haul)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Growing a blob in place changes neither index.json nor the blob
+	// directory, so the cached size is used...
+	if err := os.WriteFile(filepath.Join(blobs, "a"), make([]byte, 5000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := svc.Usage(haul); used != base {
+		t.Errorf("expected the cached usage %d, got %d", base, used)
+	}
+	// ...until a blob is added.
+	if err := os.WriteFile(filepath.Join(blobs, "b"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := svc.Usage(haul); used != base+4000+100 {
+		t.Errorf("expected usage %d after adding a blob, got %d", base+4100, used)
+	}
+
+	// Archives are always measured, and a check before a write walks the
+	// store afresh.
+	if err := os.WriteFile(filepath.Join(haul.ArchivesDir(), "x.tar.zst"), make([]byte, 700), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := svc.Usage(haul); used != base+4100+700 {
+		t.Errorf("expected the archive counted, got %d", used)
+	}
+	if err := os.WriteFile(filepath.Join(blobs, "b"), make([]byte, 2100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.db.ExecContext(ctx, `UPDATE hauls SET quota_bytes = ? WHERE id = ?`, base+4100+700+1000, haul.ID); err != nil {
+		t.Fatal(err)
+	}
+	var capErr *CapacityError
+	if err := svc.CheckRunningCapacity(ctx, haul); err != nil {
+		t.Errorf("expected the periodic check to use the cached size, got %v", err)
+	}
+	if err := svc.CheckCapacity(ctx, haul, 0); !errors.As(err, &capErr) {
+		t.Errorf("expected the check before a job to see the grown blob, got %v", err)
+	}
+
+	// A blob still growing is seen by the periodic check once the cached
+	// size is old enough.
+	if err := os.WriteFile(filepath.Join(blobs, "b"), make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.CheckCapacity(ctx, haul, 0); err != nil {
+		t.Fatalf("expected the store to fit again, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(blobs, "b"), make([]byte, 2100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	svc.storeSizesMu.Lock()
+	cached := svc.storeSizes[haul.ID]
+	cached.measured = cached.measured.Add(-storeSizeMaxAge)
+	svc.storeSizes[haul.ID] = cached
+	svc.storeSizesMu.Unlock()
+	if err := svc.CheckRunningCapacity(ctx, haul); !errors.As(err, &capErr) {
+		t.Errorf("expected the periodic check to re-measure a stale size, got %v", err)
+	}
+}
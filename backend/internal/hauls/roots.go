@@ -0,0 +1,53 @@
+package hauls
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoots is returned for paths outside every import root.
+var ErrOutsideRoots = errors.New("path is not inside a configured import root")
+
+// ResolveImportPath cleans p and resolves its symlinks, returning it only if
+// both the path as given and the resolved path lie within one of roots.
+// Paths outside the roots are refused before they are looked at, so whether
+// they exist is not revealed.
+func ResolveImportPath(roots []string, p string) (string, error) {
+	if len(roots) == 0 {
+		return "", fmt.Errorf("%w: no import roots are configured (HAULER_UI_IMPORT_ROOTS)", ErrOutsideRoots)
+	}
+	if !filepath.IsAbs(p) {
+		return "", fmt.Errorf("%w: %q is not absolute", ErrOutsideRoots, p)
+	}
+	p = filepath.Clean(p)
+	if !underRoot(roots, p, false) {
+		return "", ErrOutsideRoots
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	if !underRoot(roots, real, true) {
+		return "", ErrOutsideRoots
+	}
+	return real, nil
+}
+
+// underRoot reports whether p is one of roots or inside one, comparing
+// against the roots' resolved paths if resolve is set.
+func underRoot(roots []string, p string, resolve bool) bool {
+	for _, root := range roots {
+		if resolve {
+			var err error
+			if root, err = filepath.EvalSymlinks(root); err != nil {
+				continue
+			}
+		}
+		if rel, err := filepath.Rel(root, p); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
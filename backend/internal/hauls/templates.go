@@ -0,0 +1,335 @@
+package hauls
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrTemplateNotFound is returned when instantiating a template that does not
+// exist.
+var ErrTemplateNotFound = errors.New("template not found")
+
+// RequestDefaults are options applied to a haul's add/sync requests when the
+// request leaves them empty.
+type RequestDefaults struct {
+	Platform string `json:"platform,omitempty"`
+	Rewrite  string `json:"rewrite,omitempty"`
+	Key      string `json:"key,omitempty"` // path to a cosign public key
+}
+
+// Apply fills each empty value with the corresponding default.
+func (d RequestDefaults) Apply(platform, key, rewrite string) (string, string, string) {
+	if platform == "" {
+		platform = d.Platform
+	}
+	if key == "" {
+		key = d.Key
+	}
+	if rewrite == "" {
+		rewrite = d.Rewrite
+	}
+	return platform, key, rewrite
+}
+
+// TemplateManifest is a manifest copied into every haul made from a template.
+type TemplateManifest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	YAMLContent string   `json:"yamlContent"`
+	Tags        []string `json:"tags"`
+}
+
+// TemplatePublish controls how hauls made from a template are published.
+type TemplatePublish struct {
+	// HostnamePattern derives the publish hostname; "{slug}" is replaced by
+	// the new haul's slug, e.g. "{slug}.registry.example.com".
+	HostnamePattern string `json:"hostnamePattern,omitempty"`
+	AutoPublish     bool   `json:"autoPublish"`
+}
+
+// Template bundles the manifests and settings a new haul starts with.
+type Template struct {
+	ID          int64              `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Manifests   []TemplateManifest `json:"manifests"`
+	Defaults    RequestDefaults    `json:"defaults"`
+	Labels      map[string]string  `json:"labels"`
+	Publish     TemplatePublish    `json:"publish"`
+	QuotaBytes  int64              `json:"quotaBytes"`
+	AutoSync    bool               `json:"autoSync"` // sync the manifests right after instantiation
+	CreatedAt   time.Time          `json:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt"`
+}
+
+// Hostname expands the template's hostname pattern for a haul slug, or
+// returns "" when no pattern is set.
+func (t *Template) Hostname(slug string) string {
+	if t.Publish.HostnamePattern == "" {
+		return ""
+	}
+	return strings.ToLower(strings.ReplaceAll(t.Publish.HostnamePattern, "{slug}", slug))
+}
+
+// validate normalizes a template and checks it can be instantiated.
+func (t *Template) validate() error {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if t.QuotaBytes < 0 {
+		return fmt.Errorf("quotaBytes must not be negative")
+	}
+	if p := t.Publish.HostnamePattern; p != "" && !strings.Contains(p, "{slug}") {
+		return fmt.Errorf("publish.hostnamePattern must contain {slug} so each haul gets its own hostname")
+	}
+	seen := map[string]bool{}
+	for i, m := range t.Manifests {
+		name := strings.TrimSpace(m.Name)
+		if name == "" {
+			return fmt.Errorf("manifests[%d]: name is required", i)
+		}
+		if strings.TrimSpace(m.YAMLContent) == "" {
+			return fmt.Errorf("manifest %q: yamlContent is required", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("manifest %q appears more than once", name)
+		}
+		seen[name] = true
+		t.Manifests[i].Name = name
+		if t.Manifests[i].Tags == nil {
+			t.Manifests[i].Tags = []string{}
+		}
+	}
+	if t.Manifests == nil {
+		t.Manifests = []TemplateManifest{}
+	}
+	if t.Labels == nil {
+		t.Labels = map[string]string{}
+	}
+	return nil
+}
+
+const templateColumns = `id, name, description, manifests, defaults, labels, publish, quota_bytes, auto_sync,
+	created_at, updated_at`
+
+// scanTemplate reads a single Template row from the given scanner.
+func scanTemplate(row interface{ Scan(...any) error }) (*Template, error) {
+	var t Template
+	var desc sql.NullString
+	var manifests, defaults, labels, publish string
+	if err := row.Scan(&t.ID, &t.Name, &desc, &manifests, &defaults, &labels, &publish, &t.QuotaBytes, &t.AutoSync,
+		&t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	t.Description = desc.String
+	fields := []struct {
+		name string
+		src  string
+		dst  any
+	}{
+		{"manifests", manifests, &t.Manifests},
+		{"defaults", defaults, &t.Defaults},
+		{"labels", labels, &t.Labels},
+		{"publish", publish, &t.Publish},
+	}
+	for _, f := range fields {
+		if err := json.Unmarshal([]byte(f.src), f.dst); err != nil {
+			return nil, fmt.Errorf("template %d: decoding %s: %w", t.ID, f.name, err)
+		}
+	}
+	if t.Manifests == nil {
+		t.Manifests = []TemplateManifest{}
+	}
+	if t.Labels == nil {
+		t.Labels = map[string]string{}
+	}
+	return &t, nil
+}
+
+// ListTemplates returns all haul templates ordered by name.
+func (s *Service) ListTemplates(ctx context.Context) ([]Template, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+templateColumns+` FROM haul_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, *t)
+	}
+	return templates, rows.Err()
+}
+
+// GetTemplate returns a single template by id.
+func (s *Service) GetTemplate(ctx context.Context, id int64) (*Template, error) {
+	return scanTemplate(s.db.QueryRowContext(ctx, `SELECT `+templateColumns+` FROM haul_templates WHERE id = ?`, id))
+}
+
+// templateJSON encodes a template's nested settings for storage.
+func templateJSON(t *Template) (manifests, defaults, labels, publish string) {
+	m, _ := json.Marshal(t.Manifests)
+	d, _ := json.Marshal(t.Defaults)
+	l, _ := json.Marshal(t.Labels)
+	p, _ := json.Marshal(t.Publish)
+	return string(m), string(d), string(l), string(p)
+}
+
+// CreateTemplate stores a new template.
+func (s *Service) CreateTemplate(ctx context.Context, t *Template) (*Template, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	manifests, defaults, labels, publish := templateJSON(t)
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO haul_templates (name, description, manifests, defaults, labels, publish, quota_bytes, auto_sync)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		t.Name, t.Description, manifests, defaults, labels, publish, t.QuotaBytes, t.AutoSync,
+	).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("inserting template: %w", err)
+	}
+	return s.GetTemplate(ctx, id)
+}
+
+// UpdateTemplate replaces a template's contents. Hauls already made from it
+// are not changed.
+func (s *Service) UpdateTemplate(ctx context.Context, id int64, t *Template) (*Template, error) {
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	manifests, defaults, labels, publish := templateJSON(t)
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE haul_templates
+		SET name = ?, description = ?, manifests = ?, defaults = ?, labels = ?, publish = ?,
+		    quota_bytes = ?, auto_sync = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		t.Name, t.Description, manifests, defaults, labels, publish, t.QuotaBytes, t.AutoSync, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetTemplate(ctx, id)
+}
+
+// DeleteTemplate removes a template. Hauls made from it keep their settings.
+func (s *Service) DeleteTemplate(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM haul_templates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SavedManifests returns copies of saved manifests by id, for bundling into a
+// template.
+func (s *Service) SavedManifests(ctx context.Context, ids []int64) ([]TemplateManifest, error) {
+	out := make([]TemplateManifest, 0, len(ids))
+	for _, id := range ids {
+		var m TemplateManifest
+		var desc, tags sql.NullString
+		err := s.db.QueryRowContext(ctx,
+			`SELECT name, description, yaml_content, tags FROM saved_manifests WHERE id = ?`, id,
+		).Scan(&m.Name, &desc, &m.YAMLContent, &tags)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, fmt.Errorf("saved manifest %d not found", id)
+			}
+			return nil, err
+		}
+		m.Description = desc.String
+		m.Tags = []string{}
+		if tags.Valid && tags.String != "" {
+			_ = json.Unmarshal([]byte(tags.String), &m.Tags)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// Instantiate creates a haul from a template: a fresh store, the template's
+// manifests saved into it, and its defaults, labels, quota and publish
+// hostname applied. Publishing and the initial sync are left to the caller.
+func (s *Service) Instantiate(ctx context.Context, templateID int64, name, description string) (*Haul, *Template, error) {
+	t, err := s.GetTemplate(ctx, templateID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("%w: %d", ErrTemplateNotFound, templateID)
+		}
+		return nil, nil, err
+	}
+	if description == "" {
+		description = t.Description
+	}
+	haul, err := s.Create(ctx, name, description)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.applyTemplate(ctx, haul, t); err != nil {
+		s.discard(ctx, haul)
+		return nil, nil, fmt.Errorf("applying template %q: %w", t.Name, err)
+	}
+
+	haul, err = s.Get(ctx, haul.ID)
+	return haul, t, err
+}
+
+// discard removes a haul that failed to be set up, its directory and rows
+// alike, so a retry under the same name starts clean.
+func (s *Service) discard(ctx context.Context, haul *Haul) {
+	if err := os.RemoveAll(filepath.Dir(haul.StoreDir)); err != nil {
+		log.Printf("Warning: failed to remove haul directory for %q: %v", haul.Name, err)
+	}
+	_, _ = s.db.ExecContext(ctx, `DELETE FROM saved_manifests WHERE haul_id = ?`, haul.ID)
+	_, _ = s.db.ExecContext(ctx, `DELETE FROM hauls WHERE id = ?`, haul.ID)
+}
+
+// applyTemplate writes a template's settings and manifests onto a new haul in
+// one transaction.
+func (s *Service) applyTemplate(ctx context.Context, haul *Haul, t *Template) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	defaults, _ := json.Marshal(t.Defaults)
+	labels, _ := json.Marshal(t.Labels)
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE hauls SET defaults = ?, labels = ?, publish_hostname = ?, quota_bytes = ?, template_id = ?,
+		       updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		string(defaults), string(labels), t.Hostname(haul.Slug), t.QuotaBytes, t.ID, haul.ID); err != nil {
+		return err
+	}
+	for _, m := range t.Manifests {
+		tags, _ := json.Marshal(m.Tags)
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO saved_manifests (haul_id, name, description, yaml_content, tags)
+			VALUES (?, ?, ?, ?, ?)`,
+			haul.ID, m.Name, m.Description, m.YAMLContent, string(tags)); err != nil {
+			return fmt.Errorf("saving manifest %q: %w", m.Name, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,105 @@
+package hauls
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateHaulFromTemplate(t *testing.T) {
+	svc := setupTestService(t, 0)
+	ctx := context.Background()
+
+	tmpl, err := svc.CreateTemplate(ctx, &Template{
+		Name: "Customer baseline",
+		Manifests: []TemplateManifest{
+			{Name: "base", YAMLContent: "apiVersion: content.hauler.cattle.io/v1\nkind: Images\n"},
+		},
+		Defaults:   RequestDefaults{Platform: "linux/amd64", Rewrite: "mirror/"},
+		Labels:     map[string]string{"tier": "gold"},
+		Publish:    TemplatePublish{HostnamePattern: "{slug}.registry.example.com"},
+		QuotaBytes: 1 << 30,
+		AutoSync:   true,
+	})
+	if err != nil {
+		t.Fatalf("creating template: %v", err)
+	}
+
+	handler := NewHandler(svc)
+	var synced *Haul
+	handler.SyncManifests = func(_ context.Context, haul *Haul) (int64, error) {
+		synced = haul
+		return 42, nil
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{"name": "Acme", "templateId": tmpl.ID})
+	w := httptest.NewRecorder()
+	handler.Create(w, httptest.NewRequest(http.MethodPost, "/api/hauls", bytes.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	var resp createResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.SyncJobID == nil || *resp.SyncJobID != 42 || synced == nil {
+		t.Errorf("expected the initial sync to start, got %+v", resp)
+	}
+	if resp.Defaults.Platform != "linux/amd64" || resp.Labels["tier"] != "gold" || resp.QuotaBytes != 1<<30 {
+		t.Errorf("template settings not applied: %+v", resp.Haul)
+	}
+	if resp.PublishHostname != "acme.registry.example.com" {
+		t.Errorf("expected hostname from pattern, got %q", resp.PublishHostname)
+	}
+	if resp.TemplateID == nil || *resp.TemplateID != tmpl.ID {
+		t.Errorf("expected templateId %d, got %v", tmpl.ID, resp.TemplateID)
+	}
+
+	var manifests int
+	if err := svc.db.QueryRow(`SELECT COUNT(1) FROM saved_manifests WHERE haul_id = ?`, resp.ID).Scan(&manifests); err != nil {
+		t.Fatalf("counting manifests: %v", err)
+	}
+	if manifests != 1 {
+		t.Errorf("expected 1 saved manifest, got %d", manifests)
+	}
+}
+
+func TestCreateHaulRejectsBadRequestsCleanly(t *testing.T) {
+	svc := setupTestService(t, 0)
+	ctx := context.Background()
+	handler := NewHandler(svc)
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Create(w, httptest.NewRequest(http.MethodPost, "/api/hauls", strings.NewReader(body)))
+		return w
+	}
+	if w := create(`{"name":"x","quotaBytes":-1}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a negative quota to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := create(`{"name":"x","templateId":999}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a missing template to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+	if hauls, _ := svc.List(ctx); len(hauls) != 0 {
+		t.Errorf("expected no haul to be left behind, got %+v", hauls)
+	}
+	if w := create(`{"name":"x","quotaBytes":1024}`); w.Code != http.StatusCreated {
+		t.Errorf("expected a retry to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTemplateRejectsSharedHostname(t *testing.T) {
+	svc := setupTestService(t, 0)
+	_, err := svc.CreateTemplate(context.Background(), &Template{
+		Name:    "Fixed host",
+		Publish: TemplatePublish{HostnamePattern: "registry.example.com"},
+	})
+	if err == nil {
+		t.Fatal("expected a hostname pattern without {slug} to be rejected")
+	}
+}
@@ -0,0 +1,166 @@
+package hauls
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrBusy is returned when a haul cannot be deleted because jobs still use it.
+var ErrBusy = errors.New("haul is busy")
+
+// TrashEntry is a soft-deleted haul with its size and scheduled purge time.
+type TrashEntry struct {
+	Haul
+	SizeBytes int64      `json:"sizeBytes"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"` // nil when retention is disabled
+}
+
+// trashBaseDir is where deleted haul directories wait to be restored or purged.
+// It sits on the same volume as the hauls so moving into it is a rename.
+func (s *Service) trashBaseDir() string {
+	return filepath.Join(s.cfg.DataDir, "trash")
+}
+
+// getTrashed returns a single trashed haul by id.
+func (s *Service) getTrashed(ctx context.Context, id int64) (*Haul, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+haulColumns+`
+		 FROM hauls WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	return scanHaul(row)
+}
+
+// ListTrash returns the trashed hauls, most recently deleted first.
+func (s *Service) ListTrash(ctx context.Context) ([]TrashEntry, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+haulColumns+`
+		 FROM hauls WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TrashEntry{}
+	for rows.Next() {
+		h, err := scanHaul(rows)
+		if err != nil {
+			return nil, err
+		}
+		e := TrashEntry{Haul: *h}
+		if size, err := dirSize(h.trashDir); err == nil {
+			e.SizeBytes = size
+		}
+		if retention := s.cfg.TrashRetention; retention > 0 && h.DeletedAt != nil {
+			purgeAt := h.DeletedAt.Add(retention)
+			e.PurgeAt = &purgeAt
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Restore moves a trashed haul's directory back into place and makes the haul
+// live again. Publishing is not restored; republish it if needed.
+func (s *Service) Restore(ctx context.Context, id int64) (*Haul, error) {
+	h, err := s.getTrashed(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	haulDir := filepath.Dir(h.StoreDir)
+	if _, err := os.Lstat(haulDir); err == nil {
+		return nil, fmt.Errorf("cannot restore %q: %s already exists", h.Name, haulDir)
+	}
+	if err := os.MkdirAll(s.baseDir(), 0755); err != nil {
+		return nil, err
+	}
+	undo := func() { _ = os.Rename(haulDir, h.trashDir) }
+	if h.trashDir == "" {
+		// The haul had no directory when it was deleted; start it afresh.
+		if err := initStoreDir(h.StoreDir); err != nil {
+			return nil, fmt.Errorf("recreating haul directory: %w", err)
+		}
+		undo = func() { _ = os.RemoveAll(haulDir) }
+	} else if err := os.Rename(h.trashDir, haulDir); err != nil {
+		return nil, fmt.Errorf("restoring haul directory: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE hauls SET deleted_at = NULL, trash_dir = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, id); err != nil {
+		undo()
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+// Purge permanently removes a trashed haul: its directory in the trash, its
+// row, and everything recorded against it.
+func (s *Service) Purge(ctx context.Context, id int64) error {
+	h, err := s.getTrashed(ctx, id)
+	if err != nil {
+		return err
+	}
+	// RemoveAll does not follow symlinks, so an adopted, linked store's source
+	// directory is never touched.
+	if h.trashDir != "" {
+		if err := os.RemoveAll(h.trashDir); err != nil {
+			return fmt.Errorf("removing trashed haul directory: %w", err)
+		}
+	}
+	for _, q := range []string{
+		`DELETE FROM store_contents WHERE haul_id = ?`,
+		`DELETE FROM saved_manifests WHERE haul_id = ?`,
+		`DELETE FROM haul_freeze_events WHERE haul_id = ?`,
+		`DELETE FROM uploads WHERE haul_id = ?`,
+		`DELETE FROM hauls WHERE id = ?`,
+	} {
+		if _, err := s.db.ExecContext(ctx, q, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PurgeExpired purges every trashed haul whose retention period has lapsed
+// and returns how many were removed. It is a no-op when retention is 0.
+func (s *Service) PurgeExpired(ctx context.Context) (int, error) {
+	retention := s.cfg.TrashRetention
+	if retention <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().Add(-retention).UTC().Format("2006-01-02 15:04:05")
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id FROM hauls WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if err := s.Purge(ctx, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue // restored or purged concurrently
+			}
+			log.Printf("Warning: failed to purge trashed haul %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,168 @@
+package hauls
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/config"
+	"github.com/hauler-ui/hauler-ui/backend/internal/sqlite"
+)
+
+func setupTestService(t *testing.T, retention time.Duration) *Service {
+	t.Helper()
+	dataDir := t.TempDir()
+	db, err := sqlite.Open(filepath.Join(dataDir, "app.db"))
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewService(db.DB, &config.Config{DataDir: dataDir, TrashRetention: retention})
+}
+
+func TestDeleteRestoreRoundTrip(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+
+	haul, err := svc.Create(ctx, "Release", "")
+	if err != nil {
+		t.Fatalf("creating haul: %v", err)
+	}
+	marker := filepath.Join(haul.ArchivesDir(), "release.tar.zst")
+	if err := os.WriteFile(marker, []byte("archive"), 0644); err != nil {
+		t.Fatalf("writing archive: %v", err)
+	}
+
+	var hooked int64
+	svc.OnDelete(func(_ context.Context, h *Haul) { hooked = h.ID })
+
+	if err := svc.Delete(ctx, haul.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+	if hooked != haul.ID {
+		t.Errorf("expected delete hook for haul %d, got %d", haul.ID, hooked)
+	}
+	if _, err := svc.Get(ctx, haul.ID); err == nil {
+		t.Error("expected trashed haul to be hidden from Get")
+	}
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Errorf("expected haul directory to leave its place, stat err = %v", err)
+	}
+	if _, err := svc.Create(ctx, "Release", ""); err == nil {
+		t.Error("expected the trashed haul's name to stay reserved")
+	}
+
+	trash, err := svc.ListTrash(ctx)
+	if err != nil {
+		t.Fatalf("listing trash: %v", err)
+	}
+	if len(trash) != 1 || trash[0].ID != haul.ID || trash[0].PurgeAt == nil || trash[0].SizeBytes == 0 {
+		t.Fatalf("unexpected trash listing: %+v", trash)
+	}
+
+	restored, err := svc.Restore(ctx, haul.ID)
+	if err != nil {
+		t.Fatalf("restoring haul: %v", err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("expected restored haul to be live")
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("expected archive back in place: %v", err)
+	}
+}
+
+func TestPurgeExpired(t *testing.T) {
+	svc := setupTestService(t, time.Hour)
+	ctx := context.Background()
+
+	haul, err := svc.Create(ctx, "Old", "")
+	if err != nil {
+		t.Fatalf("creating haul: %v", err)
+	}
+	// An upload that never expires must not outlive its haul.
+	if _, err := svc.db.Exec(`INSERT INTO uploads (id, haul_id, filename, size) VALUES ('u1', ?, 'a.tar.zst', 10)`, haul.ID); err != nil {
+		t.Fatalf("recording upload: %v", err)
+	}
+	if err := svc.Delete(ctx, haul.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+
+	// Still within retention: nothing is purged.
+	if n, err := svc.PurgeExpired(ctx); err != nil || n != 0 {
+		t.Fatalf("PurgeExpired = %d, %v; want 0, nil", n, err)
+	}
+
+	if _, err := svc.db.Exec(`UPDATE hauls SET deleted_at = datetime('now', '-2 hours') WHERE id = ?`, haul.ID); err != nil {
+		t.Fatalf("backdating deletion: %v", err)
+	}
+	trashed, err := svc.getTrashed(ctx, haul.ID)
+	if err != nil {
+		t.Fatalf("loading trashed haul: %v", err)
+	}
+
+	if n, err := svc.PurgeExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("PurgeExpired = %d, %v; want 1, nil", n, err)
+	}
+	if _, err := os.Stat(trashed.trashDir); !os.IsNotExist(err) {
+		t.Errorf("expected trash directory removed, stat err = %v", err)
+	}
+	if trash, _ := svc.ListTrash(ctx); len(trash) != 0 {
+		t.Errorf("expected empty trash, got %+v", trash)
+	}
+	var uploads int
+	if err := svc.db.QueryRow(`SELECT COUNT(1) FROM uploads WHERE haul_id = ?`, haul.ID).Scan(&uploads); err != nil || uploads != 0 {
+		t.Errorf("expected the haul's uploads purged, got %d (%v)", uploads, err)
+	}
+}
+
+func TestRestoreHaulWithoutDirectory(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+
+	haul, err := svc.Create(ctx, "Gone", "")
+	if err != nil {
+		t.Fatalf("creating haul: %v", err)
+	}
+	if err := os.RemoveAll(filepath.Dir(haul.StoreDir)); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(ctx, haul.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+	if trashed, err := svc.getTrashed(ctx, haul.ID); err != nil || trashed.trashDir != "" {
+		t.Fatalf("expected no trash directory recorded, got %+v (%v)", trashed, err)
+	}
+
+	if _, err := svc.Restore(ctx, haul.ID); err != nil {
+		t.Fatalf("restoring haul: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(haul.StoreDir, "oci-layout")); err != nil {
+		t.Errorf("expected an empty store to be recreated: %v", err)
+	}
+}
+
+func TestEnsureDefaultAfterTrashingLastHaul(t *testing.T) {
+	svc := setupTestService(t, 24*time.Hour)
+	ctx := context.Background()
+
+	first, err := svc.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("creating default haul: %v", err)
+	}
+	if err := svc.Delete(ctx, first.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+	second, err := svc.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("expected a new default haul while the old one is in the trash: %v", err)
+	}
+	if second.ID == first.ID || second.Name != "Default 2" {
+		t.Errorf("unexpected default haul %d %q", second.ID, second.Name)
+	}
+	if again, err := svc.EnsureDefault(ctx); err != nil || again.ID != second.ID {
+		t.Errorf("expected the new default haul to be reused, got %+v, %v", again, err)
+	}
+}
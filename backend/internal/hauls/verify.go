@@ -0,0 +1,24 @@
+package hauls
+
+import (
+	"context"
+	"time"
+)
+
+// Verification summarizes a store integrity check. The full report is the
+// result of the verify job.
+type Verification struct {
+	At       time.Time `json:"at"`
+	OK       bool      `json:"ok"`
+	Problems int       `json:"problems"`
+	JobID    int64     `json:"jobId"`
+}
+
+// RecordVerification stores the outcome of a haul's latest integrity check.
+func (s *Service) RecordVerification(ctx context.Context, id int64, v Verification) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE hauls SET verified_at = ?, verify_ok = ?, verify_problems = ?, verify_job_id = ?
+		WHERE id = ?`,
+		v.At.UTC(), v.OK, v.Problems, v.JobID, id)
+	return err
+}
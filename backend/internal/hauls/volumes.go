@@ -0,0 +1,335 @@
+package hauls
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/config"
+)
+
+// MinVolumeSize is the smallest volume an archive may be split into.
+const MinVolumeSize = 1 << 20
+
+// volumePresets name common media limits. FAT32 cannot hold a file of 4 GiB
+// or more; a 25 GB Blu-ray keeps some room for the filesystem and index.
+var volumePresets = map[string]int64{
+	"fat32": 1<<32 - 1,
+	"bd25":  24_000_000_000,
+}
+
+// VolumeIndex describes an archive split into numbered volumes for transfer
+// media with a file or disc size limit. It is written beside the volumes as
+// <archive>.volumes.json.
+type VolumeIndex struct {
+	Archive    string    `json:"archive"`
+	Size       int64     `json:"size"`
+	SHA256     string    `json:"sha256"`
+	VolumeSize int64     `json:"volumeSize"`
+	Volumes    []Volume  `json:"volumes"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// Volume is one part of a split archive.
+type Volume struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// VolumeIndexName is the index file of an archive's volume set.
+func VolumeIndexName(archive string) string { return archive + ".volumes.json" }
+
+// VolumeName is the n'th (1-based) volume of an archive.
+func VolumeName(archive string, n int) string { return fmt.Sprintf("%s.%03d", archive, n) }
+
+// ParseVolumeSize parses a volume size such as "4095M" or "25G", or one of the
+// presets "fat32" and "bd25".
+func ParseVolumeSize(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	n, ok := volumePresets[strings.ToLower(v)]
+	if !ok {
+		n = config.ParseBytes(v)
+	}
+	if n < MinVolumeSize {
+		return 0, fmt.Errorf("invalid volume size %q (at least 1M, or fat32 / bd25)", v)
+	}
+	return n, nil
+}
+
+// SplitArchive splits the archive at path into volumes of volumeSize bytes
+// beside it and writes their index; sum is the archive's sha256, or "" to
+// compute it. Volumes are cut from the end of the archive, truncating it as
+// it goes, so the split needs at most one volume of extra space. The
+// directory's SHA256SUMS then lists the volumes instead of the archive. If
+// the split fails, the volumes cut so far are joined back onto the archive,
+// leaving it and SHA256SUMS as they were.
+func SplitArchive(path string, volumeSize int64, sum string) (*VolumeIndex, error) {
+	if volumeSize < MinVolumeSize {
+		return nil, fmt.Errorf("volume size %d is below the minimum of %d", volumeSize, int64(MinVolumeSize))
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if sum == "" {
+		if sum, _, err = FileSHA256(path); err != nil {
+			return nil, err
+		}
+	}
+	dir, archive := filepath.Dir(path), filepath.Base(path)
+	count := int((info.Size() + volumeSize - 1) / volumeSize)
+	if count == 0 {
+		count = 1
+	}
+	idx := &VolumeIndex{
+		Archive: archive, Size: info.Size(), SHA256: sum, VolumeSize: volumeSize,
+		Volumes: make([]Volume, count), CreatedAt: time.Now().UTC(),
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Volumes cut..count have been cut off the archive.
+	cut := count + 1
+	fail := func(err error) (*VolumeIndex, error) {
+		f.Close()
+		if rerr := rejoinVolumes(path, archive, cut, count); rerr != nil {
+			return nil, fmt.Errorf("%w; restoring the archive from its volumes also failed: %v", err, rerr)
+		}
+		return nil, err
+	}
+	end := info.Size()
+	for n := count; n > 1; n-- {
+		start := int64(n-1) * volumeSize
+		volPath := filepath.Join(dir, VolumeName(archive, n))
+		v, err := writeVolume(volPath, io.NewSectionReader(f, start, end-start))
+		if err != nil {
+			return fail(err)
+		}
+		idx.Volumes[n-1] = *v
+		if err := f.Truncate(start); err != nil {
+			os.Remove(volPath)
+			return fail(err)
+		}
+		cut, end = n, start
+	}
+	if err := f.Close(); err != nil {
+		return fail(err)
+	}
+	first := filepath.Join(dir, VolumeName(archive, 1))
+	firstSum, _, err := FileSHA256(path)
+	if err != nil {
+		return fail(err)
+	}
+	idx.Volumes[0] = Volume{Name: filepath.Base(first), Size: end, SHA256: firstSum}
+	if err := WriteVolumeIndex(dir, idx); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(path, first); err != nil {
+		os.Remove(filepath.Join(dir, VolumeIndexName(archive)))
+		return fail(err)
+	}
+
+	// SHA256SUMS changes last; if that fails, put it and the archive back.
+	err = WriteChecksum(dir, archive, "")
+	for _, v := range idx.Volumes {
+		if err == nil {
+			err = WriteChecksum(dir, v.Name, v.SHA256)
+		}
+	}
+	if err != nil {
+		for _, v := range idx.Volumes {
+			_ = WriteChecksum(dir, v.Name, "")
+		}
+		_ = WriteChecksum(dir, archive, sum)
+		os.Remove(filepath.Join(dir, VolumeIndexName(archive)))
+		if rerr := os.Rename(first, path); rerr != nil {
+			return nil, fmt.Errorf("%w; restoring the archive also failed: %v", err, rerr)
+		}
+		return fail(err)
+	}
+	return idx, nil
+}
+
+// rejoinVolumes appends volumes from..to of an archive back onto its
+// truncated first part at path, removing each once it is appended so the
+// rejoin needs at most one volume of extra space.
+func rejoinVolumes(path, archive string, from, to int) error {
+	dir := filepath.Dir(path)
+	for n := from; n <= to; n++ {
+		volPath := filepath.Join(dir, VolumeName(archive, n))
+		if err := appendFile(path, volPath); err != nil {
+			return err
+		}
+		if err := os.Remove(volPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendFile appends the contents of src to dst.
+func appendFile(dst, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeVolume copies r to a new volume file, hashing it on the way.
+func writeVolume(path string, r io.Reader) (*Volume, error) {
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+	return &Volume{Name: filepath.Base(path), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// WriteVolumeIndex writes idx as its archive's volume index in dir.
+func WriteVolumeIndex(dir string, idx *VolumeIndex) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, VolumeIndexName(idx.Archive)), data, 0644)
+}
+
+// ParseVolumeIndex parses a volume index and checks that its names are safe
+// and follow the volume naming scheme.
+func ParseVolumeIndex(data []byte) (*VolumeIndex, error) {
+	var idx VolumeIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parsing volume index: %w", err)
+	}
+	if !safeArchiveName(idx.Archive) {
+		return nil, fmt.Errorf("volume index names an invalid archive %q", idx.Archive)
+	}
+	if len(idx.Volumes) == 0 {
+		return nil, fmt.Errorf("volume index lists no volumes")
+	}
+	var total int64
+	for i, v := range idx.Volumes {
+		if v.Name != VolumeName(idx.Archive, i+1) {
+			return nil, fmt.Errorf("volume %d is named %q, expected %q", i+1, v.Name, VolumeName(idx.Archive, i+1))
+		}
+		total += v.Size
+	}
+	if total != idx.Size {
+		return nil, fmt.Errorf("volumes add up to %d bytes, index says %d", total, idx.Size)
+	}
+	return &idx, nil
+}
+
+// ReadVolumeIndex reads an archive's volume index from dir.
+func ReadVolumeIndex(dir, archive string) (*VolumeIndex, error) {
+	data, err := os.ReadFile(filepath.Join(dir, VolumeIndexName(archive)))
+	if err != nil {
+		return nil, err
+	}
+	return ParseVolumeIndex(data)
+}
+
+// OpenVolumes returns the reassembled archive as a stream over its volumes in
+// dir. Each volume's size and sha256, and the whole archive's sha256, are
+// checked as the stream passes them; a mismatch is returned as a read error,
+// at the latest in place of the final io.EOF.
+func OpenVolumes(dir string, idx *VolumeIndex) io.ReadCloser {
+	return &volumeReader{dir: dir, idx: idx, whole: sha256.New()}
+}
+
+type volumeReader struct {
+	dir   string
+	idx   *VolumeIndex
+	next  int
+	cur   *os.File
+	read  int64
+	part  hash.Hash
+	whole hash.Hash
+}
+
+func (v *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if v.cur == nil {
+			if v.next == len(v.idx.Volumes) {
+				if got := hex.EncodeToString(v.whole.Sum(nil)); got != v.idx.SHA256 {
+					return 0, fmt.Errorf("reassembled %s hashes to %s, expected %s", v.idx.Archive, got, v.idx.SHA256)
+				}
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(v.dir, v.idx.Volumes[v.next].Name))
+			if err != nil {
+				return 0, err
+			}
+			v.cur, v.read, v.part = f, 0, sha256.New()
+		}
+		n, err := v.cur.Read(p)
+		v.read += int64(n)
+		v.part.Write(p[:n])
+		v.whole.Write(p[:n])
+		if err == io.EOF {
+			vol := v.idx.Volumes[v.next]
+			v.cur.Close()
+			v.cur = nil
+			v.next++
+			if v.read != vol.Size {
+				return n, fmt.Errorf("volume %s is %d bytes, expected %d", vol.Name, v.read, vol.Size)
+			}
+			if got := hex.EncodeToString(v.part.Sum(nil)); got != vol.SHA256 {
+				return n, fmt.Errorf("volume %s hashes to %s, expected %s", vol.Name, got, vol.SHA256)
+			}
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (v *volumeReader) Close() error {
+	if v.cur != nil {
+		return v.cur.Close()
+	}
+	return nil
+}
+
+// removeVolumes deletes an archive's volumes and index.
+func removeVolumes(dir string, idx *VolumeIndex) error {
+	for _, v := range idx.Volumes {
+		if err := os.Remove(filepath.Join(dir, v.Name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := WriteChecksum(dir, v.Name, ""); err != nil {
+			return err
+		}
+	}
+	return os.Remove(filepath.Join(dir, VolumeIndexName(idx.Archive)))
+}
@@ -0,0 +1,116 @@
+package hauls
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitArchiveRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "release.tar.zst")
+	data := make([]byte, 2*MinVolumeSize+123)
+	_, _ = rand.Read(data)
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	idx, err := SplitArchive(archive, MinVolumeSize, "")
+	if err != nil {
+		t.Fatalf("SplitArchive: %v", err)
+	}
+	if len(idx.Volumes) != 3 || idx.Volumes[2].Size != 123 || idx.Size != int64(len(data)) {
+		t.Fatalf("unexpected volumes %+v", idx.Volumes)
+	}
+	if _, err := os.Stat(archive); !os.IsNotExist(err) {
+		t.Error("expected the archive to be replaced by its volumes")
+	}
+	sums, _ := os.ReadFile(filepath.Join(dir, ChecksumFile))
+	if strings.Count(string(sums), "\n") != 3 || strings.Contains(string(sums), "release.tar.zst\n") {
+		t.Errorf("expected SHA256SUMS to list the volumes only, got %q", sums)
+	}
+
+	read, err := ReadVolumeIndex(dir, "release.tar.zst")
+	if err != nil {
+		t.Fatalf("ReadVolumeIndex: %v", err)
+	}
+	rc := OpenVolumes(dir, read)
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("reassembly failed: %v (%d bytes)", err, len(got))
+	}
+
+	// Damage the middle volume.
+	f, _ := os.OpenFile(filepath.Join(dir, VolumeName("release.tar.zst", 2)), os.O_WRONLY, 0)
+	_, _ = f.WriteAt([]byte{data[MinVolumeSize] ^ 0xff}, 0)
+	f.Close()
+	rc = OpenVolumes(dir, read)
+	_, err = io.ReadAll(rc)
+	rc.Close()
+	if err == nil || !strings.Contains(err.Error(), VolumeName("release.tar.zst", 2)) {
+		t.Errorf("expected the damaged volume to be named, got %v", err)
+	}
+
+	if err := removeArchive(dir, "release.tar.zst"); err != nil {
+		t.Fatalf("removeArchive: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if e.Name() != ChecksumFile {
+			t.Errorf("expected %s to be removed with the volume set", e.Name())
+		}
+	}
+}
+
+func TestSplitArchiveFailureRestoresArchive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "release.tar.zst")
+	data := make([]byte, 2*MinVolumeSize+123)
+	_, _ = rand.Read(data)
+	if err := os.WriteFile(archive, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteChecksum(dir, "release.tar.zst", "feed"); err != nil {
+		t.Fatal(err)
+	}
+	sums, _ := os.ReadFile(filepath.Join(dir, ChecksumFile))
+
+	// The third volume is cut first; a directory in the second volume's place
+	// makes the split fail after the archive has been truncated.
+	if err := os.Mkdir(filepath.Join(dir, VolumeName("release.tar.zst", 2)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SplitArchive(archive, MinVolumeSize, ""); err == nil {
+		t.Fatal("expected the split to fail")
+	}
+	got, err := os.ReadFile(archive)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("expected the archive to be restored whole: %v (%d bytes)", err, len(got))
+	}
+	for _, name := range []string{VolumeName("release.tar.zst", 3), VolumeIndexName("release.tar.zst")} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be gone, stat err = %v", name, err)
+		}
+	}
+	if after, _ := os.ReadFile(filepath.Join(dir, ChecksumFile)); !bytes.Equal(after, sums) {
+		t.Errorf("expected SHA256SUMS unchanged, got %q", after)
+	}
+}
+
+func TestParseVolumeSize(t *testing.T) {
+	for in, want := range map[string]int64{"fat32": 1<<32 - 1, "BD25": 24_000_000_000, "4095M": 4095 << 20} {
+		if got, err := ParseVolumeSize(in); err != nil || got != want {
+			t.Errorf("ParseVolumeSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "10K", "lots"} {
+		if _, err := ParseVolumeSize(in); err == nil {
+			t.Errorf("expected %q to be rejected", in)
+		}
+	}
+}
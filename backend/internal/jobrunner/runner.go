@@ -52,11 +52,54 @@ type LogEntry struct {
 type Runner struct {
 	db *sql.DB
 	mu sync.Mutex
+
+	// cancels holds the cancel func of every job currently executing, so a
+	// running job can be stopped (e.g. when it crosses a haul quota).
+	cancelMu sync.Mutex
+	cancels  map[int64]context.CancelFunc
+
+	tasksMu sync.RWMutex
+	tasks   map[string]Task
 }
 
+// Task is a job implemented in-process instead of as an external command. It
+// writes progress through logf and returns the job's result (usually JSON).
+// A returned error fails the job; ctx is cancelled when the job is cancelled.
+type Task func(ctx context.Context, job *Job, logf func(format string, args ...interface{})) (string, error)
+
 // New creates a new job runner
 func New(db *sql.DB) *Runner {
-	return &Runner{db: db}
+	return &Runner{db: db, cancels: make(map[int64]context.CancelFunc), tasks: make(map[string]Task)}
+}
+
+// RegisterTask makes jobs whose command is name run task in-process. Such jobs
+// are queued, listed, logged and cancelled like any other.
+func (r *Runner) RegisterTask(name string, task Task) {
+	r.tasksMu.Lock()
+	defer r.tasksMu.Unlock()
+	r.tasks[name] = task
+}
+
+func (r *Runner) task(name string) (Task, bool) {
+	r.tasksMu.RLock()
+	defer r.tasksMu.RUnlock()
+	t, ok := r.tasks[name]
+	return t, ok
+}
+
+// Cancel stops a running job, recording reason in its log. The job is then
+// marked failed by the normal completion path. Returns an error if the job
+// is not currently executing in this process.
+func (r *Runner) Cancel(ctx context.Context, jobID int64, reason string) error {
+	r.cancelMu.Lock()
+	cancel, ok := r.cancels[jobID]
+	r.cancelMu.Unlock()
+	if !ok {
+		return fmt.Errorf("job %d is not running", jobID)
+	}
+	_ = r.appendLog(ctx, jobID, "stderr", "[cancelled] "+reason)
+	cancel()
+	return nil
 }
 
 // DB returns the underlying database connection
@@ -112,6 +155,11 @@ func (r *Runner) Start(ctx context.Context, jobID int64) error {
 		return fmt.Errorf("updating status to running: %w", err)
 	}
 
+	if task, ok := r.task(job.Command); ok {
+		r.startTask(ctx, job, task)
+		return nil
+	}
+
 	// Build environment - start with current env and add overrides
 	baseEnv := buildEnv(job.EnvOverrides)
 
@@ -123,36 +171,49 @@ func (r *Runner) Start(ctx context.Context, jobID int64) error {
 		env = baseEnv
 	}
 
-	// Create command
-	cmd := exec.CommandContext(ctx, job.Command, job.Args...)
+	// Create command. It runs under its own cancelable context so Cancel can
+	// stop it; status updates keep using ctx so they land after a cancel.
+	jobCtx, cancel := context.WithCancel(ctx)
+	cmd := exec.CommandContext(jobCtx, job.Command, job.Args...)
 	cmd.Env = env
 	cmd.Dir = "/data"
 
 	// Get pipes for stdout and stderr
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
+		cancel()
 		return fmt.Errorf("creating stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
+		cancel()
 		return fmt.Errorf("creating stderr pipe: %w", err)
 	}
 
 	// Start the command
 	if err := cmd.Start(); err != nil {
+		cancel()
 		completedAt := time.Now()
 		exitCode := -1
 		_ = r.updateStatus(ctx, jobID, StatusFailed, &now, &completedAt, &exitCode)
 		return fmt.Errorf("starting command: %w", err)
 	}
 
+	r.cancelMu.Lock()
+	r.cancels[jobID] = cancel
+	r.cancelMu.Unlock()
+
 	// Use a WaitGroup to ensure goroutines complete before returning
 	done := make(chan struct{})
 
 	// Wait for command to finish in goroutine
 	go func() {
 		r.monitorCompletion(ctx, jobID, cmd)
+		r.cancelMu.Lock()
+		delete(r.cancels, jobID)
+		r.cancelMu.Unlock()
+		cancel()
 		close(done)
 	}()
 
@@ -165,6 +226,39 @@ func (r *Runner) Start(ctx context.Context, jobID int64) error {
 	return nil
 }
 
+// startTask runs an in-process task in the background and records its outcome
+// the same way monitorCompletion does for commands.
+func (r *Runner) startTask(ctx context.Context, job *Job, task Task) {
+	jobCtx, cancel := context.WithCancel(ctx)
+	r.cancelMu.Lock()
+	r.cancels[job.ID] = cancel
+	r.cancelMu.Unlock()
+
+	go func() {
+		defer func() {
+			r.cancelMu.Lock()
+			delete(r.cancels, job.ID)
+			r.cancelMu.Unlock()
+			cancel()
+		}()
+
+		logf := func(format string, args ...interface{}) {
+			if err := r.appendLog(ctx, job.ID, "stdout", fmt.Sprintf(format, args...)); err != nil {
+				fmt.Printf("Error appending log: %v\n", err)
+			}
+		}
+		result, err := task(jobCtx, job, logf)
+
+		completedAt := time.Now()
+		status, code := StatusSucceeded, 0
+		if err != nil {
+			_ = r.appendLog(ctx, job.ID, "stderr", "Error: "+err.Error())
+			status, code = StatusFailed, 1
+		}
+		_ = r.updateStatusWithResult(ctx, job.ID, status, nil, &completedAt, &code, result)
+	}()
+}
+
 // monitorCompletion waits for the command to finish and updates the job status
 func (r *Runner) monitorCompletion(ctx context.Context, jobID int64, cmd *exec.Cmd) {
 	err := cmd.Wait()
@@ -297,6 +391,17 @@ func (r *Runner) updateStatusWithResult(ctx context.Context, jobID int64, status
 	return err
 }
 
+// Fail marks a job that already finished as failed, recording reason in its
+// log and result as its result, for when work done after the command (such
+// as post-processing its output) fails.
+func (r *Runner) Fail(ctx context.Context, jobID int64, reason, result string) error {
+	if err := r.appendLog(ctx, jobID, "stderr", "Error: "+reason); err != nil {
+		return err
+	}
+	code := 1
+	return r.updateStatusWithResult(ctx, jobID, StatusFailed, nil, nil, &code, result)
+}
+
 // UpdateResult updates just the result field for a job
 func (r *Runner) UpdateResult(ctx context.Context, jobID int64, result string) error {
 	r.mu.Lock()
@@ -408,3 +408,112 @@ func TestGetLogsWithSince(t *testing.T) {
 		t.Errorf("expected partial logs (%d) <= all logs (%d)", len(partialLogs), len(allLogs))
 	}
 }
+
+func TestCancelRunningJob(t *testing.T) {
+	db := setupTestDB(t)
+	runner := New(db)
+
+	ctx := context.Background()
+
+	sleepPath, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep command not found")
+	}
+
+	job, err := runner.CreateJob(ctx, sleepPath, []string{"30"}, nil)
+	if err != nil {
+		t.Fatalf("CreateJob failed: %v", err)
+	}
+	if err := runner.Start(ctx, job.ID); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := runner.Cancel(ctx, job.ID, "quota exceeded"); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("timeout waiting for cancelled job to stop")
+		case <-ticker.C:
+			j, err := runner.GetJob(ctx, job.ID)
+			if err != nil {
+				t.Fatalf("GetJob failed: %v", err)
+			}
+			if j.Status != StatusFailed {
+				continue
+			}
+			logs, err := runner.GetLogs(ctx, job.ID, nil)
+			if err != nil {
+				t.Fatalf("GetLogs failed: %v", err)
+			}
+			found := false
+			for _, l := range logs {
+				if strings.Contains(l.Content, "quota exceeded") {
+					found = true
+				}
+			}
+			if !found {
+				t.Error("expected cancel reason in job logs")
+			}
+			if err := runner.Cancel(ctx, job.ID, "again"); err == nil {
+				t.Error("expected cancelling a finished job to fail")
+			}
+			return
+		}
+	}
+}
+
+func TestTaskJob(t *testing.T) {
+	db := setupTestDB(t)
+	runner := New(db)
+
+	ctx := context.Background()
+
+	runner.RegisterTask("count", func(ctx context.Context, job *Job, logf func(string, ...interface{})) (string, error) {
+		logf("counting %d args", len(job.Args))
+		return `{"count":2}`, nil
+	})
+
+	job, err := runner.CreateJob(ctx, "count", []string{"a", "b"}, nil)
+	if err != nil {
+		t.Fatalf("CreateJob failed: %v", err)
+	}
+	if err := runner.Start(ctx, job.ID); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("timeout waiting for task to finish")
+		case <-ticker.C:
+			j, err := runner.GetJob(ctx, job.ID)
+			if err != nil {
+				t.Fatalf("GetJob failed: %v", err)
+			}
+			if j.Status == StatusRunning || j.Status == StatusQueued {
+				continue
+			}
+			if j.Status != StatusSucceeded || j.ExitCode == nil || *j.ExitCode != 0 {
+				t.Fatalf("expected task to succeed, got %s", j.Status)
+			}
+			if j.Result.String != `{"count":2}` {
+				t.Errorf("unexpected result %q", j.Result.String)
+			}
+			logs, _ := runner.GetLogs(ctx, job.ID, nil)
+			if len(logs) != 1 || logs[0].Content != "counting 2 args" {
+				t.Errorf("unexpected logs %+v", logs)
+			}
+			return
+		}
+	}
+}
@@ -43,6 +43,20 @@ func (h *Handler) resolveHaulID(ctx context.Context, haulID int64) (int64, error
 	return haul.ID, nil
 }
 
+// writable rejects edits to manifests of a frozen haul, writing a 409 and
+// returning false in that case.
+func (h *Handler) writable(w http.ResponseWriter, r *http.Request, haulID int64) bool {
+	haul, err := h.hauls.Get(r.Context(), haulID)
+	if err != nil {
+		return true // missing hauls are reported by the caller
+	}
+	if err := haul.Writable(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
 // Manifest represents a saved manifest
 type Manifest struct {
 	ID          int64     `json:"id"`
@@ -187,6 +201,9 @@ func (h *Handler) CreateManifest(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, r, haulID) {
+		return
+	}
 
 	// Encode tags as JSON
 	tagsJSON := "[]"
@@ -271,6 +288,10 @@ func (h *Handler) UpdateManifest(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if existing, err := h.getManifestByID(id); err == nil && !h.writable(w, r, existing.HaulID) {
+		return
+	}
+
 	// Check for duplicate name within the same haul (if name changed)
 	var existingID int64
 	err = h.db.QueryRow(`
@@ -322,6 +343,10 @@ func (h *Handler) DeleteManifest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if existing, err := h.getManifestByID(id); err == nil && !h.writable(w, r, existing.HaulID) {
+		return
+	}
+
 	result, err := h.db.Exec("DELETE FROM saved_manifests WHERE id = ?", id)
 	if err != nil {
 		log.Printf("Error deleting manifest: %v", err)
@@ -0,0 +1,153 @@
+package ocistore
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxMemBlob is the largest blob kept in memory while scanning an archive.
+// Manifests, indexes and configs are far smaller; layers are only sized.
+const maxMemBlob = 1 << 20
+
+// ReadArchive scans a hauler archive (a zstd-compressed tar of an OCI layout)
+// in one streaming pass and returns its parsed store. Only JSON blobs small
+// enough to be manifests or configs are kept; the returned Store has no
+// directory, so BlobPath and Files' downloads are not usable on it.
+func ReadArchive(r io.Reader) (*Store, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("opening zstd stream: %w", err)
+	}
+	defer zr.Close()
+
+	s := &Store{Artifacts: []Artifact{}, mem: map[string][]byte{}}
+	var index []byte
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := layoutPath(hdr.Name)
+		switch {
+		case name == "index.json":
+			if index, err = io.ReadAll(io.LimitReader(tr, 64<<20)); err != nil {
+				return nil, fmt.Errorf("reading index.json: %w", err)
+			}
+		case strings.HasPrefix(name, "blobs/") && hdr.Size <= maxMemBlob:
+			algo, hex, ok := strings.Cut(strings.TrimPrefix(name, "blobs/"), "/")
+			if !ok {
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return nil, fmt.Errorf("reading %s: %w", name, err)
+			}
+			if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+				s.mem[algo+":"+hex] = data
+			}
+		}
+	}
+	if index == nil {
+		return nil, fmt.Errorf("archive has no index.json")
+	}
+	if err := s.load(index); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// layoutPath normalizes a tar entry name to a path inside the OCI layout,
+// tolerating a leading "./" or a single wrapping directory.
+func layoutPath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if first, rest, ok := strings.Cut(name, "/"); ok && first != "blobs" {
+		if rest == "index.json" || strings.HasPrefix(rest, "blobs/") {
+			return rest
+		}
+	}
+	return name
+}
+
+// maxCachedArchives bounds how many scanned archives LoadArchive keeps; the
+// least recently used is dropped first.
+const maxCachedArchives = 32
+
+// archiveEntry is a scanned archive plus the file state it was read from.
+type archiveEntry struct {
+	store    *Store
+	modTime  time.Time
+	size     int64
+	lastUsed time.Time
+}
+
+var archiveCache = struct {
+	mu      sync.Mutex
+	entries map[string]*archiveEntry
+}{entries: map[string]*archiveEntry{}}
+
+// LoadArchive returns the parsed contents of the archive at file, reusing an
+// earlier scan while the file's mtime and size are unchanged.
+func LoadArchive(file string) (*Store, error) {
+	key := filepath.Clean(file)
+	info, err := os.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveCache.mu.Lock()
+	e, ok := archiveCache.entries[key]
+	if ok && info.ModTime().Equal(e.modTime) && info.Size() == e.size {
+		e.lastUsed = time.Now()
+		archiveCache.mu.Unlock()
+		return e.store, nil
+	}
+	archiveCache.mu.Unlock()
+
+	f, err := os.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s, err := ReadArchive(f)
+	if err != nil {
+		return nil, err
+	}
+	archiveCache.mu.Lock()
+	archiveCache.entries[key] = &archiveEntry{store: s, modTime: info.ModTime(), size: info.Size(), lastUsed: time.Now()}
+	for len(archiveCache.entries) > maxCachedArchives {
+		oldest := ""
+		for k, e := range archiveCache.entries {
+			if oldest == "" || e.lastUsed.Before(archiveCache.entries[oldest].lastUsed) {
+				oldest = k
+			}
+		}
+		delete(archiveCache.entries, oldest)
+	}
+	archiveCache.mu.Unlock()
+	return s, nil
+}
+
+// ForgetArchive drops the cached scan of an archive, e.g. once it is deleted.
+func ForgetArchive(file string) {
+	archiveCache.mu.Lock()
+	delete(archiveCache.entries, filepath.Clean(file))
+	archiveCache.mu.Unlock()
+}
@@ -0,0 +1,200 @@
+package ocistore
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// archiveLayout writes the layout in dir as a hauler-style .tar.zst.
+func archiveLayout(t *testing.T, dir, file string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, _ := zstd.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: "./" + filepath.ToSlash(rel), Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadArchiveListsArtifacts(t *testing.T) {
+	l := newLayout(t)
+	layer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", make([]byte, 2<<20)) // too big to keep in memory
+	amd := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`)), layer)
+	amd.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	arm := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"arm64"}`)), layer)
+	arm.Platform = &Platform{OS: "linux", Architecture: "arm64"}
+	multi := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd, arm}})
+	chart := l.manifest(l.blob(MediaTypeChartConfig, []byte(`{"name":"podinfo","version":"6.5.0"}`)),
+		l.blob(MediaTypeChartLayer, []byte("chart")))
+	l.writeIndex(named(multi, "docker.io/library/redis:7"), named(chart, "hauler/podinfo:6.5.0"))
+
+	file := filepath.Join(t.TempDir(), "haul.tar.zst")
+	archiveLayout(t, l.dir, file)
+
+	s, err := LoadArchive(file)
+	if err != nil {
+		t.Fatalf("LoadArchive: %v", err)
+	}
+	if len(s.Artifacts) != 2 {
+		t.Fatalf("expected 2 artifacts, got %+v", s.Artifacts)
+	}
+	redis := s.Artifacts[0]
+	if redis.Kind != KindImage || redis.Error != "" || len(redis.Platforms()) != 2 {
+		t.Errorf("unexpected image %+v", redis)
+	}
+	if redis.Size < layer.Size {
+		t.Errorf("expected the layer to be counted in the size, got %d", redis.Size)
+	}
+	if c := s.Artifacts[1]; c.Kind != KindChart || c.ChartName != "podinfo" {
+		t.Errorf("unexpected chart %+v", c)
+	}
+
+	if again, _ := LoadArchive(file); again != s {
+		t.Error("expected an unchanged archive to be served from cache")
+	}
+	future := time.Now().Add(2 * time.Second)
+	_ = os.Chtimes(file, future, future)
+	if again, _ := LoadArchive(file); again == s {
+		t.Error("expected a touched archive to be rescanned")
+	}
+}
+
+func TestLoadArchiveEvictsLeastRecentlyUsed(t *testing.T) {
+	l := newLayout(t)
+	img := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`)),
+		l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("layer")))
+	l.writeIndex(named(img, "docker.io/library/redis:7"))
+	dir := t.TempDir()
+	first := filepath.Join(dir, "0.tar.zst")
+	archiveLayout(t, l.dir, first)
+	data, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := LoadArchive(first)
+	if err != nil {
+		t.Fatalf("LoadArchive: %v", err)
+	}
+	for i := 1; i <= maxCachedArchives; i++ {
+		file := filepath.Join(dir, strconv.Itoa(i)+".tar.zst")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadArchive(file); err != nil {
+			t.Fatalf("LoadArchive %s: %v", file, err)
+		}
+	}
+
+	archiveCache.mu.Lock()
+	cached := len(archiveCache.entries)
+	archiveCache.mu.Unlock()
+	if cached > maxCachedArchives {
+		t.Errorf("expected at most %d cached archives, got %d", maxCachedArchives, cached)
+	}
+	if again, _ := LoadArchive(first); again == s {
+		t.Error("expected the least recently used archive to be evicted")
+	}
+}
+
+func TestReadArchiveRejectsNonArchives(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "bogus.tar.zst")
+	_ = os.WriteFile(file, []byte("not zstd"), 0644)
+	if _, err := LoadArchive(file); err == nil {
+		t.Error("expected an error for a file that is not a zstd tar")
+	}
+}
+
+func TestExtractArchiveMergesIntoStore(t *testing.T) {
+	l := newLayout(t)
+	img := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`)),
+		l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("layer")))
+	l.writeIndex(named(img, "docker.io/library/redis:7"))
+	file := filepath.Join(t.TempDir(), "haul.tar.zst")
+	archiveLayout(t, l.dir, file)
+
+	// The target already holds another image and an older redis:7.
+	dst := newLayout(t)
+	other := dst.manifest(dst.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"arm64"}`)))
+	old := dst.manifest(dst.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"s390x"}`)))
+	dst.writeIndex(named(other, "docker.io/library/nginx:1.25"), named(old, "docker.io/library/redis:7"))
+
+	extract := func() *ExtractStats {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		stats, err := ExtractArchive(context.Background(), f, dst.dir)
+		if err != nil {
+			t.Fatalf("ExtractArchive: %v", err)
+		}
+		return stats
+	}
+	if stats := extract(); stats.Blobs != 3 || stats.Manifests != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if stats := extract(); stats.Blobs != 0 || stats.Existing != 3 {
+		t.Errorf("expected a second extract to find every blob present, got %+v", stats)
+	}
+
+	s, err := Open(dst.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Artifacts) != 2 || s.Artifacts[1].Digest != img.Digest {
+		t.Errorf("expected redis:7 to be replaced in place, got %+v", s.Artifacts)
+	}
+}
+
+func TestExtractArchiveRejectsCorruptBlobs(t *testing.T) {
+	l := newLayout(t)
+	img := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{}`)))
+	l.writeIndex(named(img, "docker.io/library/redis:7"))
+	_ = os.WriteFile(filepath.Join(l.dir, "blobs", "sha256", strings.TrimPrefix(img.Digest, "sha256:")), []byte("tampered"), 0644)
+	file := filepath.Join(t.TempDir(), "haul.tar.zst")
+	archiveLayout(t, l.dir, file)
+
+	dst := t.TempDir()
+	f, _ := os.Open(file)
+	defer f.Close()
+	if _, err := ExtractArchive(context.Background(), f, dst); err == nil {
+		t.Fatal("expected a blob that does not match its digest to be refused")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "index.json")); !os.IsNotExist(err) {
+		t.Error("expected nothing to be merged after a failed extract")
+	}
+}
@@ -0,0 +1,144 @@
+package ocistore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Attachment is supply-chain metadata (an SBOM, signature or attestation)
+// to store beside the image it describes, following cosign's convention of
+// tagging it "<repo>:sha256-<hex>.<suffix>" and also naming the image as
+// the manifest's OCI subject.
+type Attachment struct {
+	Subject      Descriptor // the image manifest or index described
+	Repository   string     // the image's repository, e.g. docker.io/library/nginx
+	Suffix       string     // tag suffix: "sbom", "sig" or "att"
+	Kind         string     // AnnotationKind value, e.g. KindAnnotationSboms; empty for none
+	ArtifactType string
+	Layers       []AttachmentLayer
+}
+
+// AttachmentLayer is one layer of an attachment, stored as a blob.
+type AttachmentLayer struct {
+	MediaType   string
+	Data        []byte
+	Annotations map[string]string
+}
+
+// AttachmentTag returns the cosign-style tag of a suffix's attachment to the
+// manifest with the given digest, e.g. "sha256-<hex>.sbom".
+func AttachmentTag(digest, suffix string) string {
+	return strings.Replace(digest, ":", "-", 1) + "." + suffix
+}
+
+// Repository strips the tag or digest from an image reference.
+func Repository(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// Attach writes an attachment's blobs into the layout at dir and adds it to
+// index.json, replacing an earlier attachment with the same tag. It returns
+// the new index entry.
+func Attach(dir string, a Attachment) (Descriptor, error) {
+	layers := make([]Descriptor, 0, len(a.Layers))
+	diffIDs := make([]string, 0, len(a.Layers))
+	for _, l := range a.Layers {
+		d, err := putBlob(dir, l.MediaType, l.Data)
+		if err != nil {
+			return Descriptor{}, err
+		}
+		d.Annotations = l.Annotations
+		layers = append(layers, d)
+		diffIDs = append(diffIDs, d.Digest)
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"architecture": "", "os": "", "config": map[string]interface{}{},
+		"rootfs": map[string]interface{}{"type": "layers", "diff_ids": diffIDs},
+	})
+	if err != nil {
+		return Descriptor{}, err
+	}
+	configDesc, err := putBlob(dir, MediaTypeOCIConfig, config)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	subject := Descriptor{MediaType: a.Subject.MediaType, Digest: a.Subject.Digest, Size: a.Subject.Size}
+	manifest, err := json.Marshal(Manifest{
+		SchemaVersion: 2, MediaType: MediaTypeOCIManifest, ArtifactType: a.ArtifactType,
+		Config: configDesc, Layers: layers, Subject: &subject,
+	})
+	if err != nil {
+		return Descriptor{}, err
+	}
+	entry, err := putBlob(dir, MediaTypeOCIManifest, manifest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	tag := AttachmentTag(a.Subject.Digest, a.Suffix)
+	entry.ArtifactType = a.ArtifactType
+	entry.Annotations = map[string]string{
+		AnnotationContainerdName: a.Repository + ":" + tag,
+		AnnotationRefName:        tag,
+	}
+	if a.Kind != "" {
+		entry.Annotations[AnnotationKind] = a.Kind
+	}
+	if err := mergeIndex(dir, []Descriptor{entry}); err != nil {
+		return Descriptor{}, err
+	}
+	Invalidate(dir)
+	return entry, nil
+}
+
+// Attachments returns the signatures, attestations, SBOMs and referrers in
+// the store that describe a, or one of its platform manifests, in index
+// order.
+func (s *Store) Attachments(a *Artifact) []*Artifact {
+	var out []*Artifact
+	for i := range s.Artifacts {
+		b := &s.Artifacts[i]
+		if !b.Kind.Content() && b.Digest != a.Digest && attachedTo(b, a) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// blobDescriptor describes data as a sha256 blob.
+func blobDescriptor(mediaType string, data []byte) Descriptor {
+	sum := sha256.Sum256(data)
+	return Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+}
+
+// putBlob stores data as a sha256 blob in the layout at dir.
+func putBlob(dir, mediaType string, data []byte) (Descriptor, error) {
+	d := blobDescriptor(mediaType, data)
+	path := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(d.Digest, "sha256:"))
+	if info, err := os.Stat(path); err == nil && info.Size() == d.Size {
+		return d, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Descriptor{}, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".attach-*")
+	if err != nil {
+		return Descriptor{}, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return Descriptor{}, err
+	}
+	return d, os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,54 @@
+package ocistore
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a parsed store plus the index.json state it was read from.
+type cacheEntry struct {
+	store   *Store
+	modTime time.Time
+	size    int64
+}
+
+var cache = struct {
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+}{entries: map[string]*cacheEntry{}}
+
+// Load returns the parsed store in dir, reusing a cached parse while
+// index.json is unchanged. Callers that change blobs without rewriting
+// index.json must call Invalidate. The returned Store must not be modified.
+func Load(dir string) (*Store, error) {
+	key := filepath.Clean(dir)
+	info, statErr := os.Stat(filepath.Join(key, "index.json"))
+
+	cache.mu.Lock()
+	e, ok := cache.entries[key]
+	cache.mu.Unlock()
+	if ok && statErr == nil && info.ModTime().Equal(e.modTime) && info.Size() == e.size {
+		return e.store, nil
+	}
+
+	s, err := Open(key)
+	if err != nil {
+		return nil, err
+	}
+	if statErr == nil {
+		cache.mu.Lock()
+		cache.entries[key] = &cacheEntry{store: s, modTime: info.ModTime(), size: info.Size()}
+		cache.mu.Unlock()
+	}
+	return s, nil
+}
+
+// Invalidate drops the cached parse of the store in dir. Store-mutating code
+// calls it once a mutation completes.
+func Invalidate(dir string) {
+	cache.mu.Lock()
+	delete(cache.entries, filepath.Clean(dir))
+	cache.mu.Unlock()
+}
@@ -0,0 +1,193 @@
+package ocistore
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DeltaFile is the entry that marks an archive as a delta. It is written
+// first so a reader can tell a delta from a full archive cheaply.
+const DeltaFile = "hauler-ui-delta.json"
+
+// Delta describes a delta archive: the full index.json and every manifest of
+// its source store, but only the blobs its baseline did not already have.
+// Omitted lists those left out; the receiving store must hold every one of
+// them for the delta to apply.
+type Delta struct {
+	Baseline     string           `json:"baseline"`
+	CreatedAt    time.Time        `json:"createdAt"`
+	Manifests    int              `json:"manifests"` // manifests and indexes, always included
+	Blobs        int              `json:"blobs"`     // blobs included, manifests among them
+	Bytes        int64            `json:"bytes"`     // bytes included
+	OmittedBlobs int              `json:"omittedBlobs"`
+	OmittedBytes int64            `json:"omittedBytes"`
+	Omitted      map[string]int64 `json:"omitted"` // digest to size
+}
+
+// DeltaIncompleteError is returned when a delta is applied to a store that
+// lacks blobs the delta omitted.
+type DeltaIncompleteError struct {
+	Baseline string
+	Missing  []string
+}
+
+func (e *DeltaIncompleteError) Error() string {
+	return fmt.Sprintf("delta is incomplete for this store: %d blob(s) from baseline %q are missing, e.g. %s",
+		len(e.Missing), e.Baseline, e.Missing[0])
+}
+
+// WriteDelta writes the store as a delta archive (zstd tar of an OCI layout)
+// to w, leaving out every blob in baseline except manifests and indexes,
+// which are always included so the archive can be listed and its index
+// resolved. label names the baseline in the archive's delta record.
+func (s *Store) WriteDelta(ctx context.Context, w io.Writer, baseline map[string]int64, label string) (*Delta, error) {
+	type blob struct {
+		digest string
+		size   int64
+	}
+	var include []blob
+	delta := &Delta{Baseline: label, CreatedAt: time.Now().UTC(), Omitted: map[string]int64{}}
+	var walkErr error
+	s.walkRefs(s.Index.Manifests, func(d Descriptor, from string) bool {
+		if walkErr != nil || !ValidDigest(d.Digest) {
+			return false
+		}
+		info, err := os.Stat(s.BlobPath(d.Digest))
+		if err != nil {
+			// Skipped platforms are referenced but absent.
+			return false
+		}
+		structural := from == "index.json" || IsIndex(d.MediaType) || isManifest(d.MediaType) ||
+			(d.MediaType == "" && info.Size() <= maxMemBlob)
+		if _, ok := baseline[d.Digest]; ok && !structural {
+			delta.Omitted[d.Digest] = info.Size()
+			delta.OmittedBytes += info.Size()
+			return true
+		}
+		if structural {
+			delta.Manifests++
+		}
+		include = append(include, blob{d.Digest, info.Size()})
+		delta.Bytes += info.Size()
+		return true
+	}, func(d Descriptor, err error) {
+		walkErr = fmt.Errorf("reading %s: %w", d.Digest, err)
+	})
+	if walkErr != nil {
+		return nil, walkErr
+	}
+	delta.Blobs = len(include)
+	delta.OmittedBlobs = len(delta.Omitted)
+	sort.Slice(include, func(i, j int) bool { return include[i].digest < include[j].digest })
+
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return nil, err
+	}
+	tw := tar.NewWriter(zw)
+	put := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: delta.CreatedAt, Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	record, err := json.Marshal(delta)
+	if err != nil {
+		return nil, err
+	}
+	index, err := json.Marshal(s.Index)
+	if err != nil {
+		return nil, err
+	}
+	if err := put(DeltaFile, record); err != nil {
+		return nil, err
+	}
+	if err := put("oci-layout", []byte(`{"imageLayoutVersion":"1.0.0"}`)); err != nil {
+		return nil, err
+	}
+	if err := put("index.json", index); err != nil {
+		return nil, err
+	}
+	for _, b := range include {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		algo, hex, _ := strings.Cut(b.digest, ":")
+		f, err := os.Open(s.BlobPath(b.digest))
+		if err != nil {
+			return nil, err
+		}
+		err = tw.WriteHeader(&tar.Header{Name: "blobs/" + algo + "/" + hex, Mode: 0644, Size: b.size, ModTime: delta.CreatedAt, Typeflag: tar.TypeReg})
+		if err == nil {
+			_, err = io.Copy(tw, f)
+		}
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("blob %s: %w", b.digest, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return delta, nil
+}
+
+// ReadDelta returns the delta record of the archive read from r, or nil if
+// it is a full archive. Only the first tar entry is read.
+func ReadDelta(r io.Reader) (*Delta, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("opening zstd stream: %w", err)
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	if layoutPath(hdr.Name) != DeltaFile {
+		return nil, nil
+	}
+	return parseDelta(tr, hdr)
+}
+
+// parseDelta reads a delta record from the archive entry hdr.
+func parseDelta(r io.Reader, hdr *tar.Header) (*Delta, error) {
+	var d Delta
+	if err := json.NewDecoder(io.LimitReader(r, 256<<20)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", hdr.Name, err)
+	}
+	return &d, nil
+}
+
+// checkDelta reports the blobs a delta omitted that dir does not hold.
+func checkDelta(dir string, d *Delta) error {
+	s := &Store{Dir: dir}
+	var missing []string
+	for digest, size := range d.Omitted {
+		if !ValidDigest(digest) {
+			return fmt.Errorf("delta omits %q: %w", digest, ErrInvalidDigest)
+		}
+		if info, err := os.Stat(s.BlobPath(digest)); err != nil || info.Size() != size {
+			missing = append(missing, digest)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return &DeltaIncompleteError{Baseline: d.Baseline, Missing: missing}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package ocistore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteDeltaAppliesOnlyOverItsBaseline(t *testing.T) {
+	l := newLayout(t)
+	base := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("base layer"))
+	config := l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`))
+	img := l.manifest(config, base, l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("new layer")))
+	l.writeIndex(named(img, "docker.io/library/redis:7"))
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The baseline has the base layer and config, and even lists the
+	// manifest, which is included regardless.
+	baseline := map[string]int64{base.Digest: base.Size, config.Digest: config.Size, img.Digest: img.Size}
+	var buf bytes.Buffer
+	d, err := s.WriteDelta(context.Background(), &buf, baseline, "previous.tar.zst")
+	if err != nil {
+		t.Fatalf("WriteDelta: %v", err)
+	}
+	if d.OmittedBlobs != 2 || d.Blobs != 2 || d.Manifests != 1 {
+		t.Errorf("unexpected delta %+v", d)
+	}
+	if got, err := ReadDelta(bytes.NewReader(buf.Bytes())); err != nil || got == nil || got.Baseline != "previous.tar.zst" {
+		t.Errorf("expected ReadDelta to find the delta record, got %+v %v", got, err)
+	}
+	if listed, err := ReadArchive(bytes.NewReader(buf.Bytes())); err != nil || len(listed.Artifacts) != 1 || listed.Artifacts[0].Error != "" {
+		t.Errorf("expected the delta to list like a full archive, got %+v %v", listed, err)
+	}
+
+	// A store without the baseline's blobs refuses the delta and keeps its index.
+	dst := newLayout(t)
+	dst.writeIndex()
+	_, err = ExtractArchive(context.Background(), bytes.NewReader(buf.Bytes()), dst.dir)
+	var incomplete *DeltaIncompleteError
+	if !errors.As(err, &incomplete) || len(incomplete.Missing) != 2 {
+		t.Fatalf("expected an incomplete delta, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dst.dir, "index.json")); strings.Contains(string(data), img.Digest) {
+		t.Error("expected the index not to be merged")
+	}
+
+	// Once the baseline's blobs are there, it applies.
+	for _, b := range []Descriptor{base, config} {
+		data, _ := os.ReadFile(s.BlobPath(b.Digest))
+		_ = os.WriteFile(filepath.Join(dst.dir, "blobs", "sha256", strings.TrimPrefix(b.Digest, "sha256:")), data, 0644)
+	}
+	stats, err := ExtractArchive(context.Background(), bytes.NewReader(buf.Bytes()), dst.dir)
+	if err != nil {
+		t.Fatalf("applying delta: %v", err)
+	}
+	if stats.Omitted != 2 || stats.Baseline != "previous.tar.zst" || stats.Manifests != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if r, err := Verify(context.Background(), dst.dir, nil); err != nil || !r.OK {
+		t.Fatalf("expected the applied store to verify, got %+v %v", r, err)
+	}
+}
@@ -0,0 +1,189 @@
+package ocistore
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Image config media types.
+const (
+	MediaTypeOCIConfig    = "application/vnd.oci.image.config.v1+json"
+	MediaTypeDockerConfig = "application/vnd.docker.container.image.v1+json"
+)
+
+// maxRawConfig caps how large a non-image config blob may be to be returned
+// verbatim (chart and file configs are tiny).
+const maxRawConfig = 64 << 10
+
+// ImageConfig is the parsed image configuration blob.
+type ImageConfig struct {
+	Created      *time.Time      `json:"created,omitempty"`
+	Author       string          `json:"author,omitempty"`
+	Architecture string          `json:"architecture"`
+	OS           string          `json:"os"`
+	Variant      string          `json:"variant,omitempty"`
+	Config       ContainerConfig `json:"config"`
+	History      []History       `json:"history,omitempty"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// ContainerConfig is the runtime configuration baked into an image.
+type ContainerConfig struct {
+	User         string              `json:"User,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Volumes      map[string]struct{} `json:"Volumes,omitempty"`
+	StopSignal   string              `json:"StopSignal,omitempty"`
+}
+
+// History is one build step recorded in an image config.
+type History struct {
+	Created    *time.Time `json:"created,omitempty"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	Comment    string     `json:"comment,omitempty"`
+	EmptyLayer bool       `json:"empty_layer,omitempty"`
+}
+
+// PlatformDetail describes one manifest of an artifact: for a multi-arch image
+// one per platform, otherwise the single manifest.
+type PlatformDetail struct {
+	Platform   *Platform    `json:"platform,omitempty"`
+	Digest     string       `json:"digest"`
+	MediaType  string       `json:"mediaType"`
+	Size       int64        `json:"size"`       // manifest blob size
+	LayersSize int64        `json:"layersSize"` // compressed bytes of all layers
+	Config     *Descriptor  `json:"config,omitempty"`
+	Layers     []Descriptor `json:"layers"`
+	// ImageConfig is set for image configs; RawConfig holds other (small)
+	// config blobs such as a chart's Chart.yaml as JSON.
+	ImageConfig *ImageConfig    `json:"imageConfig,omitempty"`
+	RawConfig   json.RawMessage `json:"rawConfig,omitempty"`
+	Missing     bool            `json:"missing,omitempty"` // manifest blob not in the store
+}
+
+// ArtifactDetail is an artifact resolved down to its configs and layers.
+type ArtifactDetail struct {
+	Name        string            `json:"name"`
+	Kind        Kind              `json:"kind"`
+	Digest      string            `json:"digest"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platforms   []PlatformDetail  `json:"platforms"`
+}
+
+// Describe resolves the artifact with the given digest: a top-level index.json
+// entry, or one platform manifest of a multi-arch image. It returns false when
+// the store has no such artifact.
+func (s *Store) Describe(digest string) (*ArtifactDetail, bool, error) {
+	a, ok := s.Artifact(digest)
+	if !ok {
+		// A platform manifest inside a multi-arch image.
+		for i := range s.Artifacts {
+			for _, m := range s.Artifacts[i].Manifests {
+				if m.Digest == digest && !m.Missing {
+					parent := s.Artifacts[i]
+					pd, err := s.platformDetail(m.Descriptor)
+					if err != nil {
+						return nil, true, err
+					}
+					return &ArtifactDetail{
+						Name: parent.Name, Kind: parent.Kind, Digest: m.Digest, MediaType: m.MediaType,
+						Size: pd.Size + pd.LayersSize, Platforms: []PlatformDetail{*pd},
+					}, true, nil
+				}
+			}
+		}
+		return nil, false, nil
+	}
+	if a.Error != "" {
+		return nil, true, fmt.Errorf("%s", a.Error)
+	}
+
+	d := &ArtifactDetail{
+		Name: a.Name, Kind: a.Kind, Digest: a.Digest, MediaType: a.MediaType,
+		Size: a.Size, Annotations: a.Annotations, Platforms: []PlatformDetail{},
+	}
+	if len(a.Manifests) > 0 {
+		for _, m := range a.Manifests {
+			if m.Missing {
+				d.Platforms = append(d.Platforms, PlatformDetail{
+					Platform: m.Platform, Digest: m.Digest, MediaType: m.MediaType, Size: m.Size, Missing: true,
+				})
+				continue
+			}
+			pd, err := s.platformDetail(m.Descriptor)
+			if err != nil {
+				return nil, true, err
+			}
+			d.Platforms = append(d.Platforms, *pd)
+		}
+		return d, true, nil
+	}
+
+	pd, err := s.platformDetail(Descriptor{MediaType: a.MediaType, Digest: a.Digest, Size: a.topSize})
+	if err != nil {
+		return nil, true, err
+	}
+	d.Platforms = append(d.Platforms, *pd)
+	return d, true, nil
+}
+
+// platformDetail reads one manifest and its config blob.
+func (s *Store) platformDetail(desc Descriptor) (*PlatformDetail, error) {
+	m, err := s.Manifest(desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	pd := &PlatformDetail{
+		Platform:  desc.Platform,
+		Digest:    desc.Digest,
+		MediaType: desc.MediaType,
+		Size:      desc.Size,
+		Layers:    m.Layers,
+	}
+	if pd.MediaType == "" {
+		pd.MediaType = m.MediaType
+	}
+	if pd.Layers == nil {
+		pd.Layers = []Descriptor{}
+	}
+	for _, l := range m.Layers {
+		pd.LayersSize += l.Size
+	}
+	if m.Config.Digest == "" {
+		return pd, nil
+	}
+	cfg := m.Config
+	pd.Config = &cfg
+
+	data, err := s.ReadBlob(cfg.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("reading config %s: %w", cfg.Digest, err)
+	}
+	switch cfg.MediaType {
+	case MediaTypeOCIConfig, MediaTypeDockerConfig:
+		var ic ImageConfig
+		if err := json.Unmarshal(data, &ic); err != nil {
+			return nil, fmt.Errorf("parsing config %s: %w", cfg.Digest, err)
+		}
+		pd.ImageConfig = &ic
+		if pd.Platform == nil {
+			pd.Platform = &Platform{OS: ic.OS, Architecture: ic.Architecture, Variant: ic.Variant}
+		}
+	default:
+		if len(data) <= maxRawConfig && json.Valid(data) {
+			pd.RawConfig = data
+		}
+	}
+	return pd, nil
+}
@@ -0,0 +1,210 @@
+package ocistore
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ExtractStats summarizes an archive extracted into a store.
+type ExtractStats struct {
+	Blobs     int   `json:"blobs"`     // blobs written
+	Existing  int   `json:"existing"`  // blobs the store already had
+	Bytes     int64 `json:"bytes"`     // bytes written
+	Manifests int   `json:"manifests"` // index.json entries merged
+
+	// Set for a delta archive, whose omitted blobs were all found in the
+	// store before anything was merged.
+	Baseline string `json:"baseline,omitempty"`
+	Omitted  int    `json:"omitted,omitempty"`
+}
+
+// ExtractArchive streams a hauler archive (zstd tar of an OCI layout) into the
+// layout at dir without staging it anywhere: each blob is written beside its
+// final name, checked against its digest and renamed into place. Only once
+// the whole stream has been read are the archive's index.json entries merged
+// into dir's, replacing entries with the same kind and reference. A delta
+// archive is merged only if dir holds every blob it omitted; otherwise a
+// *DeltaIncompleteError is returned. An error before the merge leaves at most
+// unreferenced blobs, which GC removes.
+func ExtractArchive(ctx context.Context, r io.Reader, dir string) (*ExtractStats, error) {
+	zr, err := zstd.NewReader(ctxReader{ctx, r})
+	if err != nil {
+		return nil, fmt.Errorf("opening zstd stream: %w", err)
+	}
+	defer zr.Close()
+
+	stats := &ExtractStats{}
+	var index []byte
+	var delta *Delta
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := layoutPath(hdr.Name)
+		if name == DeltaFile {
+			if delta, err = parseDelta(tr, hdr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if name == "index.json" {
+			if index, err = io.ReadAll(io.LimitReader(tr, 64<<20)); err != nil {
+				return nil, fmt.Errorf("reading index.json: %w", err)
+			}
+			continue
+		}
+		algo, hex, ok := strings.Cut(strings.TrimPrefix(name, "blobs/"), "/")
+		if !strings.HasPrefix(name, "blobs/") || !ok {
+			continue
+		}
+		digest := algo + ":" + hex
+		if !ValidDigest(digest) {
+			return nil, fmt.Errorf("archive entry %s: %w", hdr.Name, ErrInvalidDigest)
+		}
+		dst := filepath.Join(dir, "blobs", algo, hex)
+		if info, err := os.Stat(dst); err == nil && info.Size() == hdr.Size {
+			stats.Existing++
+			continue
+		}
+		if err := writeBlob(dst, digest, tr); err != nil {
+			return nil, err
+		}
+		stats.Blobs++
+		stats.Bytes += hdr.Size
+	}
+	// Read to the very end so a source that checks itself at EOF (such as a
+	// volume set) gets to fail before anything is merged.
+	if _, err := io.Copy(io.Discard, zr); err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	if index == nil {
+		return nil, fmt.Errorf("archive has no index.json")
+	}
+
+	var incoming Index
+	if err := json.Unmarshal(index, &incoming); err != nil {
+		return nil, fmt.Errorf("parsing archive index.json: %w", err)
+	}
+	if delta != nil {
+		if err := checkDelta(dir, delta); err != nil {
+			return nil, err
+		}
+		stats.Baseline, stats.Omitted = delta.Baseline, len(delta.Omitted)
+	}
+	if err := mergeIndex(dir, incoming.Manifests); err != nil {
+		return nil, err
+	}
+	stats.Manifests = len(incoming.Manifests)
+	Invalidate(dir)
+	return stats, nil
+}
+
+// writeBlob copies r to dst via a temporary file, refusing content that does
+// not hash to digest.
+func writeBlob(dst, digest string, r io.Reader) error {
+	algo, want, _ := strings.Cut(digest, ":")
+	h := digestHash(algo)
+	if h == nil {
+		return fmt.Errorf("blob %s: unsupported digest algorithm", digest)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".extract-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("blob %s: %w", digest, err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return fmt.Errorf("blob %s: content hashes to %s:%s", digest, algo, got)
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// mergeIndex adds entries to dir's index.json (creating the layout files if
+// needed). An entry replaces an existing one with the same kind annotation
+// and reference; exact duplicates are skipped.
+func mergeIndex(dir string, entries []Descriptor) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	idx := Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	path := filepath.Join(dir, "index.json")
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &idx); err != nil {
+			return fmt.Errorf("parsing index.json: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	key := func(d Descriptor) string {
+		if name := artifactName(d.Annotations); name != "" {
+			return d.Annotations[AnnotationKind] + "|" + name
+		}
+		return ""
+	}
+	for _, in := range entries {
+		replaced := false
+		for i, cur := range idx.Manifests {
+			k := key(in)
+			if (k != "" && key(cur) == k) || (k == "" && cur.Digest == in.Digest && key(cur) == "") {
+				idx.Manifests[i] = in
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			idx.Manifests = append(idx.Manifests, in)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "oci-layout")); os.IsNotExist(err) {
+		if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+			return err
+		}
+	}
+	return writeIndex(dir, idx)
+}
+
+// digestHash returns a hash for a digest algorithm, or nil if unsupported.
+func digestHash(algo string) hash.Hash {
+	switch algo {
+	case "sha256":
+		return sha256.New()
+	case "sha512":
+		return sha512.New()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package ocistore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Blob is a blob file in a store.
+type Blob struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// GCPlan is the outcome of walking a store for garbage collection.
+type GCPlan struct {
+	Reachable      int    `json:"reachable"`
+	ReachableBytes int64  `json:"reachableBytes"`
+	Orphans        []Blob `json:"orphans"`
+	OrphanBytes    int64  `json:"orphanBytes"`
+	// Missing lists referenced blobs absent from the store, e.g. the platforms
+	// a filtered sync skipped. They hold nothing else alive.
+	Missing []string `json:"missing,omitempty"`
+	// Problems lists manifests that exist but cannot be read or parsed. Their
+	// children cannot be known, so a plan with problems must not be swept.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// PlanGC walks every manifest and index reachable from index.json, following
+// nested indexes, configs, layers and subjects, and reports the blob files
+// nothing reaches.
+func (s *Store) PlanGC() (*GCPlan, error) {
+	plan := &GCPlan{Orphans: []Blob{}}
+	seen := map[string]bool{}
+
+	s.walkRefs(s.Index.Manifests, func(d Descriptor, _ string) bool {
+		seen[d.Digest] = true
+		if !ValidDigest(d.Digest) {
+			plan.Problems = append(plan.Problems, fmt.Sprintf("invalid digest %q", d.Digest))
+			return false
+		}
+		if _, err := os.Stat(s.BlobPath(d.Digest)); err != nil {
+			if os.IsNotExist(err) {
+				plan.Missing = append(plan.Missing, d.Digest)
+			} else {
+				plan.Problems = append(plan.Problems, fmt.Sprintf("%s: %v", d.Digest, err))
+			}
+			return false
+		}
+		return true
+	}, func(d Descriptor, err error) {
+		plan.Problems = append(plan.Problems, fmt.Sprintf("%s: %v", d.Digest, err))
+	})
+
+	blobsDir := filepath.Join(s.Dir, "blobs")
+	err := filepath.WalkDir(blobsDir, func(path string, e os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == blobsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(blobsDir, path)
+		algo, hex, ok := strings.Cut(filepath.ToSlash(rel), "/")
+		if !ok || strings.Contains(hex, "/") {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		digest := algo + ":" + hex
+		if seen[digest] {
+			plan.Reachable++
+			plan.ReachableBytes += info.Size()
+			return nil
+		}
+		plan.Orphans = append(plan.Orphans, Blob{Digest: digest, Size: info.Size()})
+		plan.OrphanBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning blobs: %w", err)
+	}
+	sort.Slice(plan.Orphans, func(i, j int) bool { return plan.Orphans[i].Size > plan.Orphans[j].Size })
+	return plan, nil
+}
+
+// Sweep deletes the plan's orphaned blobs, returning how many were removed and
+// the bytes freed. It refuses plans with problems.
+func (s *Store) Sweep(plan *GCPlan) (int, int64, error) {
+	if len(plan.Problems) > 0 {
+		return 0, 0, fmt.Errorf("store has %d unreadable references (first: %s); refusing to delete blobs",
+			len(plan.Problems), plan.Problems[0])
+	}
+	var n int
+	var freed int64
+	for _, b := range plan.Orphans {
+		if !ValidDigest(b.Digest) {
+			continue
+		}
+		if err := os.Remove(s.BlobPath(b.Digest)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return n, freed, err
+		}
+		n++
+		freed += b.Size
+	}
+	return n, freed, nil
+}
+
+// walkRefs visits every distinct descriptor reachable from roots (index.json
+// entries) once, following nested indexes, configs, layers and subjects. visit
+// receives the descriptor and the digest that referenced it ("index.json" at
+// the top) and returns whether the blob exists and may be descended into.
+// Manifests that cannot be read or parsed are reported to fail; descriptors
+// without a media type are probed and treated as leaves if they do not parse.
+func (s *Store) walkRefs(roots []Descriptor, visit func(d Descriptor, from string) bool, fail func(d Descriptor, err error)) {
+	seen := map[string]bool{}
+	var walk func(d Descriptor, from string)
+	walk = func(d Descriptor, from string) {
+		if d.Digest == "" || seen[d.Digest] {
+			return
+		}
+		seen[d.Digest] = true
+		if !visit(d, from) {
+			return
+		}
+		if d.MediaType != "" && !IsIndex(d.MediaType) && !isManifest(d.MediaType) {
+			return
+		}
+		data, err := s.ReadBlob(d.Digest)
+		if err != nil {
+			fail(d, err)
+			return
+		}
+		// Indexes and manifests share one shape for the fields that matter.
+		var node struct {
+			Manifests []Descriptor `json:"manifests"`
+			Config    *Descriptor  `json:"config"`
+			Layers    []Descriptor `json:"layers"`
+			Subject   *Descriptor  `json:"subject"`
+		}
+		if err := json.Unmarshal(data, &node); err != nil {
+			if d.MediaType != "" {
+				fail(d, fmt.Errorf("parsing: %w", err))
+			}
+			return
+		}
+		for _, c := range node.Manifests {
+			walk(c, d.Digest)
+		}
+		if node.Config != nil {
+			walk(*node.Config, d.Digest)
+		}
+		for _, l := range node.Layers {
+			walk(l, d.Digest)
+		}
+		// A referrer keeps its subject alive even when index.json lost it.
+		if node.Subject != nil {
+			walk(*node.Subject, d.Digest)
+		}
+	}
+	for _, d := range roots {
+		walk(d, "index.json")
+	}
+}
+
+func isManifest(mediaType string) bool {
+	return mediaType == MediaTypeOCIManifest || mediaType == MediaTypeDockerManifest
+}
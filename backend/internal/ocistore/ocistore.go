@@ -0,0 +1,481 @@
+// Package ocistore reads a hauler store's OCI image layout directly: the
+// top-level index, image manifests and multi-arch indexes, configs, layers,
+// and the annotations hauler uses to mark what kind of artifact each entry is.
+// It replaces shelling out to "hauler store info" and ad-hoc index.json
+// parsing. Parsed stores are cached per directory; see Load and Invalidate.
+package ocistore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OCI and Docker media types.
+const (
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// Media types hauler writes for charts and files.
+const (
+	MediaTypeChartConfig     = "application/vnd.cncf.helm.config.v1+json"
+	MediaTypeChartLayer      = "application/vnd.cncf.helm.chart.content.v1.tar+gzip"
+	MediaTypeFileLayer       = "application/vnd.content.hauler.file.layer.v1"
+	MediaTypeFileLocalConfig = "application/vnd.content.hauler.file.local.config.v1+json"
+	MediaTypeFileHTTPConfig  = "application/vnd.content.hauler.file.http.config.v1+json"
+)
+
+// Annotation keys used in a hauler store's index.json and manifests.
+const (
+	AnnotationContainerdName = "io.containerd.image.name"
+	AnnotationRefName        = "org.opencontainers.image.ref.name"
+	AnnotationTitle          = "org.opencontainers.image.title"
+	// AnnotationKind is hauler's marker for what an index entry holds.
+	AnnotationKind = "kind"
+)
+
+// Values of AnnotationKind.
+const (
+	KindAnnotationImage      = "dev.cosignproject.cosign/image"
+	KindAnnotationImageIndex = "dev.cosignproject.cosign/imageIndex"
+	KindAnnotationSigs       = "dev.cosignproject.cosign/sigs"
+	KindAnnotationAtts       = "dev.cosignproject.cosign/atts"
+	KindAnnotationSboms      = "dev.cosignproject.cosign/sboms"
+	KindAnnotationReferrers  = "dev.hauler/referrers"
+)
+
+// Kind classifies an artifact in a store.
+type Kind string
+
+const (
+	KindImage       Kind = "image"
+	KindChart       Kind = "chart"
+	KindFile        Kind = "file"
+	KindSignature   Kind = "signature"
+	KindAttestation Kind = "attestation"
+	KindSBOM        Kind = "sbom"
+	KindReferrer    Kind = "referrer"
+)
+
+// Content reports whether the kind is primary content (image, chart or file)
+// rather than supply-chain metadata attached to an image.
+func (k Kind) Content() bool {
+	return k == KindImage || k == KindChart || k == KindFile
+}
+
+// Platform identifies the OS and architecture an image manifest targets.
+type Platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String renders the platform as os/arch[/variant].
+func (p Platform) String() string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Descriptor points at a blob in the layout.
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+}
+
+// Manifest is an OCI (or Docker v2) image manifest.
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        Descriptor        `json:"config"`
+	Layers        []Descriptor      `json:"layers"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// Index is an OCI image index (or Docker manifest list).
+type Index struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType,omitempty"`
+	Manifests     []Descriptor      `json:"manifests"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// IsIndex reports whether a media type is an image index or manifest list.
+func IsIndex(mediaType string) bool {
+	return mediaType == MediaTypeOCIIndex || mediaType == MediaTypeDockerManifestList
+}
+
+// PlatformManifest is one per-platform manifest of a multi-arch image.
+type PlatformManifest struct {
+	Descriptor
+	Config  *Descriptor  `json:"config,omitempty"`
+	Layers  []Descriptor `json:"layers,omitempty"`
+	Missing bool         `json:"missing,omitempty"` // listed in the index but its blob is not in the store
+}
+
+// Artifact is one entry of a store's top-level index.json, resolved.
+type Artifact struct {
+	Name        string            `json:"name"` // full reference, e.g. docker.io/library/nginx:1.25
+	Kind        Kind              `json:"kind"`
+	Digest      string            `json:"digest"` // manifest or index digest
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"` // bytes of every distinct blob the artifact references
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Single-manifest artifacts.
+	Config  *Descriptor  `json:"config,omitempty"`
+	Layers  []Descriptor `json:"layers,omitempty"`
+	Subject *Descriptor  `json:"subject,omitempty"`
+
+	// Multi-arch images.
+	Manifests []PlatformManifest `json:"manifests,omitempty"`
+
+	// Charts: name and version from the chart's config (Chart.yaml).
+	ChartName    string `json:"chartName,omitempty"`
+	ChartVersion string `json:"chartVersion,omitempty"`
+
+	// Error is set when the artifact's manifest could not be read.
+	Error string `json:"error,omitempty"`
+
+	topSize int64 // size of the manifest or index blob itself
+}
+
+// Platforms lists the platforms a multi-arch artifact provides.
+func (a *Artifact) Platforms() []string {
+	var out []string
+	for _, m := range a.Manifests {
+		if m.Platform != nil {
+			out = append(out, m.Platform.String())
+		}
+	}
+	return out
+}
+
+// File is a downloadable blob: a layer carrying an image title annotation,
+// i.e. the content of a hauler file or chart.
+type File struct {
+	Name     string `json:"name"` // original filename (layer title)
+	Size     int64  `json:"size"`
+	Digest   string `json:"digest"` // content layer digest
+	Artifact string `json:"artifact"`
+}
+
+// Store is a parsed OCI layout.
+type Store struct {
+	Dir       string
+	Index     Index
+	Artifacts []Artifact
+
+	sizesOnce sync.Once
+	sizes     *SizeReport
+
+	// mem holds the small blobs of a store read from an archive; such a
+	// store has no directory.
+	mem map[string][]byte
+}
+
+// Open parses the OCI layout in dir. A directory without an index.json is an
+// empty store, not an error.
+func Open(dir string) (*Store, error) {
+	s := &Store{Dir: dir, Artifacts: []Artifact{}}
+	data, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("reading index.json: %w", err)
+	}
+	if err := s.load(data); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load parses index.json and resolves its entries into Artifacts.
+func (s *Store) load(index []byte) error {
+	if err := json.Unmarshal(index, &s.Index); err != nil {
+		return fmt.Errorf("parsing index.json: %w", err)
+	}
+	for _, d := range s.Index.Manifests {
+		a, err := s.resolve(d)
+		if err != nil {
+			// Keep the entry so one damaged artifact does not hide the rest.
+			a = &Artifact{
+				Name: artifactName(d.Annotations), Kind: KindImage, Digest: d.Digest,
+				MediaType: d.MediaType, Size: d.Size, Annotations: d.Annotations, Error: err.Error(),
+			}
+		}
+		s.Artifacts = append(s.Artifacts, *a)
+	}
+	return nil
+}
+
+// BlobPath maps a "sha256:hex" digest to its path in the layout.
+func (s *Store) BlobPath(digest string) string {
+	algo, hex, ok := strings.Cut(digest, ":")
+	if !ok {
+		algo, hex = "sha256", digest
+	}
+	return filepath.Join(s.Dir, "blobs", algo, hex)
+}
+
+// ErrInvalidDigest is returned for digests that cannot name a blob.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// ValidDigest reports whether digest has the "algorithm:hex" form and is
+// safe to use as a blob path.
+func ValidDigest(digest string) bool {
+	algo, hex, ok := strings.Cut(digest, ":")
+	return ok && algo != "" && hex != "" && !strings.ContainsAny(algo+hex, "/\\.")
+}
+
+// ReadBlob returns the contents of a blob.
+func (s *Store) ReadBlob(digest string) ([]byte, error) {
+	if !ValidDigest(digest) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidDigest, digest)
+	}
+	if s.mem != nil {
+		data, ok := s.mem[digest]
+		if !ok {
+			return nil, fmt.Errorf("blob %s: %w", digest, os.ErrNotExist)
+		}
+		return data, nil
+	}
+	return os.ReadFile(s.BlobPath(digest))
+}
+
+// Manifest reads and parses an image manifest blob.
+func (s *Store) Manifest(digest string) (*Manifest, error) {
+	data, err := s.ReadBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %s: %w", digest, err)
+	}
+	return &m, nil
+}
+
+// ImageIndex reads and parses an image index blob.
+func (s *Store) ImageIndex(digest string) (*Index, error) {
+	data, err := s.ReadBlob(digest)
+	if err != nil {
+		return nil, err
+	}
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parsing index %s: %w", digest, err)
+	}
+	return &idx, nil
+}
+
+// Artifact returns the artifact with the given top-level digest.
+func (s *Store) Artifact(digest string) (*Artifact, bool) {
+	for i := range s.Artifacts {
+		if s.Artifacts[i].Digest == digest {
+			return &s.Artifacts[i], true
+		}
+	}
+	return nil, false
+}
+
+// Files lists the titled layers of single-manifest artifacts (hauler files
+// and charts), first occurrence of each name winning.
+func (s *Store) Files() []File {
+	files := []File{}
+	seen := map[string]bool{}
+	for _, a := range s.Artifacts {
+		for _, l := range a.Layers {
+			title := l.Annotations[AnnotationTitle]
+			if title == "" || seen[title] {
+				continue
+			}
+			seen[title] = true
+			files = append(files, File{Name: title, Size: l.Size, Digest: l.Digest, Artifact: a.Name})
+		}
+	}
+	return files
+}
+
+// FindFile locates a titled layer by filename.
+func (s *Store) FindFile(name string) (File, bool) {
+	for _, f := range s.Files() {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return File{}, false
+}
+
+// Blobs returns every blob digest the index references (manifests, indexes,
+// configs and layers), with sizes.
+func (s *Store) Blobs() map[string]int64 {
+	blobs := map[string]int64{}
+	for _, a := range s.Artifacts {
+		for d, size := range a.blobs() {
+			blobs[d] = size
+		}
+	}
+	return blobs
+}
+
+// blobs returns the distinct blobs an artifact references, with sizes.
+func (a *Artifact) blobs() map[string]int64 {
+	blobs := map[string]int64{}
+	add := func(d *Descriptor) {
+		if d != nil && d.Digest != "" {
+			blobs[d.Digest] = d.Size
+		}
+	}
+	add(&Descriptor{Digest: a.Digest, Size: a.topSize})
+	add(a.Config)
+	for i := range a.Layers {
+		add(&a.Layers[i])
+	}
+	for _, m := range a.Manifests {
+		if m.Missing {
+			continue
+		}
+		add(&m.Descriptor)
+		add(m.Config)
+		for i := range m.Layers {
+			add(&m.Layers[i])
+		}
+	}
+	return blobs
+}
+
+// resolve reads the manifest or index an index.json entry points at.
+func (s *Store) resolve(d Descriptor) (*Artifact, error) {
+	a := &Artifact{
+		Name:        artifactName(d.Annotations),
+		Digest:      d.Digest,
+		MediaType:   d.MediaType,
+		Annotations: d.Annotations,
+		topSize:     d.Size,
+	}
+
+	if IsIndex(d.MediaType) {
+		idx, err := s.ImageIndex(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		a.Subject = idx.Subject
+		for _, child := range idx.Manifests {
+			pm := PlatformManifest{Descriptor: child}
+			if m, err := s.Manifest(child.Digest); err == nil {
+				cfg := m.Config
+				pm.Config = &cfg
+				pm.Layers = m.Layers
+			} else {
+				pm.Missing = true
+			}
+			a.Manifests = append(a.Manifests, pm)
+		}
+	} else {
+		m, err := s.Manifest(d.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if a.MediaType == "" {
+			a.MediaType = m.MediaType
+		}
+		if m.Config.Digest != "" {
+			cfg := m.Config
+			a.Config = &cfg
+		}
+		a.Layers = m.Layers
+		a.Subject = m.Subject
+	}
+
+	a.Kind = classify(a, d.Annotations[AnnotationKind])
+	if a.Kind == KindChart && a.Config != nil {
+		var chart struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}
+		if data, err := s.ReadBlob(a.Config.Digest); err == nil && json.Unmarshal(data, &chart) == nil {
+			a.ChartName, a.ChartVersion = chart.Name, chart.Version
+		}
+	}
+	for _, size := range a.blobs() {
+		a.Size += size
+	}
+	return a, nil
+}
+
+// artifactName prefers the full containerd reference over the short ref name.
+func artifactName(annotations map[string]string) string {
+	if n := annotations[AnnotationContainerdName]; n != "" {
+		return n
+	}
+	return annotations[AnnotationRefName]
+}
+
+// attachmentTagRe matches cosign's "sha256-<hex>.<suffix>" attachment tags.
+var attachmentTagRe = regexp.MustCompile(`:sha256-[0-9a-f]{64}\.(sig|att|sbom)$`)
+
+// classify derives an artifact's kind from hauler's kind annotation, then
+// from cosign's attachment tags and an OCI subject (for content copied in
+// without hauler's annotations), and for plain manifests from the config
+// and layer media types.
+func classify(a *Artifact, kindAnnotation string) Kind {
+	switch kindAnnotation {
+	case KindAnnotationSigs:
+		return KindSignature
+	case KindAnnotationAtts:
+		return KindAttestation
+	case KindAnnotationSboms:
+		return KindSBOM
+	case KindAnnotationReferrers:
+		return KindReferrer
+	}
+	if m := attachmentTagRe.FindStringSubmatch(a.Name); m != nil {
+		switch m[1] {
+		case "sig":
+			return KindSignature
+		case "att":
+			return KindAttestation
+		default:
+			return KindSBOM
+		}
+	}
+	if a.Subject != nil {
+		return KindReferrer
+	}
+	if a.Config != nil {
+		switch a.Config.MediaType {
+		case MediaTypeChartConfig:
+			return KindChart
+		case MediaTypeFileLocalConfig, MediaTypeFileHTTPConfig:
+			return KindFile
+		}
+	}
+	for _, l := range a.Layers {
+		switch l.MediaType {
+		case MediaTypeChartLayer:
+			return KindChart
+		case MediaTypeFileLayer:
+			return KindFile
+		}
+	}
+	return KindImage
+}
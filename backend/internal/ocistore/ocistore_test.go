@@ -0,0 +1,761 @@
+package ocistore
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// layout builds an OCI layout on disk for tests.
+type layout struct {
+	t   *testing.T
+	dir string
+}
+
+func newLayout(t *testing.T) *layout {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatalf("creating blobs dir: %v", err)
+	}
+	return &layout{t: t, dir: dir}
+}
+
+// blob writes content and returns its descriptor.
+func (l *layout) blob(mediaType string, content []byte) Descriptor {
+	l.t.Helper()
+	sum := sha256.Sum256(content)
+	h := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(l.dir, "blobs", "sha256", h), content, 0644); err != nil {
+		l.t.Fatalf("writing blob: %v", err)
+	}
+	return Descriptor{MediaType: mediaType, Digest: "sha256:" + h, Size: int64(len(content))}
+}
+
+func (l *layout) json(mediaType string, v interface{}) Descriptor {
+	l.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		l.t.Fatalf("encoding: %v", err)
+	}
+	return l.blob(mediaType, data)
+}
+
+func (l *layout) manifest(config Descriptor, layers ...Descriptor) Descriptor {
+	return l.json(MediaTypeOCIManifest, Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest, Config: config, Layers: layers})
+}
+
+func (l *layout) writeIndex(entries ...Descriptor) {
+	l.t.Helper()
+	data, _ := json.Marshal(Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: entries})
+	if err := os.WriteFile(filepath.Join(l.dir, "index.json"), data, 0644); err != nil {
+		l.t.Fatalf("writing index.json: %v", err)
+	}
+}
+
+func named(d Descriptor, name string, extra ...string) Descriptor {
+	d.Annotations = map[string]string{AnnotationContainerdName: name}
+	for i := 0; i+1 < len(extra); i += 2 {
+		d.Annotations[extra[i]] = extra[i+1]
+	}
+	return d
+}
+
+func TestOpenClassifiesArtifacts(t *testing.T) {
+	l := newLayout(t)
+
+	sharedLayer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("base layer"))
+	imgConfig := l.blob("application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"amd64","os":"linux"}`))
+	image := l.manifest(imgConfig, sharedLayer)
+
+	armConfig := l.blob("application/vnd.oci.image.config.v1+json", []byte(`{"architecture":"arm64","os":"linux"}`))
+	armImage := l.manifest(armConfig, sharedLayer)
+	amd := image
+	amd.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	arm := armImage
+	arm.Platform = &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	multi := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd, arm}})
+
+	chartConfig := l.blob(MediaTypeChartConfig, []byte(`{"name":"podinfo","version":"6.5.0"}`))
+	chartLayer := l.blob(MediaTypeChartLayer, []byte("chart tarball"))
+	chartLayer.Annotations = map[string]string{AnnotationTitle: "podinfo-6.5.0.tgz"}
+	chart := l.manifest(chartConfig, chartLayer)
+
+	fileConfig := l.blob(MediaTypeFileLocalConfig, []byte(`{}`))
+	fileLayer := l.blob(MediaTypeFileLayer, []byte("#!/bin/sh\n"))
+	fileLayer.Annotations = map[string]string{AnnotationTitle: "install.sh"}
+	file := l.manifest(fileConfig, fileLayer)
+
+	sigLayer := l.blob("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig"))
+	sig := l.manifest(l.blob("application/vnd.oci.image.config.v1+json", []byte(`{}`)), sigLayer)
+
+	l.writeIndex(
+		named(image, "docker.io/library/nginx:1.25"),
+		named(multi, "docker.io/library/redis:7"),
+		named(chart, "hauler/podinfo:6.5.0"),
+		named(file, "hauler/install.sh:latest"),
+		named(sig, "docker.io/library/nginx:sha256-abc.sig", AnnotationKind, KindAnnotationSigs),
+	)
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(s.Artifacts) != 5 {
+		t.Fatalf("expected 5 artifacts, got %d", len(s.Artifacts))
+	}
+
+	want := []Kind{KindImage, KindImage, KindChart, KindFile, KindSignature}
+	for i, a := range s.Artifacts {
+		if a.Kind != want[i] {
+			t.Errorf("%s: expected kind %s, got %s", a.Name, want[i], a.Kind)
+		}
+	}
+
+	nginx := s.Artifacts[0]
+	if wantSize := image.Size + imgConfig.Size + sharedLayer.Size; nginx.Size != wantSize {
+		t.Errorf("nginx size = %d, want %d", nginx.Size, wantSize)
+	}
+
+	redis := s.Artifacts[1]
+	if got := redis.Platforms(); len(got) != 2 || got[0] != "linux/amd64" || got[1] != "linux/arm64/v8" {
+		t.Errorf("unexpected platforms %v", got)
+	}
+	// The shared layer counts once.
+	wantSize := multi.Size + image.Size + imgConfig.Size + armImage.Size + armConfig.Size + sharedLayer.Size
+	if redis.Size != wantSize {
+		t.Errorf("redis size = %d, want %d", redis.Size, wantSize)
+	}
+
+	if c := s.Artifacts[2]; c.ChartName != "podinfo" || c.ChartVersion != "6.5.0" {
+		t.Errorf("expected chart podinfo 6.5.0, got %q %q", c.ChartName, c.ChartVersion)
+	}
+
+	files := s.Files()
+	if len(files) != 2 || files[0].Name != "podinfo-6.5.0.tgz" || files[1].Name != "install.sh" {
+		t.Fatalf("unexpected files %+v", files)
+	}
+	if f, ok := s.FindFile("install.sh"); !ok || f.Digest != fileLayer.Digest {
+		t.Errorf("FindFile(install.sh) = %+v, %v", f, ok)
+	}
+}
+
+func TestAttachmentsWithoutHaulerAnnotations(t *testing.T) {
+	l := newLayout(t)
+	layer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("layer"))
+	cfg := l.blob(MediaTypeOCIConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	image := l.manifest(cfg, layer)
+	other := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux"}`)), layer)
+
+	// A cosign signature copied in by tag, and an OCI referrer found only
+	// through its subject.
+	empty := l.blob(MediaTypeOCIConfig, []byte(`{}`))
+	sig := l.manifest(empty, l.blob("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig")))
+	subject := image
+	ref := l.json(MediaTypeOCIManifest, Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest,
+		ArtifactType: "application/spdx+json", Config: empty, Layers: []Descriptor{layer}, Subject: &subject})
+	l.writeIndex(
+		named(image, "docker.io/library/nginx:1.25"),
+		named(other, "docker.io/library/redis:7"),
+		named(sig, "docker.io/library/nginx:"+AttachmentTag(image.Digest, "sig")),
+		named(ref, "docker.io/library/nginx@"+ref.Digest),
+	)
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if s.Artifacts[2].Kind != KindSignature || s.Artifacts[3].Kind != KindReferrer {
+		t.Errorf("kinds = %s, %s; want signature, referrer", s.Artifacts[2].Kind, s.Artifacts[3].Kind)
+	}
+	if got := s.Attachments(&s.Artifacts[0]); len(got) != 2 || got[0].Digest != sig.Digest || got[1].Digest != ref.Digest {
+		t.Errorf("nginx attachments = %v", got)
+	}
+	if got := s.Attachments(&s.Artifacts[1]); len(got) != 0 {
+		t.Errorf("expected redis to have no attachments, got %v", got)
+	}
+}
+
+func TestOpenKeepsDamagedArtifacts(t *testing.T) {
+	l := newLayout(t)
+	good := l.manifest(l.blob("application/vnd.oci.image.config.v1+json", []byte(`{}`)))
+	missing := Descriptor{MediaType: MediaTypeOCIManifest, Digest: "sha256:" + hex.EncodeToString(make([]byte, 32)), Size: 10}
+	l.writeIndex(named(good, "example.com/good:1"), named(missing, "example.com/gone:1"))
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(s.Artifacts) != 2 || s.Artifacts[0].Error != "" || s.Artifacts[1].Error == "" {
+		t.Fatalf("expected the missing manifest to be reported, got %+v", s.Artifacts)
+	}
+}
+
+func TestOpenEmptyStore(t *testing.T) {
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(s.Artifacts) != 0 {
+		t.Errorf("expected no artifacts, got %d", len(s.Artifacts))
+	}
+}
+
+func TestLoadCachesUntilIndexChanges(t *testing.T) {
+	l := newLayout(t)
+	first := l.manifest(l.blob("application/vnd.oci.image.config.v1+json", []byte(`{"a":1}`)))
+	l.writeIndex(named(first, "example.com/a:1"))
+
+	s1, err := Load(l.dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	s2, _ := Load(l.dir)
+	if s1 != s2 {
+		t.Error("expected the second Load to be served from cache")
+	}
+
+	Invalidate(l.dir)
+	if s3, _ := Load(l.dir); s3 == s1 {
+		t.Error("expected Invalidate to drop the cached store")
+	}
+
+	second := l.manifest(l.blob("application/vnd.oci.image.config.v1+json", []byte(`{"b":2}`)))
+	l.writeIndex(named(first, "example.com/a:1"), named(second, "example.com/b:2"))
+	// Make sure the rewrite is visible even on coarse-grained mtimes.
+	future := time.Now().Add(2 * time.Second)
+	_ = os.Chtimes(filepath.Join(l.dir, "index.json"), future, future)
+
+	s4, err := Load(l.dir)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(s4.Artifacts) != 2 {
+		t.Errorf("expected a rewritten index.json to be re-read, got %d artifacts", len(s4.Artifacts))
+	}
+}
+
+func TestDescribeResolvesPlatforms(t *testing.T) {
+	l := newLayout(t)
+
+	layer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("rootfs"))
+	amdConfig := l.blob(MediaTypeOCIConfig, []byte(`{
+		"created": "2024-01-02T03:04:05Z",
+		"architecture": "amd64", "os": "linux",
+		"config": {"User": "nginx", "Env": ["PATH=/usr/bin"], "Entrypoint": ["/docker-entrypoint.sh"],
+			"Labels": {"maintainer": "nginx"}},
+		"history": [{"created_by": "ADD rootfs /"}, {"created_by": "ENV PATH=/usr/bin", "empty_layer": true}]
+	}`))
+	armConfig := l.blob(MediaTypeOCIConfig, []byte(`{"architecture":"arm64","os":"linux","variant":"v8"}`))
+	amd := l.manifest(amdConfig, layer)
+	amd.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	arm := l.manifest(armConfig, layer)
+	arm.Platform = &Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	multi := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd, arm}})
+
+	single := l.manifest(amdConfig, layer)
+	chart := l.manifest(l.blob(MediaTypeChartConfig, []byte(`{"name":"podinfo","version":"6.5.0"}`)),
+		l.blob(MediaTypeChartLayer, []byte("chart tarball")))
+	l.writeIndex(named(multi, "docker.io/library/nginx:1.25"), named(single, "docker.io/library/nginx:amd64"),
+		named(chart, "hauler/podinfo:6.5.0"))
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	d, ok, err := s.Describe(multi.Digest)
+	if !ok || err != nil {
+		t.Fatalf("Describe(index) = %v, %v", ok, err)
+	}
+	if len(d.Platforms) != 2 {
+		t.Fatalf("expected 2 platforms, got %d", len(d.Platforms))
+	}
+	p := d.Platforms[0]
+	if p.Platform.String() != "linux/amd64" || len(p.Layers) != 1 || p.Layers[0].Digest != layer.Digest || p.LayersSize != layer.Size {
+		t.Errorf("unexpected amd64 detail %+v", p)
+	}
+	ic := p.ImageConfig
+	if ic == nil || ic.Config.User != "nginx" || ic.Config.Entrypoint[0] != "/docker-entrypoint.sh" ||
+		ic.Config.Labels["maintainer"] != "nginx" || len(ic.History) != 2 || !ic.History[1].EmptyLayer || ic.Created == nil {
+		t.Errorf("unexpected image config %+v", ic)
+	}
+	if d.Platforms[1].Platform.String() != "linux/arm64/v8" {
+		t.Errorf("unexpected arm64 platform %v", d.Platforms[1].Platform)
+	}
+
+	// A platform manifest can be described on its own.
+	if d, ok, err := s.Describe(arm.Digest); !ok || err != nil || d.Name != "docker.io/library/nginx:1.25" || len(d.Platforms) != 1 {
+		t.Errorf("Describe(platform manifest) = %+v, %v, %v", d, ok, err)
+	}
+
+	// A single-platform image takes its platform from the config.
+	if d, _, _ := s.Describe(single.Digest); d.Platforms[0].Platform.String() != "linux/amd64" {
+		t.Errorf("expected platform from config, got %v", d.Platforms[0].Platform)
+	}
+
+	// Non-image configs are returned as-is.
+	if d, _, _ := s.Describe(chart.Digest); d.Platforms[0].ImageConfig != nil || len(d.Platforms[0].RawConfig) == 0 {
+		t.Errorf("expected raw chart config, got %+v", d.Platforms[0])
+	}
+
+	if _, ok, _ := s.Describe("sha256:" + hex.EncodeToString(make([]byte, 32))); ok {
+		t.Error("expected an unknown digest to be reported as not found")
+	}
+}
+
+func TestPlanGCAndSweep(t *testing.T) {
+	l := newLayout(t)
+
+	layer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("kept layer"))
+	cfg := l.blob(MediaTypeOCIConfig, []byte(`{"architecture":"amd64","os":"linux"}`))
+	amd := l.manifest(cfg, layer)
+	amd.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	// A platform a filtered sync skipped: referenced but never written.
+	skipped := Descriptor{MediaType: MediaTypeOCIManifest, Digest: "sha256:" + hex.EncodeToString(make([]byte, 32)), Size: 100}
+	multi := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd, skipped}})
+
+	// Left behind by a removed image.
+	oldLayer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("stale layer bytes"))
+	oldManifest := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux"}`)), oldLayer)
+
+	l.writeIndex(named(multi, "docker.io/library/redis:7"))
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	plan, err := s.PlanGC()
+	if err != nil {
+		t.Fatalf("PlanGC: %v", err)
+	}
+	if plan.Reachable != 4 {
+		t.Errorf("expected 4 reachable blobs, got %d", plan.Reachable)
+	}
+	if len(plan.Orphans) != 3 {
+		t.Fatalf("expected 3 orphans, got %+v", plan.Orphans)
+	}
+	if len(plan.Missing) != 1 || plan.Missing[0] != skipped.Digest || len(plan.Problems) != 0 {
+		t.Errorf("expected the skipped platform as missing only, got missing=%v problems=%v", plan.Missing, plan.Problems)
+	}
+
+	n, freed, err := s.Sweep(plan)
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+	if n != 3 || freed != plan.OrphanBytes {
+		t.Errorf("Sweep = %d, %d; want 3, %d", n, freed, plan.OrphanBytes)
+	}
+	for _, d := range []Descriptor{oldLayer, oldManifest} {
+		if _, err := os.Stat(s.BlobPath(d.Digest)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be deleted", d.Digest)
+		}
+	}
+	if _, err := os.Stat(s.BlobPath(layer.Digest)); err != nil {
+		t.Errorf("reachable layer was deleted: %v", err)
+	}
+}
+
+func TestSweepRefusesUnreadableManifests(t *testing.T) {
+	l := newLayout(t)
+	broken := l.blob(MediaTypeOCIManifest, []byte("not json"))
+	l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("maybe referenced"))
+	l.writeIndex(named(broken, "example.com/broken:1"))
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	plan, err := s.PlanGC()
+	if err != nil {
+		t.Fatalf("PlanGC: %v", err)
+	}
+	if len(plan.Problems) != 1 {
+		t.Fatalf("expected one problem, got %v", plan.Problems)
+	}
+	if n, _, err := s.Sweep(plan); err == nil || n != 0 {
+		t.Errorf("expected Sweep to refuse, got %d, %v", n, err)
+	}
+}
+
+func TestVerifyReportsDamage(t *testing.T) {
+	l := newLayout(t)
+	if err := os.WriteFile(filepath.Join(l.dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	good := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("intact layer"))
+	flipped := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("bit rot here"))
+	truncated := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("a layer cut short"))
+	gone := Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: "sha256:" + hex.EncodeToString(make([]byte, 32)), Size: 5}
+	cfg := l.blob(MediaTypeOCIConfig, []byte(`{}`))
+	m := l.manifest(cfg, good, flipped, truncated, gone)
+	l.writeIndex(named(m, "example.com/app:1"))
+
+	_ = os.WriteFile(filepath.Join(l.dir, "blobs", "sha256", strings.TrimPrefix(flipped.Digest, "sha256:")), []byte("bit rot HERE"), 0644)
+	_ = os.WriteFile(filepath.Join(l.dir, "blobs", "sha256", strings.TrimPrefix(truncated.Digest, "sha256:")), []byte("a layer"), 0644)
+
+	r, err := Verify(context.Background(), l.dir, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r.OK || len(r.Layout) != 0 {
+		t.Fatalf("expected a damaged store with a valid layout, got %+v", r)
+	}
+	if r.Blobs != 5 {
+		t.Errorf("expected 5 blobs hashed, got %d", r.Blobs)
+	}
+	if len(r.Missing) != 1 || r.Missing[0].Digest != gone.Digest || r.Missing[0].ReferencedBy != m.Digest {
+		t.Errorf("unexpected missing %+v", r.Missing)
+	}
+	if len(r.SizeMismatch) != 1 || r.SizeMismatch[0].Digest != truncated.Digest || r.SizeMismatch[0].Actual != 7 {
+		t.Errorf("unexpected size mismatches %+v", r.SizeMismatch)
+	}
+	corrupt := map[string]bool{}
+	for _, i := range r.Corrupt {
+		corrupt[i.Digest] = true
+	}
+	if len(corrupt) != 2 || !corrupt[flipped.Digest] || !corrupt[truncated.Digest] {
+		t.Errorf("unexpected corrupt %+v", r.Corrupt)
+	}
+	if r.Problems() != 4 {
+		t.Errorf("expected 4 problems, got %d", r.Problems())
+	}
+}
+
+func TestVerifyAllowsAbsentPlatforms(t *testing.T) {
+	l := newLayout(t)
+	if err := os.WriteFile(filepath.Join(l.dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	amd := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"architecture":"amd64","os":"linux"}`)),
+		l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("amd64 layer")))
+	amd.Platform = &Platform{OS: "linux", Architecture: "amd64"}
+	// A platform a filtered sync skipped: referenced by the index, never pulled.
+	arm := Descriptor{MediaType: MediaTypeOCIManifest, Digest: "sha256:" + hex.EncodeToString(make([]byte, 32)), Size: 400,
+		Platform: &Platform{OS: "linux", Architecture: "arm64"}}
+	multi := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd, arm}})
+	l.writeIndex(named(multi, "example.com/app:1"))
+
+	r, err := Verify(context.Background(), l.dir, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !r.OK || r.Problems() != 0 || len(r.Missing) != 0 {
+		t.Fatalf("expected a skipped platform not to be a problem, got %+v", r)
+	}
+	if len(r.AbsentPlatforms) != 1 || r.AbsentPlatforms[0].Digest != arm.Digest || r.AbsentPlatforms[0].ReferencedBy != multi.Digest {
+		t.Errorf("unexpected absent platforms %+v", r.AbsentPlatforms)
+	}
+
+	// A top-level manifest that is gone is still missing.
+	gone := Descriptor{MediaType: MediaTypeOCIManifest, Digest: "sha256:" + strings.Repeat("1", 64), Size: 10}
+	l.writeIndex(named(multi, "example.com/app:1"), named(gone, "example.com/gone:1"))
+	if r, err = Verify(context.Background(), l.dir, nil); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r.OK || len(r.Missing) != 1 || r.Missing[0].Digest != gone.Digest {
+		t.Errorf("expected the absent top-level manifest to be missing, got %+v", r.Missing)
+	}
+}
+
+func TestVerifyChecksLayoutFiles(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "index.json"), []byte(`{"schemaVersion":2,"manifests":[]}`), 0644)
+
+	r, err := Verify(context.Background(), dir, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if r.OK || len(r.Layout) != 1 || !strings.HasPrefix(r.Layout[0], "oci-layout") {
+		t.Errorf("expected a missing oci-layout to be reported, got %+v", r.Layout)
+	}
+}
+
+func TestSizesSplitsSharedAndUniqueBytes(t *testing.T) {
+	l := newLayout(t)
+	base := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", make([]byte, 1000))
+	appA := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", make([]byte, 300))
+	appB := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("b"))
+	cfgA := l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`))
+	cfgB := l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"arm64"}`))
+	a := l.manifest(cfgA, base, appA)
+	b := l.manifest(cfgB, base, appB)
+	l.writeIndex(named(a, "example.com/a:1"), named(b, "example.com/b:1"))
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	r := s.Sizes()
+	if r != s.Sizes() {
+		t.Error("expected the report to be computed once per store")
+	}
+	if len(r.Artifacts) != 2 || r.Artifacts[0].Name != "example.com/a:1" {
+		t.Fatalf("expected a (more unique bytes) first, got %+v", r.Artifacts)
+	}
+	ra := r.Artifacts[0]
+	if ra.SharedBytes != base.Size || ra.UniqueBytes != a.Size+cfgA.Size+appA.Size || ra.TotalBytes != ra.SharedBytes+ra.UniqueBytes {
+		t.Errorf("unexpected sizes for a: %+v", ra)
+	}
+	total := base.Size + appA.Size + appB.Size + cfgA.Size + cfgB.Size + a.Size + b.Size
+	if r.TotalBytes != total || r.SharedBytes != base.Size || r.DedupSavedBytes != base.Size {
+		t.Errorf("unexpected totals %+v (want total %d)", r, total)
+	}
+}
+
+func TestSelectAndWriteSubset(t *testing.T) {
+	l := newLayout(t)
+	shared := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("base"))
+	nginxCfg := l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","config":{"Labels":{"team":"web"}}}`))
+	nginx := l.manifest(nginxCfg, shared, l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("nginx")))
+	redis := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux"}`)), shared)
+	chart := l.manifest(l.blob(MediaTypeChartConfig, []byte(`{"name":"podinfo","version":"6.5.0"}`)),
+		l.blob(MediaTypeChartLayer, []byte("chart")))
+	sig := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"sig":true}`)), l.blob("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig")))
+	sigName := "docker.io/library/nginx:" + strings.Replace(nginx.Digest, ":", "-", 1) + ".sig"
+	l.writeIndex(
+		named(nginx, "docker.io/library/nginx:1.25"),
+		named(redis, "docker.io/library/redis:7"),
+		named(chart, "hauler/podinfo:6.5.0"),
+		named(sig, sigName, AnnotationKind, KindAnnotationSigs),
+	)
+
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		sel  Selection
+		want []int
+	}{
+		{"short ref brings its signature", Selection{Refs: []string{"nginx:1.25"}}, []int{0, 3}},
+		{"digest", Selection{Digests: []string{redis.Digest}}, []int{1}},
+		{"glob", Selection{Match: "docker.io/library/*"}, []int{0, 1, 3}},
+		{"type", Selection{Types: []string{"chart"}}, []int{2}},
+		{"config label", Selection{Labels: map[string]string{"team": "web"}}, []int{0, 3}},
+		{"glob narrowed by type", Selection{Match: "*", Types: []string{"image"}}, []int{0, 1, 3}},
+	}
+	for _, tc := range cases {
+		got, err := s.Select(tc.sel)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: selected %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if _, err := s.Select(Selection{Refs: []string{"nope:1"}}); err == nil || !strings.Contains(err.Error(), "nope:1") {
+		t.Errorf("expected an unknown ref to be reported, got %v", err)
+	}
+
+	picked, _ := s.Select(Selection{Refs: []string{"docker.io/library/redis:7"}})
+	dir := filepath.Join(t.TempDir(), "subset")
+	size, err := s.WriteSubset(dir, picked)
+	if err != nil {
+		t.Fatalf("WriteSubset: %v", err)
+	}
+	sub, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open(subset): %v", err)
+	}
+	if len(sub.Artifacts) != 1 || sub.Artifacts[0].Name != "docker.io/library/redis:7" || sub.Artifacts[0].Size != size {
+		t.Fatalf("unexpected subset %+v (size %d)", sub.Artifacts, size)
+	}
+	if plan, _ := sub.PlanGC(); len(plan.Orphans) != 0 || plan.Reachable != 3 {
+		t.Errorf("expected exactly the redis blobs in the subset, got %+v", plan)
+	}
+	// The source store is untouched.
+	if again, _ := Open(l.dir); len(again.Artifacts) != 4 {
+		t.Errorf("source store changed: %d artifacts", len(again.Artifacts))
+	}
+}
+
+func TestPlanRetag(t *testing.T) {
+	l := newLayout(t)
+	layer := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("layer"))
+	nginx := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"architecture":"amd64","os":"linux"}`)), layer)
+	redis := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux"}`)), layer)
+	sig := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{}`)), l.blob("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig")))
+	l.writeIndex(
+		named(nginx, "docker.io/library/nginx:1.25", AnnotationRefName, "1.25", AnnotationKind, KindAnnotationImage),
+		named(redis, "docker.io/library/redis:7", AnnotationKind, KindAnnotationImage),
+		named(sig, "docker.io/library/nginx:"+AttachmentTag(nginx.Digest, "sig"), AnnotationKind, KindAnnotationSigs),
+	)
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	for _, tc := range []struct {
+		ops  []RetagOp
+		want string
+	}{
+		{[]RetagOp{{Action: RetagActionChange, From: "docker.io/library/nginx:1.25", To: "docker.io/library/redis:7"}}, "would refer to both"},
+		{[]RetagOp{{Action: RetagActionRemove, From: "docker.io/library/redis:7"}}, "last reference"},
+		{[]RetagOp{{Action: RetagActionChange, From: "docker.io/library/nginx:1.24", To: "nginx"}}, "no reference"},
+		{[]RetagOp{{Action: RetagActionChange, From: "docker.io/library/nginx:1.25", To: "Not A Ref"}}, "not a valid"},
+	} {
+		if _, err := s.PlanRetag(tc.ops, nil); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("PlanRetag(%+v) = %v, want %q", tc.ops, err, tc.want)
+		}
+	}
+
+	// Tag nginx again, move everything to a local registry, then drop the
+	// extra tag: the signature follows nginx into its new repository.
+	plan, err := s.PlanRetag([]RetagOp{
+		{Action: RetagActionAdd, From: "docker.io/library/nginx:1.25", To: "docker.io/library/nginx:stable"},
+		{Action: RetagActionChange, From: "docker.io/library/redis:7", To: "docker.io/cache/redis"},
+	}, []RetagRule{{Type: RetagRuleRegistry, From: "docker.io", To: "registry.local:5000"}})
+	if err != nil {
+		t.Fatalf("PlanRetag: %v", err)
+	}
+	if err := plan.Apply(l.dir); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	s, err = Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	got := map[string]string{}
+	for _, a := range s.Artifacts {
+		got[a.Name] = a.Digest
+	}
+	want := map[string]string{
+		"registry.local:5000/library/nginx:1.25":                                  nginx.Digest,
+		"registry.local:5000/library/nginx:stable":                                nginx.Digest,
+		"registry.local:5000/cache/redis:7":                                       redis.Digest,
+		"registry.local:5000/library/nginx:" + AttachmentTag(nginx.Digest, "sig"): sig.Digest,
+	}
+	if len(got) != len(want) {
+		t.Errorf("artifacts = %v, want %v", got, want)
+	}
+	for name, d := range want {
+		if got[name] != d {
+			t.Errorf("%s = %q, want %s", name, got[name], d)
+		}
+	}
+	if ref := s.Index.Manifests[0].Annotations[AnnotationRefName]; ref != "1.25" {
+		t.Errorf("ref name = %q, want the tag kept as a tag", ref)
+	}
+	if n := len(plan.Changes); n != 4 {
+		t.Errorf("expected 4 changes, got %+v", plan.Changes)
+	}
+	for _, c := range plan.Changes {
+		if c.Kind == KindSignature && (c.From == "" || c.To == "") {
+			t.Errorf("expected the signature to move, got %+v", c)
+		}
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	l := newLayout(t)
+	shared := l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte("shared base layer"))
+	platform := func(arch, layer string) Descriptor {
+		m := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"`+arch+`"}`)),
+			shared, l.blob("application/vnd.oci.image.layer.v1.tar+gzip", []byte(layer)))
+		m.Platform = &Platform{OS: "linux", Architecture: arch}
+		return m
+	}
+	amd64 := platform("amd64", "amd64 layer")
+	arm64 := platform("arm64", "arm64 layer, rather larger than the others")
+	att := l.manifest(l.blob(MediaTypeOCIConfig, []byte(`{}`)), l.blob("application/vnd.in-toto+json", []byte(`{"predicate":{}}`)))
+	att.Platform = &Platform{OS: "unknown", Architecture: "unknown"}
+	att.Annotations = map[string]string{annotationReferenceType: "attestation-manifest", annotationReferenceDigest: arm64.Digest}
+	app := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{amd64, arm64, att}})
+	armOnly := l.json(MediaTypeOCIIndex, Index{SchemaVersion: 2, MediaType: MediaTypeOCIIndex, Manifests: []Descriptor{platform("arm64", "arm only")}})
+	subject := app
+	sig := l.json(MediaTypeOCIManifest, Manifest{SchemaVersion: 2, MediaType: MediaTypeOCIManifest,
+		Config: l.blob(MediaTypeOCIConfig, []byte(`{"sig":true}`)), Layers: []Descriptor{l.blob("application/vnd.dev.cosign.simplesigning.v1+json", []byte("sig"))}, Subject: &subject})
+	l.writeIndex(
+		named(app, "docker.io/library/app:1"),
+		named(app, "docker.io/library/app:latest"),
+		named(armOnly, "docker.io/library/tool:1"),
+		named(sig, "docker.io/library/app:"+AttachmentTag(app.Digest, "sig"), AnnotationKind, KindAnnotationSigs),
+	)
+	s, err := Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	all := []int{0, 1, 2, 3}
+
+	if _, err := s.PlanPrune([]string{"amd64"}, all, false); err == nil {
+		t.Error("expected an invalid platform to be refused")
+	}
+	kept, err := s.PlanPrune([]string{"linux/amd64"}, all, true)
+	if err != nil {
+		t.Fatalf("PlanPrune: %v", err)
+	}
+	plan, err := s.PlanPrune([]string{"linux/amd64"}, all, false)
+	if err != nil {
+		t.Fatalf("PlanPrune: %v", err)
+	}
+	if len(plan.Images) != 2 {
+		t.Fatalf("expected two images, got %+v", plan.Images)
+	}
+	got := plan.Images[0]
+	if got.Digest != app.Digest || len(got.Refs) != 2 || got.Attachments != 1 ||
+		strings.Join(got.Kept, ",") != "linux/amd64" || strings.Join(got.Removed, ",") != "linux/arm64" {
+		t.Errorf("unexpected app plan %+v", got)
+	}
+	if tool := plan.Images[1]; tool.Skipped == "" || tool.PrunedDigest != "" {
+		t.Errorf("expected the arm64-only image to be skipped, got %+v", tool)
+	}
+	if got.SavedBytes <= 0 || plan.SavedBytes != got.SavedBytes {
+		t.Errorf("saved %d for the image, %d in total", got.SavedBytes, plan.SavedBytes)
+	}
+	// Keeping the signature keeps the original index, and so every platform.
+	for _, img := range kept.Images {
+		if img.Digest == app.Digest && (img.SavedBytes >= 0 || kept.SavedBytes >= 0) {
+			t.Errorf("expected nothing saved while attachments hold the original, got %+v", img)
+		}
+	}
+
+	if err := plan.Apply(l.dir); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	s, err = Open(l.dir)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if len(s.Artifacts) != 3 {
+		t.Fatalf("expected the stale signature to be dropped, got %d artifacts", len(s.Artifacts))
+	}
+	for _, a := range s.Artifacts[:2] {
+		if a.Digest != got.PrunedDigest || strings.Join(a.Platforms(), ",") != "linux/amd64" || a.Annotations[AnnotationOriginalIndex] != app.Digest {
+			t.Errorf("%s: digest %s, platforms %v, annotations %v", a.Name, a.Digest, a.Platforms(), a.Annotations)
+		}
+	}
+	idx, _ := s.ImageIndex(got.PrunedDigest)
+	if len(idx.Manifests) != 1 || idx.Annotations[AnnotationOriginalIndex] != app.Digest {
+		t.Errorf("pruned index = %+v", idx)
+	}
+
+	// The preview matches what garbage collection then frees.
+	gc, err := s.PlanGC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := gc.OrphanBytes - int64(len(mustRead(t, s, got.PrunedDigest))); plan.SavedBytes != want {
+		t.Errorf("plan saved %d, gc frees %d net", plan.SavedBytes, want)
+	}
+}
+
+func mustRead(t *testing.T, s *Store, digest string) []byte {
+	t.Helper()
+	data, err := s.ReadBlob(digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
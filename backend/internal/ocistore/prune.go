@@ -0,0 +1,373 @@
+package ocistore
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AnnotationOriginalIndex records, on an image index pruned to fewer
+// platforms and on its index.json entry, the digest of the index it was
+// pruned from.
+const AnnotationOriginalIndex = "dev.hauler/original-index"
+
+// Annotations buildkit puts on the attestation manifests of an image index.
+const (
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+)
+
+// ImagePrune is what pruning does to one multi-arch image.
+type ImagePrune struct {
+	Name         string   `json:"name"`
+	Refs         []string `json:"refs,omitempty"` // every reference to the image, if several
+	Digest       string   `json:"digest"`
+	PrunedDigest string   `json:"prunedDigest,omitempty"` // the rewritten index
+	Kept         []string `json:"kept"`
+	Removed      []string `json:"removed"`
+	// SavedBytes is what garbage collection frees once this image alone is
+	// pruned; blobs shared with other pruned images count toward the plan's
+	// total only.
+	SavedBytes int64 `json:"savedBytes"`
+	// Attachments counts the signatures, attestations and SBOMs of the
+	// original index or of removed platforms, which no longer describe the
+	// image.
+	Attachments int `json:"attachments"`
+	// Skipped says why the image is left as it is.
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// PrunePlan is the outcome of pruning a store's images to some platforms.
+type PrunePlan struct {
+	Platforms  []string     `json:"platforms"`
+	Images     []ImagePrune `json:"images"`
+	SavedBytes int64        `json:"savedBytes"`
+
+	index Index
+	blobs map[string][]byte // rewritten indexes by digest
+}
+
+// Changed reports whether applying the plan rewrites anything.
+func (p *PrunePlan) Changed() bool { return len(p.blobs) > 0 }
+
+// platformMatcher matches platforms against "os/arch[/variant]" specs; a
+// spec without a variant matches every variant.
+type platformMatcher []Platform
+
+func parsePlatforms(specs []string) (platformMatcher, error) {
+	var m platformMatcher
+	for _, spec := range specs {
+		parts := strings.Split(spec, "/")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid platform %q (want os/arch[/variant])", spec)
+		}
+		p := Platform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			p.Variant = parts[2]
+		}
+		m = append(m, p)
+	}
+	if len(m) == 0 {
+		return nil, fmt.Errorf("no platforms given")
+	}
+	return m, nil
+}
+
+func (m platformMatcher) match(p *Platform) bool {
+	for _, want := range m {
+		if p.OS == want.OS && p.Architecture == want.Architecture && (want.Variant == "" || p.Variant == want.Variant) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneGroup is one multi-arch image, which may be referenced by several
+// index.json entries.
+type pruneGroup struct {
+	entries     []int // indexes into Index.Manifests
+	attachments []int // stale attachments
+	kept        []Descriptor
+	raw         map[string]json.RawMessage
+	annotations map[string]string
+	result      *ImagePrune
+}
+
+// PlanPrune plans rewriting the multi-arch images among artifacts (indexes
+// from Select) to keep only the given platforms. Platform-less entries of an
+// index are kept, except buildkit attestations of removed platforms. Images
+// with none of the platforms are skipped rather than emptied. Attachments
+// that described the original index or removed platforms are dropped from
+// index.json unless keepAttachments is set, in which case their subjects keep
+// the original index, and its blobs, from being collected. Nothing is written
+// and no blob is deleted: collect garbage to reclaim the space.
+func (s *Store) PlanPrune(platforms []string, artifacts []int, keepAttachments bool) (*PrunePlan, error) {
+	match, err := parsePlatforms(platforms)
+	if err != nil {
+		return nil, err
+	}
+	plan := &PrunePlan{Platforms: platforms, Images: []ImagePrune{}, blobs: map[string][]byte{}}
+
+	groups := map[string]*pruneGroup{}
+	var order []string
+	for _, i := range artifacts {
+		a := &s.Artifacts[i]
+		if a.Kind != KindImage || !IsIndex(a.MediaType) || a.Error != "" {
+			continue
+		}
+		if g, ok := groups[a.Digest]; ok {
+			g.entries = append(g.entries, i)
+			g.result.Refs = append(g.result.Refs, a.Name)
+			continue
+		}
+		g, err := s.prunePlatforms(a, match)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a.Name, err)
+		}
+		g.entries = []int{i}
+		groups[a.Digest] = g
+		order = append(order, a.Digest)
+	}
+
+	// Find each pruned image's stale attachments.
+	for i := range s.Artifacts {
+		b := &s.Artifacts[i]
+		if b.Kind.Content() {
+			continue
+		}
+		for _, digest := range order {
+			g := groups[digest]
+			if g.result.Skipped != "" || len(g.result.Removed) == 0 {
+				continue
+			}
+			stale := attachedTo(b, &Artifact{Digest: digest})
+			for _, m := range s.Artifacts[g.entries[0]].Manifests {
+				if !stale && !containsDigest(g.kept, m.Digest) {
+					stale = attachedTo(b, &Artifact{Digest: m.Digest})
+				}
+			}
+			if stale {
+				g.attachments = append(g.attachments, i)
+				g.result.Attachments++
+				break
+			}
+		}
+	}
+
+	// What each index.json entry keeps reachable, and how many entries reach
+	// each blob.
+	closures := make([]map[string]int64, len(s.Index.Manifests))
+	reached := map[string]int{}
+	before := map[string]int64{}
+	for i, d := range s.Index.Manifests {
+		closures[i] = s.closure([]Descriptor{d})
+		for digest, size := range closures[i] {
+			reached[digest]++
+			before[digest] = size
+		}
+	}
+
+	rewritten := map[int]Descriptor{}
+	dropped := map[int]bool{}
+	newRoots := map[string]int64{}
+	for _, digest := range order {
+		g := groups[digest]
+		if g.result.Skipped != "" || len(g.result.Removed) == 0 {
+			if len(g.result.Refs) == 1 {
+				g.result.Refs = nil
+			}
+			plan.Images = append(plan.Images, *g.result)
+			continue
+		}
+
+		// The rewritten index.
+		annotations := map[string]string{}
+		for k, v := range g.annotations {
+			annotations[k] = v
+		}
+		if annotations[AnnotationOriginalIndex] == "" {
+			annotations[AnnotationOriginalIndex] = digest
+		}
+		raw := map[string]json.RawMessage{}
+		for k, v := range g.raw {
+			raw[k] = v
+		}
+		var err error
+		if raw["manifests"], err = json.Marshal(g.kept); err != nil {
+			return nil, err
+		}
+		if raw["annotations"], err = json.Marshal(annotations); err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		pruned := blobDescriptor(s.Index.Manifests[g.entries[0]].MediaType, data)
+		plan.blobs[pruned.Digest] = data
+		g.result.PrunedDigest = pruned.Digest
+		for _, i := range g.entries {
+			d := s.Index.Manifests[i]
+			d.Digest, d.Size = pruned.Digest, pruned.Size
+			d.Annotations = map[string]string{}
+			for k, v := range s.Index.Manifests[i].Annotations {
+				d.Annotations[k] = v
+			}
+			d.Annotations[AnnotationOriginalIndex] = annotations[AnnotationOriginalIndex]
+			rewritten[i] = d
+		}
+		if !keepAttachments {
+			for _, i := range g.attachments {
+				dropped[i] = true
+			}
+		}
+
+		// Blobs only this image's original entries (and stale attachments
+		// being dropped) reach, and its pruned index does not.
+		after := s.closure(g.kept)
+		after[pruned.Digest] = pruned.Size
+		roots := map[int]bool{}
+		for _, i := range g.entries {
+			roots[i] = true
+		}
+		if !keepAttachments {
+			for _, i := range g.attachments {
+				roots[i] = true
+			}
+		}
+		own := map[string]int{}
+		for i := range roots {
+			for d := range closures[i] {
+				own[d]++
+			}
+		}
+		for d, n := range own {
+			if _, ok := after[d]; !ok && n == reached[d] {
+				g.result.SavedBytes += before[d]
+			}
+		}
+		g.result.SavedBytes -= pruned.Size
+		for d, size := range after {
+			newRoots[d] = size
+		}
+		if len(g.result.Refs) == 1 {
+			g.result.Refs = nil
+		}
+		plan.Images = append(plan.Images, *g.result)
+	}
+
+	// The store-wide saving counts blobs shared by pruned images once.
+	idx := s.Index
+	idx.Manifests = nil
+	after := map[string]int64{}
+	for i, d := range s.Index.Manifests {
+		if dropped[i] {
+			continue
+		}
+		if r, ok := rewritten[i]; ok {
+			idx.Manifests = append(idx.Manifests, r)
+			continue
+		}
+		idx.Manifests = append(idx.Manifests, d)
+		for digest, size := range closures[i] {
+			after[digest] = size
+		}
+	}
+	for d, size := range newRoots {
+		after[d] = size
+	}
+	for d, size := range before {
+		if _, ok := after[d]; !ok {
+			plan.SavedBytes += size
+		}
+	}
+	for d := range plan.blobs {
+		plan.SavedBytes -= after[d]
+	}
+	plan.index = idx
+	sort.SliceStable(plan.Images, func(i, j int) bool { return plan.Images[i].SavedBytes > plan.Images[j].SavedBytes })
+	return plan, nil
+}
+
+// prunePlatforms works out which entries of a multi-arch image's index to
+// keep.
+func (s *Store) prunePlatforms(a *Artifact, match platformMatcher) (*pruneGroup, error) {
+	data, err := s.ReadBlob(a.Digest)
+	if err != nil {
+		return nil, err
+	}
+	g := &pruneGroup{result: &ImagePrune{Name: a.Name, Refs: []string{a.Name}, Digest: a.Digest, Kept: []string{}, Removed: []string{}}}
+	var idx Index
+	if err := json.Unmarshal(data, &g.raw); err != nil {
+		return nil, fmt.Errorf("parsing index: %w", err)
+	}
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parsing index: %w", err)
+	}
+	g.annotations = idx.Annotations
+
+	keep := map[string]bool{}
+	for _, m := range idx.Manifests {
+		if m.Platform == nil || m.Annotations[annotationReferenceType] != "" {
+			continue
+		}
+		if match.match(m.Platform) {
+			keep[m.Digest] = true
+			g.result.Kept = append(g.result.Kept, m.Platform.String())
+		} else {
+			g.result.Removed = append(g.result.Removed, m.Platform.String())
+		}
+	}
+	if len(keep) == 0 {
+		g.result.Skipped = "provides none of the selected platforms (has " + strings.Join(g.result.Removed, ", ") + ")"
+		g.result.Removed = []string{}
+		return g, nil
+	}
+	for _, m := range idx.Manifests {
+		switch {
+		case m.Annotations[annotationReferenceType] != "":
+			// A buildkit attestation stays with the platform it describes.
+			if keep[m.Annotations[annotationReferenceDigest]] {
+				g.kept = append(g.kept, m)
+			}
+		case m.Platform == nil || keep[m.Digest]:
+			g.kept = append(g.kept, m)
+		}
+	}
+	return g, nil
+}
+
+// closure returns every blob reachable from roots, with sizes.
+func (s *Store) closure(roots []Descriptor) map[string]int64 {
+	out := map[string]int64{}
+	s.walkRefs(roots, func(d Descriptor, _ string) bool {
+		out[d.Digest] = d.Size
+		return true
+	}, func(Descriptor, error) {})
+	return out
+}
+
+func containsDigest(descs []Descriptor, digest string) bool {
+	for _, d := range descs {
+		if d.Digest == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply writes the rewritten indexes and index.json into the layout at dir.
+// The blobs of removed platforms stay until garbage is collected.
+func (p *PrunePlan) Apply(dir string) error {
+	for _, data := range p.blobs {
+		if _, err := putBlob(dir, "", data); err != nil {
+			return err
+		}
+	}
+	if err := writeIndex(dir, p.index); err != nil {
+		return err
+	}
+	Invalidate(dir)
+	return nil
+}
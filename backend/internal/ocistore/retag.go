@@ -0,0 +1,463 @@
+package ocistore
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Retag actions.
+const (
+	RetagActionAdd    = "add"    // tag the artifact From refers to as To as well
+	RetagActionChange = "change" // rename From to To
+	RetagActionRemove = "remove" // drop the reference From
+)
+
+// Retag rule types.
+const (
+	// RetagRulePrefix replaces a leading From of a reference with To, e.g.
+	// "docker.io/library/" with "registry.local/mirror/".
+	RetagRulePrefix = "prefix"
+	// RetagRuleRegistry replaces the registry From (the reference's first
+	// component, e.g. "docker.io") with To.
+	RetagRuleRegistry = "registry"
+)
+
+// RetagOp adds, changes or removes one reference in a store's index.json.
+type RetagOp struct {
+	Action string `json:"action"`
+	From   string `json:"from"`             // an existing reference
+	Digest string `json:"digest,omitempty"` // picks among entries sharing From
+	// To is the new reference for add and change. Without a tag, From's tag
+	// is kept.
+	To string `json:"to,omitempty"`
+}
+
+// RetagRule rewrites every image, chart and file reference it matches.
+type RetagRule struct {
+	Type string `json:"type"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Keep adds the rewritten reference beside the original instead of
+	// replacing it.
+	Keep bool `json:"keep,omitempty"`
+}
+
+// RetagChange is one reference added, changed or removed by a retag.
+type RetagChange struct {
+	Kind   Kind   `json:"kind"`
+	Digest string `json:"digest"`
+	From   string `json:"from,omitempty"` // empty when added
+	To     string `json:"to,omitempty"`   // empty when removed
+}
+
+// RetagPlan is the outcome of a retag: the reference changes and the index
+// that results.
+type RetagPlan struct {
+	Changes []RetagChange `json:"changes"`
+
+	index Index
+}
+
+// referenceRe matches a tagged image reference: an optional registry host
+// and port, lowercase path components, and a tag.
+var referenceRe = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*(?::[0-9]+)?(?:/[a-z0-9]+(?:[._-]+[a-z0-9]+)*)*:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// retagEntry is an index.json entry with its kind.
+type retagEntry struct {
+	Descriptor
+	kind Kind
+}
+
+func (e *retagEntry) name() string { return artifactName(e.Annotations) }
+
+// PlanRetag applies ops, then rules, in order to the store's index.json and
+// returns the changes without writing anything. Only image, chart and file
+// references are retagged; signatures, attestations and SBOMs follow their
+// image into the repositories it is tagged in, since clients look them up
+// there. Retagging may not make one reference name two artifacts, or remove
+// the last reference to an artifact (delete the artifact from the haul for
+// that).
+func (s *Store) PlanRetag(ops []RetagOp, rules []RetagRule) (*RetagPlan, error) {
+	entries := make([]retagEntry, len(s.Index.Manifests))
+	for i, d := range s.Index.Manifests {
+		entries[i] = retagEntry{Descriptor: d}
+		if i < len(s.Artifacts) {
+			entries[i].kind = s.Artifacts[i].Kind
+		}
+	}
+	before := append([]retagEntry(nil), entries...)
+
+	for _, op := range ops {
+		var err error
+		if entries, err = applyRetagOp(entries, op); err != nil {
+			return nil, err
+		}
+	}
+	for _, rule := range rules {
+		var err error
+		if entries, err = applyRetagRule(entries, rule); err != nil {
+			return nil, err
+		}
+	}
+	entries = followAttachments(before, entries)
+
+	// Reject conflicts and drop exact duplicates, e.g. adding a reference an
+	// artifact already has.
+	seen := map[string]string{}
+	kept := entries[:0]
+	for _, e := range entries {
+		name := e.name()
+		if name == "" {
+			kept = append(kept, e)
+			continue
+		}
+		key := e.Annotations[AnnotationKind] + "|" + name
+		if d, ok := seen[key]; ok {
+			if d != e.Digest {
+				return nil, fmt.Errorf("%s would refer to both %s and %s", name, d, e.Digest)
+			}
+			continue
+		}
+		seen[key] = e.Digest
+		kept = append(kept, e)
+	}
+	entries = kept
+
+	remaining := map[string]bool{}
+	for _, e := range entries {
+		remaining[e.Digest] = true
+	}
+	for _, e := range before {
+		if e.kind.Content() && !remaining[e.Digest] {
+			return nil, fmt.Errorf("retag would remove the last reference to %s (%s); remove it from the haul instead", e.name(), e.Digest)
+		}
+	}
+
+	idx := s.Index
+	idx.Manifests = make([]Descriptor, len(entries))
+	for i, e := range entries {
+		idx.Manifests[i] = e.Descriptor
+	}
+	return &RetagPlan{Changes: retagChanges(before, entries), index: idx}, nil
+}
+
+// Apply writes the planned index.json into the layout at dir. Blobs are not
+// touched; the store must not have changed since it was planned.
+func (p *RetagPlan) Apply(dir string) error {
+	if err := writeIndex(dir, p.index); err != nil {
+		return err
+	}
+	Invalidate(dir)
+	return nil
+}
+
+func applyRetagOp(entries []retagEntry, op RetagOp) ([]retagEntry, error) {
+	var found []int
+	for i := range entries {
+		e := &entries[i]
+		if e.kind.Content() && e.name() == op.From && (op.Digest == "" || e.Digest == op.Digest) {
+			found = append(found, i)
+		}
+	}
+	switch {
+	case op.From == "":
+		return nil, fmt.Errorf("%s: from is required", op.Action)
+	case len(found) == 0:
+		return nil, fmt.Errorf("no reference %s in the haul", op.From)
+	case len(found) > 1:
+		return nil, fmt.Errorf("%s names %d artifacts; give the digest of one", op.From, len(found))
+	}
+	i := found[0]
+
+	switch op.Action {
+	case RetagActionRemove:
+		return append(entries[:i:i], entries[i+1:]...), nil
+	case RetagActionAdd, RetagActionChange:
+		to, err := retagTarget(op.To, op.From)
+		if err != nil {
+			return nil, err
+		}
+		renamed := renameEntry(entries[i], to)
+		if op.Action == RetagActionAdd {
+			return append(entries, renamed), nil
+		}
+		entries[i] = renamed
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unknown retag action %q", op.Action)
+	}
+}
+
+func applyRetagRule(entries []retagEntry, rule RetagRule) ([]retagEntry, error) {
+	var rewrite func(string) (string, bool)
+	switch rule.Type {
+	case RetagRulePrefix:
+		if rule.From == "" {
+			return nil, fmt.Errorf("prefix rule: from is required")
+		}
+		rewrite = func(name string) (string, bool) {
+			if !strings.HasPrefix(name, rule.From) {
+				return "", false
+			}
+			return rule.To + strings.TrimPrefix(name, rule.From), true
+		}
+	case RetagRuleRegistry:
+		if rule.From == "" || rule.To == "" || strings.Contains(rule.From, "/") || strings.Contains(rule.To, "/") {
+			return nil, fmt.Errorf("registry rule: from and to must be registry hosts, e.g. docker.io")
+		}
+		rewrite = func(name string) (string, bool) {
+			host, rest, ok := strings.Cut(name, "/")
+			if !ok || host != rule.From {
+				return "", false
+			}
+			return rule.To + "/" + rest, true
+		}
+	default:
+		return nil, fmt.Errorf("unknown retag rule type %q", rule.Type)
+	}
+
+	n := len(entries)
+	for i := 0; i < n; i++ {
+		name := entries[i].name()
+		if !entries[i].kind.Content() || name == "" {
+			continue
+		}
+		to, ok := rewrite(name)
+		if !ok || to == name {
+			continue
+		}
+		if !referenceRe.MatchString(to) {
+			return nil, fmt.Errorf("%s rule rewrites %s to %q, which is not a valid reference", rule.Type, name, to)
+		}
+		renamed := renameEntry(entries[i], to)
+		if rule.Keep {
+			entries = append(entries, renamed)
+		} else {
+			entries[i] = renamed
+		}
+	}
+	return entries, nil
+}
+
+// retagTarget validates an op's new reference, giving it from's tag if it
+// has none.
+func retagTarget(to, from string) (string, error) {
+	if to == "" {
+		return "", fmt.Errorf("to is required")
+	}
+	if Repository(to) == to && !strings.Contains(to, "@") {
+		to += ":" + referenceTag(from)
+	}
+	if !referenceRe.MatchString(to) {
+		return "", fmt.Errorf("%q is not a valid tagged reference", to)
+	}
+	return to, nil
+}
+
+// referenceTag returns a reference's tag, or "latest" if it has none.
+func referenceTag(ref string) string {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[i+1:]
+	}
+	return "latest"
+}
+
+// renameEntry returns a copy of e referring to to. The containerd name
+// carries the full reference; the OCI ref name keeps the form it had,
+// either the full reference or just the tag.
+func renameEntry(e retagEntry, to string) retagEntry {
+	old := e.name()
+	ann := make(map[string]string, len(e.Annotations)+1)
+	for k, v := range e.Annotations {
+		ann[k] = v
+	}
+	_, hasName := ann[AnnotationContainerdName]
+	if hasName {
+		ann[AnnotationContainerdName] = to
+	}
+	switch ref, hasRef := ann[AnnotationRefName]; {
+	case !hasName || ref == old:
+		ann[AnnotationRefName] = to
+	case hasRef:
+		ann[AnnotationRefName] = referenceTag(to)
+	}
+	e.Annotations = ann
+	return e
+}
+
+// followAttachments moves or copies the attachments of retagged artifacts
+// so each repository an artifact is tagged in carries its signatures,
+// attestations and SBOMs, and repositories it has left no longer do.
+func followAttachments(before, after []retagEntry) []retagEntry {
+	repos := func(entries []retagEntry) map[string]map[string]bool {
+		out := map[string]map[string]bool{}
+		for i := range entries {
+			e := &entries[i]
+			if name := e.name(); e.kind.Content() && name != "" {
+				if out[e.Digest] == nil {
+					out[e.Digest] = map[string]bool{}
+				}
+				out[e.Digest][Repository(name)] = true
+			}
+		}
+		return out
+	}
+	was, is := repos(before), repos(after)
+
+	type attachment struct {
+		index        int
+		repo, suffix string
+	}
+	byDigest := map[string][]attachment{}
+	for i := range after {
+		e := &after[i]
+		m := attachmentTagRe.FindStringSubmatch(e.name())
+		if e.kind.Content() || m == nil {
+			continue
+		}
+		tag := strings.TrimPrefix(m[0], ":")
+		digest := strings.Replace(strings.TrimSuffix(tag, "."+m[1]), "-", ":", 1)
+		byDigest[digest] = append(byDigest[digest], attachment{i, Repository(e.name()), m[1]})
+	}
+
+	drop := map[int]bool{}
+	for digest, atts := range byDigest {
+		if sameSet(was[digest], is[digest]) || len(is[digest]) == 0 {
+			continue
+		}
+		have := map[string]bool{}
+		for _, a := range atts {
+			have[a.repo+"|"+a.suffix] = true
+		}
+		for _, a := range atts {
+			for repo := range is[digest] {
+				if !have[repo+"|"+a.suffix] {
+					have[repo+"|"+a.suffix] = true
+					after = append(after, renameEntry(after[a.index], repo+":"+AttachmentTag(digest, a.suffix)))
+				}
+			}
+			if was[digest][a.repo] && !is[digest][a.repo] {
+				drop[a.index] = true
+			}
+		}
+	}
+	if len(drop) == 0 {
+		return after
+	}
+	kept := make([]retagEntry, 0, len(after)-len(drop))
+	for i, e := range after {
+		if !drop[i] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+func sameSet(a, b map[string]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if !b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// retagChanges lists the references removed and added between two indexes,
+// pairing a removal with an addition of the same artifact as a change.
+func retagChanges(before, after []retagEntry) []RetagChange {
+	type ref struct {
+		kind   Kind
+		digest string
+	}
+	names := func(entries []retagEntry) (map[ref][]string, map[ref]map[string]bool) {
+		order, set := map[ref][]string{}, map[ref]map[string]bool{}
+		for i := range entries {
+			e := &entries[i]
+			name := e.name()
+			if name == "" {
+				continue
+			}
+			r := ref{e.kind, e.Digest}
+			if set[r] == nil {
+				set[r] = map[string]bool{}
+			}
+			if !set[r][name] {
+				set[r][name] = true
+				order[r] = append(order[r], name)
+			}
+		}
+		return order, set
+	}
+	oldOrder, oldSet := names(before)
+	newOrder, newSet := names(after)
+
+	var refs []ref
+	seen := map[ref]bool{}
+	for _, entries := range [][]retagEntry{before, after} {
+		for i := range entries {
+			r := ref{entries[i].kind, entries[i].Digest}
+			if !seen[r] {
+				seen[r] = true
+				refs = append(refs, r)
+			}
+		}
+	}
+
+	changes := []RetagChange{}
+	for _, r := range refs {
+		var removed, added []string
+		for _, n := range oldOrder[r] {
+			if !newSet[r][n] {
+				removed = append(removed, n)
+			}
+		}
+		for _, n := range newOrder[r] {
+			if !oldSet[r][n] {
+				added = append(added, n)
+			}
+		}
+		for len(removed) > 0 || len(added) > 0 {
+			c := RetagChange{Kind: r.kind, Digest: r.digest}
+			if len(removed) > 0 {
+				c.From, removed = removed[0], removed[1:]
+			}
+			if len(added) > 0 {
+				c.To, added = added[0], added[1:]
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// writeIndex replaces dir's index.json.
+func writeIndex(dir string, idx Index) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".index-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, "index.json"))
+}
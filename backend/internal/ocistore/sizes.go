@@ -0,0 +1,75 @@
+package ocistore
+
+import "sort"
+
+// ArtifactSize is how an artifact's bytes are shared with the rest of a store.
+type ArtifactSize struct {
+	Name   string `json:"name"`
+	Kind   Kind   `json:"kind"`
+	Digest string `json:"digest"`
+	Blobs  int    `json:"blobs"`
+	// TotalBytes counts every distinct blob the artifact references,
+	// SharedBytes those also referenced by another artifact, and UniqueBytes
+	// the rest: what removing the artifact (and collecting garbage) frees.
+	TotalBytes  int64 `json:"totalBytes"`
+	SharedBytes int64 `json:"sharedBytes"`
+	UniqueBytes int64 `json:"uniqueBytes"`
+}
+
+// SizeReport breaks a store's size down per artifact.
+type SizeReport struct {
+	Artifacts []ArtifactSize `json:"artifacts"` // largest unique bytes first
+	// TotalBytes counts each referenced blob once; ReferencedBytes sums the
+	// artifacts' totals, so their difference is what deduplication saves.
+	TotalBytes      int64 `json:"totalBytes"`
+	ReferencedBytes int64 `json:"referencedBytes"`
+	SharedBytes     int64 `json:"sharedBytes"` // blobs used by more than one artifact, counted once
+	UniqueBytes     int64 `json:"uniqueBytes"`
+	DedupSavedBytes int64 `json:"dedupSavedBytes"`
+}
+
+// Sizes computes the store's size breakdown. It is computed once per parsed
+// store, so with Load it is cached until the store changes.
+func (s *Store) Sizes() *SizeReport {
+	s.sizesOnce.Do(func() { s.sizes = s.computeSizes() })
+	return s.sizes
+}
+
+func (s *Store) computeSizes() *SizeReport {
+	refs := map[string]int{}
+	sizes := map[string]int64{}
+	perArtifact := make([]map[string]int64, len(s.Artifacts))
+	for i := range s.Artifacts {
+		perArtifact[i] = s.Artifacts[i].blobs()
+		for d, size := range perArtifact[i] {
+			refs[d]++
+			sizes[d] = size
+		}
+	}
+
+	r := &SizeReport{Artifacts: make([]ArtifactSize, 0, len(s.Artifacts))}
+	for d, size := range sizes {
+		r.TotalBytes += size
+		if refs[d] > 1 {
+			r.SharedBytes += size
+		} else {
+			r.UniqueBytes += size
+		}
+	}
+	for i, a := range s.Artifacts {
+		as := ArtifactSize{Name: a.Name, Kind: a.Kind, Digest: a.Digest, Blobs: len(perArtifact[i])}
+		for d, size := range perArtifact[i] {
+			as.TotalBytes += size
+			if refs[d] > 1 {
+				as.SharedBytes += size
+			} else {
+				as.UniqueBytes += size
+			}
+		}
+		r.ReferencedBytes += as.TotalBytes
+		r.Artifacts = append(r.Artifacts, as)
+	}
+	r.DedupSavedBytes = r.ReferencedBytes - r.TotalBytes
+	sort.SliceStable(r.Artifacts, func(i, j int) bool { return r.Artifacts[i].UniqueBytes > r.Artifacts[j].UniqueBytes })
+	return r
+}
@@ -0,0 +1,280 @@
+package ocistore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Selection picks artifacts out of a store. Refs, Digests and Match each add
+// artifacts; with none of them set every artifact is a candidate. Types and
+// Labels then narrow the candidates down.
+type Selection struct {
+	Refs    []string          `json:"refs,omitempty"`    // artifact names, e.g. "docker.io/library/nginx:1.25" or "nginx:1.25"
+	Digests []string          `json:"digests,omitempty"` // top-level manifest or index digests
+	Match   string            `json:"match,omitempty"`   // glob against artifact names; "*" also matches "/", e.g. "docker.io/rancher/*"
+	Types   []string          `json:"types,omitempty"`   // "image", "chart" or "file"
+	Labels  map[string]string `json:"labels,omitempty"`  // annotations or image config labels; all must match
+}
+
+// Empty reports whether the selection selects the whole store.
+func (sel *Selection) Empty() bool {
+	return sel == nil || (len(sel.Refs) == 0 && len(sel.Digests) == 0 && sel.Match == "" &&
+		len(sel.Types) == 0 && len(sel.Labels) == 0)
+}
+
+// Select returns the indexes (into Artifacts and Index.Manifests) of the
+// artifacts sel picks, plus the signatures, attestations, SBOMs and referrers
+// attached to them. Refs and digests that name no artifact are an error.
+func (s *Store) Select(sel Selection) ([]int, error) {
+	var match *regexp.Regexp
+	if sel.Match != "" {
+		match = globRegexp(sel.Match)
+	}
+	for _, t := range sel.Types {
+		if k := Kind(t); k != KindImage && k != KindChart && k != KindFile {
+			return nil, fmt.Errorf("unknown type %q (want image, chart or file)", t)
+		}
+	}
+
+	named := len(sel.Refs) > 0 || len(sel.Digests) > 0 || sel.Match != ""
+	usedRefs := map[string]bool{}
+	usedDigests := map[string]bool{}
+	picked := map[int]bool{}
+	for i := range s.Artifacts {
+		a := &s.Artifacts[i]
+		if !a.Kind.Content() {
+			continue
+		}
+		if named {
+			hit := false
+			for _, ref := range sel.Refs {
+				if a.Name == ref || strings.HasSuffix(a.Name, "/"+ref) {
+					usedRefs[ref], hit = true, true
+				}
+			}
+			for _, d := range sel.Digests {
+				if a.Digest == d {
+					usedDigests[d], hit = true, true
+				}
+			}
+			if match != nil && match.MatchString(a.Name) {
+				hit = true
+			}
+			if !hit {
+				continue
+			}
+		}
+		if len(sel.Types) > 0 && !containsKind(sel.Types, a.Kind) {
+			continue
+		}
+		if len(sel.Labels) > 0 {
+			labels := s.Labels(a)
+			ok := true
+			for k, v := range sel.Labels {
+				if labels[k] != v {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				continue
+			}
+		}
+		picked[i] = true
+	}
+
+	var unknown []string
+	for _, ref := range sel.Refs {
+		if !usedRefs[ref] {
+			unknown = append(unknown, ref)
+		}
+	}
+	for _, d := range sel.Digests {
+		if !usedDigests[d] {
+			unknown = append(unknown, d)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("not in store: %s", strings.Join(unknown, ", "))
+	}
+
+	// Keep signatures and other attachments with what they describe.
+	for i := range s.Artifacts {
+		if picked[i] || s.Artifacts[i].Kind.Content() {
+			continue
+		}
+		for j := range picked {
+			if attachedTo(&s.Artifacts[i], &s.Artifacts[j]) {
+				picked[i] = true
+				break
+			}
+		}
+	}
+
+	out := make([]int, 0, len(picked))
+	for i := range s.Artifacts {
+		if picked[i] {
+			out = append(out, i)
+		}
+	}
+	return out, nil
+}
+
+// Labels returns an artifact's index.json annotations merged with the labels
+// of its image config (any platform's, for a multi-arch image).
+func (s *Store) Labels(a *Artifact) map[string]string {
+	labels := map[string]string{}
+	configs := []*Descriptor{a.Config}
+	for _, m := range a.Manifests {
+		configs = append(configs, m.Config)
+	}
+	for _, c := range configs {
+		if c == nil || (c.MediaType != MediaTypeOCIConfig && c.MediaType != MediaTypeDockerConfig) {
+			continue
+		}
+		data, err := s.ReadBlob(c.Digest)
+		if err != nil {
+			continue
+		}
+		var ic ImageConfig
+		if json.Unmarshal(data, &ic) == nil {
+			for k, v := range ic.Config.Labels {
+				labels[k] = v
+			}
+		}
+	}
+	for k, v := range a.Annotations {
+		labels[k] = v
+	}
+	return labels
+}
+
+// attachedTo reports whether a (a signature, attestation, SBOM or referrer)
+// describes target, or one of its platform manifests, either through its
+// subject or cosign's "<repo>:sha256-<hex>.<suffix>" tag convention.
+func attachedTo(a, target *Artifact) bool {
+	digests := []string{target.Digest}
+	for _, m := range target.Manifests {
+		digests = append(digests, m.Digest)
+	}
+	tag := ""
+	if i := strings.LastIndex(a.Name, ":"); i >= 0 {
+		tag = a.Name[i+1:]
+	}
+	for _, d := range digests {
+		if a.Subject != nil && a.Subject.Digest == d {
+			return true
+		}
+		if tag != "" && strings.HasPrefix(tag, strings.Replace(d, ":", "-", 1)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp compiles a glob in which "*" matches any run of characters
+// (including "/") and "?" any single character.
+func globRegexp(glob string) *regexp.Regexp {
+	re := regexp.QuoteMeta(glob)
+	re = strings.ReplaceAll(re, `\*`, ".*")
+	re = strings.ReplaceAll(re, `\?`, ".")
+	return regexp.MustCompile("^" + re + "$")
+}
+
+func containsKind(types []string, k Kind) bool {
+	for _, t := range types {
+		if Kind(t) == k {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSubset writes an OCI layout to dir holding only the given artifacts
+// (indexes from Select) and the blobs they reach. Blobs are hardlinked from
+// the store, or copied when dir is on another filesystem, so the source store
+// is never modified. It returns the total bytes of the subset's blobs.
+func (s *Store) WriteSubset(dir string, artifacts []int) (int64, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, err
+	}
+	roots := make([]Descriptor, 0, len(artifacts))
+	for _, i := range artifacts {
+		roots = append(roots, s.Index.Manifests[i])
+	}
+
+	var total int64
+	var linkErr error
+	s.walkRefs(roots, func(d Descriptor, _ string) bool {
+		if linkErr != nil || !ValidDigest(d.Digest) {
+			return false
+		}
+		src := s.BlobPath(d.Digest)
+		info, err := os.Stat(src)
+		if err != nil {
+			// Skipped platforms are referenced but absent; so be it.
+			return false
+		}
+		dst := filepath.Join(dir, "blobs", filepath.Base(filepath.Dir(src)), filepath.Base(src))
+		// Blobs are content addressed, so one already there is the same.
+		if err := LinkOrCopy(src, dst); err != nil && !os.IsExist(err) {
+			linkErr = fmt.Errorf("blob %s: %w", d.Digest, err)
+			return false
+		}
+		total += info.Size()
+		return true
+	}, func(Descriptor, error) {})
+	if linkErr != nil {
+		return 0, linkErr
+	}
+
+	idx := s.Index
+	idx.Manifests = roots
+	if idx.SchemaVersion == 0 {
+		idx.SchemaVersion = 2
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), data, 0644); err != nil {
+		return 0, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// LinkOrCopy hardlinks src to dst, creating dst's directory, and falls back
+// to a byte copy where a hardlink cannot be made, e.g. across filesystems.
+// An existing dst is an error satisfying os.IsExist.
+func LinkOrCopy(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Link(src, dst)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,197 @@
+package ocistore
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Issue is one problem found by Verify.
+type Issue struct {
+	Digest       string `json:"digest"`
+	ReferencedBy string `json:"referencedBy,omitempty"`
+	Declared     int64  `json:"declaredSize,omitempty"`
+	Actual       int64  `json:"actualSize,omitempty"`
+	Detail       string `json:"detail,omitempty"`
+}
+
+// VerifyReport is the structured result of verifying a store.
+type VerifyReport struct {
+	OK           bool      `json:"ok"`
+	CheckedAt    time.Time `json:"checkedAt"`
+	Blobs        int       `json:"blobs"`
+	Bytes        int64     `json:"bytes"`
+	References   int       `json:"references"`
+	Layout       []string  `json:"layout"`       // oci-layout / index.json problems
+	Corrupt      []Issue   `json:"corrupt"`      // content does not hash to its digest, or unparseable manifests
+	Missing      []Issue   `json:"missing"`      // referenced but absent
+	SizeMismatch []Issue   `json:"sizeMismatch"` // present, but not the declared size
+	// AbsentPlatforms lists the entries of image indexes that are absent,
+	// e.g. the platforms a filtered sync skipped. They are expected and are
+	// not counted as problems.
+	AbsentPlatforms []Issue `json:"absentPlatforms"`
+}
+
+// Problems returns the total number of issues in the report. Absent
+// platforms are not problems.
+func (r *VerifyReport) Problems() int {
+	return len(r.Layout) + len(r.Corrupt) + len(r.Missing) + len(r.SizeMismatch)
+}
+
+// Verify checks the OCI layout in dir: that oci-layout and index.json are
+// valid, that every blob reachable from index.json exists with its declared
+// size, and that every blob file hashes to its digest. progress, if set, is
+// called after each blob is hashed.
+func Verify(ctx context.Context, dir string, progress func(done, total int, bytes int64)) (*VerifyReport, error) {
+	r := &VerifyReport{
+		CheckedAt: time.Now().UTC(),
+		Layout:    []string{}, Corrupt: []Issue{}, Missing: []Issue{}, SizeMismatch: []Issue{},
+		AbsentPlatforms: []Issue{},
+	}
+
+	var layout struct {
+		Version string `json:"imageLayoutVersion"`
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "oci-layout")); err != nil {
+		r.Layout = append(r.Layout, "oci-layout: "+err.Error())
+	} else if err := json.Unmarshal(data, &layout); err != nil {
+		r.Layout = append(r.Layout, "oci-layout: "+err.Error())
+	} else if layout.Version != "1.0.0" {
+		r.Layout = append(r.Layout, fmt.Sprintf("oci-layout: unsupported imageLayoutVersion %q", layout.Version))
+	}
+
+	s := &Store{Dir: dir}
+	if data, err := os.ReadFile(filepath.Join(dir, "index.json")); err != nil {
+		r.Layout = append(r.Layout, "index.json: "+err.Error())
+	} else if err := json.Unmarshal(data, &s.Index); err != nil {
+		r.Layout = append(r.Layout, "index.json: "+err.Error())
+	} else if s.Index.SchemaVersion != 2 {
+		r.Layout = append(r.Layout, fmt.Sprintf("index.json: unsupported schemaVersion %d", s.Index.SchemaVersion))
+	}
+
+	// The image indexes seen so far; walkRefs visits a parent before its
+	// children.
+	indexes := map[string]bool{}
+	s.walkRefs(s.Index.Manifests, func(d Descriptor, from string) bool {
+		r.References++
+		if !ValidDigest(d.Digest) {
+			r.Corrupt = append(r.Corrupt, Issue{Digest: d.Digest, ReferencedBy: from, Detail: "invalid digest"})
+			return false
+		}
+		info, err := os.Stat(s.BlobPath(d.Digest))
+		if err != nil {
+			issue := Issue{Digest: d.Digest, ReferencedBy: from, Declared: d.Size, Detail: errDetail(err)}
+			if indexes[from] && os.IsNotExist(err) {
+				r.AbsentPlatforms = append(r.AbsentPlatforms, issue)
+			} else {
+				r.Missing = append(r.Missing, issue)
+			}
+			return false
+		}
+		if IsIndex(d.MediaType) {
+			indexes[d.Digest] = true
+		}
+		if d.Size > 0 && info.Size() != d.Size {
+			r.SizeMismatch = append(r.SizeMismatch, Issue{Digest: d.Digest, ReferencedBy: from, Declared: d.Size, Actual: info.Size()})
+		}
+		return true
+	}, func(d Descriptor, err error) {
+		r.Corrupt = append(r.Corrupt, Issue{Digest: d.Digest, Detail: err.Error()})
+	})
+
+	var blobs []Blob
+	blobsDir := filepath.Join(dir, "blobs")
+	err := filepath.WalkDir(blobsDir, func(path string, e os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == blobsDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !e.Type().IsRegular() {
+			return nil
+		}
+		rel, _ := filepath.Rel(blobsDir, path)
+		algo, hex, ok := strings.Cut(filepath.ToSlash(rel), "/")
+		if !ok || strings.Contains(hex, "/") {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, Blob{Digest: algo + ":" + hex, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning blobs: %w", err)
+	}
+
+	for i, b := range blobs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if detail := s.checkBlob(ctx, b.Digest); detail != "" {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			r.Corrupt = append(r.Corrupt, Issue{Digest: b.Digest, Actual: b.Size, Detail: detail})
+		}
+		r.Blobs++
+		r.Bytes += b.Size
+		if progress != nil {
+			progress(i+1, len(blobs), r.Bytes)
+		}
+	}
+
+	r.OK = r.Problems() == 0
+	return r, nil
+}
+
+// checkBlob re-hashes a blob, returning why it does not match its digest or ""
+// if it does.
+func (s *Store) checkBlob(ctx context.Context, digest string) string {
+	algo, want, _ := strings.Cut(digest, ":")
+	h := digestHash(algo)
+	if h == nil {
+		return "unsupported digest algorithm " + algo
+	}
+	f, err := os.Open(s.BlobPath(digest))
+	if err != nil {
+		return errDetail(err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, ctxReader{ctx, f}); err != nil {
+		return errDetail(err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != want {
+		return "content hashes to " + algo + ":" + got
+	}
+	return ""
+}
+
+func errDetail(err error) string {
+	if os.IsNotExist(err) {
+		return "not found"
+	}
+	return err.Error()
+}
+
+// ctxReader stops a long read when its context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -113,7 +113,8 @@ func freePort() (int, error) {
 }
 
 // Publish starts (or returns the existing) internal registry for a haul and
-// records it as desired so it is kept alive (auto-restarted on crash).
+// records it as desired so it is kept alive (auto-restarted on crash). Without
+// an override the haul's own publish hostname, if any, is used.
 func (m *Manager) Publish(ctx context.Context, haulID int64, hostnameOverride string) (*published, error) {
 	haul, err := m.hauls.Get(ctx, haulID)
 	if err != nil {
@@ -125,6 +126,9 @@ func (m *Manager) Publish(ctx context.Context, haulID int64, hostnameOverride st
 		m.mu.Unlock()
 		return existing, nil
 	}
+	if hostnameOverride == "" {
+		hostnameOverride = haul.PublishHostname
+	}
 	hostname := m.hostnameFor(haul.Slug, hostnameOverride)
 	m.desired[haulID] = hostname
 	m.mu.Unlock()
@@ -0,0 +1,111 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// InventoryFile is an inventory's own file in its directory; the rendered
+// documents sit beside it as <format>.json.
+const InventoryFile = "inventory.json"
+
+// Dir returns the directory under base holding the SBOMs of a manifest.
+func Dir(base, digest string) string {
+	return filepath.Join(base, strings.Replace(digest, ":", "-", 1))
+}
+
+// Save writes the inventory and its rendering in every format under base.
+func Save(base string, inv *Inventory) error {
+	if !ocistore.ValidDigest(inv.Digest) {
+		return fmt.Errorf("%w: %q", ocistore.ErrInvalidDigest, inv.Digest)
+	}
+	dir := Dir(base, inv.Digest)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for f := range Formats {
+		data, err := Render(inv, f)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(filepath.Join(dir, string(f)+".json"), data); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	// The inventory goes last: its presence marks the set complete.
+	return writeFile(filepath.Join(dir, InventoryFile), data)
+}
+
+// Load reads the inventory of a manifest from under base.
+func Load(base, digest string) (*Inventory, error) {
+	if !ocistore.ValidDigest(digest) {
+		return nil, fmt.Errorf("%w: %q", ocistore.ErrInvalidDigest, digest)
+	}
+	data, err := os.ReadFile(filepath.Join(Dir(base, digest), InventoryFile))
+	if err != nil {
+		return nil, err
+	}
+	var inv Inventory
+	if err := json.Unmarshal(data, &inv); err != nil {
+		return nil, fmt.Errorf("parsing inventory of %s: %w", digest, err)
+	}
+	return &inv, nil
+}
+
+// Document returns the path of a manifest's SBOM in format f under base.
+func Document(base, digest string, f Format) (string, error) {
+	if !ocistore.ValidDigest(digest) {
+		return "", fmt.Errorf("%w: %q", ocistore.ErrInvalidDigest, digest)
+	}
+	if _, ok := Formats[f]; !ok {
+		return "", fmt.Errorf("unknown SBOM format %q", f)
+	}
+	return filepath.Join(Dir(base, digest), string(f)+".json"), nil
+}
+
+// List reads every inventory under base, sorted by image and platform.
+// Inventories that cannot be read are skipped.
+func List(base string) ([]*Inventory, error) {
+	entries, err := os.ReadDir(base)
+	if os.IsNotExist(err) {
+		return []*Inventory{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []*Inventory{}
+	for _, e := range entries {
+		algo, hex, ok := strings.Cut(e.Name(), "-")
+		if !e.IsDir() || !ok {
+			continue
+		}
+		if inv, err := Load(base, algo+":"+hex); err == nil {
+			out = append(out, inv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Image != out[j].Image {
+			return out[i].Image < out[j].Image
+		}
+		return out[i].Platform < out[j].Platform
+	})
+	return out, nil
+}
+
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
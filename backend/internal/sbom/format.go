@@ -0,0 +1,162 @@
+package sbom
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Format names a rendering of an inventory.
+type Format string
+
+const (
+	FormatSPDX      Format = "spdx"
+	FormatCycloneDX Format = "cyclonedx"
+)
+
+// Formats lists the formats Render supports, with their media types.
+var Formats = map[Format]string{
+	FormatSPDX:      "text/spdx+json",
+	FormatCycloneDX: "application/vnd.cyclonedx+json",
+}
+
+// toolName identifies this tool in generated documents.
+const toolName = "hauler-ui"
+
+// Render renders the inventory as an SPDX 2.3 or CycloneDX 1.5 JSON document.
+func Render(inv *Inventory, f Format) ([]byte, error) {
+	switch f {
+	case FormatSPDX:
+		return json.MarshalIndent(spdx(inv), "", "  ")
+	case FormatCycloneDX:
+		return json.MarshalIndent(cyclonedx(inv), "", "  ")
+	}
+	return nil, fmt.Errorf("unknown SBOM format %q", f)
+}
+
+// spdxLicense matches license strings that are plausibly SPDX expressions;
+// anything else is recorded as NOASSERTION rather than producing an invalid
+// document.
+var spdxLicense = regexp.MustCompile(`^[A-Za-z0-9.+-]+( (AND|OR|WITH) [A-Za-z0-9.+-]+)*$`)
+
+func spdx(inv *Inventory) map[string]interface{} {
+	image := map[string]interface{}{
+		"SPDXID":                "SPDXRef-Image",
+		"name":                  imageName(inv),
+		"versionInfo":           inv.Digest,
+		"downloadLocation":      "NOASSERTION",
+		"primaryPackagePurpose": "CONTAINER",
+		"filesAnalyzed":         false,
+		"licenseConcluded":      "NOASSERTION",
+		"licenseDeclared":       "NOASSERTION",
+		"copyrightText":         "NOASSERTION",
+	}
+	packages := []interface{}{image}
+	relationships := []interface{}{map[string]string{
+		"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-Image",
+	}}
+	for i, p := range inv.Packages {
+		id := fmt.Sprintf("SPDXRef-Package-%d", i+1)
+		license := "NOASSERTION"
+		if spdxLicense.MatchString(p.License) {
+			license = p.License
+		}
+		pkg := map[string]interface{}{
+			"SPDXID":           id,
+			"name":             p.Name,
+			"versionInfo":      p.Version,
+			"downloadLocation": "NOASSERTION",
+			"filesAnalyzed":    false,
+			"licenseConcluded": "NOASSERTION",
+			"licenseDeclared":  license,
+			"copyrightText":    "NOASSERTION",
+			"sourceInfo":       "found in " + p.Path,
+			"externalRefs": []map[string]string{{
+				"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": p.PURL,
+			}},
+		}
+		packages = append(packages, pkg)
+		relationships = append(relationships, map[string]string{
+			"spdxElementId": "SPDXRef-Image", "relationshipType": "CONTAINS", "relatedSpdxElement": id,
+		})
+	}
+	return map[string]interface{}{
+		"spdxVersion":       "SPDX-2.3",
+		"dataLicense":       "CC0-1.0",
+		"SPDXID":            "SPDXRef-DOCUMENT",
+		"name":              imageName(inv),
+		"documentNamespace": "https://hauler-ui.local/spdx/" + strings.Replace(inv.Digest, ":", "-", 1) + "/" + docUUID(inv),
+		"creationInfo": map[string]interface{}{
+			"created":  inv.GeneratedAt.UTC().Format(time.RFC3339),
+			"creators": []string{"Tool: " + toolName},
+		},
+		"packages":      packages,
+		"relationships": relationships,
+	}
+}
+
+func cyclonedx(inv *Inventory) map[string]interface{} {
+	components := make([]interface{}, 0, len(inv.Packages))
+	for i, p := range inv.Packages {
+		c := map[string]interface{}{
+			"type":       "library",
+			"bom-ref":    fmt.Sprintf("pkg-%d", i+1),
+			"name":       p.Name,
+			"version":    p.Version,
+			"purl":       p.PURL,
+			"properties": []map[string]string{{"name": toolName + ":path", "value": p.Path}},
+		}
+		switch {
+		case p.License == "":
+		case spdxLicense.MatchString(p.License) && !strings.Contains(p.License, " "):
+			c["licenses"] = []interface{}{map[string]interface{}{"license": map[string]string{"id": p.License}}}
+		case spdxLicense.MatchString(p.License):
+			c["licenses"] = []interface{}{map[string]string{"expression": p.License}}
+		default:
+			c["licenses"] = []interface{}{map[string]interface{}{"license": map[string]string{"name": p.License}}}
+		}
+		components = append(components, c)
+	}
+	image := map[string]interface{}{
+		"type":    "container",
+		"bom-ref": "image",
+		"name":    imageName(inv),
+		"version": inv.Digest,
+	}
+	if inv.Platform != "" {
+		image["properties"] = []map[string]string{{"name": toolName + ":platform", "value": inv.Platform}}
+	}
+	return map[string]interface{}{
+		"bomFormat":    "CycloneDX",
+		"specVersion":  "1.5",
+		"serialNumber": "urn:uuid:" + docUUID(inv),
+		"version":      1,
+		"metadata": map[string]interface{}{
+			"timestamp": inv.GeneratedAt.UTC().Format(time.RFC3339),
+			"tools": map[string]interface{}{
+				"components": []map[string]string{{"type": "application", "name": toolName}},
+			},
+			"component": image,
+		},
+		"components": components,
+	}
+}
+
+func imageName(inv *Inventory) string {
+	if inv.Image != "" {
+		return inv.Image
+	}
+	return inv.Digest
+}
+
+// docUUID derives a stable UUID for an inventory's documents, so the same
+// scan renders identically.
+func docUUID(inv *Inventory) string {
+	sum := sha256.Sum256([]byte(inv.Image + "@" + inv.Digest + "@" + inv.GeneratedAt.UTC().Format(time.RFC3339Nano)))
+	sum[6] = sum[6]&0x0f | 0x50 // version 5 layout
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
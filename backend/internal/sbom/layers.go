@@ -0,0 +1,310 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Size limits for files read out of layers.
+const (
+	maxTextFile = 64 << 20
+	maxRPMDB    = 512 << 20
+	maxBinary   = 1 << 30
+)
+
+// layeredFS is the part of an image's merged filesystem the scanners care
+// about: the packages found in each file, and the os-release files, keyed by
+// path without a leading slash. Files that must be read from disk are
+// spooled under tempDir.
+type layeredFS struct {
+	files   map[string][]Package
+	release map[string][]byte
+	tempDir string
+}
+
+func newLayeredFS(tempDir string) *layeredFS {
+	return &layeredFS{files: map[string][]Package{}, release: map[string][]byte{}, tempDir: tempDir}
+}
+
+// applyLayer reads one layer tarball (gzip, zstd or uncompressed) and lays it
+// over the filesystem: its whiteouts and replaced files hide what lower
+// layers provided, then what it provides is added.
+func (fs *layeredFS) applyLayer(ctx context.Context, blob string) error {
+	f, err := os.Open(blob)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := Decompress(f)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var removed, opaque []string
+	replaced := map[string]bool{}
+	files := map[string][]Package{}
+	release := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading layer: %w", err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		dir, base := path.Split(name)
+		switch {
+		case base == ".wh..wh..opq":
+			opaque = append(opaque, dir)
+			continue
+		case strings.HasPrefix(base, ".wh."):
+			removed = append(removed, dir+strings.TrimPrefix(base, ".wh."))
+			continue
+		}
+		if hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+		replaced[name] = true
+		delete(files, name)
+		delete(release, name)
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if name == "etc/os-release" || name == "usr/lib/os-release" {
+			if data, err := readLimited(tr, hdr, maxTextFile); err == nil {
+				release[name] = data
+			}
+			continue
+		}
+		pkgs, err := scanFile(name, hdr, tr, fs.tempDir)
+		if err != nil {
+			// A file that cannot be parsed contributes nothing; one bad
+			// lockfile must not lose the rest of the image.
+			continue
+		}
+		if len(pkgs) > 0 {
+			files[name] = pkgs
+		}
+	}
+
+	// Whiteouts and replacements only hide lower layers.
+	under := func(p, dir string) bool { return strings.HasPrefix(p, dir) }
+	for p := range fs.files {
+		if replaced[p] || hidden(p, removed, opaque, under) {
+			delete(fs.files, p)
+		}
+	}
+	for p := range fs.release {
+		if replaced[p] || hidden(p, removed, opaque, under) {
+			delete(fs.release, p)
+		}
+	}
+	for p, pkgs := range files {
+		fs.files[p] = pkgs
+	}
+	for p, data := range release {
+		fs.release[p] = data
+	}
+	return nil
+}
+
+// hidden reports whether a lower-layer path is removed by a whiteout or
+// falls in an opaque directory.
+func hidden(p string, removed, opaque []string, under func(p, dir string) bool) bool {
+	for _, r := range removed {
+		if p == r || under(p, r+"/") {
+			return true
+		}
+	}
+	for _, dir := range opaque {
+		if under(p, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// paths returns the paths that hold packages, sorted.
+func (fs *layeredFS) paths() []string {
+	out := make([]string, 0, len(fs.files))
+	for p := range fs.files {
+		out = append(out, p)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// distro parses the image's os-release, preferring /etc over /usr/lib.
+func (fs *layeredFS) distro() *Distro {
+	data, ok := fs.release["etc/os-release"]
+	if !ok {
+		if data, ok = fs.release["usr/lib/os-release"]; !ok {
+			return nil
+		}
+	}
+	d := &Distro{}
+	for _, line := range strings.Split(string(data), "\n") {
+		k, v, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		v = strings.Trim(v, `"'`)
+		switch k {
+		case "ID":
+			d.ID = v
+		case "VERSION_ID":
+			d.VersionID = v
+		case "PRETTY_NAME":
+			d.Name = v
+		}
+	}
+	if d.ID == "" {
+		return nil
+	}
+	return d
+}
+
+// scanFile parses a layer file the scanners recognize by its path, or, for
+// an executable, its Go build info. Other files yield nothing.
+func scanFile(name string, hdr *tar.Header, r io.Reader, tempDir string) ([]Package, error) {
+	dir, base := path.Split(name)
+	read := func() ([]byte, error) { return readLimited(r, hdr, maxTextFile) }
+	switch {
+	case name == "lib/apk/db/installed":
+		data, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return parseAPK(data), nil
+	case name == "var/lib/dpkg/status" || (dir == "var/lib/dpkg/status.d/" && !strings.HasSuffix(base, ".md5sums")):
+		data, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return parseDpkg(data), nil
+	case base == "rpmdb.sqlite" && (dir == "var/lib/rpm/" || dir == "usr/lib/sysimage/rpm/"):
+		return readRPMDB(r, hdr, tempDir)
+	case base == "METADATA" && strings.HasSuffix(dir, ".dist-info/"), base == "PKG-INFO" && strings.HasSuffix(dir, ".egg-info/"):
+		data, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return parsePythonMetadata(data), nil
+	case base == "package.json" && installedNPM(dir):
+		data, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return parseNPMPackage(data)
+	case lockfiles[base] != nil:
+		data, err := read()
+		if err != nil {
+			return nil, err
+		}
+		return lockfiles[base](data)
+	case hdr.Mode&0111 != 0 && hdr.Size >= 1024 && hdr.Size <= maxBinary:
+		return readGoBinary(r, tempDir)
+	}
+	return nil, nil
+}
+
+// installedNPM reports whether dir is a package directly under node_modules,
+// e.g. "app/node_modules/express/" or "app/node_modules/@types/node/".
+func installedNPM(dir string) bool {
+	parts := strings.Split(strings.TrimSuffix(dir, "/"), "/")
+	n := len(parts)
+	switch {
+	case n >= 2 && parts[n-2] == "node_modules" && !strings.HasPrefix(parts[n-1], "@"):
+		return true
+	case n >= 3 && parts[n-3] == "node_modules" && strings.HasPrefix(parts[n-2], "@"):
+		return true
+	}
+	return false
+}
+
+// readGoBinary returns the module and dependencies of a Go executable read
+// from r, which is spooled to a file in tempDir since build info sits where
+// the binary format puts it. Files that are not ELF binaries are skipped
+// after their first bytes.
+func readGoBinary(r io.Reader, tempDir string) ([]Package, error) {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, []byte("\x7fELF")) {
+		return nil, nil
+	}
+	tmp, err := os.CreateTemp(tempDir, "sbom-bin-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := tmp.Write(magic); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		return nil, err
+	}
+	info, err := buildinfo.Read(tmp)
+	if err != nil {
+		return nil, nil // not a Go binary
+	}
+	var pkgs []Package
+	if v := strings.TrimPrefix(info.GoVersion, "go"); v != "" {
+		pkgs = append(pkgs, Package{Type: TypeGolang, Name: "stdlib", Version: v})
+	}
+	if info.Main.Path != "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		pkgs = append(pkgs, Package{Type: TypeGolang, Name: info.Main.Path, Version: info.Main.Version})
+	}
+	for _, dep := range info.Deps {
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		pkgs = append(pkgs, Package{Type: TypeGolang, Name: dep.Path, Version: dep.Version})
+	}
+	return pkgs, nil
+}
+
+// readLimited reads a file's content, refusing files larger than limit.
+func readLimited(r io.Reader, hdr *tar.Header, limit int64) ([]byte, error) {
+	if hdr.Size > limit {
+		return nil, fmt.Errorf("%s is %d bytes, over the %d byte limit", hdr.Name, hdr.Size, limit)
+	}
+	return io.ReadAll(io.LimitReader(r, limit))
+}
+
+// Decompress opens a possibly compressed stream, such as an image layer or
+// an OSV bundle, detecting gzip and zstd by their magic. Anything else is
+// read as is.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, 1<<20)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return io.NopCloser(br), nil
+}
@@ -0,0 +1,405 @@
+package sbom
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// lockfiles maps lockfile base names to their parsers.
+var lockfiles = map[string]func([]byte) ([]Package, error){
+	"package-lock.json":  parseNPMLock,
+	".package-lock.json": parseNPMLock, // npm's record of node_modules
+	"yarn.lock":          parseYarnLock,
+	"Cargo.lock":         parseTOMLPackages(TypeCargo),
+	"poetry.lock":        parseTOMLPackages(TypePyPI),
+	"requirements.txt":   parseRequirements,
+	"composer.lock":      parseComposerLock,
+	"Gemfile.lock":       parseGemfileLock,
+}
+
+// stanzas splits an RFC 822 style database (dpkg status, apk installed) into
+// blank-line separated records, passing each record's lines to fn.
+func stanzas(data []byte, fn func(lines []string)) {
+	var cur []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) == "" {
+			if len(cur) > 0 {
+				fn(cur)
+			}
+			cur = nil
+			continue
+		}
+		cur = append(cur, line)
+	}
+	if len(cur) > 0 {
+		fn(cur)
+	}
+}
+
+// parseAPK parses Alpine's /lib/apk/db/installed.
+func parseAPK(data []byte) []Package {
+	var pkgs []Package
+	stanzas(data, func(lines []string) {
+		p := Package{Type: TypeAPK}
+		for _, line := range lines {
+			k, v, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			switch k {
+			case "P":
+				p.Name = v
+			case "V":
+				p.Version = v
+			case "A":
+				p.Arch = v
+			case "L":
+				p.License = v
+			case "o":
+				p.Source = v
+			}
+		}
+		if p.Name != "" && p.Version != "" {
+			pkgs = append(pkgs, p)
+		}
+	})
+	return pkgs
+}
+
+// parseDpkg parses a dpkg status file, or one of distroless' status.d files,
+// keeping installed packages.
+func parseDpkg(data []byte) []Package {
+	var pkgs []Package
+	stanzas(data, func(lines []string) {
+		fields := map[string]string{}
+		for _, line := range lines {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				continue // continuation of a multi-line field
+			}
+			if k, v, ok := strings.Cut(line, ":"); ok {
+				fields[k] = strings.TrimSpace(v)
+			}
+		}
+		if status, ok := fields["Status"]; ok && !strings.HasSuffix(status, " installed") {
+			return
+		}
+		p := Package{Type: TypeDeb, Name: fields["Package"], Version: fields["Version"], Arch: fields["Architecture"]}
+		// Source may carry its own version: "openssl (3.0.11-1)".
+		if src, _, _ := strings.Cut(fields["Source"], " "); src != "" {
+			p.Source = src
+		}
+		if p.Name != "" && p.Version != "" {
+			pkgs = append(pkgs, p)
+		}
+	})
+	return pkgs
+}
+
+// parsePythonMetadata parses an installed distribution's METADATA (or an
+// egg's PKG-INFO).
+func parsePythonMetadata(data []byte) []Package {
+	header, _, _ := bytes.Cut(data, []byte("\n\n"))
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(header, '\n', '\n'))))
+	h, err := tp.ReadMIMEHeader()
+	if err != nil && len(h) == 0 {
+		return nil
+	}
+	p := Package{Type: TypePyPI, Name: h.Get("Name"), Version: h.Get("Version"), License: h.Get("License")}
+	if expr := h.Get("License-Expression"); expr != "" {
+		p.License = expr
+	}
+	if len(p.License) > 200 || strings.Contains(p.License, "\n") {
+		p.License = "" // the full license text, not a name
+	}
+	if p.Name == "" || p.Version == "" {
+		return nil
+	}
+	return []Package{p}
+}
+
+// parseNPMPackage parses the package.json of an installed node module.
+func parseNPMPackage(data []byte) ([]Package, error) {
+	var pkg struct {
+		Name    string          `json:"name"`
+		Version string          `json:"version"`
+		License json.RawMessage `json:"license"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, err
+	}
+	if pkg.Name == "" || pkg.Version == "" {
+		return nil, nil
+	}
+	p := Package{Type: TypeNPM, Name: pkg.Name, Version: pkg.Version}
+	_ = json.Unmarshal(pkg.License, &p.License) // older packages use an object
+	return []Package{p}, nil
+}
+
+// parseNPMLock parses package-lock.json: lockfile v2/v3 "packages", or v1
+// nested "dependencies".
+func parseNPMLock(data []byte) ([]Package, error) {
+	type dep struct {
+		Version      string         `json:"version"`
+		Dependencies map[string]dep `json:"dependencies"`
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+			License string `json:"license"`
+			Link    bool   `json:"link"`
+		} `json:"packages"`
+		Dependencies map[string]dep `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	if len(lock.Packages) > 0 {
+		for key, p := range lock.Packages {
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || p.Link || p.Version == "" {
+				continue // the root project, or a workspace link
+			}
+			name := p.Name
+			if name == "" {
+				name = key[i+len("node_modules/"):]
+			}
+			pkgs = append(pkgs, Package{Type: TypeNPM, Name: name, Version: p.Version, License: p.License})
+		}
+		return pkgs, nil
+	}
+	var walk func(deps map[string]dep)
+	walk = func(deps map[string]dep) {
+		for name, d := range deps {
+			if d.Version != "" && !strings.Contains(d.Version, ":") {
+				pkgs = append(pkgs, Package{Type: TypeNPM, Name: name, Version: d.Version})
+			}
+			walk(d.Dependencies)
+		}
+	}
+	walk(lock.Dependencies)
+	return pkgs, nil
+}
+
+// parseYarnLock parses yarn.lock, both classic (v1) and berry's YAML form.
+func parseYarnLock(data []byte) ([]Package, error) {
+	var pkgs []Package
+	name := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			// "lodash@^4.17.21, lodash@^4.17.15:" or "\"@babel/core@npm:^7.0.0\":"
+			spec, _, _ := strings.Cut(strings.TrimSuffix(line, ":"), ",")
+			spec = strings.Trim(strings.TrimSpace(spec), `"`)
+			name = ""
+			if i := strings.LastIndex(spec, "@"); i > 0 {
+				name = spec[:i]
+			}
+			if name == "__metadata" {
+				name = ""
+			}
+			continue
+		}
+		field := strings.TrimSpace(line)
+		if name != "" && strings.HasPrefix(field, "version") {
+			v := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(field, "version"), ":"))
+			pkgs = append(pkgs, Package{Type: TypeNPM, Name: name, Version: strings.Trim(v, `"`)})
+			name = ""
+		}
+	}
+	return pkgs, nil
+}
+
+// parseTOMLPackages returns a parser for lockfiles made of [[package]] tables
+// with name and version keys (Cargo.lock, poetry.lock).
+func parseTOMLPackages(typ string) func([]byte) ([]Package, error) {
+	return func(data []byte) ([]Package, error) {
+		var pkgs []Package
+		var cur *Package
+		flush := func() {
+			if cur != nil && cur.Name != "" && cur.Version != "" {
+				pkgs = append(pkgs, *cur)
+			}
+			cur = nil
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "[") {
+				flush()
+				if line == "[[package]]" {
+					cur = &Package{Type: typ}
+				}
+				continue
+			}
+			if cur == nil {
+				continue
+			}
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				continue
+			}
+			v = strings.Trim(strings.TrimSpace(v), `"`)
+			switch strings.TrimSpace(k) {
+			case "name":
+				cur.Name = v
+			case "version":
+				cur.Version = v
+			}
+		}
+		flush()
+		return pkgs, nil
+	}
+}
+
+// parseRequirements parses pinned requirements ("name==version").
+func parseRequirements(data []byte) ([]Package, error) {
+	var pkgs []Package
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line, _, _ = strings.Cut(line, ";") // environment markers
+		name, version, ok := strings.Cut(strings.TrimSpace(line), "==")
+		if !ok {
+			continue
+		}
+		name, _, _ = strings.Cut(name, "[") // extras
+		version, _, _ = strings.Cut(strings.TrimSpace(version), " ")
+		if name = strings.TrimSpace(name); name != "" && version != "" {
+			pkgs = append(pkgs, Package{Type: TypePyPI, Name: name, Version: version})
+		}
+	}
+	return pkgs, nil
+}
+
+// parseComposerLock parses PHP's composer.lock.
+func parseComposerLock(data []byte) ([]Package, error) {
+	type pkg struct {
+		Name    string   `json:"name"`
+		Version string   `json:"version"`
+		License []string `json:"license"`
+	}
+	var lock struct {
+		Packages    []pkg `json:"packages"`
+		PackagesDev []pkg `json:"packages-dev"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	var pkgs []Package
+	for _, p := range append(lock.Packages, lock.PackagesDev...) {
+		if p.Name != "" && p.Version != "" {
+			pkgs = append(pkgs, Package{Type: TypeComposer, Name: p.Name, Version: strings.TrimPrefix(p.Version, "v"),
+				License: strings.Join(p.License, " OR ")})
+		}
+	}
+	return pkgs, nil
+}
+
+// parseGemfileLock parses the "specs:" sections of a Gemfile.lock.
+func parseGemfileLock(data []byte) ([]Package, error) {
+	var pkgs []Package
+	inSpecs := false
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "specs:":
+			inSpecs = true
+			continue
+		case !strings.HasPrefix(line, " "):
+			inSpecs = false
+			continue
+		}
+		// Gems sit at four spaces; their dependencies at six.
+		if !inSpecs || !strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "      ") {
+			continue
+		}
+		name, version, ok := strings.Cut(trimmed, " (")
+		if !ok {
+			continue
+		}
+		version = strings.TrimSuffix(version, ")")
+		version, _, _ = strings.Cut(version, "-") // platform suffix, e.g. 1.15.4-x86_64-linux
+		pkgs = append(pkgs, Package{Type: TypeGem, Name: name, Version: version})
+	}
+	return pkgs, nil
+}
+
+// purlFor builds a package's package URL (https://github.com/package-url/purl-spec).
+func purlFor(p Package, d *Distro) string {
+	var namespace, name, version = "", p.Name, p.Version
+	var qualifiers [][2]string
+	distro := func(fallback string) string {
+		if d != nil && d.ID != "" {
+			return d.ID
+		}
+		return fallback
+	}
+	switch p.Type {
+	case TypeAPK, TypeDeb:
+		fallback := map[string]string{TypeAPK: "alpine", TypeDeb: "debian"}[p.Type]
+		namespace = distro(fallback)
+		qualifiers = append(qualifiers, [2]string{"arch", p.Arch})
+		if d != nil && d.VersionID != "" {
+			qualifiers = append(qualifiers, [2]string{"distro", d.ID + "-" + d.VersionID})
+		}
+	case TypeRPM:
+		namespace = distro("redhat")
+		epoch := ""
+		epoch, version, _ = cutEpoch(version)
+		qualifiers = append(qualifiers, [2]string{"arch", p.Arch}, [2]string{"epoch", epoch})
+		if d != nil && d.VersionID != "" {
+			qualifiers = append(qualifiers, [2]string{"distro", d.ID + "-" + d.VersionID})
+		}
+	case TypeNPM, TypeComposer, TypeGolang:
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			namespace, name = name[:i], name[i+1:]
+		}
+	case TypePyPI:
+		name = strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+	}
+
+	var b strings.Builder
+	b.WriteString("pkg:" + p.Type + "/")
+	if namespace != "" {
+		for _, seg := range strings.Split(namespace, "/") {
+			b.WriteString(purlEscape(seg) + "/")
+		}
+	}
+	b.WriteString(purlEscape(name))
+	if version != "" {
+		b.WriteString("@" + purlEscape(version))
+	}
+	sep := "?"
+	for _, q := range qualifiers {
+		if q[1] == "" {
+			continue
+		}
+		b.WriteString(sep + q[0] + "=" + purlEscape(q[1]))
+		sep = "&"
+	}
+	return b.String()
+}
+
+// cutEpoch splits an rpm "epoch:version-release" into its epoch and the rest.
+func cutEpoch(v string) (epoch, rest string, ok bool) {
+	if e, r, found := strings.Cut(v, ":"); found {
+		return e, r, true
+	}
+	return "", v, false
+}
+
+// purlEscape percent-encodes a purl component, including ':' and '@'.
+func purlEscape(s string) string {
+	s = url.PathEscape(s)
+	s = strings.ReplaceAll(s, ":", "%3A")
+	return strings.ReplaceAll(s, "@", "%40")
+}
@@ -0,0 +1,141 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	_ "modernc.org/sqlite"
+)
+
+// rpm header tags and data types read from rpmdb.sqlite.
+const (
+	rpmTagName      = 1000
+	rpmTagVersion   = 1001
+	rpmTagRelease   = 1002
+	rpmTagEpoch     = 1003
+	rpmTagLicense   = 1014
+	rpmTagArch      = 1022
+	rpmTagSourceRPM = 1044
+
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// readRPMDB copies an rpmdb.sqlite out of a layer into tempDir and lists its
+// packages.
+func readRPMDB(r io.Reader, hdr *tar.Header, tempDir string) ([]Package, error) {
+	if hdr.Size > maxRPMDB {
+		return nil, fmt.Errorf("%s is %d bytes, over the %d byte limit", hdr.Name, hdr.Size, int64(maxRPMDB))
+	}
+	dir, err := os.MkdirTemp(tempDir, "sbom-rpmdb-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rpmdb.sqlite")
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRPMDB(path)
+}
+
+// parseRPMDB lists the packages in an rpm sqlite database.
+func parseRPMDB(path string) ([]Package, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT blob FROM Packages`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var pkgs []Package
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			return nil, err
+		}
+		p, err := parseRPMHeader(blob)
+		if err != nil {
+			continue
+		}
+		if p.Name == "gpg-pubkey" {
+			continue // imported signing keys, not software
+		}
+		pkgs = append(pkgs, *p)
+	}
+	return pkgs, rows.Err()
+}
+
+// parseRPMHeader reads a package from an rpm header blob as stored in the
+// database: entry count and data length, the index entries, then the data.
+func parseRPMHeader(blob []byte) (*Package, error) {
+	if len(blob) < 8 {
+		return nil, fmt.Errorf("header too short")
+	}
+	il := int(binary.BigEndian.Uint32(blob[0:4]))
+	dl := int(binary.BigEndian.Uint32(blob[4:8]))
+	start := 8 + il*16
+	if il <= 0 || il > 1<<16 || dl < 0 || start+dl > len(blob) {
+		return nil, fmt.Errorf("malformed header")
+	}
+	data := blob[start : start+dl]
+	tags := map[int32]string{}
+	for i := 0; i < il; i++ {
+		e := blob[8+i*16 : 8+(i+1)*16]
+		tag := int32(binary.BigEndian.Uint32(e[0:4]))
+		typ := binary.BigEndian.Uint32(e[4:8])
+		off := int(int32(binary.BigEndian.Uint32(e[8:12])))
+		switch tag {
+		case rpmTagName, rpmTagVersion, rpmTagRelease, rpmTagEpoch, rpmTagLicense, rpmTagArch, rpmTagSourceRPM:
+		default:
+			continue
+		}
+		if off < 0 || off >= len(data) {
+			continue
+		}
+		switch typ {
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			s := data[off:]
+			if end := bytes.IndexByte(s, 0); end >= 0 {
+				s = s[:end]
+			}
+			tags[tag] = string(s)
+		case rpmTypeInt32:
+			if off+4 <= len(data) {
+				tags[tag] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(data[off:off+4])), 10)
+			}
+		}
+	}
+	p := &Package{Type: TypeRPM, Name: tags[rpmTagName], Arch: tags[rpmTagArch], License: tags[rpmTagLicense], Source: tags[rpmTagSourceRPM]}
+	if p.Name == "" || tags[rpmTagVersion] == "" {
+		return nil, fmt.Errorf("header has no name or version")
+	}
+	p.Version = tags[rpmTagVersion]
+	if rel := tags[rpmTagRelease]; rel != "" {
+		p.Version += "-" + rel
+	}
+	if epoch := tags[rpmTagEpoch]; epoch != "" && epoch != "0" {
+		p.Version = epoch + ":" + p.Version
+	}
+	return p, nil
+}
@@ -0,0 +1,129 @@
+// Package sbom builds software bills of materials for images in a hauler
+// store without network access. It reads each image's layers straight from
+// the OCI layout, applies whiteouts the way a container runtime would, and
+// collects packages from OS package databases (apk, dpkg, rpm sqlite),
+// language lockfiles and installed package metadata, and the build info Go
+// embeds in its binaries. The resulting Inventory renders as SPDX or
+// CycloneDX JSON.
+package sbom
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// Package ecosystems, as used in Package.Type and package URLs.
+const (
+	TypeAPK      = "apk"
+	TypeDeb      = "deb"
+	TypeRPM      = "rpm"
+	TypeNPM      = "npm"
+	TypePyPI     = "pypi"
+	TypeCargo    = "cargo"
+	TypeComposer = "composer"
+	TypeGem      = "gem"
+	TypeGolang   = "golang"
+)
+
+// Package is one package found in an image.
+type Package struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+	// Source is the source package an OS package was built from (dpkg
+	// Source, apk origin, rpm source rpm), which advisories often name.
+	Source  string `json:"source,omitempty"`
+	License string `json:"license,omitempty"`
+	PURL    string `json:"purl"`
+	Path    string `json:"path"` // file it was found in
+}
+
+// Distro identifies an image's OS from its os-release file.
+type Distro struct {
+	ID        string `json:"id"`
+	VersionID string `json:"versionId,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Inventory is the packages found in one image manifest.
+type Inventory struct {
+	Image       string    `json:"image"`  // reference, e.g. docker.io/library/nginx:1.25
+	Digest      string    `json:"digest"` // manifest digest
+	Platform    string    `json:"platform,omitempty"`
+	Distro      *Distro   `json:"distro,omitempty"`
+	Packages    []Package `json:"packages"`
+	Layers      int       `json:"layers"`
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// Scan builds the inventory of the image manifest with the given digest in
+// st. Executables and rpm databases are copied out of their layers into
+// tempDir to be read; "" uses the system temporary directory. Image and
+// Platform are left for the caller to fill in.
+func Scan(ctx context.Context, st *ocistore.Store, digest, tempDir string) (*Inventory, error) {
+	m, err := st.Manifest(digest)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s: %w", digest, err)
+	}
+	if tempDir != "" {
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	fs := newLayeredFS(tempDir)
+	for _, l := range m.Layers {
+		if !tarLayer(l.MediaType) {
+			continue
+		}
+		if err := fs.applyLayer(ctx, st.BlobPath(l.Digest)); err != nil {
+			return nil, fmt.Errorf("layer %s: %w", l.Digest, err)
+		}
+	}
+	inv := &Inventory{Digest: digest, Layers: len(m.Layers), GeneratedAt: time.Now().UTC(), Packages: []Package{}}
+	inv.Distro = fs.distro()
+
+	seen := map[string]bool{}
+	for _, path := range fs.paths() {
+		for _, p := range fs.files[path] {
+			p.Path = "/" + path
+			p.PURL = purlFor(p, inv.Distro)
+			key := p.PURL + "|" + p.Path
+			if p.Type != TypeGolang && p.Type != TypeNPM && p.Type != TypePyPI {
+				// The same OS package is only listed once, whatever file it
+				// came from (e.g. dpkg's status and status.d).
+				key = p.PURL
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			inv.Packages = append(inv.Packages, p)
+		}
+	}
+	sort.SliceStable(inv.Packages, func(i, j int) bool {
+		a, b := inv.Packages[i], inv.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return inv, nil
+}
+
+// tarLayer reports whether a layer media type is a filesystem tarball.
+func tarLayer(mediaType string) bool {
+	switch mediaType {
+	case "", "application/vnd.oci.image.layer.v1.tar", "application/vnd.oci.image.layer.v1.tar+gzip",
+		"application/vnd.oci.image.layer.v1.tar+zstd", "application/vnd.docker.image.rootfs.diff.tar.gzip",
+		"application/vnd.oci.image.layer.nondistributable.v1.tar+gzip",
+		"application/vnd.docker.image.rootfs.foreign.diff.tar.gzip":
+		return true
+	}
+	return false
+}
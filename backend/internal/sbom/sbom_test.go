@@ -0,0 +1,356 @@
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// entry is one file (or whiteout) in a test layer.
+type entry struct {
+	name string
+	data []byte
+	mode int64
+}
+
+// layer builds a layer tarball, gzipped unless plain is set.
+func layer(t *testing.T, plain bool, entries ...entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w *gzip.Writer
+	var tw *tar.Writer
+	if plain {
+		tw = tar.NewWriter(&buf)
+	} else {
+		w = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(w)
+	}
+	for _, e := range entries {
+		mode := e.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: mode, Size: int64(len(e.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if w != nil {
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeImage writes a single-manifest image with the given layers into a new
+// layout and returns the opened store and the manifest digest.
+func writeImage(t *testing.T, layers ...[]byte) (*ocistore.Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	blob := func(mediaType string, data []byte) ocistore.Descriptor {
+		sum := sha256.Sum256(data)
+		h := hex.EncodeToString(sum[:])
+		path := filepath.Join(dir, "blobs", "sha256", h)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return ocistore.Descriptor{MediaType: mediaType, Digest: "sha256:" + h, Size: int64(len(data))}
+	}
+	var descs []ocistore.Descriptor
+	for _, l := range layers {
+		mt := "application/vnd.oci.image.layer.v1.tar+gzip"
+		if l[0] != 0x1f {
+			mt = "application/vnd.oci.image.layer.v1.tar"
+		}
+		descs = append(descs, blob(mt, l))
+	}
+	config := blob(ocistore.MediaTypeOCIConfig, []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers"}}`))
+	m, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: descs})
+	md := blob(ocistore.MediaTypeOCIManifest, m)
+	md.Annotations = map[string]string{ocistore.AnnotationContainerdName: "docker.io/library/app:1"}
+	idx, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIIndex, Manifests: []ocistore.Descriptor{md}})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), idx, 0644); err != nil {
+		t.Fatal(err)
+	}
+	st, err := ocistore.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, md.Digest
+}
+
+func find(inv *Inventory, typ, name string) *Package {
+	for i := range inv.Packages {
+		if inv.Packages[i].Type == typ && inv.Packages[i].Name == name {
+			return &inv.Packages[i]
+		}
+	}
+	return nil
+}
+
+func TestScanAppliesLayersAndWhiteouts(t *testing.T) {
+	apk := "P:musl\nV:1.2.4-r2\nA:x86_64\nL:MIT\no:musl\n\nP:busybox\nV:1.36.1-r5\nA:x86_64\nL:GPL-2.0-only\no:busybox\n"
+	lock := `{"lockfileVersion":3,"packages":{"":{"name":"web"},"node_modules/lodash":{"version":"4.17.21","license":"MIT"}}}`
+	base := layer(t, false,
+		entry{name: "etc/os-release", data: []byte("ID=alpine\nVERSION_ID=3.19.1\nPRETTY_NAME=\"Alpine Linux v3.19\"\n")},
+		entry{name: "lib/apk/db/installed", data: []byte(apk)},
+		entry{name: "srv/web/package-lock.json", data: []byte(lock)},
+		entry{name: "srv/old/package-lock.json", data: []byte(strings.Replace(lock, "lodash", "left-pad", 1))},
+		entry{name: "usr/lib/python3.12/site-packages/requests-2.31.0.dist-info/METADATA", data: []byte("Metadata-Version: 2.1\nName: requests\nVersion: 2.31.0\nLicense: Apache-2.0\n\nbody\n")},
+	)
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin, err := os.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The upper layer removes the old app, drops busybox from the apk db and
+	// adds a Go binary (this test binary).
+	upper := layer(t, true,
+		entry{name: "srv/.wh.old"},
+		entry{name: "lib/apk/db/installed", data: []byte(apk[:strings.Index(apk, "\n\n")+1])},
+		entry{name: "usr/local/bin/app", data: bin, mode: 0755},
+	)
+	st, digest := writeImage(t, base, upper)
+
+	inv, err := Scan(context.Background(), st, digest, t.TempDir())
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if inv.Distro == nil || inv.Distro.ID != "alpine" || inv.Distro.VersionID != "3.19.1" {
+		t.Errorf("distro = %+v", inv.Distro)
+	}
+	if inv.Layers != 2 {
+		t.Errorf("layers = %d, want 2", inv.Layers)
+	}
+	musl := find(inv, TypeAPK, "musl")
+	if musl == nil {
+		t.Fatalf("musl not found in %+v", inv.Packages)
+	}
+	if musl.PURL != "pkg:apk/alpine/musl@1.2.4-r2?arch=x86_64&distro=alpine-3.19.1" || musl.Path != "/lib/apk/db/installed" {
+		t.Errorf("musl = %+v", musl)
+	}
+	if find(inv, TypeAPK, "busybox") != nil {
+		t.Error("busybox was replaced by the upper layer's apk db but is still listed")
+	}
+	if p := find(inv, TypeNPM, "lodash"); p == nil || p.Version != "4.17.21" || p.PURL != "pkg:npm/lodash@4.17.21" {
+		t.Errorf("lodash = %+v", p)
+	}
+	if find(inv, TypeNPM, "left-pad") != nil {
+		t.Error("left-pad sits under a whiteout but is still listed")
+	}
+	if p := find(inv, TypePyPI, "requests"); p == nil || p.License != "Apache-2.0" {
+		t.Errorf("requests = %+v", p)
+	}
+	if p := find(inv, TypeGolang, "stdlib"); p == nil || p.Path != "/usr/local/bin/app" {
+		t.Errorf("stdlib = %+v", p)
+	}
+	if find(inv, TypeGolang, "github.com/klauspost/compress") == nil {
+		t.Error("the Go binary's dependencies were not listed")
+	}
+}
+
+func TestParseDpkg(t *testing.T) {
+	status := `Package: libssl3
+Status: install ok installed
+Architecture: amd64
+Source: openssl (3.0.11-1)
+Version: 3.0.11-1~deb12u2
+Description: Secure Sockets Layer toolkit
+ multi-line description
+
+Package: removed
+Status: deinstall ok config-files
+Version: 1.0
+`
+	pkgs := parseDpkg([]byte(status))
+	if len(pkgs) != 1 {
+		t.Fatalf("packages = %+v, want only the installed one", pkgs)
+	}
+	p := pkgs[0]
+	if p.Name != "libssl3" || p.Source != "openssl" || p.Version != "3.0.11-1~deb12u2" || p.Arch != "amd64" {
+		t.Errorf("package = %+v", p)
+	}
+	p.PURL = purlFor(p, &Distro{ID: "debian", VersionID: "12"})
+	if want := "pkg:deb/debian/libssl3@3.0.11-1~deb12u2?arch=amd64&distro=debian-12"; p.PURL != want {
+		t.Errorf("purl = %s, want %s", p.PURL, want)
+	}
+}
+
+// rpmHeader encodes an rpm header blob with the given string tags and an
+// optional epoch.
+func rpmHeader(tags map[int32]string, epoch uint32) []byte {
+	var index, data bytes.Buffer
+	put := func(tag int32, typ uint32, value []byte) {
+		_ = binary.Write(&index, binary.BigEndian, []uint32{uint32(tag), typ, uint32(data.Len()), 1})
+		data.Write(value)
+	}
+	for tag, v := range tags {
+		put(tag, rpmTypeString, append([]byte(v), 0))
+	}
+	if epoch > 0 {
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+		put(rpmTagEpoch, rpmTypeInt32, binary.BigEndian.AppendUint32(nil, epoch))
+	}
+	var out bytes.Buffer
+	_ = binary.Write(&out, binary.BigEndian, []uint32{uint32(index.Len() / 16), uint32(data.Len())})
+	out.Write(index.Bytes())
+	out.Write(data.Bytes())
+	return out.Bytes()
+}
+
+func TestParseRPMDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rpmdb.sqlite")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE Packages (hnum INTEGER PRIMARY KEY AUTOINCREMENT, blob BLOB NOT NULL)`); err != nil {
+		t.Fatal(err)
+	}
+	headers := [][]byte{
+		rpmHeader(map[int32]string{rpmTagName: "openssl-libs", rpmTagVersion: "3.0.7", rpmTagRelease: "27.el9",
+			rpmTagArch: "x86_64", rpmTagLicense: "ASL 2.0", rpmTagSourceRPM: "openssl-3.0.7-27.el9.src.rpm"}, 1),
+		rpmHeader(map[int32]string{rpmTagName: "gpg-pubkey", rpmTagVersion: "fd431d51", rpmTagRelease: "4ae0493b"}, 0),
+		[]byte("garbage"),
+	}
+	for _, h := range headers {
+		if _, err := db.Exec(`INSERT INTO Packages (blob) VALUES (?)`, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	pkgs, err := parseRPMDB(path)
+	if err != nil {
+		t.Fatalf("parseRPMDB: %v", err)
+	}
+	if len(pkgs) != 1 {
+		t.Fatalf("packages = %+v, want just openssl-libs", pkgs)
+	}
+	p := pkgs[0]
+	if p.Name != "openssl-libs" || p.Version != "1:3.0.7-27.el9" || p.Arch != "x86_64" || p.Source != "openssl-3.0.7-27.el9.src.rpm" {
+		t.Errorf("package = %+v", p)
+	}
+	p.PURL = purlFor(p, &Distro{ID: "rhel", VersionID: "9.3"})
+	if want := "pkg:rpm/rhel/openssl-libs@3.0.7-27.el9?arch=x86_64&epoch=1&distro=rhel-9.3"; p.PURL != want {
+		t.Errorf("purl = %s, want %s", p.PURL, want)
+	}
+}
+
+func TestLockfiles(t *testing.T) {
+	cases := []struct {
+		file, content string
+		want          []string // name@version
+	}{
+		{"yarn.lock", "# yarn lockfile v1\n\n\"@babel/core@^7.0.0\", \"@babel/core@^7.1.0\":\n  version \"7.23.2\"\n\nms@2.1.3:\n  version \"2.1.3\"\n", []string{"@babel/core@7.23.2", "ms@2.1.3"}},
+		{"Cargo.lock", "version = 3\n\n[[package]]\nname = \"serde\"\nversion = \"1.0.193\"\nsource = \"registry+https://github.com/rust-lang/crates.io-index\"\n", []string{"serde@1.0.193"}},
+		{"poetry.lock", "[[package]]\nname = \"urllib3\"\nversion = \"2.1.0\"\n", []string{"urllib3@2.1.0"}},
+		{"requirements.txt", "# pinned\nflask==3.0.0\nclick>=8\njinja2==3.1.2 ; python_version >= \"3.8\"\n", []string{"flask@3.0.0", "jinja2@3.1.2"}},
+		{"composer.lock", `{"packages":[{"name":"monolog/monolog","version":"3.5.0","license":["MIT"]}],"packages-dev":[]}`, []string{"monolog/monolog@3.5.0"}},
+		{"Gemfile.lock", "GEM\n  remote: https://rubygems.org/\n  specs:\n    rack (3.0.8)\n    rails (7.1.2)\n      rack (>= 2.2.4)\n\nPLATFORMS\n  ruby\n", []string{"rack@3.0.8", "rails@7.1.2"}},
+	}
+	for _, c := range cases {
+		pkgs, err := lockfiles[c.file]([]byte(c.content))
+		if err != nil {
+			t.Errorf("%s: %v", c.file, err)
+			continue
+		}
+		var got []string
+		for _, p := range pkgs {
+			got = append(got, p.Name+"@"+p.Version)
+		}
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s: got %v, want %v", c.file, got, c.want)
+		}
+	}
+}
+
+func TestRenderAndSave(t *testing.T) {
+	inv := &Inventory{
+		Image: "docker.io/library/app:1", Digest: "sha256:" + strings.Repeat("ab", 32), Platform: "linux/amd64",
+		Distro: &Distro{ID: "alpine", VersionID: "3.19.1"},
+		Packages: []Package{
+			{Type: TypeAPK, Name: "musl", Version: "1.2.4-r2", License: "MIT", PURL: "pkg:apk/alpine/musl@1.2.4-r2", Path: "/lib/apk/db/installed"},
+			{Type: TypeNPM, Name: "x", Version: "1.0.0", License: "see LICENSE file", PURL: "pkg:npm/x@1.0.0", Path: "/app/package-lock.json"},
+		},
+	}
+	base := t.TempDir()
+	if err := Save(base, inv); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	path, err := Document(base, inv.Digest, FormatSPDX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		SPDXVersion string `json:"spdxVersion"`
+		Packages    []struct {
+			Name            string `json:"name"`
+			LicenseDeclared string `json:"licenseDeclared"`
+		} `json:"packages"`
+		Relationships []interface{} `json:"relationships"`
+	}
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.SPDXVersion != "SPDX-2.3" || len(doc.Packages) != 3 || len(doc.Relationships) != 3 {
+		t.Errorf("spdx = %+v", doc)
+	}
+	if doc.Packages[2].LicenseDeclared != "NOASSERTION" {
+		t.Errorf("a free-text license should not be declared as SPDX: %+v", doc.Packages[2])
+	}
+
+	path, _ = Document(base, inv.Digest, FormatCycloneDX)
+	var bom struct {
+		BOMFormat  string `json:"bomFormat"`
+		Components []struct {
+			PURL string `json:"purl"`
+		} `json:"components"`
+	}
+	data, _ = os.ReadFile(path)
+	if err := json.Unmarshal(data, &bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.BOMFormat != "CycloneDX" || len(bom.Components) != 2 || bom.Components[0].PURL != "pkg:apk/alpine/musl@1.2.4-r2" {
+		t.Errorf("cyclonedx = %+v", bom)
+	}
+
+	if _, err := Document(base, "../etc", FormatSPDX); err == nil {
+		t.Error("Document accepted an invalid digest")
+	}
+	list, err := List(base)
+	if err != nil || len(list) != 1 || list[0].Image != inv.Image {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+	if got, err := Load(base, inv.Digest); err != nil || len(got.Packages) != 2 {
+		t.Errorf("Load = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,224 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Media types and annotations of cosign's signature and attestation layers.
+const (
+	MediaTypeSimpleSigning  = "application/vnd.dev.cosign.simplesigning.v1+json"
+	MediaTypeDSSE           = "application/vnd.dsse.envelope.v1+json"
+	MediaTypeSigstoreBundle = "application/vnd.dev.sigstore.bundle.v0.3+json"
+
+	// AnnotationSignature carries the base64 signature of a simple signing
+	// layer's payload.
+	AnnotationSignature = "dev.cosignproject.cosign/signature"
+	// AnnotationCertificate carries the signing certificate of a keyless
+	// signature.
+	AnnotationCertificate = "dev.sigstore.cosign/certificate"
+	// AnnotationPredicateType names an attestation layer's predicate.
+	AnnotationPredicateType = "predicateType"
+)
+
+// SimpleSigningType is the critical.type of a cosign image signature.
+const SimpleSigningType = "cosign container image signature"
+
+// Verifier is a public key that verifies cosign signatures: ECDSA (cosign's
+// default P-256 keys), RSA or ed25519.
+type Verifier struct {
+	Key crypto.PublicKey
+	ID  string // sha256 of the PKIX encoding, as KeyID
+}
+
+// NewVerifier wraps a public key, rejecting unsupported key types.
+func NewVerifier(key crypto.PublicKey) (Verifier, error) {
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+	default:
+		return Verifier{}, fmt.Errorf("unsupported public key type %T", key)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return Verifier{}, err
+	}
+	sum := sha256.Sum256(der)
+	return Verifier{Key: key, ID: "sha256:" + hex.EncodeToString(sum[:])}, nil
+}
+
+// ParseVerifier parses a PEM "PUBLIC KEY" block, as written by
+// "cosign generate-key-pair" to cosign.pub.
+func ParseVerifier(data []byte) (Verifier, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Verifier{}, fmt.Errorf("no PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return Verifier{}, err
+	}
+	return NewVerifier(key)
+}
+
+// LoadVerifiers reads every PEM public key (*.pub or *.pem) in dir. A
+// missing directory yields no keys.
+func LoadVerifiers(dir string) ([]Verifier, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []Verifier
+	for _, e := range entries {
+		if e.IsDir() || !(strings.HasSuffix(e.Name(), ".pub") || strings.HasSuffix(e.Name(), ".pem")) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		v, err := ParseVerifier(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		keys = append(keys, v)
+	}
+	return keys, nil
+}
+
+// verify checks sig over data. ECDSA and RSA signatures are over the data's
+// sha256, as cosign produces them; ed25519 signs the data itself.
+func (v Verifier) verify(data, sig []byte) bool {
+	switch k := v.Key.(type) {
+	case *ecdsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(k, sum[:], sig)
+	case *rsa.PublicKey:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil ||
+			rsa.VerifyPSS(k, crypto.SHA256, sum[:], sig, nil) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, data, sig)
+	}
+	return false
+}
+
+// VerifyAny checks a base64 signature of data against keys and returns the
+// id of the key that verified it.
+func VerifyAny(data []byte, signature string, keys []Verifier) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return "", fmt.Errorf("decoding signature: %w", err)
+	}
+	for _, k := range keys {
+		if k.verify(data, sig) {
+			return k.ID, nil
+		}
+	}
+	return "", ErrUntrusted
+}
+
+// SimpleSigning is the payload cosign signs for an image: the digest of the
+// manifest it vouches for.
+type SimpleSigning struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// NewSimpleSigning returns the payload signing the manifest with the given
+// digest, pushed under repository.
+func NewSimpleSigning(repository, digest string) *SimpleSigning {
+	p := &SimpleSigning{}
+	p.Critical.Identity.DockerReference = repository
+	p.Critical.Image.DockerManifestDigest = digest
+	p.Critical.Type = SimpleSigningType
+	return p
+}
+
+// ParseSimpleSigning parses a simple signing payload.
+func ParseSimpleSigning(data []byte) (*SimpleSigning, error) {
+	var p SimpleSigning
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parsing signature payload: %w", err)
+	}
+	if p.Critical.Type != SimpleSigningType {
+		return nil, fmt.Errorf("unexpected signature payload type %q", p.Critical.Type)
+	}
+	return &p, nil
+}
+
+// Envelope is a DSSE envelope, the form of cosign attestations.
+type Envelope struct {
+	PayloadType string `json:"payloadType"`
+	Payload     string `json:"payload"` // base64
+	Signatures  []struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"` // base64
+	} `json:"signatures"`
+}
+
+// PAE is DSSE's pre-authentication encoding of a payload, which is what the
+// envelope's signatures sign.
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// Verify checks the envelope's signatures against keys and returns the
+// decoded payload and the id of the key that verified it.
+func (e *Envelope) Verify(keys []Verifier) ([]byte, string, error) {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding payload: %w", err)
+	}
+	pae := PAE(e.PayloadType, payload)
+	for _, s := range e.Signatures {
+		if id, err := VerifyAny(pae, s.Sig, keys); err == nil {
+			return payload, id, nil
+		}
+	}
+	return payload, "", ErrUntrusted
+}
+
+// Statement is an in-toto statement, the payload of an attestation.
+type Statement struct {
+	Type    string `json:"_type"`
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+}
+
+// Covers reports whether the statement's subjects include the manifest with
+// the given "algorithm:hex" digest.
+func (s *Statement) Covers(digest string) bool {
+	algo, hex, _ := strings.Cut(digest, ":")
+	for _, sub := range s.Subject {
+		if strings.EqualFold(sub.Digest[algo], hex) {
+			return true
+		}
+	}
+	return false
+}
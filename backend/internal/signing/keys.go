@@ -0,0 +1,214 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM block types of encrypted private keys, as written by cosign
+// (older releases used the COSIGN form).
+const (
+	PEMTypeEncryptedKey       = "ENCRYPTED SIGSTORE PRIVATE KEY"
+	pemTypeEncryptedCosignKey = "ENCRYPTED COSIGN PRIVATE KEY"
+)
+
+// The largest scrypt parameters an encrypted key may ask for: those of
+// cosign's import-key-pair, whose generated keys use N=32768.
+const (
+	maxScryptN = 65536
+	maxScryptR = 8
+	maxScryptP = 1
+)
+
+// ErrWrongPassword is returned when an encrypted key does not decrypt.
+var ErrWrongPassword = errors.New("wrong password for encrypted key")
+
+// encryptedKey is the JSON body of an encrypted private key: the PKCS#8 key
+// sealed with nacl/secretbox under a key derived from a password by scrypt.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// EncryptPrivateKey encodes key as a PEM block encrypted with password, in
+// the format cosign reads and writes.
+func EncryptPrivateKey(key crypto.Signer, password []byte) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	var e encryptedKey
+	e.KDF.Name, e.Cipher.Name = "scrypt", "nacl/secretbox"
+	e.KDF.Params.N, e.KDF.Params.R, e.KDF.Params.P = 32768, 8, 1
+	e.KDF.Salt, e.Cipher.Nonce = make([]byte, 32), make([]byte, 24)
+	if _, err := rand.Read(e.KDF.Salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(e.Cipher.Nonce); err != nil {
+		return nil, err
+	}
+	secret, err := scrypt.Key(password, e.KDF.Salt, e.KDF.Params.N, e.KDF.Params.R, e.KDF.Params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+	var k [32]byte
+	var nonce [24]byte
+	copy(k[:], secret)
+	copy(nonce[:], e.Cipher.Nonce)
+	e.Ciphertext = secretbox.Seal(nil, der, &nonce, &k)
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: PEMTypeEncryptedKey, Bytes: body}), nil
+}
+
+// ParsePrivateKey reads a PEM private key: encrypted (cosign.key, opened
+// with password) or plain PKCS#8, SEC 1 (EC) or PKCS#1 (RSA).
+func ParsePrivateKey(data, password []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+	der := block.Bytes
+	switch block.Type {
+	case PEMTypeEncryptedKey, pemTypeEncryptedCosignKey:
+		var e encryptedKey
+		if err := json.Unmarshal(block.Bytes, &e); err != nil {
+			return nil, fmt.Errorf("parsing encrypted key: %w", err)
+		}
+		if e.KDF.Name != "scrypt" || e.Cipher.Name != "nacl/secretbox" || len(e.Cipher.Nonce) != 24 {
+			return nil, fmt.Errorf("unsupported key encryption %s/%s", e.KDF.Name, e.Cipher.Name)
+		}
+		// The parameters come from the key file; above cosign's they could
+		// make scrypt allocate gigabytes.
+		if p := e.KDF.Params; p.N > maxScryptN || p.R > maxScryptR || p.P > maxScryptP {
+			return nil, fmt.Errorf("scrypt parameters N=%d r=%d p=%d exceed cosign's (N=%d r=%d p=%d)",
+				p.N, p.R, p.P, maxScryptN, maxScryptR, maxScryptP)
+		}
+		secret, err := scrypt.Key(password, e.KDF.Salt, e.KDF.Params.N, e.KDF.Params.R, e.KDF.Params.P, 32)
+		if err != nil {
+			return nil, err
+		}
+		var k [32]byte
+		var nonce [24]byte
+		copy(k[:], secret)
+		copy(nonce[:], e.Cipher.Nonce)
+		var ok bool
+		if der, ok = secretbox.Open(nil, e.Ciphertext, &nonce, &k); !ok {
+			return nil, ErrWrongPassword
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(der)
+	case "PRIVATE KEY":
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// CosignSigner signs cosign payloads with a private key.
+type CosignSigner struct {
+	key crypto.Signer
+	Verifier
+}
+
+// NewCosignSigner wraps an ECDSA, RSA or ed25519 private key.
+func NewCosignSigner(key crypto.Signer) (*CosignSigner, error) {
+	v, err := NewVerifier(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &CosignSigner{key: key, Verifier: v}, nil
+}
+
+// GenerateCosignKey creates an ECDSA P-256 key, cosign's default.
+func GenerateCosignKey() (*CosignSigner, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewCosignSigner(key)
+}
+
+// Algorithm names the key type, e.g. "ecdsa-p256".
+func (s *CosignSigner) Algorithm() string {
+	switch k := s.key.(type) {
+	case *ecdsa.PrivateKey:
+		return "ecdsa-" + map[int]string{256: "p256", 384: "p384", 521: "p521"}[k.Curve.Params().BitSize]
+	case *rsa.PrivateKey:
+		return fmt.Sprintf("rsa-%d", k.N.BitLen())
+	case ed25519.PrivateKey:
+		return "ed25519"
+	}
+	return "unknown"
+}
+
+// PublicKeyPEM returns the public key as a PEM "PUBLIC KEY" block, the form
+// of cosign.pub.
+func (s *CosignSigner) PublicKeyPEM() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(s.key.Public())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Encrypt returns the private key encrypted with password.
+func (s *CosignSigner) Encrypt(password []byte) ([]byte, error) {
+	return EncryptPrivateKey(s.key, password)
+}
+
+// Sign returns the base64 signature of data the way cosign makes it: ECDSA
+// and RSA sign the data's sha256, ed25519 the data itself.
+func (s *CosignSigner) Sign(data []byte) (string, error) {
+	var sig []byte
+	var err error
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, data)
+	case *rsa.PrivateKey:
+		sum := sha256.Sum256(data)
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, sum[:])
+	default:
+		sum := sha256.Sum256(data)
+		sig, err = s.key.Sign(rand.Reader, sum[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
@@ -0,0 +1,162 @@
+package signing
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/sqlite"
+)
+
+func TestEncryptedKeys(t *testing.T) {
+	s, err := GenerateCosignKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Algorithm() != "ecdsa-p256" {
+		t.Errorf("algorithm = %s", s.Algorithm())
+	}
+	enc, err := s.Encrypt([]byte("hunter2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if block, _ := pem.Decode(enc); block == nil || block.Type != PEMTypeEncryptedKey {
+		t.Fatalf("expected an encrypted PEM block, got %s", enc)
+	}
+	if _, err := ParsePrivateKey(enc, []byte("wrong")); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected a wrong password to fail, got %v", err)
+	}
+	key, err := ParsePrivateKey(enc, []byte("hunter2"))
+	if err != nil {
+		t.Fatalf("decrypting: %v", err)
+	}
+	opened, _ := NewCosignSigner(key)
+	if opened.ID != s.ID {
+		t.Errorf("decrypted key %s, want %s", opened.ID, s.ID)
+	}
+
+	// What is signed verifies against the public key, as cosign.pub.
+	payload, _ := json.Marshal(NewSimpleSigning("docker.io/library/nginx", "sha256:abc"))
+	sig, err := opened.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ParseVerifier(s.PublicKeyPEM())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := VerifyAny(payload, sig, []Verifier{pub}); err != nil || id != s.ID {
+		t.Errorf("VerifyAny = %q, %v", id, err)
+	}
+
+	// Plain SEC 1 keys import too.
+	ec, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	der, _ := x509.MarshalECPrivateKey(ec)
+	plain, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil)
+	if err != nil {
+		t.Fatalf("parsing EC key: %v", err)
+	}
+	if p, _ := NewCosignSigner(plain); p.Algorithm() != "ecdsa-p384" {
+		t.Errorf("algorithm = %s", p.Algorithm())
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	secret, err := LoadOrCreateSecret(filepath.Join(t.TempDir(), "keys", "keystore.secret"))
+	if err != nil || len(secret) == 0 {
+		t.Fatalf("LoadOrCreateSecret = %q, %v", secret, err)
+	}
+	ks := NewKeystore(db.DB, secret)
+
+	s, _ := GenerateCosignKey()
+	key, err := ks.Add(ctx, "release", s, false)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if key.KeyID != s.ID || key.Algorithm != "ecdsa-p256" || key.PublicKey != string(s.PublicKeyPEM()) {
+		t.Errorf("unexpected key %+v", key)
+	}
+	if _, err := ks.Add(ctx, "release", s, false); !errors.Is(err, ErrKeyExists) {
+		t.Errorf("expected a duplicate name to be refused, got %v", err)
+	}
+	var stored string
+	_ = db.QueryRow(`SELECT private_key FROM cosign_keys WHERE id = ?`, key.ID).Scan(&stored)
+	if block, _ := pem.Decode([]byte(stored)); block == nil || block.Type != PEMTypeEncryptedKey {
+		t.Errorf("expected the private key to be stored encrypted, got %q", stored)
+	}
+
+	signer, err := ks.Signer(ctx, key.ID)
+	if err != nil || signer.ID != s.ID {
+		t.Fatalf("Signer = %v, %v", signer, err)
+	}
+	if _, err := NewKeystore(db.DB, []byte("other")).Signer(ctx, key.ID); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected another password to fail, got %v", err)
+	}
+	if vs, err := ks.Verifiers(ctx); err != nil || len(vs) != 1 || vs[0].ID != s.ID {
+		t.Errorf("Verifiers = %v, %v", vs, err)
+	}
+	if err := ks.Delete(ctx, key.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get(ctx, key.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the key to be gone, got %v", err)
+	}
+}
+
+func TestKeystoreUnlock(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A key stored under the generated secret, before a password was set.
+	s, _ := GenerateCosignKey()
+	key, err := NewKeystore(db.DB, []byte("generated")).Add(ctx, "release", s, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeystore(db.DB, []byte("configured")).Unlock(ctx); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected another password alone not to unlock, got %v", err)
+	}
+	ks := NewKeystore(db.DB, []byte("configured"))
+	if n, err := ks.Unlock(ctx, []byte("generated")); err != nil || n != 1 {
+		t.Fatalf("Unlock = %d, %v; want the key re-encrypted", n, err)
+	}
+	if signer, err := ks.Signer(ctx, key.ID); err != nil || signer.ID != s.ID {
+		t.Errorf("expected the configured password to open the key, got %v", err)
+	}
+	if n, err := ks.Unlock(ctx, []byte("generated")); err != nil || n != 0 {
+		t.Errorf("expected nothing left to re-encrypt, got %d, %v", n, err)
+	}
+}
+
+func TestParsePrivateKeyLimitsScrypt(t *testing.T) {
+	s, _ := GenerateCosignKey()
+	enc, _ := s.Encrypt([]byte("hunter2"))
+	block, _ := pem.Decode(enc)
+	var e encryptedKey
+	_ = json.Unmarshal(block.Bytes, &e)
+	e.KDF.Params.N = 1 << 24
+	body, _ := json.Marshal(e)
+	crafted := pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: body})
+	if _, err := ParsePrivateKey(crafted, []byte("hunter2")); err == nil || errors.Is(err, ErrWrongPassword) {
+		t.Errorf("expected oversized scrypt parameters to be refused, got %v", err)
+	}
+}
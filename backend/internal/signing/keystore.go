@@ -0,0 +1,248 @@
+package signing
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrKeyExists is returned when a key name is already taken.
+var ErrKeyExists = errors.New("a key with this name already exists")
+
+// Key is a cosign signing key held in the keystore. Only the public half is
+// ever returned; the private key is stored encrypted and used in place.
+type Key struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	KeyID     string    `json:"keyId"`
+	Algorithm string    `json:"algorithm"`
+	PublicKey string    `json:"publicKey"` // PEM
+	Imported  bool      `json:"imported"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Keystore keeps cosign signing keys in the cosign_keys table, each private
+// key encrypted (as cosign does) with the keystore password.
+type Keystore struct {
+	db       *sql.DB
+	password []byte
+}
+
+// NewKeystore returns a keystore over db whose keys are encrypted with
+// password.
+func NewKeystore(db *sql.DB, password []byte) *Keystore {
+	return &Keystore{db: db, password: password}
+}
+
+// ReadSecret reads the secret in the file at path.
+func ReadSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strings.TrimSpace(string(data))), nil
+}
+
+// LoadOrCreateSecret reads the secret in the file at path, generating and
+// writing a random one (mode 0600) if the file does not exist.
+func LoadOrCreateSecret(path string) ([]byte, error) {
+	secret, err := ReadSecret(path)
+	if err == nil {
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading keystore secret: %w", err)
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(raw)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("writing keystore secret: %w", err)
+	}
+	return []byte(encoded), nil
+}
+
+// Add stores a signing key under name.
+func (k *Keystore) Add(ctx context.Context, name string, s *CosignSigner, imported bool) (*Key, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	var n int
+	if err := k.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM cosign_keys WHERE name = ?`, name).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, ErrKeyExists
+	}
+	private, err := s.Encrypt(k.password)
+	if err != nil {
+		return nil, err
+	}
+	res, err := k.db.ExecContext(ctx, `
+		INSERT INTO cosign_keys (name, key_id, algorithm, public_key, private_key, imported)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		name, s.ID, s.Algorithm(), string(s.PublicKeyPEM()), string(private), imported)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return k.Get(ctx, id)
+}
+
+const keyColumns = `id, name, key_id, algorithm, public_key, imported, created_at`
+
+func scanKey(row interface{ Scan(...interface{}) error }) (*Key, error) {
+	var key Key
+	if err := row.Scan(&key.ID, &key.Name, &key.KeyID, &key.Algorithm, &key.PublicKey, &key.Imported, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// Get returns a key, or sql.ErrNoRows.
+func (k *Keystore) Get(ctx context.Context, id int64) (*Key, error) {
+	return scanKey(k.db.QueryRowContext(ctx, `SELECT `+keyColumns+` FROM cosign_keys WHERE id = ?`, id))
+}
+
+// List returns every key, oldest first.
+func (k *Keystore) List(ctx context.Context) ([]Key, error) {
+	rows, err := k.db.QueryContext(ctx, `SELECT `+keyColumns+` FROM cosign_keys ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []Key{}
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// Delete removes a key, or returns sql.ErrNoRows.
+func (k *Keystore) Delete(ctx context.Context, id int64) error {
+	res, err := k.db.ExecContext(ctx, `DELETE FROM cosign_keys WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Signer decrypts a key for signing.
+func (k *Keystore) Signer(ctx context.Context, id int64) (*CosignSigner, error) {
+	var private string
+	if err := k.db.QueryRowContext(ctx, `SELECT private_key FROM cosign_keys WHERE id = ?`, id).Scan(&private); err != nil {
+		return nil, err
+	}
+	key, err := ParsePrivateKey([]byte(private), k.password)
+	if err != nil {
+		return nil, fmt.Errorf("opening key %d: %w", id, err)
+	}
+	return NewCosignSigner(key)
+}
+
+// Unlock checks that the keystore password opens every stored key. A key
+// that it does not open but one of previous does, e.g. the generated secret
+// in use before a password was configured, is re-encrypted with the password.
+// It returns how many keys were re-encrypted, or ErrWrongPassword when a key
+// opens with none of the passwords.
+func (k *Keystore) Unlock(ctx context.Context, previous ...[]byte) (int, error) {
+	rows, err := k.db.QueryContext(ctx, `SELECT id, name, private_key FROM cosign_keys ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	type storedKey struct {
+		id            int64
+		name, private string
+	}
+	var stored []storedKey
+	for rows.Next() {
+		var s storedKey
+		if err := rows.Scan(&s.id, &s.name, &s.private); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		stored = append(stored, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	migrated := 0
+	for _, s := range stored {
+		_, err := ParsePrivateKey([]byte(s.private), k.password)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrWrongPassword) {
+			return 0, fmt.Errorf("key %s: %w", s.name, err)
+		}
+		var key crypto.Signer
+		for _, password := range previous {
+			if len(password) == 0 {
+				continue
+			}
+			if key, err = ParsePrivateKey([]byte(s.private), password); err == nil {
+				break
+			}
+		}
+		if key == nil {
+			return 0, fmt.Errorf("key %s: %w", s.name, ErrWrongPassword)
+		}
+		private, err := EncryptPrivateKey(key, k.password)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE cosign_keys SET private_key = ? WHERE id = ?`, string(private), s.id); err != nil {
+			return 0, err
+		}
+		migrated++
+	}
+	return migrated, tx.Commit()
+}
+
+// Verifiers returns the public keys of every stored key.
+func (k *Keystore) Verifiers(ctx context.Context) ([]Verifier, error) {
+	keys, err := k.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Verifier, 0, len(keys))
+	for _, key := range keys {
+		v, err := ParseVerifier([]byte(key.PublicKey))
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.Name, err)
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
@@ -0,0 +1,150 @@
+// Package signing manages the server's ed25519 key, verifies detached
+// signatures against a set of trusted public keys, and reads and verifies
+// cosign image signatures and attestations.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUntrusted is returned when no trusted key verifies a signature.
+var ErrUntrusted = errors.New("signature does not verify against any trusted key")
+
+// Signer signs with the server's ed25519 key.
+type Signer struct {
+	priv  ed25519.PrivateKey
+	KeyID string
+}
+
+// LoadOrCreate reads the PEM (PKCS#8) ed25519 private key at path, generating
+// and writing a new one (mode 0600) if the file does not exist.
+func LoadOrCreate(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(priv)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("writing signing key: %w", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ed25519 key", path)
+	}
+	return &Signer{priv: priv, KeyID: KeyID(priv.Public().(ed25519.PublicKey))}, nil
+}
+
+// Public returns the signer's public key.
+func (s *Signer) Public() ed25519.PublicKey {
+	return s.priv.Public().(ed25519.PublicKey)
+}
+
+// PublicKeyPEM returns the signer's public key as a PEM "PUBLIC KEY" block.
+func (s *Signer) PublicKeyPEM() []byte {
+	der, _ := x509.MarshalPKIXPublicKey(s.Public())
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+// Sign returns the base64-encoded signature of data.
+func (s *Signer) Sign(data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, data))
+}
+
+// KeyID identifies a public key by the sha256 of its PKIX encoding.
+func KeyID(pub ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// LoadPublicKeys reads every PEM ed25519 public key (*.pub or *.pem) in dir.
+// A missing directory yields no keys.
+func LoadPublicKeys(dir string) ([]ed25519.PublicKey, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var keys []ed25519.PublicKey
+	for _, e := range entries {
+		if e.IsDir() || !(strings.HasSuffix(e.Name(), ".pub") || strings.HasSuffix(e.Name(), ".pem")) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		pub, err := ParsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", e.Name(), err)
+		}
+		keys = append(keys, pub)
+	}
+	return keys, nil
+}
+
+// ParsePublicKey parses a PEM "PUBLIC KEY" block holding an ed25519 key.
+func ParsePublicKey(data []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 public key")
+	}
+	return pub, nil
+}
+
+// Verify checks a base64 signature of data against keys and returns the id of
+// the key that verified it.
+func Verify(data []byte, signature string, keys []ed25519.PublicKey) (string, error) {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return "", fmt.Errorf("decoding signature: %w", err)
+	}
+	for _, k := range keys {
+		if ed25519.Verify(k, data, sig) {
+			return KeyID(k), nil
+		}
+	}
+	return "", ErrUntrusted
+}
@@ -0,0 +1,116 @@
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "keys", "signing.pem")
+
+	s, err := LoadOrCreate(keyPath)
+	if err != nil {
+		t.Fatalf("creating key: %v", err)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("expected a 0600 key file, got %v %v", info, err)
+	}
+	again, err := LoadOrCreate(keyPath)
+	if err != nil || again.KeyID != s.KeyID {
+		t.Fatalf("expected the key to be reused, got %v %v", again, err)
+	}
+
+	data := []byte(`{"archive":"a.tar.zst"}`)
+	sig := s.Sign(data)
+
+	trusted := filepath.Join(dir, "trusted")
+	_ = os.MkdirAll(trusted, 0755)
+	_ = os.WriteFile(filepath.Join(trusted, "server.pub"), s.PublicKeyPEM(), 0644)
+	keys, err := LoadPublicKeys(trusted)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("loading trusted keys: %v %v", keys, err)
+	}
+	if id, err := Verify(data, sig, keys); err != nil || id != s.KeyID {
+		t.Errorf("Verify = %q, %v; want %q", id, err, s.KeyID)
+	}
+	if _, err := Verify([]byte("tampered"), sig, keys); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("expected tampered data to be untrusted, got %v", err)
+	}
+
+	other, _ := LoadOrCreate(filepath.Join(dir, "other.pem"))
+	if _, err := Verify(data, other.Sign(data), keys); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("expected an unknown key to be untrusted, got %v", err)
+	}
+	if keys, err := LoadPublicKeys(filepath.Join(dir, "missing")); err != nil || keys != nil {
+		t.Errorf("expected a missing directory to yield no keys, got %v %v", keys, err)
+	}
+}
+
+func TestCosignSignatures(t *testing.T) {
+	ec, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rk, _ := rsa.GenerateKey(rand.Reader, 2048)
+	dir := t.TempDir()
+	for name, pub := range map[string]interface{}{"cosign.pub": &ec.PublicKey, "rsa.pem": &rk.PublicKey} {
+		der, _ := x509.MarshalPKIXPublicKey(pub)
+		_ = os.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	}
+	keys, err := LoadVerifiers(dir)
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("LoadVerifiers = %v, %v", keys, err)
+	}
+	ecID := keys[0].ID
+
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	payload, _ := json.Marshal(NewSimpleSigning("docker.io/library/nginx", digest))
+	sum := sha256.Sum256(payload)
+	sig, _ := ecdsa.SignASN1(rand.Reader, ec, sum[:])
+	if id, err := VerifyAny(payload, base64.StdEncoding.EncodeToString(sig), keys); err != nil || id != ecID {
+		t.Errorf("VerifyAny = %q, %v; want %q", id, err, ecID)
+	}
+	rsig, _ := rsa.SignPKCS1v15(rand.Reader, rk, crypto.SHA256, sum[:])
+	if _, err := VerifyAny(payload, base64.StdEncoding.EncodeToString(rsig), keys); err != nil {
+		t.Errorf("expected the RSA signature to verify, got %v", err)
+	}
+	if _, err := VerifyAny([]byte("tampered"), base64.StdEncoding.EncodeToString(sig), keys); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("expected tampered data to be untrusted, got %v", err)
+	}
+	if p, err := ParseSimpleSigning(payload); err != nil || p.Critical.Image.DockerManifestDigest != digest {
+		t.Errorf("ParseSimpleSigning = %+v, %v", p, err)
+	}
+
+	stmt := []byte(`{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",` +
+		`"subject":[{"name":"nginx","digest":{"sha256":"` + digest[7:] + `"}}]}`)
+	pae := sha256.Sum256(PAE("application/vnd.in-toto+json", stmt))
+	esig, _ := ecdsa.SignASN1(rand.Reader, ec, pae[:])
+	env := Envelope{PayloadType: "application/vnd.in-toto+json", Payload: base64.StdEncoding.EncodeToString(stmt)}
+	env.Signatures = append(env.Signatures, struct {
+		KeyID string `json:"keyid"`
+		Sig   string `json:"sig"`
+	}{Sig: base64.StdEncoding.EncodeToString(esig)})
+	got, id, err := env.Verify(keys)
+	if err != nil || id != ecID {
+		t.Fatalf("Envelope.Verify = %q, %v", id, err)
+	}
+	var st Statement
+	if err := json.Unmarshal(got, &st); err != nil || !st.Covers(digest) || st.Covers("sha256:"+strings.Repeat("0", 64)) {
+		t.Errorf("statement %+v does not cover exactly %s", st, digest)
+	}
+	env.PayloadType = "text/plain"
+	if _, _, err := env.Verify(keys); !errors.Is(err, ErrUntrusted) {
+		t.Errorf("expected a changed payload type to break the signature, got %v", err)
+	}
+}
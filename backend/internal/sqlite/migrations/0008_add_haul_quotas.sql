@@ -0,0 +1,3 @@
+-- Per-haul size quota in bytes covering the haul's store and archives.
+-- 0 means unlimited; the global data-dir reserve still applies.
+ALTER TABLE hauls ADD COLUMN quota_bytes INTEGER NOT NULL DEFAULT 0;
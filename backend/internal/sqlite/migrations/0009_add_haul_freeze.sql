@@ -0,0 +1,19 @@
+-- Frozen hauls are read-only: store mutations and manifest edits are refused.
+-- The digest of index.json at freeze time is kept so drift can be detected.
+ALTER TABLE hauls ADD COLUMN frozen INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE hauls ADD COLUMN frozen_at DATETIME;
+ALTER TABLE hauls ADD COLUMN frozen_by TEXT;
+ALTER TABLE hauls ADD COLUMN frozen_reason TEXT;
+ALTER TABLE hauls ADD COLUMN frozen_index_digest TEXT;
+
+-- Audit trail of every freeze/unfreeze: who, when, and why.
+CREATE TABLE IF NOT EXISTS haul_freeze_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    haul_id INTEGER NOT NULL,
+    action TEXT NOT NULL,         -- 'freeze' | 'unfreeze'
+    actor TEXT,
+    reason TEXT,
+    index_digest TEXT,            -- digest of index.json when the action happened
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_haul_freeze_events_haul ON haul_freeze_events(haul_id, created_at);
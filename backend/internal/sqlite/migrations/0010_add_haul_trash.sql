@@ -0,0 +1,6 @@
+-- Deleted hauls are soft-deleted: the haul directory is moved into the trash
+-- and the row is kept (deleted_at set) until the retention period lapses or it
+-- is purged explicitly. trash_dir is where the haul directory now lives.
+ALTER TABLE hauls ADD COLUMN deleted_at DATETIME;
+ALTER TABLE hauls ADD COLUMN trash_dir TEXT;
+CREATE INDEX IF NOT EXISTS idx_hauls_deleted_at ON hauls(deleted_at);
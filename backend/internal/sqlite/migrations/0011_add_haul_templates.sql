@@ -0,0 +1,22 @@
+-- Haul templates bundle everything a new haul starts with: saved manifests,
+-- default request options, labels, a publish hostname pattern, and whether to
+-- sync right away. Nested settings are stored as JSON.
+CREATE TABLE IF NOT EXISTS haul_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT,
+    manifests TEXT NOT NULL DEFAULT '[]',  -- JSON array of {name, description, yamlContent, tags}
+    defaults TEXT NOT NULL DEFAULT '{}',   -- JSON {platform, rewrite, key}
+    labels TEXT NOT NULL DEFAULT '{}',     -- JSON object of label -> value
+    publish TEXT NOT NULL DEFAULT '{}',    -- JSON {hostnamePattern, autoPublish}
+    quota_bytes INTEGER NOT NULL DEFAULT 0,
+    auto_sync INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Per-haul settings a template configures (and that can be edited afterwards).
+ALTER TABLE hauls ADD COLUMN defaults TEXT;          -- JSON {platform, rewrite, key}
+ALTER TABLE hauls ADD COLUMN labels TEXT;            -- JSON object
+ALTER TABLE hauls ADD COLUMN publish_hostname TEXT;  -- preferred hostname when published
+ALTER TABLE hauls ADD COLUMN template_id INTEGER;    -- template the haul was created from
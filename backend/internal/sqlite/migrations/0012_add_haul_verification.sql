@@ -0,0 +1,6 @@
+-- Outcome of the most recent store integrity check (fsck) per haul. The full
+-- report lives in the result of the verify job (verify_job_id).
+ALTER TABLE hauls ADD COLUMN verified_at DATETIME;
+ALTER TABLE hauls ADD COLUMN verify_ok INTEGER;
+ALTER TABLE hauls ADD COLUMN verify_problems INTEGER;
+ALTER TABLE hauls ADD COLUMN verify_job_id INTEGER;
@@ -0,0 +1,17 @@
+-- Resumable archive uploads. Chunks are appended to a partial file beside the
+-- haul's archives; hash_state is the running sha256 of what has been received
+-- so finishing an upload does not re-read it. Expired sessions are purged.
+CREATE TABLE IF NOT EXISTS uploads (
+    id TEXT PRIMARY KEY,
+    haul_id INTEGER NOT NULL,
+    filename TEXT NOT NULL,
+    size INTEGER NOT NULL,
+    received INTEGER NOT NULL DEFAULT 0,
+    hash_state BLOB,
+    options TEXT,                 -- JSON: expected sha256, manifest, signature, clear
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME           -- NULL when HAULER_UI_UPLOAD_EXPIRY is 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_uploads_expires_at ON uploads(expires_at);
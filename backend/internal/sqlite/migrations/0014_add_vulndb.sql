@@ -0,0 +1,35 @@
+-- Offline vulnerability database, imported from OSV bundles. Each advisory
+-- keeps one row per affected package; ranges and versions are the OSV JSON,
+-- evaluated when a haul's package inventories are matched.
+CREATE TABLE IF NOT EXISTS vuln_imports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source TEXT NOT NULL,         -- bundle filename
+    advisories INTEGER NOT NULL DEFAULT 0,
+    withdrawn INTEGER NOT NULL DEFAULT 0,
+    job_id INTEGER,
+    imported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS vuln_advisories (
+    id TEXT PRIMARY KEY,          -- e.g. GHSA-xxxx, CVE-2024-1234, DSA-5678-1
+    aliases TEXT,                 -- JSON array
+    summary TEXT,
+    severity TEXT NOT NULL,       -- CRITICAL, HIGH, MEDIUM, LOW or UNKNOWN
+    score REAL,                   -- CVSS v3 base score, when known
+    modified TEXT,
+    published TEXT,
+    import_id INTEGER
+);
+
+CREATE TABLE IF NOT EXISTS vuln_affected (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    advisory_id TEXT NOT NULL,
+    ecosystem TEXT NOT NULL,      -- lower-case OSV ecosystem without release, e.g. "debian"
+    release TEXT NOT NULL DEFAULT '', -- e.g. "12" for "Debian:12"
+    package TEXT NOT NULL,
+    ranges TEXT,                  -- JSON
+    versions TEXT                 -- JSON array
+);
+
+CREATE INDEX IF NOT EXISTS idx_vuln_affected_package ON vuln_affected(ecosystem, package);
+CREATE INDEX IF NOT EXISTS idx_vuln_affected_advisory ON vuln_affected(advisory_id);
@@ -0,0 +1,13 @@
+-- Cosign signing keys held by the server. The private key is an encrypted
+-- PEM block in cosign's format (scrypt + nacl/secretbox), sealed with the
+-- keystore password; only the public key is ever served.
+CREATE TABLE IF NOT EXISTS cosign_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    key_id TEXT NOT NULL,         -- sha256 of the PKIX public key
+    algorithm TEXT NOT NULL,      -- e.g. ecdsa-p256
+    public_key TEXT NOT NULL,     -- PEM
+    private_key TEXT NOT NULL,    -- encrypted PEM
+    imported INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
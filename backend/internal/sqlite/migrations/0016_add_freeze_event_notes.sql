@@ -0,0 +1,3 @@
+-- The actor of a freeze event is the client's address; what the client says
+-- about who it is (the request's "by") is kept apart as an unverified note.
+ALTER TABLE haul_freeze_events ADD COLUMN note TEXT;
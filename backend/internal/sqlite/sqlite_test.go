@@ -24,8 +24,8 @@ func TestMigrationsApplyOnEmptyDB(t *testing.T) {
 	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&migrationCount); err != nil {
 		t.Fatalf("Failed to query schema_migrations: %v", err)
 	}
-	if migrationCount != 7 {
-		t.Errorf("Expected 7 migrations, got %d", migrationCount)
+	if migrationCount != 16 {
+		t.Errorf("Expected 16 migrations, got %d", migrationCount)
 	}
 
 	// Verify all tables exist
@@ -65,8 +65,8 @@ func TestMigrationsIdempotent(t *testing.T) {
 	if err := db2.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&migrationCount); err != nil {
 		t.Fatalf("Failed to query schema_migrations: %v", err)
 	}
-	if migrationCount != 7 {
-		t.Errorf("Expected 7 migrations after reopen, got %d", migrationCount)
+	if migrationCount != 16 {
+		t.Errorf("Expected 16 migrations after reopen, got %d", migrationCount)
 	}
 }
 
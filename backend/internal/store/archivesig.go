@@ -0,0 +1,248 @@
+package store
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/signing"
+)
+
+// maxManifestSize bounds a content manifest or signature read from a request.
+const maxManifestSize = 16 << 20
+
+// ArchiveManifest is the content manifest written beside every saved archive
+// and signed with the server's key. Its sha256 and size pin the archive, so a
+// valid signature over the manifest vouches for the archive's bytes.
+type ArchiveManifest struct {
+	Archive   string             `json:"archive"`
+	SHA256    string             `json:"sha256"`
+	Size      int64              `json:"size"`
+	Haul      string             `json:"haul,omitempty"`
+	CreatedAt time.Time          `json:"createdAt"`
+	KeyID     string             `json:"keyId"`
+	Artifacts []ManifestArtifact `json:"artifacts"`
+
+	// Blobs lists every blob the archive's artifacts reference (digest to
+	// size), so the manifest alone can serve as the baseline of a delta.
+	Blobs map[string]int64 `json:"blobs,omitempty"`
+	// Baseline is set for a delta archive, naming what it was cut against.
+	Baseline string `json:"baseline,omitempty"`
+}
+
+// ManifestArtifact is one artifact listed in an ArchiveManifest.
+type ManifestArtifact struct {
+	Type      ocistore.Kind `json:"type"`
+	Ref       string        `json:"ref"`
+	Digest    string        `json:"digest"`
+	Size      int64         `json:"size"`
+	Platforms []string      `json:"platforms,omitempty"`
+}
+
+// errRejected marks an import refused by archive verification.
+var errRejected = errors.New("archive rejected")
+
+// signer returns the server's signing key, generating it on first use.
+func (h *Handler) signer() (*signing.Signer, error) {
+	h.signerMu.Lock()
+	defer h.signerMu.Unlock()
+	if h.signerKey == nil {
+		s, err := signing.LoadOrCreate(h.Cfg.SigningKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		h.signerKey = s
+	}
+	return h.signerKey, nil
+}
+
+// trustedKeys returns the server's own public key plus those in the trusted
+// keys directory.
+func (h *Handler) trustedKeys() ([]ed25519.PublicKey, error) {
+	s, err := h.signer()
+	if err != nil {
+		return nil, err
+	}
+	extra, err := signing.LoadPublicKeys(h.Cfg.TrustedKeysDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading trusted keys: %w", err)
+	}
+	return append([]ed25519.PublicKey{s.Public()}, extra...), nil
+}
+
+// SigningKey handles GET /api/store/signing-key, returning the PEM public key
+// that verifies this server's archive manifests. Add it to another server's
+// trusted keys directory to let that server accept these archives.
+func (h *Handler) SigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s, err := h.signer()
+	if err != nil {
+		http.Error(w, "Failed to load signing key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("X-Key-Id", s.KeyID)
+	_, _ = w.Write(s.PublicKeyPEM())
+}
+
+// writeArchiveSidecars hashes a saved archive, records it in the haul's
+// SHA256SUMS and writes its signed content manifest beside it.
+func (h *Handler) writeArchiveSidecars(haul *hauls.Haul, archivePath string) (*ArchiveManifest, error) {
+	sum, size, err := hauls.FileSHA256(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	dir, name := filepath.Dir(archivePath), filepath.Base(archivePath)
+	if err := hauls.WriteChecksum(dir, name, sum); err != nil {
+		return nil, fmt.Errorf("writing %s: %w", hauls.ChecksumFile, err)
+	}
+
+	st, err := ocistore.LoadArchive(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("reading archive: %w", err)
+	}
+	s, err := h.signer()
+	if err != nil {
+		return nil, err
+	}
+	m := &ArchiveManifest{
+		Archive:   name,
+		SHA256:    sum,
+		Size:      size,
+		Haul:      haul.Slug,
+		CreatedAt: time.Now().UTC(),
+		KeyID:     s.KeyID,
+		Artifacts: make([]ManifestArtifact, 0, len(st.Artifacts)),
+		Blobs:     st.Blobs(),
+	}
+	if f, err := os.Open(archivePath); err == nil {
+		if d, err := ocistore.ReadDelta(f); err == nil && d != nil {
+			m.Baseline = d.Baseline
+		}
+		f.Close()
+	}
+	for i := range st.Artifacts {
+		a := &st.Artifacts[i]
+		m.Artifacts = append(m.Artifacts, ManifestArtifact{
+			Type: a.Kind, Ref: a.Name, Digest: a.Digest, Size: a.Size, Platforms: a.Platforms(),
+		})
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeSignedManifest(dir, name, data, s.Sign(data)); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeSignedManifest writes an archive's manifest and signature sidecars.
+func writeSignedManifest(dir, archive string, manifest []byte, signature string) error {
+	if err := os.WriteFile(filepath.Join(dir, hauls.ManifestName(archive)), manifest, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, hauls.SignatureName(archive)), []byte(strings.TrimSpace(signature)+"\n"), 0644)
+}
+
+// importCheck is what an upload brings to vouch for its archive.
+type importCheck struct {
+	SHA256    string // expected checksum, e.g. the archive's SHA256SUMS line
+	Manifest  []byte // content manifest
+	Signature string // base64 signature over Manifest
+	Require   bool   // refuse archives without a trusted signed manifest
+}
+
+// verifyImport checks an uploaded archive, whose bytes hash to sum, against
+// what came with it. It returns the id of the key that signed the manifest,
+// or "" for an archive accepted unsigned. Failures wrap errRejected.
+func (h *Handler) verifyImport(c importCheck, sum string, size int64) (string, error) {
+	if c.SHA256 != "" && !strings.EqualFold(strings.TrimPrefix(c.SHA256, "sha256:"), sum) {
+		return "", fmt.Errorf("%w: sha256 is %s, expected %s", errRejected, sum, c.SHA256)
+	}
+	if c.Manifest == nil || c.Signature == "" {
+		if c.Require {
+			return "", fmt.Errorf("%w: a content manifest and its signature are required", errRejected)
+		}
+		if c.Manifest == nil {
+			return "", nil
+		}
+	}
+
+	keyID := ""
+	if c.Signature != "" {
+		keys, err := h.trustedKeys()
+		if err != nil {
+			return "", err
+		}
+		if keyID, err = signing.Verify(c.Manifest, c.Signature, keys); err != nil {
+			return "", fmt.Errorf("%w: manifest signature: %v", errRejected, err)
+		}
+	}
+	var m ArchiveManifest
+	if err := json.Unmarshal(c.Manifest, &m); err != nil {
+		return "", fmt.Errorf("%w: invalid manifest: %v", errRejected, err)
+	}
+	if m.SHA256 != sum || m.Size != size {
+		return "", fmt.Errorf("%w: archive does not match its manifest (sha256 %s, %d bytes; manifest lists %s, %d bytes)",
+			errRejected, sum, size, m.SHA256, m.Size)
+	}
+	return keyID, nil
+}
+
+// readImportCheck collects the optional verification parts of an import
+// form: "sha256", "manifest" and "signature" (files or plain fields), and
+// "requireSignature".
+func (h *Handler) readImportCheck(form *multipart.Form, value func(string) string) (importCheck, error) {
+	c := importCheck{
+		SHA256:  strings.TrimSpace(value("sha256")),
+		Require: h.Cfg.RequireSignedImports || value("requireSignature") == "true",
+	}
+	manifest, err := formPart(form, value, "manifest")
+	if err != nil {
+		return c, err
+	}
+	if len(manifest) > 0 {
+		c.Manifest = manifest
+	}
+	sig, err := formPart(form, value, "signature")
+	if err != nil {
+		return c, err
+	}
+	c.Signature = strings.TrimSpace(string(sig))
+	return c, nil
+}
+
+// formPart returns a multipart file part's content, or else the plain field
+// of the same name.
+func formPart(form *multipart.Form, value func(string) string, name string) ([]byte, error) {
+	if form != nil && len(form.File[name]) > 0 {
+		f, err := form.File[name][0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, err := io.ReadAll(io.LimitReader(f, maxManifestSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxManifestSize {
+			return nil, fmt.Errorf("%s is too large", name)
+		}
+		return data, nil
+	}
+	return []byte(value(name)), nil
+}
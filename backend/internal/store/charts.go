@@ -0,0 +1,104 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/charts"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// ChartByDigest handles GET /api/store/charts/{digest}?haulId=N, describing
+// a chart in a haul for review: its Chart.yaml, dependencies and whether the
+// haul holds them, default values, templates and README.
+func (h *Handler) ChartByDigest(w http.ResponseWriter, r *http.Request) {
+	digest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/store/charts/"), "/")
+	if d, ok := strings.CutSuffix(digest, "/images"); ok {
+		h.chartImages(w, r, d)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	haulID, _ := strconv.ParseInt(r.URL.Query().Get("haulId"), 10, 64)
+	st, ch, ok := h.openChart(w, r, haulID, digest)
+	if !ok {
+		return
+	}
+	info := charts.Inspect(ch, charts.Versions(st))
+	info.Digest = digest
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+// openChart loads the chart with the given digest from a haul, writing an
+// error and returning false when it cannot.
+func (h *Handler) openChart(w http.ResponseWriter, r *http.Request, haulID int64, digest string) (*ocistore.Store, *chart.Chart, bool) {
+	if !ocistore.ValidDigest(digest) {
+		http.Error(w, "Invalid digest", http.StatusBadRequest)
+		return nil, nil, false
+	}
+	haul, _, err := h.resolveHaul(r.Context(), haulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return nil, nil, false
+	}
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	ch, err := charts.Open(st, digest)
+	if errors.Is(err, charts.ErrNotChart) {
+		http.Error(w, "Chart not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, "Failed to read chart: "+err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return st, ch, true
+}
+
+// ChartImagesRequest is the body of POST /api/store/charts/{digest}/images.
+type ChartImagesRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+	charts.RenderOptions
+}
+
+// chartImages handles POST /api/store/charts/{digest}/images, which renders
+// a chart in a haul with its default values, or the supplied ones, and
+// reports the container images it uses and which of them the haul lacks,
+// with an Images manifest for those that can be saved and synced. This shows
+// what hauler's --add-images would find without adding anything.
+func (h *Handler) chartImages(w http.ResponseWriter, r *http.Request, digest string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ChartImagesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	st, ch, ok := h.openChart(w, r, req.HaulID, digest)
+	if !ok {
+		return
+	}
+	report, err := charts.FindImages(ch, req.RenderOptions)
+	if err != nil {
+		http.Error(w, "Failed to render chart: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	report.Compare(st)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,306 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// saveDeltaTask is the job command that writes a delta archive in-process.
+const saveDeltaTask = "store-save-delta"
+
+// applyDeltaTask is the job command that loads archives including at least
+// one delta; it runs the same in-process load as volume sets.
+const applyDeltaTask = "store-apply-delta"
+
+// Baseline is what the receiving side of a delta archive already holds:
+// another haul's store, a previous archive (by default of the haul being
+// saved), or the content manifest written beside a previous archive.
+type Baseline struct {
+	HaulID   int64           `json:"haulId,omitempty"`
+	Archive  string          `json:"archive,omitempty"`
+	Manifest json.RawMessage `json:"manifest,omitempty"`
+}
+
+// startDeltaSave validates a Save with a baseline and starts the job that
+// writes the delta archive. subsetDir, if set, is the selected sub-store to
+// save instead of the whole haul; it is removed after the job.
+func (h *Handler) startDeltaSave(w http.ResponseWriter, r *http.Request, haul *hauls.Haul, req *SaveRequest,
+	archivePath string, volumeSize int64, subsetDir string, resp map[string]interface{}) {
+	b := req.Baseline
+	fail := func(msg string, code int) {
+		if subsetDir != "" {
+			_ = os.RemoveAll(subsetDir)
+		}
+		http.Error(w, msg, code)
+	}
+	if req.Platform != "" || req.Containerd != "" {
+		fail("platform and containerd cannot be combined with a baseline", http.StatusBadRequest)
+		return
+	}
+	if b.Archive != "" && len(b.Manifest) > 0 {
+		fail("baseline takes an archive or a manifest, not both", http.StatusBadRequest)
+		return
+	}
+	if b.HaulID == 0 && b.Archive == "" && len(b.Manifest) == 0 {
+		fail("baseline needs a haulId, an archive or a manifest", http.StatusBadRequest)
+		return
+	}
+	if b.Archive != "" && (strings.Contains(b.Archive, "..") || strings.ContainsAny(b.Archive, "/\\")) {
+		fail("Invalid baseline archive", http.StatusBadRequest)
+		return
+	}
+	if b.HaulID != 0 {
+		if _, err := h.Hauls.Get(r.Context(), b.HaulID); err != nil {
+			fail("Baseline haul not found", http.StatusBadRequest)
+			return
+		}
+	}
+
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10)}
+	if b.HaulID != 0 {
+		args = append(args, "--baseline-haul", strconv.FormatInt(b.HaulID, 10))
+	}
+	if b.Archive != "" {
+		args = append(args, "--baseline-archive", b.Archive)
+	}
+	var manifestPath string
+	if len(b.Manifest) > 0 {
+		var m ArchiveManifest
+		if err := json.Unmarshal(b.Manifest, &m); err != nil || len(m.Blobs) == 0 {
+			fail("baseline manifest must be a content manifest listing blobs", http.StatusBadRequest)
+			return
+		}
+		if err := os.MkdirAll(h.Cfg.HaulerTempDir, 0755); err != nil {
+			fail("Failed to create temp directory", http.StatusInternalServerError)
+			return
+		}
+		f, err := os.CreateTemp(h.Cfg.HaulerTempDir, "baseline-*.json")
+		if err == nil {
+			_, err = f.Write(b.Manifest)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			fail("Failed to save baseline manifest", http.StatusInternalServerError)
+			return
+		}
+		manifestPath = f.Name()
+		args = append(args, "--baseline-manifest", manifestPath)
+	}
+	if subsetDir != "" {
+		args = append(args, "--store", subsetDir)
+	}
+	if volumeSize > 0 {
+		args = append(args, "--volume-size", strconv.FormatInt(volumeSize, 10))
+	}
+	args = append(args, archivePath)
+
+	job, err := h.JobRunner.CreateJob(r.Context(), saveDeltaTask, args, nil)
+	if err != nil {
+		if manifestPath != "" {
+			os.Remove(manifestPath)
+		}
+		log.Printf("Error creating save job: %v", err)
+		fail("Failed to create save job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
+	if subsetDir != "" {
+		go h.removeAfterJob(job.ID, subsetDir)
+	}
+	if manifestPath != "" {
+		go h.removeAfterJob(job.ID, manifestPath)
+	}
+
+	resp["jobId"] = job.ID
+	resp["message"] = "Delta save job started"
+	resp["delta"] = true
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// runSaveDelta is the store-save-delta task. It resolves the baseline's
+// blobs, writes the haul (or selected sub-store) as a delta archive holding
+// the full index and manifests but only blobs the baseline lacks, and then
+// signs and optionally splits it like any saved archive.
+func (h *Handler) runSaveDelta(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(saveDeltaTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	baseHaul := fs.Int64("baseline-haul", 0, "baseline haul id")
+	baseArchive := fs.String("baseline-archive", "", "baseline archive")
+	baseManifest := fs.String("baseline-manifest", "", "baseline content manifest file")
+	storeDir := fs.String("store", "", "store to save instead of the haul's")
+	volumeSize := fs.Int64("volume-size", 0, "split into volumes of this size")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected one archive path, got %d", fs.NArg())
+	}
+	archivePath := fs.Arg(0)
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+
+	var blobs map[string]int64
+	var label string
+	switch {
+	case *baseManifest != "":
+		data, err := os.ReadFile(*baseManifest)
+		if err != nil {
+			return "", err
+		}
+		var m ArchiveManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return "", fmt.Errorf("parsing baseline manifest: %w", err)
+		}
+		blobs, label = m.Blobs, "manifest of "+m.Archive
+	case *baseArchive != "":
+		from := haul
+		if *baseHaul != 0 {
+			if from, err = h.Hauls.Get(ctx, *baseHaul); err != nil {
+				return "", fmt.Errorf("baseline haul %d: %w", *baseHaul, err)
+			}
+		}
+		if blobs, err = archiveBlobs(from.ArchivesDir(), *baseArchive); err != nil {
+			return "", fmt.Errorf("baseline archive %s: %w", *baseArchive, err)
+		}
+		label = *baseArchive
+	default:
+		base, err := h.Hauls.Get(ctx, *baseHaul)
+		if err != nil {
+			return "", fmt.Errorf("baseline haul %d: %w", *baseHaul, err)
+		}
+		if blobs, err = storeBlobs(base.StoreDir); err != nil {
+			return "", fmt.Errorf("baseline haul %s: %w", base.Slug, err)
+		}
+		label = "haul " + base.Slug
+	}
+	logf("Baseline %s holds %d blob(s)", label, len(blobs))
+
+	dir := haul.StoreDir
+	if *storeDir != "" {
+		dir = *storeDir
+	}
+	st, err := ocistore.Open(dir)
+	if err != nil {
+		return "", err
+	}
+	tmp := archivePath + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	delta, err := st.WriteDelta(ctx, f, blobs, label)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, archivePath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	ocistore.ForgetArchive(archivePath)
+	logf("Wrote %s: %d blob(s), %d bytes; omitted %d blob(s), %d bytes already in the baseline",
+		filepath.Base(archivePath), delta.Blobs, delta.Bytes, delta.OmittedBlobs, delta.OmittedBytes)
+
+	result, err := h.saveResult(ctx, haul.ID, archivePath, filepath.Base(archivePath), *volumeSize)
+	if err != nil {
+		return "", err
+	}
+	result["baseline"] = label
+	result["blobs"] = delta.Blobs
+	result["bytes"] = delta.Bytes
+	result["omittedBlobs"] = delta.OmittedBlobs
+	result["omittedBytes"] = delta.OmittedBytes
+	out, _ := json.Marshal(result)
+	return string(out), nil
+}
+
+// storeBlobs returns the blobs present in the store at dir that its index
+// references.
+func storeBlobs(dir string) (map[string]int64, error) {
+	st, err := ocistore.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	blobs := map[string]int64{}
+	for digest := range st.Blobs() {
+		if info, err := os.Stat(st.BlobPath(digest)); err == nil {
+			blobs[digest] = info.Size()
+		}
+	}
+	return blobs, nil
+}
+
+// archiveBlobs returns the blobs an archive in dir references, from its
+// content manifest when that lists them, otherwise by scanning the archive
+// or its volume set.
+func archiveBlobs(dir, archive string) (map[string]int64, error) {
+	if data, err := os.ReadFile(filepath.Join(dir, hauls.ManifestName(archive))); err == nil {
+		var m ArchiveManifest
+		if err := json.Unmarshal(data, &m); err == nil && len(m.Blobs) > 0 {
+			return m.Blobs, nil
+		}
+	}
+	path := filepath.Join(dir, archive)
+	if index, ok := volumeSet(path); ok {
+		idx, err := readVolumeSet(index)
+		if err != nil {
+			return nil, err
+		}
+		rc := hauls.OpenVolumes(dir, idx)
+		defer rc.Close()
+		st, err := ocistore.ReadArchive(rc)
+		if err != nil {
+			return nil, err
+		}
+		return st.Blobs(), nil
+	}
+	st, err := ocistore.LoadArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	return st.Blobs(), nil
+}
+
+// isDelta reports whether the archive at path, or the volume set it names,
+// is a delta archive.
+func isDelta(path string) (bool, error) {
+	var r io.ReadCloser
+	if index, ok := volumeSet(path); ok {
+		idx, err := readVolumeSet(index)
+		if err != nil {
+			return false, err
+		}
+		r = hauls.OpenVolumes(filepath.Dir(index), idx)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return false, err
+		}
+		r = f
+	}
+	defer r.Close()
+	d, err := ocistore.ReadDelta(r)
+	return d != nil, err
+}
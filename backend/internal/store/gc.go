@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// gcTask is the job command of an in-process store garbage collection.
+const gcTask = "store-gc"
+
+// GCRequest is the body of POST /api/store/gc.
+type GCRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+	DryRun bool  `json:"dryRun"`
+}
+
+// GCReport is the result of a garbage collection job.
+type GCReport struct {
+	ocistore.GCPlan
+	HaulID     int64    `json:"haulId"`
+	DryRun     bool     `json:"dryRun"`
+	Deleted    int      `json:"deleted"`
+	FreedBytes int64    `json:"freedBytes"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// GC handles /api/store/gc. GET reports a haul's unreferenced blobs without
+// starting a job; POST starts a job that reports them and, unless dryRun is
+// set, deletes them under the haul's write lock.
+func (h *Handler) GC(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var haulID int64
+		if v := r.URL.Query().Get("haulId"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid haulId", http.StatusBadRequest)
+				return
+			}
+			haulID = id
+		}
+		haul, _, err := h.resolveHaul(r.Context(), haulID)
+		if err != nil {
+			http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		st, err := ocistore.Open(haul.StoreDir)
+		if err != nil {
+			http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		plan, err := st.PlanGC()
+		if err != nil {
+			http.Error(w, "Failed to plan garbage collection: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(GCReport{GCPlan: *plan, HaulID: haul.ID, DryRun: true})
+
+	case http.MethodPost:
+		var req GCRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+		if err != nil {
+			http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !req.DryRun && !h.writable(w, haul) {
+			return
+		}
+
+		args := []string{"--haul", strconv.FormatInt(haul.ID, 10)}
+		if req.DryRun {
+			args = append(args, "--dry-run")
+		}
+		job, err := h.JobRunner.CreateJob(r.Context(), gcTask, args, nil)
+		if err != nil {
+			log.Printf("Error creating gc job: %v", err)
+			http.Error(w, "Failed to create gc job", http.StatusInternalServerError)
+			return
+		}
+		h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"jobId":   job.ID,
+			"message": "Garbage collection job started",
+			"dryRun":  req.DryRun,
+			"haulId":  haul.ID,
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// runGC is the store-gc task. It takes the haul's write lock before sweeping
+// so no add, sync or load can write blobs that are not yet in index.json.
+func (h *Handler) runGC(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(gcTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	dryRun := fs.Bool("dry-run", false, "report only")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	report := GCReport{HaulID: haul.ID, DryRun: *dryRun}
+
+	if !*dryRun {
+		if err := haul.Writable(); err != nil {
+			return "", err
+		}
+		unlock, err := h.Hauls.Lock(haul.ID, fmt.Sprintf("gc job %d", job.ID))
+		if err != nil {
+			return "", err
+		}
+		defer unlock()
+	}
+	// Jobs queued before the lock was taken may still write to the store.
+	active, err := h.activeJobs(ctx, haul.ID, job.ID)
+	if err != nil {
+		return "", err
+	}
+	if active > 0 {
+		if !*dryRun {
+			return "", fmt.Errorf("haul %q has %d other queued or running job(s); retry when they finish", haul.Name, active)
+		}
+		report.Warnings = append(report.Warnings,
+			fmt.Sprintf("%d other job(s) are active on this haul; blobs they are writing may be listed as unreferenced", active))
+	}
+
+	logf("Walking %s", haul.StoreDir)
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	plan, err := st.PlanGC()
+	if err != nil {
+		return "", err
+	}
+	report.GCPlan = *plan
+	logf("%d reachable blob(s) (%d bytes), %d unreferenced (%d bytes)",
+		plan.Reachable, plan.ReachableBytes, len(plan.Orphans), plan.OrphanBytes)
+	for _, m := range plan.Missing {
+		logf("Referenced blob not in store: %s", m)
+	}
+
+	if !*dryRun && len(plan.Orphans) > 0 {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		report.Deleted, report.FreedBytes, err = st.Sweep(plan)
+		ocistore.Invalidate(haul.StoreDir)
+		if err != nil {
+			return "", err
+		}
+		logf("Deleted %d blob(s), freed %d bytes", report.Deleted, report.FreedBytes)
+	}
+
+	out, _ := json.Marshal(report)
+	return string(out), nil
+}
+
+// activeJobs counts a haul's queued or running jobs other than self.
+func (h *Handler) activeJobs(ctx context.Context, haulID, self int64) (int, error) {
+	var n int
+	err := h.JobRunner.DB().QueryRowContext(ctx,
+		`SELECT COUNT(1) FROM jobs WHERE haul_id = ? AND id != ? AND status IN ('queued', 'running')`,
+		haulID, self).Scan(&n)
+	return n, err
+}
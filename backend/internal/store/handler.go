@@ -2,22 +2,28 @@ package store
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hauler-ui/hauler-ui/backend/internal/config"
 	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
 	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/signing"
+	"github.com/hauler-ui/hauler-ui/backend/internal/vulns"
 )
 
 // Handler handles HTTP requests for store operations
@@ -25,15 +31,41 @@ type Handler struct {
 	JobRunner *jobrunner.Runner
 	Cfg       *config.Config
 	Hauls     *hauls.Service
+	Vulns     *vulns.DB
+
+	signerMu  sync.Mutex
+	signerKey *signing.Signer
+
+	uploadsMu   sync.Mutex
+	uploadsBusy map[string]bool
+
+	sigCache signatureCache
+
+	keystoreMu sync.Mutex
+	keys       *signing.Keystore
 }
 
 // NewHandler creates a new store handler
 func NewHandler(jobRunner *jobrunner.Runner, cfg *config.Config, haulSvc *hauls.Service) *Handler {
-	return &Handler{
+	h := &Handler{
 		JobRunner: jobRunner,
 		Cfg:       cfg,
 		Hauls:     haulSvc,
-	}
+		Vulns:     vulns.New(jobRunner.DB()),
+	}
+	jobRunner.RegisterTask(gcTask, h.runGC)
+	jobRunner.RegisterTask(verifyTask, h.runVerify)
+	jobRunner.RegisterTask(loadVolumesTask, h.runLoadVolumes)
+	jobRunner.RegisterTask(applyDeltaTask, h.runLoadVolumes)
+	jobRunner.RegisterTask(saveDeltaTask, h.runSaveDelta)
+	jobRunner.RegisterTask(importPathTask, h.runImportPath)
+	jobRunner.RegisterTask(sbomTask, h.runSBOM)
+	jobRunner.RegisterTask(vulnDBImportTask, h.runVulnDBImport)
+	jobRunner.RegisterTask(vulnScanTask, h.runVulnScan)
+	jobRunner.RegisterTask(signTask, h.runSign)
+	jobRunner.RegisterTask(retagTask, h.runRetag)
+	jobRunner.RegisterTask(pruneTask, h.runPrunePlatforms)
+	return h
 }
 
 // resolveHaul returns the haul a request targets. When haulID is 0 it falls back
@@ -62,6 +94,71 @@ func (h *Handler) tagJobHaul(ctx context.Context, jobID, haulID int64) {
 	}
 }
 
+// writable rejects an operation that would change a frozen or locked haul's
+// contents, writing a 409 and returning false in that case.
+func (h *Handler) writable(w http.ResponseWriter, haul *hauls.Haul) bool {
+	if err := haul.Writable(); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	if err := h.Hauls.Locked(haul.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return false
+	}
+	return true
+}
+
+// limitCheckInterval is how often a running store job's haul is re-measured
+// against its quota and the data-dir reserve.
+const limitCheckInterval = 5 * time.Second
+
+// preflight rejects an operation expected to write incoming bytes into haul
+// when that would exceed its quota or the global free-space reserve. It writes
+// a 507 and returns false in that case. Failures to measure are logged and do
+// not block the operation.
+func (h *Handler) preflight(w http.ResponseWriter, r *http.Request, haul *hauls.Haul, incoming int64) bool {
+	err := h.Hauls.CheckCapacity(r.Context(), haul, incoming)
+	if err == nil {
+		return true
+	}
+	var capErr *hauls.CapacityError
+	if errors.As(err, &capErr) {
+		http.Error(w, "Insufficient storage: "+capErr.Error(), http.StatusInsufficientStorage)
+		return false
+	}
+	log.Printf("Warning: capacity preflight failed: %v", err)
+	return true
+}
+
+// enforceLimits watches a store-modifying job while it runs and cancels it if
+// the haul crosses its quota or the data volume dips into the reserve.
+func (h *Handler) enforceLimits(jobID int64, haul *hauls.Haul) {
+	ctx := context.Background()
+	ticker := time.NewTicker(limitCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		j, err := h.JobRunner.GetJob(ctx, jobID)
+		if err != nil {
+			return
+		}
+		switch j.Status {
+		case jobrunner.StatusQueued:
+			continue
+		case jobrunner.StatusRunning:
+			var capErr *hauls.CapacityError
+			if err := h.Hauls.CheckRunningCapacity(ctx, haul); errors.As(err, &capErr) {
+				log.Printf("Stopping job %d on haul %d: %v", jobID, haul.ID, capErr)
+				if err := h.JobRunner.Cancel(ctx, jobID, "storage limit reached: "+capErr.Error()); err != nil {
+					log.Printf("Warning: failed to cancel job %d: %v", jobID, err)
+				}
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
 // AddImageRequest represents the request to add an image to the store
 type AddImageRequest struct {
 	HaulID                      int64  `json:"haulId,omitempty"`
@@ -100,6 +197,13 @@ func (h *Handler) AddImage(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
+	if !h.preflight(w, r, haul, 0) {
+		return
+	}
+	req.Platform, req.Key, req.Rewrite = haul.Defaults.Apply(req.Platform, req.Key, req.Rewrite)
 
 	// Build args for hauler store add image command
 	args := []string{"store", "add", "image", req.ImageRef}
@@ -153,6 +257,7 @@ func (h *Handler) AddImage(w http.ResponseWriter, r *http.Request) {
 	}
 	h.tagJobHaul(r.Context(), job.ID, haul.ID)
 	go h.trackAfterJob(job.ID, haul)
+	go h.enforceLimits(job.ID, haul)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -205,6 +310,12 @@ func (h *Handler) AddChart(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
+	if !h.preflight(w, r, haul, 0) {
+		return
+	}
 
 	// Build args for hauler store add chart command
 	args := []string{"store", "add", "chart", req.Name}
@@ -271,6 +382,7 @@ func (h *Handler) AddChart(w http.ResponseWriter, r *http.Request) {
 	}
 	h.tagJobHaul(r.Context(), job.ID, haul.ID)
 	go h.trackAfterJob(job.ID, haul)
+	go h.enforceLimits(job.ID, haul)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -337,6 +449,12 @@ func (h *Handler) AddFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
+	if !h.preflight(w, r, haul, 0) {
+		return
+	}
 
 	// Determine the file source
 	fileSource := req.FilePath
@@ -364,6 +482,7 @@ func (h *Handler) AddFile(w http.ResponseWriter, r *http.Request) {
 	}
 	h.tagJobHaul(r.Context(), job.ID, haul.ID)
 	go h.trackAfterJob(job.ID, haul)
+	go h.enforceLimits(job.ID, haul)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -414,6 +533,13 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
+	if !h.preflight(w, r, haul, 0) {
+		return
+	}
+	req.Platform, req.Key, req.Rewrite = haul.Defaults.Apply(req.Platform, req.Key, req.Rewrite)
 
 	// Build args for hauler store sync command
 	args := []string{"store", "sync"}
@@ -514,6 +640,7 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 	}
 	h.tagJobHaul(r.Context(), job.ID, haul.ID)
 	go h.trackAfterJob(job.ID, haul)
+	go h.enforceLimits(job.ID, haul)
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
@@ -525,12 +652,116 @@ func (h *Handler) Sync(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// SyncManifests starts a sync of every manifest saved in a haul, using the
+// haul's request defaults. The manifests are written to a private temp
+// directory that is removed once the job finishes. It returns the job id.
+func (h *Handler) SyncManifests(ctx context.Context, haul *hauls.Haul) (int64, error) {
+	if err := haul.Writable(); err != nil {
+		return 0, err
+	}
+	if err := h.Hauls.CheckCapacity(ctx, haul, 0); err != nil {
+		return 0, err
+	}
+
+	db := h.JobRunner.DB()
+	rows, err := db.QueryContext(ctx, `SELECT name, yaml_content FROM saved_manifests WHERE haul_id = ? ORDER BY name`, haul.ID)
+	if err != nil {
+		return 0, err
+	}
+	type saved struct{ name, yaml string }
+	var manifests []saved
+	for rows.Next() {
+		var m saved
+		if err := rows.Scan(&m.name, &m.yaml); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		manifests = append(manifests, m)
+	}
+	rows.Close()
+	if len(manifests) == 0 {
+		return 0, fmt.Errorf("haul %q has no saved manifests", haul.Name)
+	}
+
+	if err := os.MkdirAll(h.Cfg.HaulerTempDir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	dir, err := os.MkdirTemp(h.Cfg.HaulerTempDir, fmt.Sprintf("sync-haul-%d-", haul.ID))
+	if err != nil {
+		return 0, err
+	}
+	args := []string{"store", "sync"}
+	for i, m := range manifests {
+		path := filepath.Join(dir, fmt.Sprintf("manifest-%02d.yaml", i))
+		if err := os.WriteFile(path, []byte(m.yaml), 0644); err != nil {
+			os.RemoveAll(dir)
+			return 0, fmt.Errorf("failed to write manifest %q: %w", m.name, err)
+		}
+		args = append(args, "-f", path)
+	}
+	d := haul.Defaults
+	if d.Platform != "" {
+		args = append(args, "--platform", d.Platform)
+	}
+	if d.Key != "" {
+		args = append(args, "--key", d.Key)
+	}
+	if d.Rewrite != "" {
+		args = append(args, "--rewrite", d.Rewrite)
+	}
+	args = append(args, "--store", haul.StoreDir)
+
+	job, err := h.JobRunner.CreateJob(ctx, "hauler", args, nil)
+	if err != nil {
+		os.RemoveAll(dir)
+		return 0, err
+	}
+	h.tagJobHaul(ctx, job.ID, haul.ID)
+	go h.trackAfterJob(job.ID, haul)
+	go h.enforceLimits(job.ID, haul)
+	go h.removeAfterJob(job.ID, dir)
+	return job.ID, nil
+}
+
+// removeAfterJob deletes path once a job has finished, however it ended.
+func (h *Handler) removeAfterJob(jobID int64, path string) {
+	ctx := context.Background()
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for range ticker.C {
+		j, err := h.JobRunner.GetJob(ctx, jobID)
+		if err == nil && (j.Status == jobrunner.StatusQueued || j.Status == jobrunner.StatusRunning) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			log.Printf("Warning: failed to remove %s after job %d: %v", path, jobID, err)
+		}
+		return
+	}
+}
+
 // SaveRequest represents the request to save the store to an archive
 type SaveRequest struct {
 	HaulID     int64  `json:"haulId,omitempty"`
 	Filename   string `json:"filename,omitempty"`
 	Platform   string `json:"platform,omitempty"`
 	Containerd string `json:"containerd,omitempty"`
+
+	// VolumeSize, if set, splits the archive into numbered volumes of at most
+	// this size, e.g. "4095M", "25G", or the presets "fat32" and "bd25".
+	VolumeSize string `json:"volumeSize,omitempty"`
+
+	// Baseline, if set, makes this a delta archive: the full index and
+	// manifests, but only the blobs the baseline does not already hold.
+	Baseline *Baseline `json:"baseline,omitempty"`
+
+	// IncludeSBOMs attaches the SBOMs generated for the haul's images to the
+	// archive as ".sbom" artifacts of the images they describe.
+	IncludeSBOMs bool `json:"includeSboms,omitempty"`
+
+	// Optional selection (refs, digests, match, types, labels); when set only
+	// the selected artifacts are archived.
+	ocistore.Selection
 }
 
 // Save handles POST /api/store/save
@@ -566,13 +797,74 @@ func (h *Handler) Save(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
+	var volumeSize int64
+	if req.VolumeSize != "" {
+		if volumeSize, err = hauls.ParseVolumeSize(req.VolumeSize); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// A selection is saved from a temporary sub-store holding hardlinks to just
+	// the selected artifacts' blobs, so the haul itself is never touched. SBOMs
+	// are attached to such a sub-store too, never to the haul.
+	var subsetDir string
+	selected, sboms := 0, 0
+	var estimate int64
+	if !req.Selection.Empty() || req.IncludeSBOMs {
+		subsetDir, selected, estimate, err = h.buildSubset(haul, req.Selection)
+		if err != nil {
+			http.Error(w, "Failed to select artifacts: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.IncludeSBOMs {
+			if sboms, err = attachSBOMs(haul, subsetDir); err != nil {
+				_ = os.RemoveAll(subsetDir)
+				http.Error(w, "Failed to attach SBOMs: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		storeArgs = []string{"--store", subsetDir}
+	} else {
+		// The archive holds (already-compressed) store blobs, so it is roughly
+		// the size of the store itself.
+		estimate, err = h.Hauls.StoreBytes(haul)
+		if err != nil {
+			log.Printf("Warning: failed to measure store for haul %d: %v", haul.ID, err)
+		}
+	}
+	cleanup := func() {
+		if subsetDir != "" {
+			_ = os.RemoveAll(subsetDir)
+		}
+	}
+	if !h.preflight(w, r, haul, estimate) {
+		cleanup()
+		return
+	}
 
 	if err := os.MkdirAll(haul.ArchivesDir(), 0755); err != nil {
+		cleanup()
 		http.Error(w, "Failed to prepare archives directory: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 	archivePath := filepath.Join(haul.ArchivesDir(), filename)
 
+	if req.Baseline != nil {
+		resp := map[string]interface{}{"filename": filename, "haulId": haul.ID}
+		if subsetDir != "" {
+			resp["artifacts"] = selected
+		}
+		if req.IncludeSBOMs {
+			resp["sboms"] = sboms
+		}
+		if volumeSize > 0 {
+			resp["volumeSize"] = volumeSize
+		}
+		h.startDeltaSave(w, r, haul, &req, archivePath, volumeSize, subsetDir, resp)
+		return
+	}
+
 	// Build args for hauler store save command
 	args := []string{"store", "save", "--filename", archivePath}
 
@@ -591,29 +883,72 @@ func (h *Handler) Save(w http.ResponseWriter, r *http.Request) {
 
 	job, err := h.JobRunner.CreateJob(r.Context(), "hauler", args, nil)
 	if err != nil {
+		cleanup()
 		log.Printf("Error creating save job: %v", err)
 		http.Error(w, "Failed to create save job", http.StatusInternalServerError)
 		return
 	}
 	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
+	if subsetDir != "" {
+		go h.removeAfterJob(job.ID, subsetDir)
+	}
 
 	// Track the archive path and download URL once the job succeeds.
-	go h.trackSaveResult(job.ID, haul.ID, archivePath, filename)
+	go h.trackSaveResult(job.ID, haul.ID, archivePath, filename, volumeSize)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+	resp := map[string]interface{}{
 		"jobId":    job.ID,
 		"message":  "Save job started",
 		"filename": filename,
 		"haulId":   haul.ID,
-	})
+	}
+	if subsetDir != "" {
+		resp["artifacts"] = selected
+	}
+	if req.IncludeSBOMs {
+		resp["sboms"] = sboms
+	}
+	if volumeSize > 0 {
+		resp["volumeSize"] = volumeSize
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// buildSubset writes the artifacts sel picks from haul's store into a new
+// temporary layout beside the store (on the same filesystem, so blobs can be
+// hardlinked). It returns the layout's directory, how many artifacts it holds
+// and their total size.
+func (h *Handler) buildSubset(haul *hauls.Haul, sel ocistore.Selection) (string, int, int64, error) {
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	picked, err := st.Select(sel)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	if len(picked) == 0 {
+		return "", 0, 0, fmt.Errorf("the selection matches no artifacts")
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(haul.StoreDir), ".save-subset-")
+	if err != nil {
+		return "", 0, 0, err
+	}
+	size, err := st.WriteSubset(dir, picked)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", 0, 0, err
+	}
+	return dir, len(picked), size, nil
 }
 
 // trackSaveResult waits for a save job to finish and records the resulting
-// archive path and download URL on the job. Uses a background context because
-// it outlives the originating HTTP request.
-func (h *Handler) trackSaveResult(jobID, haulID int64, archivePath, filename string) {
+// archive path and download URL on the job, along with what saveResult adds.
+// Uses a background context because it outlives the originating HTTP request.
+func (h *Handler) trackSaveResult(jobID, haulID int64, archivePath, filename string, volumeSize int64) {
 	ctx := context.Background()
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
@@ -626,13 +961,13 @@ func (h *Handler) trackSaveResult(jobID, haulID int64, archivePath, filename str
 		switch job.Status {
 		case jobrunner.StatusSucceeded:
 			if _, err := os.Stat(archivePath); err == nil {
-				result := map[string]interface{}{
-					"archivePath": archivePath,
-					"filename":    filename,
-					"downloadUrl": fmt.Sprintf("/api/hauls/%d/archives/%s", haulID, filename),
-				}
+				result, err := h.saveResult(ctx, haulID, archivePath, filename, volumeSize)
 				resultJSON, _ := json.Marshal(result)
-				_ = h.JobRunner.UpdateResult(ctx, jobID, string(resultJSON))
+				if err != nil {
+					_ = h.JobRunner.Fail(ctx, jobID, err.Error(), string(resultJSON))
+				} else {
+					_ = h.JobRunner.UpdateResult(ctx, jobID, string(resultJSON))
+				}
 			}
 			return
 		case jobrunner.StatusFailed:
@@ -641,6 +976,44 @@ func (h *Handler) trackSaveResult(jobID, haulID int64, archivePath, filename str
 	}
 }
 
+// saveResult signs a freshly saved archive and, when volumeSize is set,
+// splits it into volumes. It returns the save job's result: the archive's
+// path and URLs, or why signing failed. A failed split leaves the archive
+// whole and is returned as an error, which fails the job.
+func (h *Handler) saveResult(ctx context.Context, haulID int64, archivePath, filename string, volumeSize int64) (map[string]interface{}, error) {
+	result := map[string]interface{}{
+		"archivePath": archivePath,
+		"filename":    filename,
+		"downloadUrl": fmt.Sprintf("/api/hauls/%d/archives/%s", haulID, filename),
+	}
+	if haul, err := h.Hauls.Get(ctx, haulID); err != nil {
+		result["signError"] = err.Error()
+	} else if m, err := h.writeArchiveSidecars(haul, archivePath); err != nil {
+		log.Printf("Warning: failed to sign archive %s: %v", archivePath, err)
+		result["signError"] = err.Error()
+	} else {
+		result["sha256"] = m.SHA256
+		result["keyId"] = m.KeyID
+		result["manifestUrl"] = fmt.Sprintf("/api/hauls/%d/archives/%s", haulID, hauls.ManifestName(filename))
+		result["signatureUrl"] = fmt.Sprintf("/api/hauls/%d/archives/%s", haulID, hauls.SignatureName(filename))
+	}
+	if volumeSize > 0 {
+		sum, _ := result["sha256"].(string)
+		ocistore.ForgetArchive(archivePath)
+		idx, err := hauls.SplitArchive(archivePath, volumeSize, sum)
+		if err != nil {
+			return result, fmt.Errorf("splitting %s into volumes: %w", filename, err)
+		}
+		names := make([]string, len(idx.Volumes))
+		for i, v := range idx.Volumes {
+			names[i] = v.Name
+		}
+		result["volumes"] = names
+		result["volumeIndexUrl"] = fmt.Sprintf("/api/hauls/%d/archives/%s", haulID, hauls.VolumeIndexName(filename))
+	}
+	return result, nil
+}
+
 // ExtractRequest represents the request to extract an artifact from the store
 type ExtractRequest struct {
 	HaulID      int64  `json:"haulId,omitempty"`
@@ -758,17 +1131,8 @@ func (h *Handler) Load(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	// Clear this haul's store if requested.
-	if req.Clear {
-		if err := h.clearStore(haul.StoreDir); err != nil {
-			log.Printf("Error clearing store: %v", err)
-			http.Error(w, "Failed to clear store: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		if _, err := h.JobRunner.DB().ExecContext(ctx, `DELETE FROM store_contents WHERE haul_id = ?`, haul.ID); err != nil {
-			log.Printf("Warning: failed to clear tracked contents for haul %d: %v", haul.ID, err)
-		}
+	if !h.writable(w, haul) {
+		return
 	}
 
 	// Determine archives to load. Bare filenames are resolved against the haul's
@@ -787,6 +1151,83 @@ func (h *Handler) Load(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Archives in the haul's archives directory were verified when they were
+	// imported, or were saved here. Anything else would skip that check, so
+	// when signed imports are required it must come in through an import.
+	if h.Cfg.RequireSignedImports {
+		for _, f := range resolved {
+			if filepath.Dir(f) != filepath.Clean(haul.ArchivesDir()) {
+				http.Error(w, "Signed imports are required: "+f+" is outside the haul's archives; import it so its manifest is verified",
+					http.StatusForbidden)
+				return
+			}
+		}
+	}
+
+	// Split archives and delta archives are loaded in-process: volume sets
+	// stream from their volumes, and a delta is only merged once the store
+	// holds every blob it omitted. Plain archives loaded alongside them are
+	// extracted the same way.
+	var indexes, native []string
+	deltas := 0
+	for _, f := range resolved {
+		path := f
+		if index, ok := volumeSet(f); ok {
+			indexes = append(indexes, index)
+			path = index
+		}
+		if delta, err := isDelta(f); err == nil && delta {
+			deltas++
+		}
+		native = append(native, path)
+	}
+	if deltas > 0 && req.Clear {
+		http.Error(w, "A delta archive applies on top of the store; it cannot be loaded with clear", http.StatusBadRequest)
+		return
+	}
+
+	// Loaded blobs land in the store roughly at their archived size.
+	var incoming int64
+	for _, f := range resolved {
+		if info, err := os.Stat(f); err == nil {
+			incoming += info.Size()
+		}
+	}
+	for _, index := range indexes {
+		idx, err := readVolumeSet(index)
+		if err != nil {
+			http.Error(w, "Invalid volume set: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		incoming += idx.Size
+	}
+	if !h.preflight(w, r, haul, incoming) {
+		return
+	}
+
+	// Clear this haul's store if requested.
+	if req.Clear {
+		if err := h.clearHaul(ctx, haul); err != nil {
+			log.Printf("Error clearing store: %v", err)
+			http.Error(w, "Failed to clear store: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if len(indexes) > 0 || deltas > 0 {
+		task := loadVolumesTask
+		if deltas > 0 {
+			task = applyDeltaTask
+		}
+		h.startNativeLoad(w, r, haul, task, native, map[string]interface{}{
+			"message":   "Load job started",
+			"filenames": filenames,
+			"cleared":   req.Clear,
+			"deltas":    deltas,
+		})
+		return
+	}
+
 	// Build args for hauler store load command
 	args := []string{"store", "load"}
 	for _, f := range resolved {
@@ -801,6 +1242,7 @@ func (h *Handler) Load(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	h.tagJobHaul(ctx, job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
 
 	// After the load completes, track what landed in the store for this haul.
 	jobID := job.ID
@@ -947,6 +1389,9 @@ func (h *Handler) Remove(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
 
 	// Build args for hauler store remove command
 	args := []string{"store", "remove", req.Match}
@@ -979,7 +1424,7 @@ func (h *Handler) Remove(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// StoreInfo represents the response from hauler store info
+// StoreInfo is the content of a haul's store grouped by type
 type StoreInfo struct {
 	Images []ImageInfo  `json:"images"`
 	Charts []ChartInfo  `json:"charts"`
@@ -988,10 +1433,13 @@ type StoreInfo struct {
 
 // ImageInfo represents information about a stored image
 type ImageInfo struct {
-	Name      string `json:"name,omitempty"`
-	Digest    string `json:"digest,omitempty"`
-	Size      int64  `json:"size,omitempty"`
-	SourceHaul string `json:"sourceHaul,omitempty"`
+	Name       string   `json:"name,omitempty"`
+	Digest     string   `json:"digest,omitempty"`
+	Size       int64    `json:"size,omitempty"`
+	Platforms  []string `json:"platforms,omitempty"` // multi-arch images only
+	SourceHaul string   `json:"sourceHaul,omitempty"`
+	// Signatures is the image's signature status and what is attached to it.
+	Signatures *ImageSignatures `json:"signatures,omitempty"`
 }
 
 // ChartInfo represents information about a stored chart
@@ -1011,18 +1459,8 @@ type FileInfo struct {
 	SourceHaul string `json:"sourceHaul,omitempty"`
 }
 
-// StoreItem represents a single item from hauler store info raw output
-type StoreItem struct {
-	Reference string `json:"Reference"`
-	Type      string `json:"Type"`
-	Platform  string `json:"Platform"`
-	Digest    string `json:"Digest"`
-	Layers    int    `json:"Layers"`
-	Size      int64  `json:"Size"`
-}
-
 // GetInfo handles GET /api/store/info
-// Runs "hauler store info -o json" and returns parsed store contents
+// Reads the haul's OCI layout directly and returns its contents grouped by type.
 func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1039,116 +1477,77 @@ func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build args for hauler store info command with JSON output, scoped to the haul.
-	args := []string{"store", "info", "-o", "json", "--store", haul.StoreDir}
-
-	// Run hauler store info command directly
-	cmd := exec.CommandContext(ctx, "hauler", args...)
-	output, err := cmd.CombinedOutput()
+	st, err := ocistore.Load(haul.StoreDir)
 	if err != nil {
-		log.Printf("Error running store info: %v, output: %s", err, string(output))
-		http.Error(w, "Failed to get store info: "+err.Error(), http.StatusInternalServerError)
+		log.Printf("Error reading store for haul %d: %v", haul.ID, err)
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Fetch source_haul data from database
-	type SourceInfo struct {
-		Name      string
-		SourceHaul string
-	}
-	// Map by digest (primary) and by name (fallback)
+	// Provenance is tracked under the same names and digests the reader
+	// reports, so an exact lookup is enough.
 	digestSourceMap := make(map[string]string)
 	nameSourceMap := make(map[string]string)
-
-	db := h.JobRunner.DB()
-	rows, err := db.QueryContext(ctx, `SELECT name, digest, source_haul FROM store_contents WHERE haul_id = ?`, haul.ID)
+	rows, err := h.JobRunner.DB().QueryContext(ctx, `SELECT name, digest, source_haul FROM store_contents WHERE haul_id = ?`, haul.ID)
 	if err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var s SourceInfo
-			var digest sql.NullString
-			if err := rows.Scan(&s.Name, &digest, &s.SourceHaul); err == nil {
-				nameSourceMap[s.Name] = s.SourceHaul
+			var name string
+			var digest, source sql.NullString
+			if err := rows.Scan(&name, &digest, &source); err == nil && source.String != "" {
+				nameSourceMap[name] = source.String
 				if digest.Valid {
-					digestSourceMap[digest.String] = s.SourceHaul
+					digestSourceMap[digest.String] = source.String
 				}
 			}
 		}
 	}
 
-	// Parse the array format from hauler store info
-	var items []StoreItem
+	signatures := h.imageSignatures(ctx, haul, st)
 	storeInfo := StoreInfo{
 		Images: []ImageInfo{},
 		Charts: []ChartInfo{},
 		Files:  []FileInfo{},
 	}
+	for _, a := range st.Artifacts {
+		sourceHaul := digestSourceMap[a.Digest]
+		if sourceHaul == "" {
+			sourceHaul = nameSourceMap[a.Name]
+		}
 
-	// Handle empty store (returns "null")
-	trimmed := strings.TrimSpace(string(output))
-	if trimmed == "null" || trimmed == "" {
-		// Empty store, keep default empty slices
-	} else if err := json.Unmarshal(output, &items); err != nil {
-		log.Printf("Error parsing store info JSON: %v, output: %s", err, string(output))
-		http.Error(w, "Failed to parse store info: "+err.Error(), http.StatusInternalServerError)
-		return
-	} else {
-		// Group items by type
-		for _, item := range items {
-			// Look up source_haul from database
-			// Try digest first (most reliable), then exact name, then normalized name variations
-			sourceHaul := digestSourceMap[item.Digest]
-			if sourceHaul == "" {
-				sourceHaul = nameSourceMap[item.Reference]
-			}
-			// For images, try matching without registry prefix as fallback
-			if sourceHaul == "" {
-				normalizedName := item.Reference
-				// Strip common registry prefixes
-				for _, prefix := range []string{"index.docker.io/", "docker.io/"} {
-					if strings.HasPrefix(normalizedName, prefix) {
-						normalizedName = strings.TrimPrefix(normalizedName, prefix)
-						break
-					}
-				}
-				if sourceHaul = nameSourceMap[normalizedName]; sourceHaul != "" {
-					// Found it
-				} else if sourceHaul = nameSourceMap["library/"+normalizedName]; sourceHaul != "" {
-					// Try with library/ prefix for docker hub images
-				}
-			}
-
-			switch strings.ToLower(item.Type) {
-			case "image":
-				storeInfo.Images = append(storeInfo.Images, ImageInfo{
-					Name:      item.Reference,
-					Digest:    item.Digest,
-					Size:      item.Size,
-					SourceHaul: sourceHaul,
-				})
-			case "chart":
-				// Extract version from reference (format: hauler/chart:version)
-				name := item.Reference
-				version := ""
-				if parts := strings.Split(name, ":"); len(parts) >= 2 {
-					name = strings.Join(parts[:len(parts)-1], ":")
-					version = parts[len(parts)-1]
+		switch a.Kind {
+		case ocistore.KindImage:
+			storeInfo.Images = append(storeInfo.Images, ImageInfo{
+				Name:       a.Name,
+				Digest:     a.Digest,
+				Size:       a.Size,
+				Platforms:  a.Platforms(),
+				SourceHaul: sourceHaul,
+				Signatures: signatures[a.Digest],
+			})
+		case ocistore.KindChart:
+			name, version := a.ChartName, a.ChartVersion
+			if name == "" {
+				// Fall back to the reference (format: hauler/chart:version).
+				name = a.Name
+				if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+					name, version = name[:i], name[i+1:]
 				}
-				storeInfo.Charts = append(storeInfo.Charts, ChartInfo{
-					Name:       name,
-					Version:    version,
-					Digest:     item.Digest,
-					Size:       item.Size,
-					SourceHaul: sourceHaul,
-				})
-			case "file":
-				storeInfo.Files = append(storeInfo.Files, FileInfo{
-					Name:       item.Reference,
-					Digest:     item.Digest,
-					Size:       item.Size,
-					SourceHaul: sourceHaul,
-				})
 			}
+			storeInfo.Charts = append(storeInfo.Charts, ChartInfo{
+				Name:       name,
+				Version:    version,
+				Digest:     a.Digest,
+				Size:       a.Size,
+				SourceHaul: sourceHaul,
+			})
+		case ocistore.KindFile:
+			storeInfo.Files = append(storeInfo.Files, FileInfo{
+				Name:       a.Name,
+				Digest:     a.Digest,
+				Size:       a.Size,
+				SourceHaul: sourceHaul,
+			})
 		}
 	}
 
@@ -1160,6 +1559,7 @@ func (h *Handler) GetInfo(w http.ResponseWriter, r *http.Request) {
 // clearStore removes a haul's store directory and recreates the OCI layout structure
 func (h *Handler) clearStore(storeDir string) error {
 	// Remove the store directory
+	ocistore.Invalidate(storeDir)
 	if err := os.RemoveAll(storeDir); err != nil {
 		return fmt.Errorf("removing store directory: %w", err)
 	}
@@ -1181,6 +1581,17 @@ func (h *Handler) clearStore(storeDir string) error {
 	return nil
 }
 
+// clearHaul clears a haul's store and forgets its tracked contents.
+func (h *Handler) clearHaul(ctx context.Context, haul *hauls.Haul) error {
+	if err := h.clearStore(haul.StoreDir); err != nil {
+		return err
+	}
+	if _, err := h.JobRunner.DB().ExecContext(ctx, `DELETE FROM store_contents WHERE haul_id = ?`, haul.ID); err != nil {
+		log.Printf("Warning: failed to clear tracked contents for haul %d: %v", haul.ID, err)
+	}
+	return nil
+}
+
 // storeItem is a single artifact discovered in a haul's store index.
 type storeItem struct {
 	ContentType string
@@ -1188,50 +1599,21 @@ type storeItem struct {
 	Digest      string
 }
 
-// readStoreItems parses a haul store's index.json into a list of artifacts,
-// deriving each item's name from its OCI annotations (the index manifests have
-// no top-level name field). Returns an empty slice for a fresh/empty store.
+// readStoreItems lists the images, charts and files in a haul's store. Types
+// come from hauler's media types and kind annotations, so signatures and
+// attestations attached to images are not listed. Returns an empty slice for
+// a fresh/empty store.
 func readStoreItems(storeDir string) ([]storeItem, error) {
-	indexData, err := os.ReadFile(filepath.Join(storeDir, "index.json"))
+	st, err := ocistore.Load(storeDir)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil // fresh store, nothing tracked yet
-		}
-		return nil, fmt.Errorf("reading index.json: %w", err)
-	}
-
-	var index struct {
-		Manifests []struct {
-			Digest      string                 `json:"digest"`
-			Annotations map[string]interface{} `json:"annotations"`
-		} `json:"manifests"`
-	}
-	if err := json.Unmarshal(indexData, &index); err != nil {
-		return nil, fmt.Errorf("parsing index.json: %w", err)
+		return nil, err
 	}
-
-	items := make([]storeItem, 0, len(index.Manifests))
-	for _, m := range index.Manifests {
-		// Prefer io.containerd.image.name (full reference) over the short ref name.
-		var name string
-		if m.Annotations != nil {
-			if n, ok := m.Annotations["io.containerd.image.name"].(string); ok {
-				name = n
-			} else if n, ok := m.Annotations["org.opencontainers.image.ref.name"].(string); ok {
-				name = n
-			}
-		}
-		if name == "" {
+	items := make([]storeItem, 0, len(st.Artifacts))
+	for _, a := range st.Artifacts {
+		if a.Name == "" || !a.Kind.Content() {
 			continue
 		}
-
-		contentType := "file"
-		if strings.Contains(name, ":") {
-			contentType = "image"
-		} else if strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz") {
-			contentType = "chart"
-		}
-		items = append(items, storeItem{ContentType: contentType, Name: name, Digest: m.Digest})
+		items = append(items, storeItem{ContentType: string(a.Kind), Name: a.Name, Digest: a.Digest})
 	}
 	return items, nil
 }
@@ -1240,6 +1622,7 @@ func readStoreItems(storeDir string) ([]storeItem, error) {
 // rows are preserved (INSERT OR IGNORE) so provenance from prior loads is not
 // clobbered by later direct adds; sourceArchive is recorded for newly seen items.
 func (h *Handler) trackStoreContents(ctx context.Context, haul *hauls.Haul, sourceArchive string) error {
+	ocistore.Invalidate(haul.StoreDir)
 	items, err := readStoreItems(haul.StoreDir)
 	if err != nil {
 		return err
@@ -1281,6 +1664,7 @@ func (h *Handler) trackAfterJob(jobID int64, haul *hauls.Haul) {
 			}
 			return
 		case jobrunner.StatusFailed:
+			ocistore.Invalidate(haul.StoreDir) // a failed job may still have written blobs
 			return
 		}
 	}
@@ -1304,6 +1688,7 @@ func (h *Handler) rescanAfterJob(jobID int64, haul *hauls.Haul) {
 			}
 			return
 		case jobrunner.StatusFailed:
+			ocistore.Invalidate(haul.StoreDir) // a failed job may still have written blobs
 			return
 		}
 	}
@@ -1312,6 +1697,7 @@ func (h *Handler) rescanAfterJob(jobID int64, haul *hauls.Haul) {
 // rescanStore rebuilds a haul's store_contents rows from scratch (used after
 // removals and by the manual Rescan endpoint). Source provenance is reset.
 func (h *Handler) rescanStore(ctx context.Context, haul *hauls.Haul) (int, error) {
+	ocistore.Invalidate(haul.StoreDir)
 	items, err := readStoreItems(haul.StoreDir)
 	if err != nil {
 		return 0, err
@@ -1366,6 +1752,81 @@ func (h *Handler) Rescan(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// AdoptRequest represents the request to register an existing hauler store
+// directory on the server as a new haul.
+type AdoptRequest struct {
+	Name           string `json:"name"`
+	Description    string `json:"description,omitempty"`
+	SourceDir      string `json:"sourceDir"`
+	Mode           string `json:"mode,omitempty"` // link (default), move, or hardlink
+	ImportArchives bool   `json:"importArchives"`
+	// Writable keeps a linked haul unfrozen, so jobs change the source
+	// store in place.
+	Writable bool `json:"writable,omitempty"`
+}
+
+// Adopt handles POST /api/store/adopt. It validates the source OCI layout,
+// which must lie within an import root, creates a haul around it, and
+// populates store_contents from its index. A linked haul starts frozen
+// unless the request asks for it to be writable.
+func (h *Handler) Adopt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req AdoptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.SourceDir == "" {
+		http.Error(w, "sourceDir is required", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	haul, imported, err := h.Hauls.Adopt(ctx, hauls.AdoptOptions{
+		Name:           req.Name,
+		Description:    req.Description,
+		SourceDir:      req.SourceDir,
+		Mode:           hauls.AdoptMode(req.Mode),
+		ImportArchives: req.ImportArchives,
+		Writable:       req.Writable,
+		Actor:          r.RemoteAddr,
+	})
+	if err != nil {
+		log.Printf("Error adopting store %s: %v", req.SourceDir, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, hauls.ErrOutsideRoots) {
+			status = http.StatusForbidden
+		}
+		http.Error(w, "Failed to adopt store: "+err.Error(), status)
+		return
+	}
+
+	count, err := h.rescanStore(ctx, haul)
+	if err != nil {
+		log.Printf("Warning: failed to track contents for adopted haul %d: %v", haul.ID, err)
+	}
+	if imported == nil {
+		imported = []string{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":    fmt.Sprintf("Store adopted, tracked %d items", count),
+		"haul":       haul,
+		"itemsFound": count,
+		"archives":   imported,
+	})
+}
+
 // RegisterRoutes registers the store routes with the given mux. Operations are
 // scoped to a haul via a "haulId" field in the request body (or "?haul=" query
 // for reads); when omitted they fall back to the default haul.
@@ -1382,6 +1843,37 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/store/remove", h.Remove)
 	mux.HandleFunc("/api/store/rescan", h.Rescan)
 	mux.HandleFunc("/api/store/import", h.Import)
+	mux.HandleFunc("/api/store/adopt", h.Adopt)
+	mux.HandleFunc("/api/store/gc", h.GC)
+	mux.HandleFunc("/api/store/verify", h.Verify)
+	mux.HandleFunc("/api/store/signing-key", h.SigningKey)
+	mux.HandleFunc("/api/store/uploads", h.Uploads)
+	mux.HandleFunc("/api/store/uploads/", h.UploadByID)
+	mux.HandleFunc("/api/store/import-roots", h.ImportRoots)
+	mux.HandleFunc("/api/store/browse", h.Browse)
+	mux.HandleFunc("/api/store/import-path", h.ImportPath)
+	mux.HandleFunc("/api/store/sbom", h.GenerateSBOMs)
+	mux.HandleFunc("/api/store/sboms", h.SBOMs)
+	mux.HandleFunc("/api/store/sboms/", h.SBOMs)
+	mux.HandleFunc("/api/store/vulndb", h.VulnDB)
+	mux.HandleFunc("/api/store/vulndb/import", h.VulnDBImport)
+	mux.HandleFunc("/api/store/vulnscan", h.VulnScan)
+	mux.HandleFunc("/api/store/vulnerabilities", h.Vulnerabilities)
+	mux.HandleFunc("/api/store/cosign-keys", h.CosignKeys)
+	mux.HandleFunc("/api/store/cosign-keys/", h.CosignKeyByID)
+	mux.HandleFunc("/api/store/sign", h.Sign)
+	mux.HandleFunc("/api/store/retag", h.Retag)
+	mux.HandleFunc("/api/store/prune-platforms", h.PrunePlatforms)
+	mux.HandleFunc("/api/store/charts/", h.ChartByDigest)
+}
+
+// importTimeout is how long a single-request import may take to arrive. It
+// is never unbounded, so a stalled client cannot hold a connection forever.
+func (h *Handler) importTimeout() time.Duration {
+	if h.Cfg.ImportTimeout <= 0 {
+		return time.Hour
+	}
+	return h.Cfg.ImportTimeout
 }
 
 // Import handles POST /api/store/import. It accepts a .tar.zst upload, saves it
@@ -1396,6 +1888,17 @@ func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The upload is spooled to disk and then loaded into a store, so it needs
+	// roughly twice its size. Check the global reserve before accepting it.
+	if r.ContentLength > 0 && !h.preflight(w, r, nil, 2*r.ContentLength) {
+		return
+	}
+
+	// A whole archive cannot arrive within the server's read timeout, but it
+	// must arrive within the import timeout; large or unreliable transfers
+	// should use the resumable uploads API instead.
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(h.importTimeout()))
+
 	// Parse multipart form (max 100GB)
 	if err := r.ParseMultipartForm(100 << 30); err != nil {
 		log.Printf("Error parsing multipart form: %v", err)
@@ -1410,7 +1913,24 @@ func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !h.writable(w, haul) {
+		return
+	}
 	clear := r.FormValue("clear") == "true"
+	check, err := h.readImportCheck(r.MultipartForm, r.FormValue)
+	if err != nil {
+		http.Error(w, "Invalid manifest or signature: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A volume set comes as its index plus every volume as a "file" part.
+	if index, err := formPart(r.MultipartForm, r.FormValue, "volumes"); err != nil {
+		http.Error(w, "Invalid volume index: "+err.Error(), http.StatusBadRequest)
+		return
+	} else if len(index) > 0 {
+		h.importVolumes(w, r, haul, check, index, clear)
+		return
+	}
 
 	// Get the file from form
 	file, header, err := r.FormFile("file")
@@ -1430,6 +1950,9 @@ func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
+	if !h.preflight(w, r, haul, 2*header.Size) {
+		return
+	}
 
 	if err := os.MkdirAll(haul.ArchivesDir(), 0755); err != nil {
 		log.Printf("Error creating archives directory: %v", err)
@@ -1437,45 +1960,117 @@ func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Spool to a partial file so a rejected upload never replaces an archive
+	// of the same name; it is hashed on the way in for verification.
 	destinationPath := filepath.Join(haul.ArchivesDir(), filename)
-	destFile, err := os.OpenFile(destinationPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	partPath := destinationPath + ".part"
+	destFile, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		log.Printf("Error creating destination file: %v", err)
 		http.Error(w, "Failed to create file", http.StatusInternalServerError)
 		return
 	}
-	defer destFile.Close()
-
-	written, err := io.Copy(destFile, file)
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(destFile, hash), file)
+	if cerr := destFile.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
 		log.Printf("Error copying file: %v", err)
-		os.Remove(destinationPath)
+		os.Remove(partPath)
 		http.Error(w, "Failed to save file", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("Imported archive into haul %d: %s (%d bytes)", haul.ID, filename, written)
+	sum := hex.EncodeToString(hash.Sum(nil))
 
-	// Optionally clear the haul's store before loading.
-	if clear {
-		if err := h.clearStore(haul.StoreDir); err != nil {
-			http.Error(w, "Failed to clear store: "+err.Error(), http.StatusInternalServerError)
+	keyID, err := h.verifyImport(check, sum, written)
+	if err != nil {
+		os.Remove(partPath)
+		if errors.Is(err, errRejected) {
+			log.Printf("Rejected archive import into haul %d: %s: %v", haul.ID, filename, err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
-		if _, err := h.JobRunner.DB().ExecContext(ctx, `DELETE FROM store_contents WHERE haul_id = ?`, haul.ID); err != nil {
-			log.Printf("Warning: failed to clear tracked contents for haul %d: %v", haul.ID, err)
+		http.Error(w, "Failed to verify archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	job, err := h.installImport(ctx, haul, storeArgs, partPath, filename, sum, written, keyID, check, clear, 0)
+	if err != nil {
+		http.Error(w, "Failed to import archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Archive imported, load started",
+		"filename": filename,
+		"size":     written,
+		"sha256":   sum,
+		"signedBy": keyID,
+		"jobId":    job.ID,
+		"haulId":   haul.ID,
+	})
+}
+
+// installImport moves a verified upload from partPath into the haul's
+// archives, records its checksum and signed manifest, optionally clears the
+// store, and starts the job that loads the archive and then tracks what it
+// added. parent is the job installing it, if any, which a delta apply does
+// not wait for.
+func (h *Handler) installImport(ctx context.Context, haul *hauls.Haul, storeArgs []string, partPath, filename, sum string,
+	size int64, keyID string, check importCheck, clear bool, parent int64) (*jobrunner.Job, error) {
+	destinationPath := filepath.Join(haul.ArchivesDir(), filename)
+	if err := os.Rename(partPath, destinationPath); err != nil {
+		os.Remove(partPath)
+		return nil, fmt.Errorf("saving file: %w", err)
+	}
+	ocistore.ForgetArchive(destinationPath)
+	if err := hauls.WriteChecksum(haul.ArchivesDir(), filename, sum); err != nil {
+		log.Printf("Warning: failed to record checksum of %s: %v", filename, err)
+	}
+	if keyID != "" {
+		if err := writeSignedManifest(haul.ArchivesDir(), filename, check.Manifest, check.Signature); err != nil {
+			log.Printf("Warning: failed to keep manifest of %s: %v", filename, err)
+		}
+	}
+	log.Printf("Imported archive into haul %d: %s (%d bytes)", haul.ID, filename, size)
+
+	// A delta is applied in-process, on top of what the store already holds.
+	// An unreadable archive is left for the load job to report.
+	delta, _ := isDelta(destinationPath)
+	if delta && clear {
+		return nil, fmt.Errorf("%s is a delta archive; it cannot be loaded into a cleared store", filename)
+	}
+
+	// Optionally clear the haul's store before loading.
+	if clear {
+		if err := h.clearHaul(ctx, haul); err != nil {
+			return nil, fmt.Errorf("clearing store: %w", err)
 		}
 	}
 
 	// Kick off a load of the freshly uploaded archive into the haul's store.
-	args := []string{"store", "load", "-f", destinationPath}
+	command, args := "hauler", []string{"store", "load", "-f", destinationPath}
 	args = append(args, storeArgs...)
-	job, err := h.JobRunner.CreateJob(ctx, "hauler", args, nil)
+	if delta {
+		command, args = applyDeltaTask, []string{"--haul", strconv.FormatInt(haul.ID, 10)}
+		if parent != 0 {
+			args = append(args, "--parent", strconv.FormatInt(parent, 10))
+		}
+		args = append(args, destinationPath)
+	}
+	job, err := h.JobRunner.CreateJob(ctx, command, args, nil)
 	if err != nil {
 		log.Printf("Error creating load job: %v", err)
-		http.Error(w, "Failed to create load job", http.StatusInternalServerError)
-		return
+		return nil, fmt.Errorf("creating load job: %w", err)
 	}
 	h.tagJobHaul(ctx, job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
+	if delta {
+		// The apply task tracks what it loaded itself.
+		return job, nil
+	}
 
 	jobID := job.ID
 	go func() {
@@ -1497,14 +2092,5 @@ func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 	}()
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"message":  "Archive imported, load started",
-		"filename": filename,
-		"size":     written,
-		"jobId":    job.ID,
-		"haulId":   haul.ID,
-	})
+	return job, nil
 }
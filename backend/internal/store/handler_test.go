@@ -1,21 +1,40 @@
 package store
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
 	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	_ "modernc.org/sqlite"
 
+	"github.com/hauler-ui/hauler-ui/backend/internal/charts"
 	"github.com/hauler-ui/hauler-ui/backend/internal/config"
 	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
 	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/signing"
+	"github.com/hauler-ui/hauler-ui/backend/internal/vulns"
 )
 
 func setupTestHandler(t *testing.T) (*Handler, *sql.DB) {
@@ -63,8 +82,48 @@ func setupTestHandler(t *testing.T) (*Handler, *sql.DB) {
 			slug TEXT NOT NULL UNIQUE,
 			description TEXT,
 			store_dir TEXT NOT NULL,
+			quota_bytes INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			frozen INTEGER NOT NULL DEFAULT 0,
+			frozen_at DATETIME,
+			frozen_by TEXT,
+			frozen_reason TEXT,
+			frozen_index_digest TEXT,
+			deleted_at DATETIME,
+			trash_dir TEXT,
+			defaults TEXT,
+			labels TEXT,
+			publish_hostname TEXT,
+			template_id INTEGER,
+			verified_at DATETIME,
+			verify_ok INTEGER,
+			verify_problems INTEGER,
+			verify_job_id INTEGER
+		);
+
+		CREATE TABLE IF NOT EXISTS haul_freeze_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			haul_id INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			actor TEXT,
+			note TEXT,
+			reason TEXT,
+			index_digest TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS uploads (
+			id TEXT PRIMARY KEY,
+			haul_id INTEGER NOT NULL,
+			filename TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			received INTEGER NOT NULL DEFAULT 0,
+			hash_state BLOB,
+			options TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME
 		);
 
 		CREATE TABLE IF NOT EXISTS store_contents (
@@ -77,14 +136,59 @@ func setupTestHandler(t *testing.T) (*Handler, *sql.DB) {
 			loaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(haul_id, content_type, name, digest)
 		);
+
+		CREATE TABLE IF NOT EXISTS vuln_imports (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			source TEXT NOT NULL,
+			advisories INTEGER NOT NULL DEFAULT 0,
+			withdrawn INTEGER NOT NULL DEFAULT 0,
+			job_id INTEGER,
+			imported_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS vuln_advisories (
+			id TEXT PRIMARY KEY,
+			aliases TEXT,
+			summary TEXT,
+			severity TEXT NOT NULL,
+			score REAL,
+			modified TEXT,
+			published TEXT,
+			import_id INTEGER
+		);
+
+		CREATE TABLE IF NOT EXISTS vuln_affected (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			advisory_id TEXT NOT NULL,
+			ecosystem TEXT NOT NULL,
+			release TEXT NOT NULL DEFAULT '',
+			package TEXT NOT NULL,
+			ranges TEXT,
+			versions TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS cosign_keys (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			key_id TEXT NOT NULL,
+			algorithm TEXT NOT NULL,
+			public_key TEXT NOT NULL,
+			private_key TEXT NOT NULL,
+			imported INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
 	`)
 	if err != nil {
 		t.Fatalf("creating schema: %v", err)
 	}
 
 	cfg := &config.Config{
-		HaulerTempDir: filepath.Join(dataDir, "tmp"),
-		DataDir:       dataDir,
+		HaulerTempDir:  filepath.Join(dataDir, "tmp"),
+		DataDir:        dataDir,
+		SigningKeyPath: filepath.Join(dataDir, "keys", "archive-signing.pem"),
+		TrustedKeysDir: filepath.Join(dataDir, "keys", "trusted"),
+		CosignKeysDir:  filepath.Join(dataDir, "keys", "cosign"),
+		UploadExpiry:   time.Hour,
 	}
 
 	runner := jobrunner.New(db)
@@ -362,3 +466,1411 @@ func TestCopyHandler_OnlyAttestations(t *testing.T) {
 	// Clean up job
 	db.Exec("DELETE FROM jobs WHERE id = ?", job.ID)
 }
+
+// writeTestLayout builds a minimal OCI layout in dir whose index.json lists one
+// manifest per name, each annotated the way hauler annotates stored artifacts.
+func writeTestLayout(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatalf("creating blobs dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644); err != nil {
+		t.Fatalf("writing oci-layout: %v", err)
+	}
+	type desc struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Size        int64             `json:"size"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	}
+	var manifests []desc
+	for _, name := range names {
+		body := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[],"annotations":{"name":%q}}`, name))
+		sum := sha256.Sum256(body)
+		hexDigest := hex.EncodeToString(sum[:])
+		if err := os.WriteFile(filepath.Join(blobs, hexDigest), body, 0644); err != nil {
+			t.Fatalf("writing manifest blob: %v", err)
+		}
+		manifests = append(manifests, desc{
+			MediaType:   "application/vnd.oci.image.manifest.v1+json",
+			Digest:      "sha256:" + hexDigest,
+			Size:        int64(len(body)),
+			Annotations: map[string]string{"io.containerd.image.name": name},
+		})
+	}
+	index, _ := json.Marshal(map[string]interface{}{"schemaVersion": 2, "manifests": manifests})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0644); err != nil {
+		t.Fatalf("writing index.json: %v", err)
+	}
+}
+
+func TestAdoptHandler_LinkMode(t *testing.T) {
+	handler, db := setupTestHandler(t)
+
+	srcRoot := t.TempDir()
+	handler.Cfg.ImportRoots = []string{srcRoot}
+	source := filepath.Join(srcRoot, "store")
+	writeTestLayout(t, source, "docker.io/library/nginx:1.25", "docker.io/library/redis:7")
+	if err := os.WriteFile(filepath.Join(srcRoot, "old.tar.zst"), []byte("archive"), 0644); err != nil {
+		t.Fatalf("writing loose archive: %v", err)
+	}
+
+	body, _ := json.Marshal(AdoptRequest{Name: "Legacy", SourceDir: source, ImportArchives: true})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/adopt", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.Adopt(w, r)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+
+	haul, err := handler.Hauls.GetBySlug(context.Background(), "legacy")
+	if err != nil {
+		t.Fatalf("adopted haul not found: %v", err)
+	}
+	target, err := os.Readlink(haul.StoreDir)
+	if err != nil || target != source {
+		t.Errorf("expected store dir to link to %s, got %q (%v)", source, target, err)
+	}
+	if _, err := os.Stat(filepath.Join(haul.ArchivesDir(), "old.tar.zst")); err != nil {
+		t.Errorf("expected loose archive to be imported: %v", err)
+	}
+
+	var count int
+	if err := db.QueryRow(`SELECT COUNT(1) FROM store_contents WHERE haul_id = ?`, haul.ID).Scan(&count); err != nil {
+		t.Fatalf("counting store contents: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 tracked items, got %d", count)
+	}
+
+	// Jobs must not change the source through the link until it is
+	// explicitly unfrozen.
+	if !haul.Frozen || !strings.Contains(haul.FrozenReason, source) {
+		t.Errorf("expected a linked haul to start frozen, got %+v", haul)
+	}
+	if _, err := handler.Hauls.Unfreeze(context.Background(), haul.ID, "test", "", "done"); err != nil {
+		t.Fatalf("unfreezing haul: %v", err)
+	}
+
+	// Deleting the haul must only remove the link, never the adopted source.
+	if err := handler.Hauls.Delete(context.Background(), haul.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(source, "index.json")); err != nil {
+		t.Errorf("expected source store to survive haul deletion: %v", err)
+	}
+}
+
+func TestAdoptHandler_InvalidLayout(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	source := t.TempDir()
+	handler.Cfg.ImportRoots = []string{source}
+	if err := os.WriteFile(filepath.Join(source, "oci-layout"), []byte(`{"imageLayoutVersion": "1.0.0"}`), 0644); err != nil {
+		t.Fatalf("writing oci-layout: %v", err)
+	}
+
+	body, _ := json.Marshal(AdoptRequest{Name: "Broken", SourceDir: source})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/adopt", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.Adopt(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if _, err := handler.Hauls.GetBySlug(context.Background(), "broken"); err == nil {
+		t.Error("expected no haul to be created for an invalid layout")
+	}
+}
+
+func TestAdoptHandler_OutsideImportRoots(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.Cfg.ImportRoots = []string{t.TempDir()}
+
+	source := filepath.Join(t.TempDir(), "store")
+	writeTestLayout(t, source, "docker.io/library/nginx:1.25")
+
+	body, _ := json.Marshal(AdoptRequest{Name: "Elsewhere", SourceDir: source})
+	w := httptest.NewRecorder()
+	handler.Adopt(w, httptest.NewRequest(http.MethodPost, "/api/store/adopt", bytes.NewReader(body)))
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d: %s", http.StatusForbidden, w.Code, w.Body.String())
+	}
+	if _, err := handler.Hauls.GetBySlug(context.Background(), "elsewhere"); err == nil {
+		t.Error("expected no haul to be created outside the import roots")
+	}
+}
+
+func TestAdoptHandler_TrashedName(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	trashed, err := handler.Hauls.Create(ctx, "Legacy", "")
+	if err != nil {
+		t.Fatalf("creating haul: %v", err)
+	}
+	if err := handler.Hauls.Delete(ctx, trashed.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+
+	srcRoot := t.TempDir()
+	handler.Cfg.ImportRoots = []string{srcRoot}
+	source := filepath.Join(srcRoot, "store")
+	writeTestLayout(t, source, "docker.io/library/nginx:1.25")
+
+	body, _ := json.Marshal(AdoptRequest{Name: "Legacy", SourceDir: source})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/adopt", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.Adopt(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "in the trash") {
+		t.Errorf("expected the trashed name to be reported, got %q", w.Body.String())
+	}
+	if _, err := os.Stat(filepath.Join(source, "index.json")); err != nil {
+		t.Errorf("expected source store to be left alone: %v", err)
+	}
+}
+
+func TestAddImageHandler_OverQuota(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	haul, err := handler.Hauls.EnsureDefault(context.Background())
+	if err != nil {
+		t.Fatalf("resolving default haul: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(haul.ArchivesDir(), "big.tar.zst"), make([]byte, 4096), 0644); err != nil {
+		t.Fatalf("writing archive: %v", err)
+	}
+	if _, err := handler.Hauls.SetQuota(context.Background(), haul.ID, 1024); err != nil {
+		t.Fatalf("setting quota: %v", err)
+	}
+
+	body, _ := json.Marshal(AddImageRequest{ImageRef: "nginx:latest"})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/add-image", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.AddImage(w, r)
+
+	if w.Code != http.StatusInsufficientStorage {
+		t.Errorf("expected status %d, got %d: %s", http.StatusInsufficientStorage, w.Code, w.Body.String())
+	}
+
+	jobs, err := handler.JobRunner.ListJobs(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("listing jobs: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Errorf("expected no job to be created, got %d", len(jobs))
+	}
+}
+
+func TestAddImageHandler_FrozenHaul(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	haul, err := handler.Hauls.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("resolving default haul: %v", err)
+	}
+	if _, err := handler.Hauls.Freeze(ctx, haul.ID, "127.0.0.1:1234", "tester", "release candidate"); err != nil {
+		t.Fatalf("freezing haul: %v", err)
+	}
+
+	body, _ := json.Marshal(AddImageRequest{ImageRef: "nginx:latest"})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/add-image", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.AddImage(w, r)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d: %s", http.StatusConflict, w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "release candidate") {
+		t.Errorf("expected freeze reason in response, got %q", w.Body.String())
+	}
+
+	// Unfreezing makes the haul writable again and leaves an audit trail.
+	if _, err := handler.Hauls.Unfreeze(ctx, haul.ID, "127.0.0.1:1234", "tester", "fixes landed"); err != nil {
+		t.Fatalf("unfreezing haul: %v", err)
+	}
+	history, err := handler.Hauls.FreezeHistory(ctx, haul.ID)
+	if err != nil {
+		t.Fatalf("loading freeze history: %v", err)
+	}
+	if len(history) != 2 || history[0].Action != "unfreeze" || history[1].Action != "freeze" {
+		t.Errorf("unexpected freeze history: %+v", history)
+	}
+}
+
+func TestAddImageHandler_LockedHaul(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	haul, err := handler.Hauls.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("resolving default haul: %v", err)
+	}
+	unlock, err := handler.Hauls.Lock(haul.ID, "gc job 1")
+	if err != nil {
+		t.Fatalf("locking haul: %v", err)
+	}
+	if _, err := handler.Hauls.Lock(haul.ID, "gc job 2"); err == nil {
+		t.Error("expected a second lock to fail")
+	}
+
+	body, _ := json.Marshal(AddImageRequest{ImageRef: "nginx:latest"})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/add-image", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.AddImage(w, r)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "gc job 1") {
+		t.Errorf("expected 409 naming the lock holder, got %d: %s", w.Code, w.Body.String())
+	}
+
+	unlock()
+	if err := handler.Hauls.Locked(haul.ID); err != nil {
+		t.Errorf("expected the lock to be released, got %v", err)
+	}
+}
+
+func TestVerifyTaskRecordsLastVerified(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+
+	haul, err := handler.Hauls.EnsureDefault(ctx)
+	if err != nil {
+		t.Fatalf("resolving default haul: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(haul.StoreDir, "blobs", "sha256"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(filepath.Join(haul.StoreDir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0644)
+	_ = os.WriteFile(filepath.Join(haul.StoreDir, "index.json"), []byte(`{"schemaVersion":2,"manifests":[]}`), 0644)
+	// A blob whose name does not match its content.
+	_ = os.WriteFile(filepath.Join(haul.StoreDir, "blobs", "sha256", strings.Repeat("0", 64)), []byte("junk"), 0644)
+
+	job, err := handler.JobRunner.CreateJob(ctx, verifyTask, []string{"--haul", fmt.Sprint(haul.ID)}, nil)
+	if err != nil {
+		t.Fatalf("creating job: %v", err)
+	}
+	result, err := handler.runVerify(ctx, job, func(string, ...interface{}) {})
+	if err == nil {
+		t.Fatal("expected the corrupt blob to fail the job")
+	}
+	var res VerifyResult
+	if err := json.Unmarshal([]byte(result), &res); err != nil {
+		t.Fatalf("decoding result: %v", err)
+	}
+	if len(res.Corrupt) != 1 {
+		t.Errorf("expected one corrupt blob, got %+v", res.Corrupt)
+	}
+
+	haul, _ = handler.Hauls.Get(ctx, haul.ID)
+	if haul.LastVerified == nil || haul.LastVerified.OK || haul.LastVerified.Problems != 1 || haul.LastVerified.JobID != job.ID {
+		t.Errorf("unexpected last verification %+v", haul.LastVerified)
+	}
+}
+
+func TestSaveHandler_UnknownSelection(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+
+	body, _ := json.Marshal(SaveRequest{Selection: ocistore.Selection{Refs: []string{"nginx:1.25"}}})
+	r := httptest.NewRequest(http.MethodPost, "/api/store/save", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handler.Save(w, r)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "nginx:1.25") {
+		t.Errorf("expected 400 naming the unknown ref, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+// importRequest builds a multipart import of archive plus the given fields.
+func importRequest(t *testing.T, archive []byte, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", "bundle.tar.zst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = fw.Write(archive)
+	for k, v := range fields {
+		_ = mw.WriteField(k, v)
+	}
+	_ = mw.Close()
+	r := httptest.NewRequest(http.MethodPost, "/api/store/import", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestImportHandler_VerifiesSignedManifest(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	haul, _ := handler.Hauls.EnsureDefault(context.Background())
+	archive := []byte("pretend this is a zstd tarball")
+	sum := sha256.Sum256(archive)
+
+	signer, err := handler.signer()
+	if err != nil {
+		t.Fatalf("loading signing key: %v", err)
+	}
+	manifest, _ := json.Marshal(ArchiveManifest{Archive: "bundle.tar.zst", SHA256: hex.EncodeToString(sum[:]), Size: int64(len(archive))})
+
+	tests := []struct {
+		name   string
+		data   []byte
+		fields map[string]string
+		want   int
+	}{
+		{"unsigned when required", archive, map[string]string{"requireSignature": "true"}, http.StatusUnprocessableEntity},
+		{"wrong checksum", archive, map[string]string{"sha256": strings.Repeat("0", 64)}, http.StatusUnprocessableEntity},
+		{"bad signature", archive, map[string]string{"manifest": string(manifest), "signature": signer.Sign([]byte("other"))}, http.StatusUnprocessableEntity},
+		{"tampered archive", append([]byte("x"), archive...), map[string]string{"manifest": string(manifest), "signature": signer.Sign(manifest)}, http.StatusUnprocessableEntity},
+		{"signed", archive, map[string]string{"manifest": string(manifest), "signature": signer.Sign(manifest), "requireSignature": "true"}, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.Import(w, importRequest(t, tt.data, tt.fields))
+			if w.Code != tt.want {
+				t.Fatalf("expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			_, err := os.Stat(filepath.Join(haul.ArchivesDir(), "bundle.tar.zst"))
+			if tt.want != http.StatusAccepted && err == nil {
+				t.Error("rejected archive was kept")
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(haul.ArchivesDir(), hauls.SignatureName("bundle.tar.zst"))); err != nil {
+		t.Errorf("expected the signature to be kept beside the archive: %v", err)
+	}
+	sums, _ := os.ReadFile(filepath.Join(haul.ArchivesDir(), hauls.ChecksumFile))
+	if want := hex.EncodeToString(sum[:]) + "  bundle.tar.zst\n"; string(sums) != want {
+		t.Errorf("SHA256SUMS = %q, want %q", sums, want)
+	}
+}
+
+func TestLoadHandler_VolumeSet(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+
+	// A one-blob archive, large and incompressible enough for two volumes.
+	layer := make([]byte, hauls.MinVolumeSize+4096)
+	_, _ = rand.Read(layer)
+	sum := sha256.Sum256(layer)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	index, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, Manifests: []ocistore.Descriptor{{
+		MediaType: ocistore.MediaTypeOCIManifest, Digest: digest, Size: int64(len(layer)),
+		Annotations: map[string]string{ocistore.AnnotationRefName: "blob:1"},
+	}}})
+	_ = os.MkdirAll(haul.ArchivesDir(), 0755)
+	archive := filepath.Join(haul.ArchivesDir(), "bundle.tar.zst")
+	f, _ := os.Create(archive)
+	zw, _ := zstd.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for name, data := range map[string][]byte{"index.json": index, "blobs/sha256/" + digest[7:]: layer} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		_, _ = tw.Write(data)
+	}
+	tw.Close()
+	zw.Close()
+	f.Close()
+	if idx, err := hauls.SplitArchive(archive, hauls.MinVolumeSize, ""); err != nil || len(idx.Volumes) != 2 {
+		t.Fatalf("splitting: %v %+v", err, idx)
+	}
+
+	body, _ := json.Marshal(LoadRequest{Filenames: []string{"bundle.tar.zst"}})
+	w := httptest.NewRecorder()
+	handler.Load(w, httptest.NewRequest(http.MethodPost, "/api/store/load", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct{ JobID int64 }
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, err := handler.JobRunner.GetJob(ctx, resp.JobID)
+	if err != nil || job.Command != loadVolumesTask {
+		t.Fatalf("expected a %s job, got %+v %v", loadVolumesTask, job, err)
+	}
+
+	// A job queued before the load took the lock may still write the store.
+	other, _ := handler.JobRunner.CreateJob(ctx, "hauler", []string{"store", "sync"}, nil)
+	handler.tagJobHaul(ctx, other.ID, haul.ID)
+	if _, err := handler.runLoadVolumes(ctx, job, func(string, ...interface{}) {}); err == nil || !strings.Contains(err.Error(), "queued or running") {
+		t.Fatalf("expected the load to wait for the other job, got %v", err)
+	}
+	if err := handler.JobRunner.Fail(ctx, other.ID, "cancelled", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := handler.runLoadVolumes(ctx, job, func(string, ...interface{}) {}); err != nil {
+		t.Fatalf("loading volumes: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(haul.StoreDir, "blobs", "sha256", digest[7:])); err != nil || !bytes.Equal(data, layer) {
+		t.Errorf("expected the blob in the store: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(haul.StoreDir, "index.json")); !strings.Contains(string(data), digest) {
+		t.Errorf("expected index.json to list the loaded entry, got %s", data)
+	}
+}
+
+func TestLoadHandler_RequireSignedRefusesOutsideArchives(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	handler.Cfg.RequireSignedImports = true
+
+	outside := filepath.Join(t.TempDir(), "bundle.tar.zst")
+	if err := os.WriteFile(outside, []byte("archive"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{outside, "../../elsewhere/bundle.tar.zst"} {
+		body, _ := json.Marshal(LoadRequest{Filenames: []string{name}})
+		w := httptest.NewRecorder()
+		handler.Load(w, httptest.NewRequest(http.MethodPost, "/api/store/load", bytes.NewReader(body)))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s: expected status %d, got %d: %s", name, http.StatusForbidden, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestResumableUpload(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	haul, _ := handler.Hauls.EnsureDefault(context.Background())
+	data := []byte("0123456789abcdefghij")
+	sum := sha256.Sum256(data)
+
+	do := func(method, path string, body []byte, offset string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, bytes.NewReader(body))
+		if offset != "" {
+			r.Header.Set("Upload-Offset", offset)
+		}
+		w := httptest.NewRecorder()
+		if path == "/api/store/uploads" {
+			handler.Uploads(w, r)
+		} else {
+			handler.UploadByID(w, r)
+		}
+		return w
+	}
+
+	create, _ := json.Marshal(UploadRequest{Filename: "bundle.tar.zst", Size: int64(len(data))})
+	w := do(http.MethodPost, "/api/store/uploads", create, "")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	var created struct{ URL string }
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+
+	if w := do(http.MethodPatch, created.URL, data[:8], "0"); w.Code != http.StatusOK {
+		t.Fatalf("first chunk: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPatch, created.URL, data[4:], "4"); w.Code != http.StatusConflict || w.Header().Get("Upload-Offset") != "8" {
+		t.Fatalf("expected a stale offset to be refused with the current one, got %d %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := do(http.MethodPost, created.URL+"/complete", []byte(`{"sha256":"`+hex.EncodeToString(sum[:])+`"}`), ""); w.Code != http.StatusConflict {
+		t.Fatalf("expected an incomplete upload to be refused, got %d", w.Code)
+	}
+	if w := do(http.MethodHead, created.URL, nil, ""); w.Header().Get("Upload-Offset") != "8" {
+		t.Fatalf("expected HEAD to report offset 8, got %q", w.Header().Get("Upload-Offset"))
+	}
+	if w := do(http.MethodPatch, created.URL, append(data[8:], 'x'), "8"); w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected an overrunning chunk to be refused, got %d", w.Code)
+	}
+	if w := do(http.MethodPatch, created.URL, data[8:], "8"); w.Code != http.StatusOK {
+		t.Fatalf("second chunk: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, created.URL+"/complete", []byte(`{"sha256":"`+hex.EncodeToString(sum[:])+`"}`), "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("complete: %d %s", w.Code, w.Body.String())
+	}
+	if got, err := os.ReadFile(filepath.Join(haul.ArchivesDir(), "bundle.tar.zst")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the archive to be in place: %v", err)
+	}
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(1) FROM jobs WHERE command = 'hauler' AND args LIKE '%bundle.tar.zst%'`).Scan(&n)
+	if n != 1 {
+		t.Errorf("expected a load job for the archive, found %d", n)
+	}
+	if w := do(http.MethodGet, created.URL, nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the finished upload to be gone, got %d", w.Code)
+	}
+}
+
+func TestPurgeExpiredUploads(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+
+	body, _ := json.Marshal(UploadRequest{Filename: "stale.tar.zst", Size: 10})
+	w := httptest.NewRecorder()
+	handler.Uploads(w, httptest.NewRequest(http.MethodPost, "/api/store/uploads", bytes.NewReader(body)))
+	var created struct{ Upload Upload }
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	part := filepath.Join(haul.ArchivesDir(), ".upload-"+created.Upload.ID+".part")
+	if _, err := os.Stat(part); err != nil {
+		t.Fatalf("expected partial data file: %v", err)
+	}
+
+	if n, err := handler.PurgeExpiredUploads(ctx); err != nil || n != 0 {
+		t.Fatalf("expected a fresh upload to survive, got %d %v", n, err)
+	}
+	_, _ = db.Exec(`UPDATE uploads SET expires_at = ?`, time.Now().UTC().Add(-time.Minute))
+	if n, err := handler.PurgeExpiredUploads(ctx); err != nil || n != 1 {
+		t.Fatalf("expected the expired upload to be purged, got %d %v", n, err)
+	}
+	if _, err := os.Stat(part); !os.IsNotExist(err) {
+		t.Error("expected the partial data to be removed")
+	}
+}
+
+func TestBrowseHandler_ConfinedToImportRoots(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	root, outside := t.TempDir(), t.TempDir()
+	handler.Cfg.ImportRoots = []string{root}
+	_ = os.Mkdir(filepath.Join(root, "disc1"), 0755)
+	_ = os.WriteFile(filepath.Join(root, "bundle.tar.zst"), []byte("archive"), 0644)
+	_ = os.WriteFile(filepath.Join(root, "notes.txt"), []byte("notes"), 0644)
+	_ = os.WriteFile(filepath.Join(root, hauls.ChecksumFile), []byte(strings.Repeat("a", 64)+"  bundle.tar.zst\n"), 0644)
+	_ = os.Symlink(outside, filepath.Join(root, "escape"))
+
+	browse := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Browse(w, httptest.NewRequest(http.MethodGet, "/api/store/browse?path="+path, nil))
+		return w
+	}
+	w := browse(root)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var listing struct{ Dirs, Archives []BrowseEntry }
+	_ = json.Unmarshal(w.Body.Bytes(), &listing)
+	if len(listing.Archives) != 1 || listing.Archives[0].Name != "bundle.tar.zst" || listing.Archives[0].Size != 7 ||
+		listing.Archives[0].SHA256 != strings.Repeat("a", 64) {
+		t.Errorf("unexpected archives: %+v", listing.Archives)
+	}
+	if len(listing.Dirs) != 2 {
+		t.Errorf("expected disc1 and escape as directories, got %+v", listing.Dirs)
+	}
+
+	for _, path := range []string{outside, root + "/../", filepath.Join(root, "escape"), "relative"} {
+		if w := browse(path); w.Code != http.StatusForbidden {
+			t.Errorf("browse %q: expected 403, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestImportPath_CopiesVerifiesAndLoads(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	root := t.TempDir()
+	handler.Cfg.ImportRoots = []string{root}
+	data := []byte("0123456789abcdefghij")
+	sum := sha256.Sum256(data)
+	src := filepath.Join(root, "bundle.tar.zst")
+	_ = os.WriteFile(src, data, 0644)
+
+	start := func(req ImportPathRequest) *jobrunner.Job {
+		t.Helper()
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		handler.ImportPath(w, httptest.NewRequest(http.MethodPost, "/api/store/import-path", bytes.NewReader(body)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct{ JobID int64 }
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		job, err := handler.JobRunner.GetJob(ctx, resp.JobID)
+		if err != nil || job.Command != importPathTask {
+			t.Fatalf("expected a %s job, got %+v %v", importPathTask, job, err)
+		}
+		return job
+	}
+	logf := func(string, ...interface{}) {}
+
+	// A wrong checksum in SHA256SUMS beside the source is enforced.
+	_ = os.WriteFile(filepath.Join(root, hauls.ChecksumFile), []byte(strings.Repeat("0", 64)+"  bundle.tar.zst\n"), 0644)
+	if _, err := handler.runImportPath(ctx, start(ImportPathRequest{Path: src, Mode: "copy"}), logf); err == nil {
+		t.Fatal("expected a checksum mismatch to fail the import")
+	}
+	if _, err := os.Stat(filepath.Join(haul.ArchivesDir(), "bundle.tar.zst")); !os.IsNotExist(err) {
+		t.Error("expected a rejected archive not to be kept")
+	}
+
+	_ = os.WriteFile(filepath.Join(root, hauls.ChecksumFile), []byte(hex.EncodeToString(sum[:])+"  bundle.tar.zst\n"), 0644)
+	out, err := handler.runImportPath(ctx, start(ImportPathRequest{Path: src, Mode: "copy"}), logf)
+	if err != nil {
+		t.Fatalf("importing: %v", err)
+	}
+	if !strings.Contains(out, `"mode":"Copied"`) || !strings.Contains(out, hex.EncodeToString(sum[:])) {
+		t.Errorf("unexpected result %s", out)
+	}
+	if got, err := os.ReadFile(filepath.Join(haul.ArchivesDir(), "bundle.tar.zst")); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("expected the archive to be copied: %v", err)
+	}
+	if got, ok := hauls.LookupChecksum(haul.ArchivesDir(), "bundle.tar.zst"); !ok || got != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the checksum to be recorded, got %q", got)
+	}
+	var n int
+	_ = db.QueryRow(`SELECT COUNT(1) FROM jobs WHERE command = 'hauler' AND args LIKE '%bundle.tar.zst%'`).Scan(&n)
+	if n != 1 {
+		t.Errorf("expected a load job for the archive, found %d", n)
+	}
+
+	body, _ := json.Marshal(ImportPathRequest{Path: filepath.Join(root, "..", "elsewhere.tar.zst")})
+	w := httptest.NewRecorder()
+	handler.ImportPath(w, httptest.NewRequest(http.MethodPost, "/api/store/import-path", bytes.NewReader(body)))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected a path outside the roots to be refused, got %d", w.Code)
+	}
+
+	// A hardlink could change under a verified signature.
+	body, _ = json.Marshal(ImportPathRequest{Path: src, Mode: "hardlink", RequireSignature: true})
+	w = httptest.NewRecorder()
+	handler.ImportPath(w, httptest.NewRequest(http.MethodPost, "/api/store/import-path", bytes.NewReader(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected a signed hardlink import to be refused, got %d", w.Code)
+	}
+}
+
+func TestSaveDelta_AppliesOntoBaselineHaul(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+	src, _ := handler.Hauls.EnsureDefault(ctx)
+	dst, err := handler.Hauls.Create(ctx, "site", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// src holds an image whose first layer the site already has.
+	writeBlob := func(dir string, data []byte) ocistore.Descriptor {
+		sum := sha256.Sum256(data)
+		_ = os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755)
+		_ = os.WriteFile(filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:])), data, 0644)
+		return ocistore.Descriptor{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	}
+	old, fresh := writeBlob(src.StoreDir, []byte("old layer")), writeBlob(src.StoreDir, []byte("fresh layer"))
+	config := writeBlob(src.StoreDir, []byte(`{"os":"linux","architecture":"amd64"}`))
+	config.MediaType = ocistore.MediaTypeOCIConfig
+	manifest, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: []ocistore.Descriptor{old, fresh}})
+	img := writeBlob(src.StoreDir, manifest)
+	img.MediaType = ocistore.MediaTypeOCIManifest
+	img.Annotations = map[string]string{ocistore.AnnotationRefName: "docker.io/library/app:2"}
+	index, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, Manifests: []ocistore.Descriptor{img}})
+	_ = os.WriteFile(filepath.Join(src.StoreDir, "index.json"), index, 0644)
+	// The site runs app:1, built from the same config and old layer.
+	writeBlob(dst.StoreDir, []byte("old layer"))
+	writeBlob(dst.StoreDir, []byte(`{"os":"linux","architecture":"amd64"}`))
+	v1, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: []ocistore.Descriptor{old}})
+	base := writeBlob(dst.StoreDir, v1)
+	base.MediaType = ocistore.MediaTypeOCIManifest
+	base.Annotations = map[string]string{ocistore.AnnotationRefName: "docker.io/library/app:1"}
+	baseIndex, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, Manifests: []ocistore.Descriptor{base}})
+	_ = os.WriteFile(filepath.Join(dst.StoreDir, "index.json"), baseIndex, 0644)
+
+	body, _ := json.Marshal(SaveRequest{HaulID: src.ID, Filename: "update.tar.zst", Baseline: &Baseline{HaulID: dst.ID}})
+	w := httptest.NewRecorder()
+	handler.Save(w, httptest.NewRequest(http.MethodPost, "/api/store/save", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct{ JobID int64 }
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, err := handler.JobRunner.GetJob(ctx, resp.JobID)
+	if err != nil || job.Command != saveDeltaTask {
+		t.Fatalf("expected a %s job, got %+v %v", saveDeltaTask, job, err)
+	}
+	out, err := handler.runSaveDelta(ctx, job, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatalf("saving delta: %v", err)
+	}
+	var result struct{ OmittedBlobs, Blobs int }
+	_ = json.Unmarshal([]byte(out), &result)
+	if result.OmittedBlobs != 2 || result.Blobs != 2 {
+		t.Errorf("expected the old layer and config to be omitted, got %s", out)
+	}
+
+	// Carried to the site, the delta is applied in-process on top of its store.
+	archive := filepath.Join(src.ArchivesDir(), "update.tar.zst")
+	body, _ = json.Marshal(LoadRequest{HaulID: dst.ID, Filenames: []string{archive}})
+	w = httptest.NewRecorder()
+	handler.Load(w, httptest.NewRequest(http.MethodPost, "/api/store/load", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, err = handler.JobRunner.GetJob(ctx, resp.JobID)
+	if err != nil || job.Command != applyDeltaTask {
+		t.Fatalf("expected a %s job, got %+v %v", applyDeltaTask, job, err)
+	}
+	if _, err := handler.runLoadVolumes(ctx, job, func(string, ...interface{}) {}); err != nil {
+		t.Fatalf("applying delta: %v", err)
+	}
+	if report, err := ocistore.Verify(ctx, dst.StoreDir, nil); err != nil || !report.OK {
+		t.Errorf("expected the site's store to be complete, got %+v %v", report, err)
+	}
+
+	// The same delta does not apply to an empty haul.
+	empty, _ := handler.Hauls.Create(ctx, "empty", "")
+	body, _ = json.Marshal(LoadRequest{HaulID: empty.ID, Filenames: []string{archive}})
+	w = httptest.NewRecorder()
+	handler.Load(w, httptest.NewRequest(http.MethodPost, "/api/store/load", bytes.NewReader(body)))
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ = handler.JobRunner.GetJob(ctx, resp.JobID)
+	if _, err := handler.runLoadVolumes(ctx, job, func(string, ...interface{}) {}); err == nil || !strings.Contains(err.Error(), "incomplete") {
+		t.Errorf("expected an incomplete delta to fail, got %v", err)
+	}
+}
+
+// writeAlpineImage writes an alpine image with two packages in its apk
+// database as the only manifest in the store at dir.
+func writeAlpineImage(t *testing.T, dir string) ocistore.Descriptor {
+	t.Helper()
+	var layer bytes.Buffer
+	gz := gzip.NewWriter(&layer)
+	tw := tar.NewWriter(gz)
+	for name, data := range map[string]string{
+		"etc/os-release":       "ID=alpine\nVERSION_ID=3.19.1\n",
+		"lib/apk/db/installed": "P:musl\nV:1.2.4-r2\nA:x86_64\n\nP:zlib\nV:1.3.1-r0\nA:x86_64\n",
+	} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data))})
+		_, _ = tw.Write([]byte(data))
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	writeBlob := func(mediaType string, data []byte) ocistore.Descriptor {
+		sum := sha256.Sum256(data)
+		_ = os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755)
+		_ = os.WriteFile(filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:])), data, 0644)
+		return ocistore.Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	}
+	config := writeBlob(ocistore.MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"amd64"}`))
+	l := writeBlob("application/vnd.oci.image.layer.v1.tar+gzip", layer.Bytes())
+	manifest, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: []ocistore.Descriptor{l}})
+	img := writeBlob(ocistore.MediaTypeOCIManifest, manifest)
+	img.Annotations = map[string]string{ocistore.AnnotationContainerdName: "docker.io/library/alpine:3.19"}
+	index, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, Manifests: []ocistore.Descriptor{img}})
+	_ = os.WriteFile(filepath.Join(dir, "index.json"), index, 0644)
+	return img
+}
+
+func TestSBOMJobAndSaveInclude(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+
+	img := writeAlpineImage(t, haul.StoreDir)
+
+	w := httptest.NewRecorder()
+	handler.GenerateSBOMs(w, httptest.NewRequest(http.MethodPost, "/api/store/sbom", strings.NewReader(`{}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct{ JobID int64 }
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ := handler.JobRunner.GetJob(ctx, resp.JobID)
+	if _, err := handler.runSBOM(ctx, job, func(string, ...interface{}) {}); err != nil {
+		t.Fatalf("generating SBOMs: %v", err)
+	}
+	// A second run keeps what is there.
+	out, _ := handler.runSBOM(ctx, job, func(string, ...interface{}) {})
+	if !strings.Contains(out, `"skipped":1`) {
+		t.Errorf("expected the existing SBOM to be skipped, got %s", out)
+	}
+
+	w = httptest.NewRecorder()
+	handler.SBOMs(w, httptest.NewRequest(http.MethodGet, "/api/store/sboms", nil))
+	var list struct{ SBOMs []SBOMSummary }
+	_ = json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.SBOMs) != 1 || list.SBOMs[0].Packages != 2 || list.SBOMs[0].Image != "docker.io/library/alpine:3.19" {
+		t.Fatalf("unexpected SBOM list %s", w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handler.SBOMs(w, httptest.NewRequest(http.MethodGet, "/api/store/sboms/"+img.Digest+"?format=cyclonedx", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "pkg:apk/alpine/zlib@1.3.1-r0") {
+		t.Errorf("expected the CycloneDX document, got %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handler.SBOMs(w, httptest.NewRequest(http.MethodGet, "/api/store/sboms/sha256:"+strings.Repeat("0", 64), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an image without an SBOM, got %d", w.Code)
+	}
+
+	// Saving with the SBOMs attaches them to a sub-store, not the haul.
+	body, _ := json.Marshal(SaveRequest{IncludeSBOMs: true})
+	w = httptest.NewRecorder()
+	handler.Save(w, httptest.NewRequest(http.MethodPost, "/api/store/save", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), `"sboms":1`) {
+		t.Fatalf("expected 202 with one SBOM attached, got %d: %s", w.Code, w.Body.String())
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ = handler.JobRunner.GetJob(ctx, resp.JobID)
+	subset := job.Args[len(job.Args)-1]
+	if subset == haul.StoreDir {
+		t.Fatal("expected the save to use a sub-store")
+	}
+	defer os.RemoveAll(subset)
+	st, err := ocistore.Open(subset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, a := range st.Artifacts {
+		if a.Kind == ocistore.KindSBOM && a.Subject != nil && a.Subject.Digest == img.Digest && len(a.Layers) == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an SBOM artifact for the image, got %+v", st.Artifacts)
+	}
+	if st, _ := ocistore.Open(haul.StoreDir); len(st.Artifacts) != 1 {
+		t.Errorf("expected the haul's own store to be untouched, got %d artifacts", len(st.Artifacts))
+	}
+}
+
+func TestVulnDBImportScanAndReport(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	img := writeAlpineImage(t, haul.StoreDir)
+	noop := func(string, ...interface{}) {}
+
+	w := httptest.NewRecorder()
+	handler.VulnScan(w, httptest.NewRequest(http.MethodPost, "/api/store/vulnscan", strings.NewReader(`{}`)))
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 before any import, got %d", w.Code)
+	}
+
+	bundle := `[
+		{"id":"CVE-2024-0001","summary":"musl overflow","affected":[{"package":{"ecosystem":"Alpine:v3.19","name":"musl"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"},{"fixed":"1.2.4-r3"}]}]}],
+			"severity":[{"type":"CVSS_V3","score":"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}]},
+		{"id":"CVE-2024-0002","summary":"zlib issue","database_specific":{"severity":"LOW"},
+			"affected":[{"package":{"ecosystem":"Alpine:v3.19","name":"zlib"},"versions":["1.3.1-r0"]}]},
+		{"id":"CVE-2024-0003","summary":"fixed already","affected":[{"package":{"ecosystem":"Alpine:v3.19","name":"zlib"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"},{"fixed":"1.3-r0"}]}]}]}
+	]`
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("file", "alpine.json")
+	_, _ = part.Write([]byte(bundle))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/store/vulndb/import", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w = httptest.NewRecorder()
+	handler.VulnDBImport(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct{ JobID int64 }
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ := handler.JobRunner.GetJob(ctx, resp.JobID)
+	if _, err := handler.runVulnDBImport(ctx, job, noop); err != nil {
+		t.Fatalf("importing: %v", err)
+	}
+	if _, err := os.Stat(job.Args[len(job.Args)-1]); !os.IsNotExist(err) {
+		t.Error("expected the uploaded bundle to be removed after the import")
+	}
+
+	w = httptest.NewRecorder()
+	handler.VulnScan(w, httptest.NewRequest(http.MethodPost, "/api/store/vulnscan", strings.NewReader(`{}`)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ = handler.JobRunner.GetJob(ctx, resp.JobID)
+	if _, err := handler.runVulnScan(ctx, job, noop); err != nil {
+		t.Fatalf("scanning: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	handler.Vulnerabilities(w, httptest.NewRequest(http.MethodGet, "/api/store/vulnerabilities", nil))
+	var report vulns.Report
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	if report.Counts.Total != 2 || report.Counts.Critical != 1 || report.Counts.Low != 1 {
+		t.Fatalf("unexpected counts %+v: %s", report.Counts, w.Body.String())
+	}
+	if len(report.Images) != 1 || report.Images[0].Digest != img.Digest || report.Images[0].Packages != 2 {
+		t.Errorf("unexpected images %+v", report.Images)
+	}
+
+	w = httptest.NewRecorder()
+	handler.Vulnerabilities(w, httptest.NewRequest(http.MethodGet, "/api/store/vulnerabilities?severity=critical&fixable=true&format=csv", nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Header().Get("Content-Type") != "text/csv" || len(lines) != 2 || !strings.Contains(lines[1], "CVE-2024-0001") {
+		t.Errorf("unexpected CSV export: %s", w.Body.String())
+	}
+}
+
+func TestInfoSignatureStatus(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	img := writeAlpineImage(t, haul.StoreDir)
+
+	info := func() *ImageSignatures {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.GetInfo(w, httptest.NewRequest(http.MethodGet, "/api/store/info", nil))
+		var si StoreInfo
+		_ = json.Unmarshal(w.Body.Bytes(), &si)
+		if len(si.Images) != 1 || si.Images[0].Signatures == nil {
+			t.Fatalf("expected one image with a signature status, got %s", w.Body.String())
+		}
+		return si.Images[0].Signatures
+	}
+	if s := info(); s.Status != SignatureUnsigned {
+		t.Errorf("expected unsigned, got %+v", s)
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	sign := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		sig, _ := ecdsa.SignASN1(rand.Reader, key, sum[:])
+		return base64.StdEncoding.EncodeToString(sig)
+	}
+	// A signature of this image, and one copied from another image.
+	own, _ := json.Marshal(signing.NewSimpleSigning("docker.io/library/alpine", img.Digest))
+	copied, _ := json.Marshal(signing.NewSimpleSigning("docker.io/library/alpine", "sha256:"+strings.Repeat("0", 64)))
+	_, err := ocistore.Attach(haul.StoreDir, ocistore.Attachment{
+		Subject: img, Repository: "docker.io/library/alpine", Suffix: "sig", Kind: ocistore.KindAnnotationSigs,
+		Layers: []ocistore.AttachmentLayer{
+			{MediaType: signing.MediaTypeSimpleSigning, Data: own, Annotations: map[string]string{signing.AnnotationSignature: sign(own)}},
+			{MediaType: signing.MediaTypeSimpleSigning, Data: copied, Annotations: map[string]string{signing.AnnotationSignature: sign(copied)}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt := []byte(`{"_type":"https://in-toto.io/Statement/v1","predicateType":"https://slsa.dev/provenance/v1",` +
+		`"subject":[{"name":"alpine","digest":{"sha256":"` + strings.TrimPrefix(img.Digest, "sha256:") + `"}}]}`)
+	env, _ := json.Marshal(map[string]interface{}{
+		"payloadType": "application/vnd.in-toto+json",
+		"payload":     base64.StdEncoding.EncodeToString(stmt),
+		"signatures":  []map[string]string{{"sig": sign(signing.PAE("application/vnd.in-toto+json", stmt))}},
+	})
+	if _, err := ocistore.Attach(haul.StoreDir, ocistore.Attachment{
+		Subject: img, Repository: "docker.io/library/alpine", Suffix: "att", Kind: ocistore.KindAnnotationAtts,
+		Layers: []ocistore.AttachmentLayer{{MediaType: signing.MediaTypeDSSE, Data: env}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the public key the signatures are present but unverified.
+	if s := info(); s.Status != SignatureSigned || s.Signatures != 2 || s.Attestations != 1 || s.VerifiedSignatures != 0 {
+		t.Errorf("expected signed and unverified, got %+v", s)
+	}
+
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	_ = os.MkdirAll(handler.Cfg.CosignKeysDir, 0755)
+	_ = os.WriteFile(filepath.Join(handler.Cfg.CosignKeysDir, "cosign.pub"), pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+	s := info()
+	if s.Status != SignatureVerified || s.VerifiedSignatures != 1 || s.VerifiedAttestations != 1 || len(s.KeyIDs) != 1 {
+		t.Errorf("expected one verified signature and attestation, got %+v", s)
+	}
+	if len(s.PredicateTypes) != 1 || s.PredicateTypes[0] != "https://slsa.dev/provenance/v1" {
+		t.Errorf("unexpected predicate types %v", s.PredicateTypes)
+	}
+}
+
+func TestCosignKeysAndSign(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	img := writeAlpineImage(t, haul.StoreDir)
+
+	addKey := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.CosignKeys(w, httptest.NewRequest(http.MethodPost, "/api/store/cosign-keys", strings.NewReader(body)))
+		return w
+	}
+	w := addKey(`{"name":"release"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("generating key: %d %s", w.Code, w.Body.String())
+	}
+	var key signing.Key
+	_ = json.Unmarshal(w.Body.Bytes(), &key)
+	if w := addKey(`{"name":"release"}`); w.Code != http.StatusConflict {
+		t.Errorf("expected a duplicate name to conflict, got %d", w.Code)
+	}
+
+	// A cosign.key imports with its password, and not without it.
+	imported, _ := signing.GenerateCosignKey()
+	enc, _ := imported.Encrypt([]byte("s3cret"))
+	body, _ := json.Marshal(CosignKeyRequest{Name: "ci", PrivateKey: string(enc), Password: "wrong"})
+	if w := addKey(string(body)); w.Code != http.StatusBadRequest {
+		t.Errorf("expected a wrong password to be refused, got %d", w.Code)
+	}
+	body, _ = json.Marshal(CosignKeyRequest{Name: "ci", PrivateKey: string(enc), Password: "s3cret"})
+	if w := addKey(string(body)); w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), imported.ID) {
+		t.Errorf("importing key: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.CosignKeyByID(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/store/cosign-keys/%d/public", key.ID), nil))
+	if w.Code != http.StatusOK || w.Header().Get("X-Key-Id") != key.KeyID || !strings.Contains(w.Body.String(), "BEGIN PUBLIC KEY") {
+		t.Errorf("public key: %d %s", w.Code, w.Body.String())
+	}
+
+	sign := func() map[string]interface{} {
+		t.Helper()
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"keyId":%d,"annotations":{"release":"1.0"}}`, key.ID)
+		handler.Sign(w, httptest.NewRequest(http.MethodPost, "/api/store/sign", strings.NewReader(body)))
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("sign: %d %s", w.Code, w.Body.String())
+		}
+		var resp map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		job, _ := handler.JobRunner.GetJob(ctx, int64(resp["jobId"].(float64)))
+		out, err := handler.runSign(ctx, job, func(string, ...interface{}) {})
+		if err != nil {
+			t.Fatalf("runSign: %v", err)
+		}
+		// Signing refuses to run beside other jobs, so settle this one.
+		_, _ = db.Exec(`UPDATE jobs SET status = 'succeeded' WHERE id = ?`, job.ID)
+		var result map[string]interface{}
+		_ = json.Unmarshal([]byte(out), &result)
+		return result
+	}
+	if r := sign(); r["signed"] != float64(1) || r["skipped"] != float64(0) {
+		t.Errorf("unexpected result %v", r)
+	}
+	if r := sign(); r["signed"] != float64(0) || r["skipped"] != float64(1) {
+		t.Errorf("expected signing again to be skipped, got %v", r)
+	}
+
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigs := 0
+	for i := range st.Artifacts {
+		a := &st.Artifacts[i]
+		if a.Kind != ocistore.KindSignature {
+			continue
+		}
+		sigs++
+		if want := "docker.io/library/alpine:" + ocistore.AttachmentTag(img.Digest, "sig"); a.Name != want {
+			t.Errorf("signature named %s, want %s", a.Name, want)
+		}
+	}
+	if sigs != 1 {
+		t.Errorf("expected one signature artifact, got %d", sigs)
+	}
+
+	w = httptest.NewRecorder()
+	handler.GetInfo(w, httptest.NewRequest(http.MethodGet, "/api/store/info", nil))
+	var si StoreInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &si)
+	if len(si.Images) != 1 || si.Images[0].Signatures == nil {
+		t.Fatalf("expected one image, got %s", w.Body.String())
+	}
+	if s := si.Images[0].Signatures; s.Status != SignatureVerified || s.Signatures != 1 || len(s.KeyIDs) != 1 || s.KeyIDs[0] != key.KeyID {
+		t.Errorf("expected the image verified by the stored key, got %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	handler.CosignKeyByID(w, httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/store/cosign-keys/%d", key.ID), nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("delete: %d %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handler.CosignKeyByID(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/store/cosign-keys/%d", key.ID), nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected the deleted key to be gone, got %d", w.Code)
+	}
+}
+
+func TestRetagKeepsContentsInSync(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	img := writeAlpineImage(t, haul.StoreDir)
+	if err := handler.trackStoreContents(ctx, haul, "site.tar.zst"); err != nil {
+		t.Fatal(err)
+	}
+
+	retag := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.Retag(w, httptest.NewRequest(http.MethodPost, "/api/store/retag", strings.NewReader(body)))
+		return w
+	}
+	if w := retag(`{"ops":[{"action":"remove","from":"docker.io/library/alpine:3.19"}]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected removing the only reference to be refused, got %d %s", w.Code, w.Body.String())
+	}
+
+	body := `{"ops":[{"action":"add","from":"docker.io/library/alpine:3.19","to":"docker.io/library/alpine:3"}],` +
+		`"rules":[{"type":"prefix","from":"docker.io/library/","to":"registry.local/mirror/"}]}`
+	w := retag(strings.TrimSuffix(body, "}") + `,"dryRun":true}`)
+	var preview RetagReport
+	_ = json.Unmarshal(w.Body.Bytes(), &preview)
+	if w.Code != http.StatusOK || len(preview.Changes) != 2 {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body.String())
+	}
+	if st, _ := ocistore.Open(haul.StoreDir); st.Artifacts[0].Name != "docker.io/library/alpine:3.19" {
+		t.Errorf("dry run changed the store: %s", st.Artifacts[0].Name)
+	}
+
+	w = retag(body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("retag: %d %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ := handler.JobRunner.GetJob(ctx, int64(resp["jobId"].(float64)))
+	if _, err := handler.runRetag(ctx, job, func(string, ...interface{}) {}); err != nil {
+		t.Fatalf("runRetag: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT name, digest, source_haul FROM store_contents WHERE haul_id = ? ORDER BY name`, haul.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name, digest string
+		var source sql.NullString
+		_ = rows.Scan(&name, &digest, &source)
+		if digest != img.Digest || source.String != "site.tar.zst" {
+			t.Errorf("%s: digest %s, source %q", name, digest, source.String)
+		}
+		got = append(got, name)
+	}
+	if strings.Join(got, ",") != "registry.local/mirror/alpine:3,registry.local/mirror/alpine:3.19" {
+		t.Errorf("tracked contents = %v", got)
+	}
+}
+
+func TestPrunePlatforms(t *testing.T) {
+	handler, db := setupTestHandler(t)
+	ctx := context.Background()
+	haul, _ := handler.Hauls.EnsureDefault(ctx)
+	writeBlob := func(mediaType string, data []byte) ocistore.Descriptor {
+		sum := sha256.Sum256(data)
+		_ = os.MkdirAll(filepath.Join(haul.StoreDir, "blobs", "sha256"), 0755)
+		_ = os.WriteFile(filepath.Join(haul.StoreDir, "blobs", "sha256", hex.EncodeToString(sum[:])), data, 0644)
+		return ocistore.Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	}
+	var platforms []ocistore.Descriptor
+	for _, arch := range []string{"amd64", "arm64", "s390x"} {
+		config := writeBlob(ocistore.MediaTypeOCIConfig, []byte(`{"os":"linux","architecture":"`+arch+`"}`))
+		layer := writeBlob("application/vnd.oci.image.layer.v1.tar+gzip", []byte(strings.Repeat(arch, 100)))
+		manifest, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: []ocistore.Descriptor{layer}})
+		m := writeBlob(ocistore.MediaTypeOCIManifest, manifest)
+		m.Platform = &ocistore.Platform{OS: "linux", Architecture: arch}
+		platforms = append(platforms, m)
+	}
+	data, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIIndex, Manifests: platforms})
+	img := writeBlob(ocistore.MediaTypeOCIIndex, data)
+	img.Annotations = map[string]string{ocistore.AnnotationContainerdName: "docker.io/library/app:1"}
+	index, _ := json.Marshal(ocistore.Index{SchemaVersion: 2, Manifests: []ocistore.Descriptor{img}})
+	_ = os.WriteFile(filepath.Join(haul.StoreDir, "index.json"), index, 0644)
+	if err := handler.trackStoreContents(ctx, haul, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	prune := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.PrunePlatforms(w, httptest.NewRequest(http.MethodPost, "/api/store/prune-platforms", strings.NewReader(body)))
+		return w
+	}
+	if w := prune(`{"dryRun":true}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected platforms to be required without a haul default, got %d", w.Code)
+	}
+	w := prune(`{"platforms":["linux/amd64"],"dryRun":true}`)
+	var preview PruneReport
+	_ = json.Unmarshal(w.Body.Bytes(), &preview)
+	if w.Code != http.StatusOK || len(preview.Images) != 1 || len(preview.Images[0].Removed) != 2 || preview.Images[0].SavedBytes <= 1000 {
+		t.Fatalf("dry run: %d %s", w.Code, w.Body.String())
+	}
+
+	w = prune(`{"platforms":["linux/amd64"]}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("prune: %d %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	job, _ := handler.JobRunner.GetJob(ctx, int64(resp["jobId"].(float64)))
+	out, err := handler.runPrunePlatforms(ctx, job, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatalf("runPrunePlatforms: %v", err)
+	}
+	var report PruneReport
+	_ = json.Unmarshal([]byte(out), &report)
+	pruned := report.Images[0].PrunedDigest
+
+	w = httptest.NewRecorder()
+	handler.GetInfo(w, httptest.NewRequest(http.MethodGet, "/api/store/info", nil))
+	var si StoreInfo
+	_ = json.Unmarshal(w.Body.Bytes(), &si)
+	if len(si.Images) != 1 || si.Images[0].Digest != pruned || strings.Join(si.Images[0].Platforms, ",") != "linux/amd64" {
+		t.Errorf("unexpected images after pruning: %s", w.Body.String())
+	}
+	var tracked string
+	_ = db.QueryRow(`SELECT digest FROM store_contents WHERE haul_id = ? AND name = ?`, haul.ID, "docker.io/library/app:1").Scan(&tracked)
+	if tracked != pruned {
+		t.Errorf("tracked digest %s, want %s", tracked, pruned)
+	}
+	st, _ := ocistore.Open(haul.StoreDir)
+	if gc, _ := st.PlanGC(); gc.OrphanBytes < preview.Images[0].SavedBytes {
+		t.Errorf("gc frees %d bytes, preview promised %d", gc.OrphanBytes, preview.Images[0].SavedBytes)
+	}
+}
+
+// writeTestChart packages files (paths relative to the chart directory) as a
+// chart the way hauler stores one and adds it to the layout's index.json.
+func writeTestChart(t *testing.T, dir, name, version string, files map[string]string) ocistore.Descriptor {
+	t.Helper()
+	var tgz bytes.Buffer
+	gz := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gz)
+	for path, data := range files {
+		_ = tw.WriteHeader(&tar.Header{Name: name + "/" + path, Mode: 0644, Size: int64(len(data))})
+		_, _ = tw.Write([]byte(data))
+	}
+	_ = tw.Close()
+	_ = gz.Close()
+	writeBlob := func(mediaType string, data []byte) ocistore.Descriptor {
+		sum := sha256.Sum256(data)
+		_ = os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0755)
+		_ = os.WriteFile(filepath.Join(dir, "blobs", "sha256", hex.EncodeToString(sum[:])), data, 0644)
+		return ocistore.Descriptor{MediaType: mediaType, Digest: "sha256:" + hex.EncodeToString(sum[:]), Size: int64(len(data))}
+	}
+	config := writeBlob(ocistore.MediaTypeChartConfig, []byte(`{"name":"`+name+`","version":"`+version+`","apiVersion":"v2"}`))
+	layer := writeBlob(ocistore.MediaTypeChartLayer, tgz.Bytes())
+	layer.Annotations = map[string]string{ocistore.AnnotationTitle: name + "-" + version + ".tgz"}
+	manifest, _ := json.Marshal(ocistore.Manifest{SchemaVersion: 2, MediaType: ocistore.MediaTypeOCIManifest, Config: config, Layers: []ocistore.Descriptor{layer}})
+	m := writeBlob(ocistore.MediaTypeOCIManifest, manifest)
+	m.Annotations = map[string]string{ocistore.AnnotationContainerdName: "hauler/" + name + ":" + version}
+
+	idx := ocistore.Index{SchemaVersion: 2}
+	if data, err := os.ReadFile(filepath.Join(dir, "index.json")); err == nil {
+		_ = json.Unmarshal(data, &idx)
+	}
+	idx.Manifests = append(idx.Manifests, m)
+	data, _ := json.Marshal(idx)
+	_ = os.WriteFile(filepath.Join(dir, "index.json"), data, 0644)
+	return m
+}
+
+func TestChartByDigest(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	haul, _ := handler.Hauls.EnsureDefault(context.Background())
+	writeTestChart(t, haul.StoreDir, "redis", "17.3.4", map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: redis\nversion: 17.3.4\n",
+	})
+	app := writeTestChart(t, haul.StoreDir, "app", "1.0.0", map[string]string{
+		"Chart.yaml": "apiVersion: v2\nname: app\nversion: 1.0.0\nappVersion: \"2.1\"\n" +
+			"dependencies:\n- name: redis\n  version: 17.x.x\n  repository: https://charts.bitnami.com/bitnami\n" +
+			"- name: memcached\n  version: 6.x.x\n  repository: https://charts.bitnami.com/bitnami\n",
+		"values.yaml":               "# Image to run\nimage: nginx:1.25\n",
+		"templates/deployment.yaml": "kind: Deployment\n",
+		"templates/_helpers.tpl":    "{{/* helpers */}}\n",
+		"README.md":                 "# App\n",
+	})
+
+	get := func(digest string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ChartByDigest(w, httptest.NewRequest(http.MethodGet, "/api/store/charts/"+digest, nil))
+		return w
+	}
+	w := get(app.Digest)
+	if w.Code != http.StatusOK {
+		t.Fatalf("chart: %d %s", w.Code, w.Body.String())
+	}
+	var info charts.Info
+	_ = json.Unmarshal(w.Body.Bytes(), &info)
+	if info.Name != "app" || info.Metadata.AppVersion != "2.1" || info.Readme != "# App\n" || !strings.HasPrefix(info.Values, "# Image to run") {
+		t.Errorf("unexpected chart info %+v", info)
+	}
+	if len(info.Templates) != 2 || len(info.Dependencies) != 2 || info.MissingDependencies != 1 {
+		t.Errorf("templates %+v, dependencies %+v", info.Templates, info.Dependencies)
+	}
+	if d := info.Dependencies[0]; d.Name != "redis" || !d.InHaul || d.HaulVersion != "17.3.4" {
+		t.Errorf("redis dependency = %+v", d)
+	}
+
+	if w := get("sha256:" + strings.Repeat("0", 64)); w.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown digest to be 404, got %d", w.Code)
+	}
+	if w := get("nonsense"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected an invalid digest to be 400, got %d", w.Code)
+	}
+}
+
+func TestChartImages(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	haul, _ := handler.Hauls.EnsureDefault(context.Background())
+	writeAlpineImage(t, haul.StoreDir)
+	app := writeTestChart(t, haul.StoreDir, "app", "1.0.0", map[string]string{
+		"Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"values.yaml": "image: alpine:3.19\nsidecar: nginx:1.25\n",
+		"templates/deployment.yaml": "kind: Deployment\nspec:\n  template:\n    spec:\n      containers:\n" +
+			"      - name: app\n        image: {{ .Values.image }}\n      - name: sidecar\n        image: {{ .Values.sidecar }}\n",
+	})
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ChartByDigest(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return w
+	}
+	w := post("/api/store/charts/"+app.Digest+"/images", `{}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("chart images: %d %s", w.Code, w.Body.String())
+	}
+	var report charts.ImageReport
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	if len(report.Images) != 2 || !report.Images[0].InHaul || report.Images[0].HaulRef != "docker.io/library/alpine:3.19" || report.Images[1].InHaul {
+		t.Fatalf("unexpected images %+v", report.Images)
+	}
+	if len(report.Missing) != 1 || report.Missing[0] != "nginx:1.25" ||
+		!strings.Contains(report.Manifest, "kind: Images") || !strings.Contains(report.Manifest, "- name: nginx:1.25") {
+		t.Errorf("missing %v, manifest:\n%s", report.Missing, report.Manifest)
+	}
+
+	// Supplied values are rendered instead of the defaults.
+	w = post("/api/store/charts/"+app.Digest+"/images", `{"values": "sidecar: docker.io/library/alpine:3.19\n"}`)
+	report = charts.ImageReport{}
+	_ = json.Unmarshal(w.Body.Bytes(), &report)
+	if len(report.Images) != 2 || len(report.Missing) != 0 || report.Manifest != "" {
+		t.Errorf("with values: %+v", report)
+	}
+
+	if w := post("/api/store/charts/"+app.Digest+"/images", `{"values": "image: [unclosed"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected invalid values to be 422, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	handler.ChartByDigest(w, httptest.NewRequest(http.MethodGet, "/api/store/charts/"+app.Digest+"/images", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET to be 405, got %d", w.Code)
+	}
+}
+
+func TestDefaultHaulAfterTrashingLastHaul(t *testing.T) {
+	handler, _ := setupTestHandler(t)
+	haul, err := handler.Hauls.EnsureDefault(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := handler.Hauls.Delete(context.Background(), haul.ID); err != nil {
+		t.Fatalf("deleting haul: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.GetInfo(w, httptest.NewRequest(http.MethodGet, "/api/store/info", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected a request without haulId to fall back to a new default haul, got %d %s", w.Code, w.Body.String())
+	}
+	hauls, _ := handler.Hauls.List(context.Background())
+	if len(hauls) != 1 || hauls[0].ID == haul.ID {
+		t.Errorf("expected one new live haul, got %+v", hauls)
+	}
+}
@@ -0,0 +1,403 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+)
+
+// importPathTask is the job command that imports an archive from a
+// server-side path under one of the configured import roots.
+const importPathTask = "store-import-path"
+
+// ImportRoot is one configured import root.
+type ImportRoot struct {
+	Path      string `json:"path"`
+	Available bool   `json:"available"` // exists and is a directory, e.g. the media is mounted
+}
+
+// BrowseEntry is a directory or archive listed by Browse.
+type BrowseEntry struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Dir      bool      `json:"dir,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Modified time.Time `json:"modified"`
+	SHA256   string    `json:"sha256,omitempty"` // as listed by a SHA256SUMS beside it
+	Signed   bool      `json:"signed,omitempty"` // has a manifest and signature beside it
+}
+
+// ImportPathRequest is the body of POST /api/store/import-path.
+type ImportPathRequest struct {
+	HaulID           int64  `json:"haulId,omitempty"`
+	Path             string `json:"path"`
+	Mode             string `json:"mode,omitempty"`   // "copy", "hardlink", or "" to hardlink when possible (copy for signed imports)
+	SHA256           string `json:"sha256,omitempty"` // expected; defaults to the SHA256SUMS beside the file
+	RequireSignature bool   `json:"requireSignature,omitempty"`
+	Clear            bool   `json:"clear,omitempty"`
+}
+
+// ImportRoots handles GET /api/store/import-roots.
+func (h *Handler) ImportRoots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	roots := make([]ImportRoot, 0, len(h.Cfg.ImportRoots))
+	for _, p := range h.Cfg.ImportRoots {
+		info, err := os.Stat(p)
+		roots = append(roots, ImportRoot{Path: p, Available: err == nil && info.IsDir()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"roots": roots})
+}
+
+// Browse handles GET /api/store/browse?path=..., listing the subdirectories
+// and .tar.zst archives of a directory inside an import root.
+func (h *Handler) Browse(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	dir, err := h.resolveImportPath(r.URL.Query().Get("path"))
+	if err != nil {
+		importPathError(w, err)
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		importPathError(w, err)
+		return
+	}
+
+	dirs, archives := []BrowseEntry{}, []BrowseEntry{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(dir, e.Name())) // follows symlinks
+		if err != nil {
+			continue
+		}
+		entry := BrowseEntry{Name: e.Name(), Path: filepath.Join(dir, e.Name()), Modified: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Dir = true
+			dirs = append(dirs, entry)
+		case info.Mode().IsRegular() && strings.HasSuffix(strings.ToLower(e.Name()), ".tar.zst"):
+			entry.Size = info.Size()
+			entry.SHA256, _ = hauls.LookupChecksum(dir, e.Name())
+			_, merr := os.Stat(filepath.Join(dir, hauls.ManifestName(e.Name())))
+			_, serr := os.Stat(filepath.Join(dir, hauls.SignatureName(e.Name())))
+			entry.Signed = merr == nil && serr == nil
+			archives = append(archives, entry)
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Name < dirs[j].Name })
+	sort.Slice(archives, func(i, j int) bool { return archives[i].Name < archives[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"path": dir, "dirs": dirs, "archives": archives})
+}
+
+// ImportPath handles POST /api/store/import-path, starting a job that copies
+// (or hardlinks) an archive from an import root into the haul's archives,
+// checks its checksum, and then loads it.
+func (h *Handler) ImportPath(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req ImportPathRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Mode != "" && req.Mode != "copy" && req.Mode != "hardlink" {
+		http.Error(w, "mode must be copy or hardlink", http.StatusBadRequest)
+		return
+	}
+	if req.Mode == "hardlink" && (h.Cfg.RequireSignedImports || req.RequireSignature) {
+		http.Error(w, "A signed import is copied so it cannot change after it is verified; hardlink mode is not allowed", http.StatusBadRequest)
+		return
+	}
+	src, err := h.resolveImportPath(req.Path)
+	if err != nil {
+		importPathError(w, err)
+		return
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		importPathError(w, err)
+		return
+	}
+	if !info.Mode().IsRegular() || !strings.HasSuffix(strings.ToLower(src), ".tar.zst") {
+		http.Error(w, "Only .tar.zst files can be imported", http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.writable(w, haul) {
+		return
+	}
+	// A hardlink costs no space, but it may turn out to be a copy.
+	if !h.preflight(w, r, haul, 2*info.Size()) {
+		return
+	}
+
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10)}
+	if req.Mode != "" {
+		args = append(args, "--mode", req.Mode)
+	}
+	if req.SHA256 != "" {
+		args = append(args, "--sha256", req.SHA256)
+	}
+	if req.RequireSignature {
+		args = append(args, "--require-signature")
+	}
+	if req.Clear {
+		args = append(args, "--clear")
+	}
+	args = append(args, src)
+	job, err := h.JobRunner.CreateJob(r.Context(), importPathTask, args, nil)
+	if err != nil {
+		log.Printf("Error creating import job: %v", err)
+		http.Error(w, "Failed to create import job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":    job.ID,
+		"message":  "Import job started",
+		"filename": filepath.Base(src),
+		"size":     info.Size(),
+		"haulId":   haul.ID,
+	})
+}
+
+// runImportPath is the store-import-path task. The archive is hardlinked or
+// copied (with progress) into a partial file beside the haul's archives and
+// hashed, always copied when a signature is required; a mismatch with the expected sha256, or with a manifest and
+// signature found beside the source, fails the job. It then hands over to
+// the same install-and-load step as an uploaded import.
+func (h *Handler) runImportPath(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(importPathTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	mode := fs.String("mode", "", "copy or hardlink")
+	want := fs.String("sha256", "", "expected sha256")
+	requireSig := fs.Bool("require-signature", false, "require a signed manifest")
+	clear := fs.Bool("clear", false, "clear the store before loading")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected one path, got %d", fs.NArg())
+	}
+	src, err := h.resolveImportPath(fs.Arg(0))
+	if err != nil {
+		return "", err
+	}
+	haul, storeArgs, err := h.resolveHaul(ctx, *haulID)
+	if err != nil {
+		return "", err
+	}
+	if err := haul.Writable(); err != nil {
+		return "", err
+	}
+	if err := h.Hauls.Locked(haul.ID); err != nil {
+		return "", err
+	}
+
+	dir, filename := filepath.Dir(src), filepath.Base(src)
+	check := importCheck{SHA256: *want, Require: h.Cfg.RequireSignedImports || *requireSig}
+	source := "request"
+	if check.SHA256 == "" {
+		if sum, ok := hauls.LookupChecksum(dir, filename); ok {
+			check.SHA256, source = sum, hauls.ChecksumFile
+		}
+	}
+	if manifest, err := os.ReadFile(filepath.Join(dir, hauls.ManifestName(filename))); err == nil {
+		check.Manifest = manifest
+		if sig, err := os.ReadFile(filepath.Join(dir, hauls.SignatureName(filename))); err == nil {
+			check.Signature = strings.TrimSpace(string(sig))
+		}
+	}
+
+	if err := os.MkdirAll(haul.ArchivesDir(), 0755); err != nil {
+		return "", err
+	}
+	// A hardlink shares the source's bytes, which a writer on the import root
+	// could change between verification and loading; a required signature is
+	// only worth checking on a private copy.
+	how := *mode
+	if check.Require {
+		if how == "hardlink" {
+			return "", fmt.Errorf("signed imports are copied; hardlink mode is not allowed")
+		}
+		how = "copy"
+	}
+
+	// A name of its own, so two imports of the same file never share it.
+	tmp, err := os.CreateTemp(haul.ArchivesDir(), ".import-*.part")
+	if err != nil {
+		return "", err
+	}
+	part := tmp.Name()
+	tmp.Close()
+	how, sum, size, err := importFile(ctx, src, part, how, logf)
+	if err != nil {
+		os.Remove(part)
+		return "", err
+	}
+	logf("%s %s (%d bytes), sha256 %s", how, src, size, sum)
+
+	keyID, err := h.verifyImport(check, sum, size)
+	if err != nil {
+		os.Remove(part)
+		return "", err
+	}
+	switch {
+	case keyID != "":
+		logf("Manifest signature verified (key %s)", keyID)
+	case check.SHA256 != "":
+		logf("Checksum matches %s", source)
+	default:
+		logf("No checksum or signed manifest to verify against")
+	}
+
+	load, err := h.installImport(ctx, haul, storeArgs, part, filename, sum, size, keyID, check, *clear, job.ID)
+	if err != nil {
+		return "", err
+	}
+	logf("Load job %d started", load.ID)
+
+	out, _ := json.Marshal(map[string]interface{}{
+		"haulId": haul.ID, "source": src, "filename": filename, "size": size, "sha256": sum,
+		"mode": how, "signedBy": keyID, "loadJobId": load.ID,
+	})
+	return string(out), nil
+}
+
+// importFile hardlinks or copies src to dst and hashes it, logging progress.
+// Without an explicit mode a hardlink is tried first. It returns which was
+// done ("Hardlinked" or "Copied").
+func importFile(ctx context.Context, src, dst, mode string, logf func(string, ...interface{})) (string, string, int64, error) {
+	// A leftover partial file may itself be a hardlink to a source; never
+	// write through it.
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return "", "", 0, err
+	}
+	how, verb := "Copied", "Copied"
+	if mode != "copy" {
+		err := os.Link(src, dst)
+		switch {
+		case err == nil:
+			how, verb = "Hardlinked", "Hashed"
+		case mode == "hardlink":
+			return "", "", 0, fmt.Errorf("hardlinking %s: %w", src, err)
+		default:
+			logf("Cannot hardlink (%v); copying instead", err)
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return "", "", 0, err
+	}
+	hash := sha256.New()
+	progress := &progressWriter{total: info.Size(), logf: func(done, total int64) {
+		logf("%s %d/%d bytes (%d%%)", verb, done, total, done*100/max(total, 1))
+	}}
+	w := io.MultiWriter(hash, progress)
+	var out *os.File
+	if how == "Copied" {
+		if out, err = os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644); err != nil {
+			return "", "", 0, err
+		}
+		w = io.MultiWriter(out, hash, progress)
+	}
+	n, err := io.Copy(w, ctxReader{ctx, in})
+	if out != nil {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return "", "", 0, err
+	}
+	return how, hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// progressWriter reports bytes written about every 10%.
+type progressWriter struct {
+	total, done int64
+	step        int64
+	logf        func(done, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.done += int64(len(b))
+	if pct := p.done * 10 / max(p.total, 1); pct > p.step || p.done == p.total {
+		p.step = pct
+		p.logf(p.done, p.total)
+	}
+	return len(b), nil
+}
+
+// ctxReader stops a long copy when its context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// resolveImportPath resolves p within the configured import roots; see
+// hauls.ResolveImportPath.
+func (h *Handler) resolveImportPath(p string) (string, error) {
+	return hauls.ResolveImportPath(h.Cfg.ImportRoots, p)
+}
+
+func importPathError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, hauls.ErrOutsideRoots):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case os.IsNotExist(err):
+		http.Error(w, "Path not found", http.StatusNotFound)
+	default:
+		http.Error(w, "Failed to read path: "+err.Error(), http.StatusBadRequest)
+	}
+}
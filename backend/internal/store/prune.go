@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// pruneTask is the job command that prunes platforms from a haul's images.
+const pruneTask = "store-prune-platforms"
+
+// PruneRequest is the body of POST /api/store/prune-platforms.
+type PruneRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+	// Platforms to keep, e.g. ["linux/amd64"]; by default the haul's
+	// default platform.
+	Platforms []string `json:"platforms,omitempty"`
+	// KeepAttachments keeps the signatures, attestations and SBOMs of the
+	// original indexes, which also keeps their blobs from being collected.
+	KeepAttachments bool `json:"keepAttachments,omitempty"`
+	// DryRun returns the plan, with the bytes saved per image, without
+	// starting a job.
+	DryRun bool `json:"dryRun,omitempty"`
+	// Optional selection of images; by default every image is pruned.
+	ocistore.Selection
+}
+
+// PruneReport is the result of pruning platforms.
+type PruneReport struct {
+	ocistore.PrunePlan
+	HaulID int64 `json:"haulId"`
+	DryRun bool  `json:"dryRun"`
+}
+
+// PrunePlatforms handles POST /api/store/prune-platforms, which rewrites the
+// multi-arch images of a haul to keep only some platforms. A dry run answers
+// with the plan; otherwise a job rewrites the indexes under the haul's write
+// lock. The removed platforms' blobs stay until garbage is collected.
+func (h *Handler) PrunePlatforms(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req PruneRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Platforms) == 0 {
+		req.Platforms = splitPlatforms(haul.Defaults.Platform)
+		if len(req.Platforms) == 0 {
+			http.Error(w, "platforms are required (the haul has no default platform)", http.StatusBadRequest)
+			return
+		}
+	}
+	if !req.DryRun && !h.writable(w, haul) {
+		return
+	}
+
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	plan, err := planPrune(st, req.Platforms, req.Selection, req.KeepAttachments)
+	if err != nil {
+		http.Error(w, "Invalid prune: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(PruneReport{PrunePlan: *plan, HaulID: haul.ID, DryRun: true})
+		return
+	}
+
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10), "--platforms", strings.Join(req.Platforms, ",")}
+	if req.KeepAttachments {
+		args = append(args, "--keep-attachments")
+	}
+	if !req.Selection.Empty() {
+		sel, _ := json.Marshal(req.Selection)
+		args = append(args, "--select", string(sel))
+	}
+	job, err := h.JobRunner.CreateJob(r.Context(), pruneTask, args, nil)
+	if err != nil {
+		log.Printf("Error creating prune job: %v", err)
+		http.Error(w, "Failed to create prune job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":      job.ID,
+		"message":    "Platform pruning started",
+		"platforms":  req.Platforms,
+		"savedBytes": plan.SavedBytes,
+		"haulId":     haul.ID,
+	})
+}
+
+// splitPlatforms splits a comma-separated platform list.
+func splitPlatforms(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// planPrune plans pruning the images sel picks.
+func planPrune(st *ocistore.Store, platforms []string, sel ocistore.Selection, keepAttachments bool) (*ocistore.PrunePlan, error) {
+	picked, err := st.Select(sel)
+	if err != nil {
+		return nil, err
+	}
+	return st.PlanPrune(platforms, picked, keepAttachments)
+}
+
+// runPrunePlatforms is the store-prune-platforms task. Like retagging, it
+// rewrites index.json and so refuses to run beside other jobs on the haul.
+func (h *Handler) runPrunePlatforms(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(pruneTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	platforms := fs.String("platforms", "", "platforms to keep (comma-separated)")
+	keepAttachments := fs.Bool("keep-attachments", false, "keep attachments of the original indexes")
+	selJSON := fs.String("select", "", "selection (JSON)")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	var sel ocistore.Selection
+	if *selJSON != "" {
+		if err := json.Unmarshal([]byte(*selJSON), &sel); err != nil {
+			return "", fmt.Errorf("parsing selection: %w", err)
+		}
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	if err := haul.Writable(); err != nil {
+		return "", err
+	}
+	unlock, err := h.Hauls.Lock(haul.ID, fmt.Sprintf("prune job %d", job.ID))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	active, err := h.activeJobs(ctx, haul.ID, job.ID)
+	if err != nil {
+		return "", err
+	}
+	if active > 0 {
+		return "", fmt.Errorf("haul %q has %d other queued or running job(s); retry when they finish", haul.Name, active)
+	}
+
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	plan, err := planPrune(st, splitPlatforms(*platforms), sel, *keepAttachments)
+	if err != nil {
+		return "", err
+	}
+	for _, img := range plan.Images {
+		switch {
+		case img.Skipped != "":
+			logf("%s: skipped, %s", img.Name, img.Skipped)
+		case len(img.Removed) == 0:
+			logf("%s: nothing to prune", img.Name)
+		default:
+			logf("%s: kept %s, removed %s (%d bytes), %d attachment(s) of the original dropped",
+				img.Name, strings.Join(img.Kept, ", "), strings.Join(img.Removed, ", "), img.SavedBytes, img.Attachments)
+		}
+	}
+	if plan.Changed() {
+		if err := plan.Apply(haul.StoreDir); err != nil {
+			return "", err
+		}
+		if err := h.pruneContents(ctx, haul, plan.Images); err != nil {
+			log.Printf("Warning: failed to update tracked contents for haul %d: %v", haul.ID, err)
+		}
+	}
+	logf("Collect garbage to free %d bytes", plan.SavedBytes)
+
+	out, _ := json.Marshal(PruneReport{PrunePlan: *plan, HaulID: haul.ID})
+	return string(out), nil
+}
+
+// pruneContents points a haul's store_contents rows at the pruned indexes.
+func (h *Handler) pruneContents(ctx context.Context, haul *hauls.Haul, images []ocistore.ImagePrune) error {
+	for _, img := range images {
+		if img.PrunedDigest == "" {
+			continue
+		}
+		if _, err := h.JobRunner.DB().ExecContext(ctx, `
+			UPDATE OR IGNORE store_contents SET digest = ? WHERE haul_id = ? AND content_type = ? AND digest = ?`,
+			img.PrunedDigest, haul.ID, string(ocistore.KindImage), img.Digest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// retagTask is the job command that rewrites a haul's references.
+const retagTask = "store-retag"
+
+// RetagRequest is the body of POST /api/store/retag. Ops run first, in
+// order, then rules.
+type RetagRequest struct {
+	HaulID int64                `json:"haulId,omitempty"`
+	Ops    []ocistore.RetagOp   `json:"ops,omitempty"`
+	Rules  []ocistore.RetagRule `json:"rules,omitempty"`
+	// DryRun returns the changes without starting a job.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// retagSpec is the part of a RetagRequest passed to the job.
+type retagSpec struct {
+	Ops   []ocistore.RetagOp   `json:"ops,omitempty"`
+	Rules []ocistore.RetagRule `json:"rules,omitempty"`
+}
+
+// RetagReport is the result of a retag.
+type RetagReport struct {
+	HaulID  int64                  `json:"haulId"`
+	DryRun  bool                   `json:"dryRun"`
+	Changes []ocistore.RetagChange `json:"changes"`
+}
+
+// Retag handles POST /api/store/retag, which adds, changes or removes the
+// references of content already in a haul without pulling it again. A dry
+// run answers with the changes; otherwise a job rewrites index.json under
+// the haul's write lock and updates its tracked contents.
+func (h *Handler) Retag(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req RetagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.Ops) == 0 && len(req.Rules) == 0 {
+		http.Error(w, "ops or rules are required", http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !req.DryRun && !h.writable(w, haul) {
+		return
+	}
+
+	// Plan now so mistakes are reported before a job is queued.
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	plan, err := st.PlanRetag(req.Ops, req.Rules)
+	if err != nil {
+		http.Error(w, "Invalid retag: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.DryRun {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(RetagReport{HaulID: haul.ID, DryRun: true, Changes: plan.Changes})
+		return
+	}
+
+	spec, _ := json.Marshal(retagSpec{Ops: req.Ops, Rules: req.Rules})
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10), "--spec", string(spec)}
+	job, err := h.JobRunner.CreateJob(r.Context(), retagTask, args, nil)
+	if err != nil {
+		log.Printf("Error creating retag job: %v", err)
+		http.Error(w, "Failed to create retag job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "Retag job started",
+		"changes": len(plan.Changes),
+		"haulId":  haul.ID,
+	})
+}
+
+// runRetag is the store-retag task. It plans again under the write lock, as
+// the store may have changed since the request, and refuses to run beside
+// other jobs on the haul since they may rewrite index.json too.
+func (h *Handler) runRetag(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(retagTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	specJSON := fs.String("spec", "", "ops and rules (JSON)")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	var spec retagSpec
+	if err := json.Unmarshal([]byte(*specJSON), &spec); err != nil {
+		return "", fmt.Errorf("parsing retag spec: %w", err)
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	if err := haul.Writable(); err != nil {
+		return "", err
+	}
+	unlock, err := h.Hauls.Lock(haul.ID, fmt.Sprintf("retag job %d", job.ID))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	active, err := h.activeJobs(ctx, haul.ID, job.ID)
+	if err != nil {
+		return "", err
+	}
+	if active > 0 {
+		return "", fmt.Errorf("haul %q has %d other queued or running job(s); retry when they finish", haul.Name, active)
+	}
+
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	plan, err := st.PlanRetag(spec.Ops, spec.Rules)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range plan.Changes {
+		switch {
+		case c.From == "":
+			logf("Added %s (%s)", c.To, c.Digest)
+		case c.To == "":
+			logf("Removed %s (%s)", c.From, c.Digest)
+		default:
+			logf("Renamed %s to %s", c.From, c.To)
+		}
+	}
+	if len(plan.Changes) > 0 {
+		if err := plan.Apply(haul.StoreDir); err != nil {
+			return "", err
+		}
+		if err := h.retagContents(ctx, haul, plan.Changes); err != nil {
+			log.Printf("Warning: failed to update tracked contents for haul %d: %v", haul.ID, err)
+		}
+	}
+	logf("Retagged %d reference(s)", len(plan.Changes))
+
+	out, _ := json.Marshal(RetagReport{HaulID: haul.ID, Changes: plan.Changes})
+	return string(out), nil
+}
+
+// retagContents applies retag changes to a haul's store_contents rows. New
+// names inherit the provenance of the name they were made from.
+func (h *Handler) retagContents(ctx context.Context, haul *hauls.Haul, changes []ocistore.RetagChange) error {
+	tx, err := h.JobRunner.DB().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, c := range changes {
+		if !c.Kind.Content() {
+			continue
+		}
+		if c.To != "" {
+			var source sql.NullString
+			if c.From != "" {
+				_ = tx.QueryRowContext(ctx, `
+					SELECT source_haul FROM store_contents
+					WHERE haul_id = ? AND content_type = ? AND name = ? AND digest = ?`,
+					haul.ID, string(c.Kind), c.From, c.Digest).Scan(&source)
+			} else {
+				// An added reference inherits from any other name of the artifact.
+				_ = tx.QueryRowContext(ctx, `
+					SELECT source_haul FROM store_contents
+					WHERE haul_id = ? AND content_type = ? AND digest = ? AND source_haul IS NOT NULL LIMIT 1`,
+					haul.ID, string(c.Kind), c.Digest).Scan(&source)
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT OR IGNORE INTO store_contents (haul_id, content_type, name, digest, source_haul)
+				VALUES (?, ?, ?, ?, ?)`,
+				haul.ID, string(c.Kind), c.To, c.Digest, source); err != nil {
+				return err
+			}
+		}
+		if c.From != "" {
+			if _, err := tx.ExecContext(ctx, `
+				DELETE FROM store_contents WHERE haul_id = ? AND content_type = ? AND name = ? AND digest = ?`,
+				haul.ID, string(c.Kind), c.From, c.Digest); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
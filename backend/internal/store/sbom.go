@@ -0,0 +1,305 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+)
+
+// sbomTask is the job command that generates SBOMs for a haul's images.
+const sbomTask = "store-sbom"
+
+// SBOMRequest is the body of POST /api/store/sbom.
+type SBOMRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+	// Force regenerates SBOMs that already exist.
+	Force bool `json:"force,omitempty"`
+	// Optional selection of images; by default every image is covered.
+	ocistore.Selection
+}
+
+// SBOMSummary is one generated SBOM as listed by GET /api/store/sboms.
+type SBOMSummary struct {
+	Image       string         `json:"image"`
+	Digest      string         `json:"digest"`
+	Platform    string         `json:"platform,omitempty"`
+	Distro      *sbom.Distro   `json:"distro,omitempty"`
+	Packages    int            `json:"packages"`
+	Types       map[string]int `json:"types"` // packages per ecosystem
+	GeneratedAt string         `json:"generatedAt"`
+}
+
+// imageManifest is one single-platform image manifest to scan.
+type imageManifest struct {
+	Image    string
+	Digest   string
+	Platform string
+	Desc     ocistore.Descriptor
+}
+
+// GenerateSBOMs handles POST /api/store/sbom, starting a job that scans the
+// haul's images and writes an SBOM per image manifest beside the haul.
+func (h *Handler) GenerateSBOMs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req SBOMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10)}
+	if req.Force {
+		args = append(args, "--force")
+	}
+	if !req.Selection.Empty() {
+		sel, _ := json.Marshal(req.Selection)
+		args = append(args, "--select", string(sel))
+	}
+	job, err := h.JobRunner.CreateJob(r.Context(), sbomTask, args, nil)
+	if err != nil {
+		log.Printf("Error creating SBOM job: %v", err)
+		http.Error(w, "Failed to create SBOM job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "SBOM job started",
+		"haulId":  haul.ID,
+	})
+}
+
+// runSBOM is the store-sbom task. Each image manifest (every platform of a
+// multi-arch image) is scanned layer by layer; SBOMs that already exist are
+// kept unless forced, since a manifest digest pins its content.
+func (h *Handler) runSBOM(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(sbomTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	force := fs.Bool("force", false, "regenerate existing SBOMs")
+	selection := fs.String("select", "", "selection (JSON)")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	var sel ocistore.Selection
+	if *selection != "" {
+		if err := json.Unmarshal([]byte(*selection), &sel); err != nil {
+			return "", fmt.Errorf("parsing selection: %w", err)
+		}
+	}
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	images, err := imageManifests(st, sel)
+	if err != nil {
+		return "", err
+	}
+	logf("Scanning %d image manifest(s) in haul %s", len(images), haul.Slug)
+
+	var generated []SBOMSummary
+	skipped, failed := 0, 0
+	for i, img := range images {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if !*force {
+			if _, err := sbom.Load(haul.SBOMDir(), img.Digest); err == nil {
+				skipped++
+				continue
+			}
+		}
+		inv, err := sbom.Scan(ctx, st, img.Digest, h.Cfg.HaulerTempDir)
+		if err != nil {
+			logf("[%d/%d] %s %s: %v", i+1, len(images), img.Image, img.Platform, err)
+			failed++
+			continue
+		}
+		inv.Image, inv.Platform = img.Image, img.Platform
+		if err := sbom.Save(haul.SBOMDir(), inv); err != nil {
+			return "", err
+		}
+		logf("[%d/%d] %s %s: %d package(s)", i+1, len(images), img.Image, img.Platform, len(inv.Packages))
+		generated = append(generated, summarizeSBOM(inv))
+	}
+	if failed > 0 {
+		logf("%d image manifest(s) could not be scanned", failed)
+	}
+	out, _ := json.Marshal(map[string]interface{}{
+		"haulId": haul.ID, "generated": generated, "skipped": skipped, "failed": failed,
+	})
+	return string(out), nil
+}
+
+// imageManifests lists the single-platform manifests of the images sel picks
+// (every image when sel is empty). Platforms absent from the store are left
+// out.
+func imageManifests(st *ocistore.Store, sel ocistore.Selection) ([]imageManifest, error) {
+	picked, err := st.Select(sel)
+	if err != nil {
+		return nil, err
+	}
+	var out []imageManifest
+	for _, i := range picked {
+		a := &st.Artifacts[i]
+		if a.Kind != ocistore.KindImage || a.Error != "" {
+			continue
+		}
+		if len(a.Manifests) == 0 {
+			out = append(out, imageManifest{Image: a.Name, Digest: a.Digest,
+				Desc: ocistore.Descriptor{MediaType: a.MediaType, Digest: a.Digest, Size: st.Index.Manifests[i].Size}})
+			continue
+		}
+		for _, m := range a.Manifests {
+			if m.Missing || m.Platform == nil {
+				continue
+			}
+			out = append(out, imageManifest{Image: a.Name, Digest: m.Digest, Platform: m.Platform.String(),
+				Desc: ocistore.Descriptor{MediaType: m.MediaType, Digest: m.Digest, Size: m.Size}})
+		}
+	}
+	return out, nil
+}
+
+func summarizeSBOM(inv *sbom.Inventory) SBOMSummary {
+	s := SBOMSummary{
+		Image: inv.Image, Digest: inv.Digest, Platform: inv.Platform, Distro: inv.Distro,
+		Packages: len(inv.Packages), Types: map[string]int{}, GeneratedAt: inv.GeneratedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	for _, p := range inv.Packages {
+		s.Types[p.Type]++
+	}
+	return s
+}
+
+// SBOMs handles GET /api/store/sboms?haulId=N, listing the haul's SBOMs, and
+// GET /api/store/sboms/{digest}?haulId=N&format=spdx|cyclonedx|inventory,
+// returning one.
+func (h *Handler) SBOMs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	haulID, _ := strconv.ParseInt(r.URL.Query().Get("haulId"), 10, 64)
+	haul, _, err := h.resolveHaul(r.Context(), haulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	digest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/store/sboms"), "/")
+	if digest == "" {
+		invs, err := sbom.List(haul.SBOMDir())
+		if err != nil {
+			http.Error(w, "Failed to list SBOMs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		out := make([]SBOMSummary, 0, len(invs))
+		for _, inv := range invs {
+			out = append(out, summarizeSBOM(inv))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"haulId": haul.ID, "sboms": out})
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = string(sbom.FormatSPDX)
+	}
+	var path, contentType string
+	if format == "inventory" {
+		if !ocistore.ValidDigest(digest) {
+			http.Error(w, "Invalid digest", http.StatusBadRequest)
+			return
+		}
+		path, contentType = sbom.Dir(haul.SBOMDir(), digest)+"/"+sbom.InventoryFile, "application/json"
+	} else {
+		if path, err = sbom.Document(haul.SBOMDir(), digest, sbom.Format(format)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		contentType = sbom.Formats[sbom.Format(format)]
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		http.Error(w, "No SBOM for "+digest, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read SBOM: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s.json"`, strings.Replace(digest, ":", "-", 1), format))
+	_, _ = w.Write(data)
+}
+
+// attachSBOMs adds the haul's generated SBOMs to the layout at dir (a
+// temporary sub-store being saved) as cosign-style ".sbom" artifacts of the
+// images they describe, one layer per format. It returns how many images
+// got one.
+func attachSBOMs(haul *hauls.Haul, dir string) (int, error) {
+	st, err := ocistore.Open(dir)
+	if err != nil {
+		return 0, err
+	}
+	images, err := imageManifests(st, ocistore.Selection{})
+	if err != nil {
+		return 0, err
+	}
+	attached := 0
+	for _, img := range images {
+		var layers []ocistore.AttachmentLayer
+		for _, f := range []sbom.Format{sbom.FormatSPDX, sbom.FormatCycloneDX} {
+			path, err := sbom.Document(haul.SBOMDir(), img.Digest, f)
+			if err != nil {
+				return attached, err
+			}
+			data, err := os.ReadFile(path)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return attached, err
+			}
+			layers = append(layers, ocistore.AttachmentLayer{MediaType: sbom.Formats[f], Data: data})
+		}
+		if len(layers) == 0 {
+			continue
+		}
+		_, err := ocistore.Attach(dir, ocistore.Attachment{
+			Subject: img.Desc, Repository: ocistore.Repository(img.Image), Suffix: "sbom",
+			Kind: ocistore.KindAnnotationSboms, ArtifactType: sbom.Formats[sbom.FormatSPDX], Layers: layers,
+		})
+		if err != nil {
+			return attached, err
+		}
+		attached++
+	}
+	return attached, nil
+}
@@ -0,0 +1,414 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/signing"
+)
+
+// signTask is the job command that signs images in a haul.
+const signTask = "store-sign"
+
+// CosignKeyRequest is the body of POST /api/store/cosign-keys. Without a
+// private key a new ECDSA P-256 key is generated; otherwise the PEM key is
+// imported, e.g. a cosign.key together with its password.
+type CosignKeyRequest struct {
+	Name       string `json:"name"`
+	PrivateKey string `json:"privateKey,omitempty"`
+	Password   string `json:"password,omitempty"`
+}
+
+// SignRequest is the body of POST /api/store/sign.
+type SignRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+	KeyID  int64 `json:"keyId"`
+	// Annotations are added to each signature's payload, as with
+	// "cosign sign -a key=value".
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Force signs images this key has already signed again.
+	Force bool `json:"force,omitempty"`
+	// Optional selection of images; by default every image is signed.
+	ocistore.Selection
+}
+
+// keystore returns the cosign keystore. Its password comes from the
+// configuration, or else from a secret generated on first use. Keys stored
+// under the generated secret before a password was configured are
+// re-encrypted with the password; if the password opens neither, the
+// keystore does not open.
+func (h *Handler) keystore() (*signing.Keystore, error) {
+	h.keystoreMu.Lock()
+	defer h.keystoreMu.Unlock()
+	if h.keys != nil {
+		return h.keys, nil
+	}
+	secretPath := filepath.Join(filepath.Dir(h.Cfg.SigningKeyPath), "keystore.secret")
+	password := []byte(h.Cfg.KeystorePassword)
+	var previous []byte
+	if len(password) > 0 {
+		previous, _ = signing.ReadSecret(secretPath)
+	} else {
+		var err error
+		if password, err = signing.LoadOrCreateSecret(secretPath); err != nil {
+			return nil, err
+		}
+	}
+	ks := signing.NewKeystore(h.JobRunner.DB(), password)
+	migrated, err := ks.Unlock(context.Background(), previous)
+	if errors.Is(err, signing.ErrWrongPassword) {
+		source := "the generated " + secretPath
+		if h.Cfg.KeystorePassword != "" {
+			source = "HAULER_UI_KEYSTORE_PASSWORD"
+		}
+		return nil, fmt.Errorf("the stored cosign keys do not open with %s: %w", source, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if migrated > 0 {
+		log.Printf("Re-encrypted %d cosign key(s) with HAULER_UI_KEYSTORE_PASSWORD", migrated)
+	}
+	h.keys = ks
+	return h.keys, nil
+}
+
+// OpenKeystore opens the cosign keystore, checking that its password opens
+// the stored keys, so a mismatch is reported at startup rather than on the
+// first signing.
+func (h *Handler) OpenKeystore() error {
+	_, err := h.keystore()
+	return err
+}
+
+// CosignKeys handles /api/store/cosign-keys: GET lists the signing keys and
+// POST generates or imports one.
+func (h *Handler) CosignKeys(w http.ResponseWriter, r *http.Request) {
+	ks, err := h.keystore()
+	if err != nil {
+		http.Error(w, "Failed to open keystore: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		keys, err := ks.List(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to list keys: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(keys)
+	case http.MethodPost:
+		var req CosignKeyRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxManifestSize)).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var signer *signing.CosignSigner
+		if req.PrivateKey == "" {
+			if signer, err = signing.GenerateCosignKey(); err != nil {
+				http.Error(w, "Failed to generate key: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			key, err := signing.ParsePrivateKey([]byte(req.PrivateKey), []byte(req.Password))
+			if err == nil {
+				signer, err = signing.NewCosignSigner(key)
+			}
+			if err != nil {
+				http.Error(w, "Invalid private key: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		key, err := ks.Add(r.Context(), req.Name, signer, req.PrivateKey != "")
+		switch {
+		case errors.Is(err, signing.ErrKeyExists):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "Failed to store key: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CosignKeyByID handles /api/store/cosign-keys/{id}: GET describes the key,
+// GET .../public returns its PEM public key (cosign.pub) and DELETE removes
+// it. Signatures already made with a deleted key stay in the store.
+func (h *Handler) CosignKeyByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/store/cosign-keys/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || (action != "" && action != "public") {
+		http.NotFound(w, r)
+		return
+	}
+	ks, err := h.keystore()
+	if err != nil {
+		http.Error(w, "Failed to open keystore: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		key, err := ks.Get(r.Context(), id)
+		if err != nil {
+			cosignKeyError(w, err)
+			return
+		}
+		if action == "public" {
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pub"`, key.Name))
+			w.Header().Set("X-Key-Id", key.KeyID)
+			_, _ = w.Write([]byte(key.PublicKey))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(key)
+	case http.MethodDelete:
+		if action != "" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := ks.Delete(r.Context(), id); err != nil {
+			cosignKeyError(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"message": "Key deleted", "id": id})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func cosignKeyError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to read key: "+err.Error(), http.StatusInternalServerError)
+}
+
+// Sign handles POST /api/store/sign, starting a job that signs the selected
+// images of a haul with a stored key. Signatures are written into the store
+// as cosign "sha256-<hex>.sig" artifacts, so they are saved and served with
+// their images.
+func (h *Handler) Sign(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req SignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.writable(w, haul) {
+		return
+	}
+	ks, err := h.keystore()
+	if err != nil {
+		http.Error(w, "Failed to open keystore: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := ks.Get(r.Context(), req.KeyID); err != nil {
+		cosignKeyError(w, err)
+		return
+	}
+
+	args := []string{"--haul", strconv.FormatInt(haul.ID, 10), "--key", strconv.FormatInt(req.KeyID, 10)}
+	if req.Force {
+		args = append(args, "--force")
+	}
+	if len(req.Annotations) > 0 {
+		a, _ := json.Marshal(req.Annotations)
+		args = append(args, "--annotations", string(a))
+	}
+	if !req.Selection.Empty() {
+		sel, _ := json.Marshal(req.Selection)
+		args = append(args, "--select", string(sel))
+	}
+	job, err := h.JobRunner.CreateJob(r.Context(), signTask, args, nil)
+	if err != nil {
+		log.Printf("Error creating sign job: %v", err)
+		http.Error(w, "Failed to create sign job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "Signing started",
+		"haulId":  haul.ID,
+	})
+}
+
+// runSign is the store-sign task. Each image gets a signature of its
+// top-level digest (the index of a multi-arch image, as cosign signs it),
+// added as a layer of the image's .sig artifact beside any signatures it
+// already carries.
+func (h *Handler) runSign(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(signTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	keyID := fs.Int64("key", 0, "key id")
+	force := fs.Bool("force", false, "sign again with a key that already signed")
+	annotations := fs.String("annotations", "", "payload annotations (JSON object)")
+	selJSON := fs.String("select", "", "selection (JSON)")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	var sel ocistore.Selection
+	if *selJSON != "" {
+		if err := json.Unmarshal([]byte(*selJSON), &sel); err != nil {
+			return "", fmt.Errorf("parsing selection: %w", err)
+		}
+	}
+	var optional map[string]interface{}
+	if *annotations != "" {
+		if err := json.Unmarshal([]byte(*annotations), &optional); err != nil {
+			return "", fmt.Errorf("parsing annotations: %w", err)
+		}
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	if err := haul.Writable(); err != nil {
+		return "", err
+	}
+	unlock, err := h.Hauls.Lock(haul.ID, fmt.Sprintf("sign job %d", job.ID))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	active, err := h.activeJobs(ctx, haul.ID, job.ID)
+	if err != nil {
+		return "", err
+	}
+	if active > 0 {
+		return "", fmt.Errorf("haul %q has %d other queued or running job(s); retry when they finish", haul.Name, active)
+	}
+
+	ks, err := h.keystore()
+	if err != nil {
+		return "", err
+	}
+	key, err := ks.Get(ctx, *keyID)
+	if err != nil {
+		return "", fmt.Errorf("key %d: %w", *keyID, err)
+	}
+	signer, err := ks.Signer(ctx, key.ID)
+	if err != nil {
+		return "", err
+	}
+	st, err := ocistore.Open(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	picked, err := st.Select(sel)
+	if err != nil {
+		return "", err
+	}
+
+	signed, skipped := 0, 0
+	for _, i := range picked {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		a := &st.Artifacts[i]
+		if a.Kind != ocistore.KindImage {
+			continue
+		}
+		if a.Name == "" {
+			logf("Skipping unnamed image %s", a.Digest)
+			continue
+		}
+		repo := ocistore.Repository(a.Name)
+		layers, kind, already := existingSignatures(st, a, repo, signer, *force)
+		if already {
+			logf("%s: already signed with %s", a.Name, key.Name)
+			skipped++
+			continue
+		}
+		payload := signing.NewSimpleSigning(repo, a.Digest)
+		payload.Optional = optional
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", err
+		}
+		sig, err := signer.Sign(data)
+		if err != nil {
+			return "", err
+		}
+		layers = append(layers, ocistore.AttachmentLayer{
+			MediaType:   signing.MediaTypeSimpleSigning,
+			Data:        data,
+			Annotations: map[string]string{signing.AnnotationSignature: sig},
+		})
+		if _, err := ocistore.Attach(haul.StoreDir, ocistore.Attachment{
+			Subject: st.Index.Manifests[i], Repository: repo, Suffix: "sig", Kind: kind, Layers: layers,
+		}); err != nil {
+			return "", fmt.Errorf("%s: %w", a.Name, err)
+		}
+		logf("%s: signed %s with %s (%s)", a.Name, a.Digest, key.Name, key.KeyID)
+		signed++
+	}
+	logf("Signed %d image(s), %d already signed", signed, skipped)
+	out, _ := json.Marshal(map[string]interface{}{"haulId": haul.ID, "keyId": key.KeyID, "signed": signed, "skipped": skipped})
+	return string(out), nil
+}
+
+// existingSignatures returns the layers of the image's .sig artifact under
+// repo, which a new signature is added to, and the kind annotation to keep
+// on it. already is set when signer has signed the image before; with force
+// its earlier signatures are dropped instead, to be replaced.
+func existingSignatures(st *ocistore.Store, a *ocistore.Artifact, repo string, signer *signing.CosignSigner, force bool) (layers []ocistore.AttachmentLayer, kind string, already bool) {
+	kind = ocistore.KindAnnotationSigs
+	name := repo + ":" + ocistore.AttachmentTag(a.Digest, "sig")
+	for _, att := range st.Attachments(a) {
+		if att.Kind != ocistore.KindSignature || att.Name != name {
+			continue
+		}
+		kind = att.Annotations[ocistore.AnnotationKind]
+		for _, l := range attachmentLayers(st, att) {
+			data, err := st.ReadBlob(l.Digest)
+			if err != nil {
+				continue
+			}
+			if l.MediaType == signing.MediaTypeSimpleSigning {
+				if _, err := signing.VerifyAny(data, l.Annotations[signing.AnnotationSignature], []signing.Verifier{signer.Verifier}); err == nil {
+					if p, err := signing.ParseSimpleSigning(data); err == nil && p.Critical.Image.DockerManifestDigest == a.Digest {
+						if !force {
+							return nil, "", true
+						}
+						continue
+					}
+				}
+			}
+			layers = append(layers, ocistore.AttachmentLayer{MediaType: l.MediaType, Data: data, Annotations: l.Annotations})
+		}
+	}
+	return layers, kind, false
+}
@@ -0,0 +1,267 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/signing"
+)
+
+// Signature statuses of an image.
+const (
+	// SignatureUnsigned: no signatures or attestations are attached.
+	SignatureUnsigned = "unsigned"
+	// SignatureSigned: signatures or attestations are attached, but none
+	// verifies against a configured key.
+	SignatureSigned = "signed"
+	// SignatureVerified: at least one signature or attestation verifies
+	// against a configured key and names the image's digest.
+	SignatureVerified = "verified"
+)
+
+// ImageSignatures summarizes the supply-chain artifacts attached to an image
+// and how many of its signatures verified.
+type ImageSignatures struct {
+	Status               string   `json:"status"`
+	Signatures           int      `json:"signatures"`
+	Attestations         int      `json:"attestations"`
+	SBOMs                int      `json:"sboms"`
+	Referrers            int      `json:"referrers"`
+	VerifiedSignatures   int      `json:"verifiedSignatures"`
+	VerifiedAttestations int      `json:"verifiedAttestations"`
+	KeyIDs               []string `json:"keyIds,omitempty"` // keys that verified
+	PredicateTypes       []string `json:"predicateTypes,omitempty"`
+	// Keyless is set when signatures carry a certificate instead of being
+	// made with a key; those cannot be verified offline.
+	Keyless bool `json:"keyless,omitempty"`
+}
+
+// signatureCache keeps each store's verification results until its index or
+// the configured keys change.
+type signatureCache struct {
+	mu      sync.Mutex
+	entries map[string]signatureCacheEntry // by store directory
+}
+
+type signatureCacheEntry struct {
+	st     *ocistore.Store
+	keys   string
+	images map[string]*ImageSignatures
+}
+
+// cosignVerifiers returns the keys image signatures are verified against:
+// those in the cosign keys directory, the signing keys held by the server,
+// and the haul's default verification key. Unreadable keys are logged and
+// skipped so the store stays browsable.
+func (h *Handler) cosignVerifiers(ctx context.Context, haul *hauls.Haul) []signing.Verifier {
+	keys, err := signing.LoadVerifiers(h.Cfg.CosignKeysDir)
+	if err != nil {
+		log.Printf("Warning: loading cosign keys: %v", err)
+	}
+	ks, err := h.keystore()
+	if err == nil {
+		var held []signing.Verifier
+		if held, err = ks.Verifiers(ctx); err == nil {
+			keys = append(keys, held...)
+		}
+	}
+	if err != nil {
+		log.Printf("Warning: loading signing keys: %v", err)
+	}
+	if path := haul.Defaults.Key; path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var v signing.Verifier
+			if v, err = signing.ParseVerifier(data); err == nil {
+				keys = append(keys, v)
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: haul %s default key %s: %v", haul.Slug, path, err)
+		}
+	}
+	return keys
+}
+
+// imageSignatures returns the signature summary of every image in a haul's
+// store, keyed by image digest.
+func (h *Handler) imageSignatures(ctx context.Context, haul *hauls.Haul, st *ocistore.Store) map[string]*ImageSignatures {
+	keys := h.cosignVerifiers(ctx, haul)
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.ID
+	}
+	sort.Strings(ids)
+	fingerprint := strings.Join(ids, ",")
+
+	h.sigCache.mu.Lock()
+	defer h.sigCache.mu.Unlock()
+	if e, ok := h.sigCache.entries[st.Dir]; ok && e.st == st && e.keys == fingerprint {
+		return e.images
+	}
+	images := verifyImages(st, keys)
+	if h.sigCache.entries == nil {
+		h.sigCache.entries = map[string]signatureCacheEntry{}
+	}
+	h.sigCache.entries[st.Dir] = signatureCacheEntry{st: st, keys: fingerprint, images: images}
+	return images
+}
+
+// verifyImages associates each image with its attached artifacts and
+// verifies their signatures against keys.
+func verifyImages(st *ocistore.Store, keys []signing.Verifier) map[string]*ImageSignatures {
+	out := map[string]*ImageSignatures{}
+	for i := range st.Artifacts {
+		a := &st.Artifacts[i]
+		if a.Kind != ocistore.KindImage {
+			continue
+		}
+		digests := map[string]bool{a.Digest: true}
+		for _, m := range a.Manifests {
+			digests[m.Digest] = true
+		}
+		s := &ImageSignatures{}
+		for _, att := range st.Attachments(a) {
+			switch att.Kind {
+			case ocistore.KindSBOM:
+				s.SBOMs++
+				continue
+			case ocistore.KindReferrer:
+				s.Referrers++
+			}
+			for _, l := range attachmentLayers(st, att) {
+				s.check(st, l, digests, keys)
+			}
+		}
+		switch {
+		case s.VerifiedSignatures+s.VerifiedAttestations > 0:
+			s.Status = SignatureVerified
+		case s.Signatures+s.Attestations > 0:
+			s.Status = SignatureSigned
+		default:
+			s.Status = SignatureUnsigned
+		}
+		sort.Strings(s.KeyIDs)
+		sort.Strings(s.PredicateTypes)
+		out[a.Digest] = s
+	}
+	return out
+}
+
+// attachmentLayers returns the layers of an attached artifact, reading the
+// manifests of one stored as an index.
+func attachmentLayers(st *ocistore.Store, a *ocistore.Artifact) []ocistore.Descriptor {
+	layers := a.Layers
+	for _, m := range a.Manifests {
+		if mf, err := st.Manifest(m.Digest); err == nil {
+			layers = append(layers, mf.Layers...)
+		}
+	}
+	return layers
+}
+
+// check counts one signature or attestation layer and verifies it. A
+// signature only counts as verified if its payload names one of the image's
+// digests, so a valid signature copied from another image does not.
+func (s *ImageSignatures) check(st *ocistore.Store, l ocistore.Descriptor, digests map[string]bool, keys []signing.Verifier) {
+	switch l.MediaType {
+	case signing.MediaTypeSimpleSigning:
+		s.Signatures++
+		if l.Annotations[signing.AnnotationCertificate] != "" {
+			s.Keyless = true
+		}
+		payload, err := st.ReadBlob(l.Digest)
+		if err != nil {
+			return
+		}
+		id, err := signing.VerifyAny(payload, l.Annotations[signing.AnnotationSignature], keys)
+		if err != nil {
+			return
+		}
+		if p, err := signing.ParseSimpleSigning(payload); err == nil && digests[p.Critical.Image.DockerManifestDigest] {
+			s.VerifiedSignatures++
+			s.addKey(id)
+		}
+	case signing.MediaTypeDSSE:
+		s.Attestations++
+		if pt := l.Annotations[signing.AnnotationPredicateType]; pt != "" {
+			s.addPredicate(pt)
+		}
+		data, err := st.ReadBlob(l.Digest)
+		if err != nil {
+			return
+		}
+		var env signing.Envelope
+		if json.Unmarshal(data, &env) == nil {
+			s.checkEnvelope(&env, digests, keys)
+		}
+	case signing.MediaTypeSigstoreBundle:
+		data, err := st.ReadBlob(l.Digest)
+		if err != nil {
+			return
+		}
+		var bundle struct {
+			DSSEEnvelope *signing.Envelope `json:"dsseEnvelope"`
+		}
+		if json.Unmarshal(data, &bundle) != nil {
+			return
+		}
+		if bundle.DSSEEnvelope == nil {
+			// A message signature over the image digest; bundles are made
+			// keyless, which cannot be verified offline.
+			s.Signatures++
+			s.Keyless = true
+			return
+		}
+		s.Attestations++
+		s.checkEnvelope(bundle.DSSEEnvelope, digests, keys)
+	}
+}
+
+// checkEnvelope verifies a DSSE attestation whose statement must name one of
+// the image's digests.
+func (s *ImageSignatures) checkEnvelope(env *signing.Envelope, digests map[string]bool, keys []signing.Verifier) {
+	payload, id, err := env.Verify(keys)
+	var stmt signing.Statement
+	if payload == nil || json.Unmarshal(payload, &stmt) != nil {
+		return
+	}
+	if stmt.PredicateType != "" {
+		s.addPredicate(stmt.PredicateType)
+	}
+	if err != nil {
+		return
+	}
+	for d := range digests {
+		if stmt.Covers(d) {
+			s.VerifiedAttestations++
+			s.addKey(id)
+			return
+		}
+	}
+}
+
+func (s *ImageSignatures) addKey(id string) {
+	for _, k := range s.KeyIDs {
+		if k == id {
+			return
+		}
+	}
+	s.KeyIDs = append(s.KeyIDs, id)
+}
+
+func (s *ImageSignatures) addPredicate(t string) {
+	for _, p := range s.PredicateTypes {
+		if p == t {
+			return
+		}
+	}
+	s.PredicateTypes = append(s.PredicateTypes, t)
+}
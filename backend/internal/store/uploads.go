@@ -0,0 +1,534 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+)
+
+const (
+	// maxChunkSize bounds one PATCH of an upload.
+	maxChunkSize = 256 << 20
+	// chunkTimeout replaces the server's short read timeout while a chunk
+	// streams in over a slow link.
+	chunkTimeout = 15 * time.Minute
+)
+
+// UploadRequest is the body of POST /api/store/uploads, which starts a
+// resumable archive upload. SHA256 may instead be given when completing;
+// Manifest, Signature and RequireSignature are checked as for Import.
+type UploadRequest struct {
+	HaulID           int64  `json:"haulId,omitempty"`
+	Filename         string `json:"filename"`
+	Size             int64  `json:"size"`
+	SHA256           string `json:"sha256,omitempty"`
+	Manifest         string `json:"manifest,omitempty"`
+	Signature        string `json:"signature,omitempty"`
+	RequireSignature bool   `json:"requireSignature,omitempty"`
+	Clear            bool   `json:"clear,omitempty"`
+}
+
+// Upload is the state of a resumable upload.
+type Upload struct {
+	ID        string     `json:"id"`
+	HaulID    int64      `json:"haulId"`
+	Filename  string     `json:"filename"`
+	Size      int64      `json:"size"`
+	Received  int64      `json:"received"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"` // nil when uploads never expire
+
+	opts      UploadRequest
+	hashState []byte
+}
+
+// partPath is where an upload's data accumulates: hidden in the haul's
+// archives directory, so finishing it is a rename.
+func (u *Upload) partPath(haul *hauls.Haul) string {
+	return filepath.Join(haul.ArchivesDir(), ".upload-"+u.ID+".part")
+}
+
+// Uploads handles /api/store/uploads: POST starts an upload, GET lists the
+// unfinished ones (optionally for one "?haul=").
+func (h *Handler) Uploads(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		h.createUpload(w, r)
+	case http.MethodGet:
+		haulID, _ := strconv.ParseInt(r.URL.Query().Get("haul"), 10, 64)
+		uploads, err := h.listUploads(r.Context(), haulID)
+		if err != nil {
+			http.Error(w, "Failed to list uploads: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(uploads)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// UploadByID handles /api/store/uploads/{id}: GET or HEAD report progress
+// (also as an Upload-Offset header), PATCH appends a chunk at the offset
+// given by the Upload-Offset header, DELETE abandons the upload, and
+// POST /api/store/uploads/{id}/complete finishes it.
+func (h *Handler) UploadByID(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/store/uploads/")
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "complete" && r.Method == http.MethodPost:
+		h.completeUpload(w, r, id)
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		up, err := h.getUpload(r.Context(), id)
+		if err != nil {
+			uploadError(w, err)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.FormatInt(up.Received, 10))
+		w.Header().Set("Upload-Length", strconv.FormatInt(up.Size, 10))
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodGet {
+			_ = json.NewEncoder(w).Encode(up)
+		}
+	case r.Method == http.MethodPatch || r.Method == http.MethodPut:
+		h.uploadChunk(w, r, id)
+	case r.Method == http.MethodDelete:
+		up, err := h.getUpload(r.Context(), id)
+		if err != nil {
+			uploadError(w, err)
+			return
+		}
+		if err := h.dropUpload(r.Context(), up); err != nil {
+			http.Error(w, "Failed to delete upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"message": "Upload deleted", "id": id})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) createUpload(w http.ResponseWriter, r *http.Request) {
+	var req UploadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !strings.HasSuffix(strings.ToLower(req.Filename), ".tar.zst") {
+		http.Error(w, "Only .tar.zst files are allowed", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(req.Filename, "..") || strings.ContainsAny(req.Filename, "/\\") {
+		http.Error(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+	if req.Size <= 0 {
+		http.Error(w, "size is required", http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.writable(w, haul) {
+		return
+	}
+	// The upload is spooled and then loaded, so it needs about twice its size.
+	if !h.preflight(w, r, haul, 2*req.Size) {
+		return
+	}
+	if err := os.MkdirAll(haul.ArchivesDir(), 0755); err != nil {
+		http.Error(w, "Failed to create archives directory", http.StatusInternalServerError)
+		return
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		http.Error(w, "Failed to create upload", http.StatusInternalServerError)
+		return
+	}
+	req.HaulID = haul.ID
+	up := &Upload{ID: hex.EncodeToString(idBytes), HaulID: haul.ID, Filename: req.Filename, Size: req.Size, opts: req}
+	if err := os.WriteFile(up.partPath(haul), nil, 0644); err != nil {
+		http.Error(w, "Failed to create upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	opts, _ := json.Marshal(req)
+	if _, err := h.JobRunner.DB().ExecContext(r.Context(),
+		`INSERT INTO uploads (id, haul_id, filename, size, options, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		up.ID, haul.ID, up.Filename, up.Size, string(opts), h.uploadExpiry()); err != nil {
+		os.Remove(up.partPath(haul))
+		http.Error(w, "Failed to create upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if up, err = h.getUpload(r.Context(), up.ID); err != nil {
+		uploadError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/store/uploads/"+up.ID)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"upload":       up,
+		"url":          "/api/store/uploads/" + up.ID,
+		"maxChunkSize": maxChunkSize,
+	})
+}
+
+// uploadChunk appends the request body at the client's Upload-Offset, which
+// must equal what the server has received so far. Whatever arrives before
+// the connection drops is kept, so a client resumes from the offset that
+// GET or HEAD reports.
+func (h *Handler) uploadChunk(w http.ResponseWriter, r *http.Request, id string) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset header is required", http.StatusBadRequest)
+		return
+	}
+	if !h.claimUpload(id) {
+		http.Error(w, "Another chunk of this upload is in progress", http.StatusConflict)
+		return
+	}
+	defer h.releaseUpload(id)
+
+	ctx := r.Context()
+	up, err := h.getUpload(ctx, id)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(up.Received, 10))
+	if offset != up.Received {
+		http.Error(w, fmt.Sprintf("Upload is at offset %d, not %d", up.Received, offset), http.StatusConflict)
+		return
+	}
+	remaining := up.Size - up.Received
+	if r.ContentLength > remaining {
+		http.Error(w, fmt.Sprintf("Chunk overruns the declared size by %d bytes", r.ContentLength-remaining), http.StatusRequestEntityTooLarge)
+		return
+	}
+	haul, err := h.Hauls.Get(ctx, up.HaulID)
+	if err != nil {
+		http.Error(w, "Haul not found", http.StatusNotFound)
+		return
+	}
+
+	hash := sha256.New()
+	if up.hashState != nil {
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(up.hashState); err != nil {
+			http.Error(w, "Corrupt upload state: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	f, err := os.OpenFile(up.partPath(haul), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		http.Error(w, "Failed to open upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Drop anything past the recorded offset, e.g. from a write whose
+	// progress was never recorded.
+	if err := f.Truncate(up.Received); err != nil {
+		f.Close()
+		http.Error(w, "Failed to prepare upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := f.Seek(up.Received, io.SeekStart); err != nil {
+		f.Close()
+		http.Error(w, "Failed to prepare upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(chunkTimeout))
+	body := io.LimitReader(http.MaxBytesReader(w, r.Body, maxChunkSize), remaining)
+	n, copyErr := io.Copy(io.MultiWriter(f, hash), body)
+	if err := f.Close(); copyErr == nil {
+		copyErr = err
+	}
+
+	state, _ := hash.(encoding.BinaryMarshaler).MarshalBinary()
+	up.Received += n
+	if _, err := h.JobRunner.DB().ExecContext(context.WithoutCancel(ctx),
+		`UPDATE uploads SET received = ?, hash_state = ?, updated_at = CURRENT_TIMESTAMP, expires_at = ? WHERE id = ?`,
+		up.Received, state, h.uploadExpiry(), up.ID); err != nil {
+		http.Error(w, "Failed to record upload progress: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(up.Received, 10))
+	if copyErr != nil {
+		log.Printf("Upload %s interrupted at offset %d: %v", up.ID, up.Received, copyErr)
+		http.Error(w, fmt.Sprintf("Chunk interrupted at offset %d: %v", up.Received, copyErr), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": up.ID, "received": up.Received, "size": up.Size})
+}
+
+// completeUpload checks a fully received upload against its checksum (and
+// manifest and signature, if any) and then imports it exactly as Import
+// would: into the haul's archives, followed by a load job.
+func (h *Handler) completeUpload(w http.ResponseWriter, r *http.Request, id string) {
+	var req struct {
+		SHA256 string `json:"sha256"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.claimUpload(id) {
+		http.Error(w, "A chunk of this upload is in progress", http.StatusConflict)
+		return
+	}
+	defer h.releaseUpload(id)
+
+	ctx := r.Context()
+	up, err := h.getUpload(ctx, id)
+	if err != nil {
+		uploadError(w, err)
+		return
+	}
+	if up.Received != up.Size {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(up.Received, 10))
+		http.Error(w, fmt.Sprintf("Upload is incomplete: %d of %d bytes received", up.Received, up.Size), http.StatusConflict)
+		return
+	}
+	check := importCheck{
+		SHA256:    up.opts.SHA256,
+		Signature: up.opts.Signature,
+		Require:   h.Cfg.RequireSignedImports || up.opts.RequireSignature,
+	}
+	if req.SHA256 != "" {
+		check.SHA256 = req.SHA256
+	}
+	if check.SHA256 == "" {
+		http.Error(w, "sha256 is required to complete an upload", http.StatusBadRequest)
+		return
+	}
+	if up.opts.Manifest != "" {
+		check.Manifest = []byte(up.opts.Manifest)
+	}
+	haul, storeArgs, err := h.resolveHaul(ctx, up.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.writable(w, haul) {
+		return
+	}
+
+	hash := sha256.New()
+	if up.hashState != nil {
+		if err := hash.(encoding.BinaryUnmarshaler).UnmarshalBinary(up.hashState); err != nil {
+			http.Error(w, "Corrupt upload state: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	keyID, err := h.verifyImport(check, sum, up.Size)
+	if err != nil {
+		if errors.Is(err, errRejected) {
+			log.Printf("Rejected upload %s into haul %d: %s: %v", up.ID, haul.ID, up.Filename, err)
+			if derr := h.dropUpload(ctx, up); derr != nil {
+				log.Printf("Warning: failed to remove rejected upload %s: %v", up.ID, derr)
+			}
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Failed to verify archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	job, err := h.installImport(ctx, haul, storeArgs, up.partPath(haul), up.Filename, sum, up.Size, keyID, check, up.opts.Clear, 0)
+	if err != nil {
+		http.Error(w, "Failed to import archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := h.JobRunner.DB().ExecContext(ctx, `DELETE FROM uploads WHERE id = ?`, up.ID); err != nil {
+		log.Printf("Warning: failed to delete finished upload %s: %v", up.ID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Archive imported, load started",
+		"filename": up.Filename,
+		"size":     up.Size,
+		"sha256":   sum,
+		"signedBy": keyID,
+		"jobId":    job.ID,
+		"haulId":   haul.ID,
+	})
+}
+
+// PurgeExpiredUploads removes uploads that have sat idle past their expiry,
+// with their partial data. It returns how many were removed.
+func (h *Handler) PurgeExpiredUploads(ctx context.Context) (int, error) {
+	rows, err := h.JobRunner.DB().QueryContext(ctx,
+		`SELECT id FROM uploads WHERE expires_at IS NOT NULL AND expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range ids {
+		if !h.claimUpload(id) {
+			continue // a chunk is arriving right now
+		}
+		up, err := h.getUpload(ctx, id)
+		if err == nil {
+			err = h.dropUpload(ctx, up)
+		}
+		h.releaseUpload(id)
+		if err != nil {
+			log.Printf("Warning: failed to purge upload %s: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// dropUpload deletes an upload's partial data and its record. The data of an
+// upload whose haul is gone went with the haul.
+func (h *Handler) dropUpload(ctx context.Context, up *Upload) error {
+	if haul, err := h.Hauls.Get(ctx, up.HaulID); err == nil {
+		if err := os.Remove(up.partPath(haul)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	_, err := h.JobRunner.DB().ExecContext(ctx, `DELETE FROM uploads WHERE id = ?`, up.ID)
+	return err
+}
+
+// errUploadNotFound is returned for unknown or already finished uploads.
+var errUploadNotFound = errors.New("upload not found")
+
+const uploadColumns = `id, haul_id, filename, size, received, hash_state, options, created_at, updated_at, expires_at`
+
+func scanUpload(row interface{ Scan(...interface{}) error }) (*Upload, error) {
+	var (
+		up        Upload
+		opts      sql.NullString
+		expiresAt sql.NullTime
+	)
+	if err := row.Scan(&up.ID, &up.HaulID, &up.Filename, &up.Size, &up.Received, &up.hashState, &opts,
+		&up.CreatedAt, &up.UpdatedAt, &expiresAt); err != nil {
+		return nil, err
+	}
+	if opts.Valid {
+		_ = json.Unmarshal([]byte(opts.String), &up.opts)
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		up.ExpiresAt = &t
+	}
+	return &up, nil
+}
+
+func (h *Handler) getUpload(ctx context.Context, id string) (*Upload, error) {
+	up, err := scanUpload(h.JobRunner.DB().QueryRowContext(ctx,
+		`SELECT `+uploadColumns+` FROM uploads WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errUploadNotFound
+	}
+	return up, err
+}
+
+func (h *Handler) listUploads(ctx context.Context, haulID int64) ([]*Upload, error) {
+	query := `SELECT ` + uploadColumns + ` FROM uploads`
+	args := []interface{}{}
+	if haulID > 0 {
+		query += ` WHERE haul_id = ?`
+		args = append(args, haulID)
+	}
+	rows, err := h.JobRunner.DB().QueryContext(ctx, query+` ORDER BY created_at DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	uploads := []*Upload{}
+	for rows.Next() {
+		up, err := scanUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, up)
+	}
+	return uploads, rows.Err()
+}
+
+// uploadExpiry is when an upload touched now expires, or nil if uploads
+// never expire.
+func (h *Handler) uploadExpiry() interface{} {
+	if h.Cfg.UploadExpiry <= 0 {
+		return nil
+	}
+	return time.Now().UTC().Add(h.Cfg.UploadExpiry)
+}
+
+// claimUpload marks an upload busy so chunks, completion and purging of the
+// same upload never overlap; it reports false if it already is.
+func (h *Handler) claimUpload(id string) bool {
+	h.uploadsMu.Lock()
+	defer h.uploadsMu.Unlock()
+	if h.uploadsBusy == nil {
+		h.uploadsBusy = map[string]bool{}
+	}
+	if h.uploadsBusy[id] {
+		return false
+	}
+	h.uploadsBusy[id] = true
+	return true
+}
+
+func (h *Handler) releaseUpload(id string) {
+	h.uploadsMu.Lock()
+	delete(h.uploadsBusy, id)
+	h.uploadsMu.Unlock()
+}
+
+func uploadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUploadNotFound) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "Failed to read upload: "+err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// verifyTask is the job command of an in-process store integrity check.
+const verifyTask = "store-verify"
+
+// VerifyRequest is the body of POST /api/store/verify.
+type VerifyRequest struct {
+	HaulID int64 `json:"haulId,omitempty"`
+}
+
+// VerifyResult is the result of a verify job.
+type VerifyResult struct {
+	ocistore.VerifyReport
+	HaulID   int64    `json:"haulId"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Verify handles POST /api/store/verify, starting a job that re-hashes every
+// blob in a haul's store and checks its references and layout files.
+func (h *Handler) Verify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.JobRunner.CreateJob(r.Context(), verifyTask, []string{"--haul", strconv.FormatInt(haul.ID, 10)}, nil)
+	if err != nil {
+		log.Printf("Error creating verify job: %v", err)
+		http.Error(w, "Failed to create verify job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "Verify job started",
+		"haulId":  haul.ID,
+	})
+}
+
+// runVerify is the store-verify task. The report is the job result; the job
+// fails when the store has problems, and the outcome is recorded on the haul.
+func (h *Handler) runVerify(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(verifyTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	result := VerifyResult{HaulID: haul.ID}
+	if active, err := h.activeJobs(ctx, haul.ID, job.ID); err == nil && active > 0 {
+		result.Warnings = append(result.Warnings,
+			fmt.Sprintf("%d other job(s) were active on this haul; blobs they were writing may be reported", active))
+	}
+
+	logf("Verifying %s", haul.StoreDir)
+	step := 0
+	report, err := ocistore.Verify(ctx, haul.StoreDir, func(done, total int, bytes int64) {
+		// Log about every 10% so large stores show progress without flooding.
+		if pct := done * 10 / total; pct > step || done == total {
+			step = pct
+			logf("Hashed %d/%d blobs (%d bytes)", done, total, bytes)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	result.VerifyReport = *report
+
+	for _, p := range report.Layout {
+		logf("Layout: %s", p)
+	}
+	for _, i := range report.Corrupt {
+		logf("Corrupt: %s %s", i.Digest, i.Detail)
+	}
+	for _, i := range report.Missing {
+		logf("Missing: %s (referenced by %s)", i.Digest, i.ReferencedBy)
+	}
+	for _, i := range report.SizeMismatch {
+		logf("Size mismatch: %s declared %d, found %d", i.Digest, i.Declared, i.Actual)
+	}
+	if n := len(report.AbsentPlatforms); n > 0 {
+		logf("%d platform manifest(s) of image indexes are absent, as after a filtered sync", n)
+	}
+
+	if err := h.Hauls.RecordVerification(ctx, haul.ID, hauls.Verification{
+		At: report.CheckedAt, OK: report.OK, Problems: report.Problems(), JobID: job.ID,
+	}); err != nil {
+		log.Printf("Warning: failed to record verification of haul %d: %v", haul.ID, err)
+	}
+
+	out, _ := json.Marshal(result)
+	if !report.OK {
+		return string(out), fmt.Errorf("store has %d problem(s)", report.Problems())
+	}
+	logf("Store OK: %d blobs, %d bytes", report.Blobs, report.Bytes)
+	return string(out), nil
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/hauls"
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+)
+
+// loadVolumesTask is the job command that loads split archives in-process,
+// streaming their volumes straight into the store.
+const loadVolumesTask = "store-load-volumes"
+
+// VolumeLoad is one archive's part of an in-process load result.
+type VolumeLoad struct {
+	Archive string `json:"archive"`
+	Volumes int    `json:"volumes,omitempty"`
+	ocistore.ExtractStats
+}
+
+// volumeSet reports whether path names a split archive, either by its volume
+// index or by the archive name when only volumes exist, and returns the path
+// of its index.
+func volumeSet(path string) (string, bool) {
+	if strings.HasSuffix(path, ".volumes.json") {
+		return path, true
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		index := filepath.Join(filepath.Dir(path), hauls.VolumeIndexName(filepath.Base(path)))
+		if _, err := os.Stat(index); err == nil {
+			return index, true
+		}
+	}
+	return "", false
+}
+
+// readVolumeSet reads the volume index at path.
+func readVolumeSet(path string) (*hauls.VolumeIndex, error) {
+	return hauls.ReadVolumeIndex(filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), ".volumes.json"))
+}
+
+// startNativeLoad creates an in-process load job (task is loadVolumesTask or
+// applyDeltaTask) for the given volume indexes and archives and writes the 202
+// response.
+func (h *Handler) startNativeLoad(w http.ResponseWriter, r *http.Request, haul *hauls.Haul, task string, paths []string, resp map[string]interface{}) {
+	args := append([]string{"--haul", strconv.FormatInt(haul.ID, 10)}, paths...)
+	job, err := h.JobRunner.CreateJob(r.Context(), task, args, nil)
+	if err != nil {
+		log.Printf("Error creating load job: %v", err)
+		http.Error(w, "Failed to create load job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+	go h.enforceLimits(job.ID, haul)
+
+	resp["jobId"] = job.ID
+	resp["haulId"] = haul.ID
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// runLoadVolumes is the store-load-volumes and store-apply-delta task. Each
+// volume set is read as one stream, its volumes' checksums checked on the
+// way, and extracted into the haul's store without reassembling the archive
+// on disk; plain archives are extracted the same way. A delta archive fails
+// the job, before its index is merged, unless the store already holds every
+// blob it omitted.
+func (h *Handler) runLoadVolumes(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(loadVolumesTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	parent := fs.Int64("parent", 0, "job that started this one")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	if err := haul.Writable(); err != nil {
+		return "", err
+	}
+	unlock, err := h.Hauls.Lock(haul.ID, fmt.Sprintf("load job %d", job.ID))
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	// Jobs queued before the lock was taken may still write to the store;
+	// the import that started this job only wrote the archive.
+	active, err := h.activeJobs(ctx, haul.ID, job.ID)
+	if err != nil {
+		return "", err
+	}
+	if *parent != 0 {
+		if p, err := h.JobRunner.GetJob(ctx, *parent); err == nil &&
+			(p.Status == jobrunner.StatusQueued || p.Status == jobrunner.StatusRunning) {
+			active--
+		}
+	}
+	if active > 0 {
+		return "", fmt.Errorf("haul %q has %d other queued or running job(s); retry when they finish", haul.Name, active)
+	}
+
+	var loaded []VolumeLoad
+	for _, path := range fs.Args() {
+		archive, volumes := filepath.Base(path), 0
+		var rc io.ReadCloser
+		if strings.HasSuffix(path, ".volumes.json") {
+			idx, err := readVolumeSet(path)
+			if err != nil {
+				return "", err
+			}
+			archive, volumes = idx.Archive, len(idx.Volumes)
+			logf("Loading %s from %d volume(s), %d bytes", archive, volumes, idx.Size)
+			rc = hauls.OpenVolumes(filepath.Dir(path), idx)
+		} else {
+			f, err := os.Open(path)
+			if err != nil {
+				return "", err
+			}
+			logf("Loading %s", archive)
+			rc = f
+		}
+		stats, err := ocistore.ExtractArchive(ctx, rc, haul.StoreDir)
+		rc.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", archive, err)
+		}
+		if stats.Baseline != "" {
+			logf("Delta %s: all %d blob(s) omitted against %s are present", archive, stats.Omitted, stats.Baseline)
+		}
+		logf("Loaded %s: %d manifest(s), %d new blob(s) (%d bytes), %d already present",
+			archive, stats.Manifests, stats.Blobs, stats.Bytes, stats.Existing)
+		loaded = append(loaded, VolumeLoad{Archive: archive, Volumes: volumes, ExtractStats: *stats})
+		if err := h.trackStoreContents(ctx, haul, archive); err != nil {
+			log.Printf("Warning: failed to track contents for %s: %v", archive, err)
+		}
+	}
+
+	out, _ := json.Marshal(map[string]interface{}{"haulId": haul.ID, "archives": loaded})
+	return string(out), nil
+}
+
+// importVolumes handles an Import that carries a volume set: the "volumes"
+// index plus every volume as a "file" part. Each volume is checked against
+// the index as it is saved, then the set is loaded like Load would.
+func (h *Handler) importVolumes(w http.ResponseWriter, r *http.Request, haul *hauls.Haul, check importCheck, index []byte, clear bool) {
+	idx, err := hauls.ParseVolumeIndex(index)
+	if err != nil {
+		http.Error(w, "Invalid volume index: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	parts := map[string]int{}
+	for i, fh := range r.MultipartForm.File["file"] {
+		parts[fh.Filename] = i
+	}
+	for _, v := range idx.Volumes {
+		if _, ok := parts[v.Name]; !ok {
+			http.Error(w, "Missing volume "+v.Name, http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.preflight(w, r, haul, 2*idx.Size) {
+		return
+	}
+	dir := haul.ArchivesDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		http.Error(w, "Failed to create archives directory", http.StatusInternalServerError)
+		return
+	}
+
+	var saved []string
+	discard := func() {
+		for _, p := range saved {
+			os.Remove(p)
+		}
+	}
+	for _, v := range idx.Volumes {
+		part := filepath.Join(dir, v.Name+".part")
+		saved = append(saved, part)
+		sum, size, err := savePart(r.MultipartForm.File["file"][parts[v.Name]], part)
+		if err != nil {
+			discard()
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		if sum != v.SHA256 || size != v.Size {
+			discard()
+			log.Printf("Rejected volume import into haul %d: %s does not match its index", haul.ID, v.Name)
+			http.Error(w, fmt.Sprintf("%v: volume %s does not match the index (sha256 %s, %d bytes)", errRejected, v.Name, sum, size),
+				http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	keyID, err := h.verifyImport(check, idx.SHA256, idx.Size)
+	if err != nil {
+		discard()
+		if errors.Is(err, errRejected) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "Failed to verify archive: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for i, v := range idx.Volumes {
+		if err := os.Rename(saved[i], filepath.Join(dir, v.Name)); err != nil {
+			discard()
+			http.Error(w, "Failed to save file", http.StatusInternalServerError)
+			return
+		}
+		if err := hauls.WriteChecksum(dir, v.Name, v.SHA256); err != nil {
+			log.Printf("Warning: failed to record checksum of %s: %v", v.Name, err)
+		}
+	}
+	if err := hauls.WriteVolumeIndex(dir, idx); err != nil {
+		http.Error(w, "Failed to save volume index: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if keyID != "" {
+		if err := writeSignedManifest(dir, idx.Archive, check.Manifest, check.Signature); err != nil {
+			log.Printf("Warning: failed to keep manifest of %s: %v", idx.Archive, err)
+		}
+	}
+	log.Printf("Imported volume set into haul %d: %s (%d volumes, %d bytes)", haul.ID, idx.Archive, len(idx.Volumes), idx.Size)
+
+	if clear {
+		if delta, _ := isDelta(filepath.Join(dir, hauls.VolumeIndexName(idx.Archive))); delta {
+			http.Error(w, idx.Archive+" is a delta archive; it cannot be loaded into a cleared store", http.StatusBadRequest)
+			return
+		}
+		if err := h.clearHaul(r.Context(), haul); err != nil {
+			http.Error(w, "Failed to clear store: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	h.startNativeLoad(w, r, haul, loadVolumesTask, []string{filepath.Join(dir, hauls.VolumeIndexName(idx.Archive))}, map[string]interface{}{
+		"message":  "Volume set imported, load started",
+		"filename": idx.Archive,
+		"volumes":  len(idx.Volumes),
+		"size":     idx.Size,
+		"sha256":   idx.SHA256,
+		"signedBy": keyID,
+	})
+}
+
+// savePart copies an uploaded part to path, returning its sha256 and size.
+func savePart(fh *multipart.FileHeader, path string) (string, int64, error) {
+	in, err := fh.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return "", 0, err
+	}
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, hash), in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
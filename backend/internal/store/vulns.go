@@ -0,0 +1,383 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/jobrunner"
+	"github.com/hauler-ui/hauler-ui/backend/internal/ocistore"
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+	"github.com/hauler-ui/hauler-ui/backend/internal/vulns"
+)
+
+const (
+	// vulnDBImportTask is the job command that imports an OSV bundle.
+	vulnDBImportTask = "vulndb-import"
+	// vulnScanTask is the job command that builds a haul's vulnerability
+	// report.
+	vulnScanTask = "store-vulnscan"
+	// vulnDBUploadTimeout replaces the server's short read timeout while an
+	// OSV bundle uploads; full exports run to several gigabytes.
+	vulnDBUploadTimeout = time.Hour
+)
+
+// VulnDBImportRequest is the JSON body of POST /api/store/vulndb/import. The
+// bundle is either a file under an import root (Path) or a file artifact in
+// a haul (HaulID and File), e.g. one delivered in a loaded archive. Bundles
+// can also be uploaded as multipart form data with a "file" part.
+type VulnDBImportRequest struct {
+	Path   string `json:"path,omitempty"`
+	HaulID int64  `json:"haulId,omitempty"`
+	File   string `json:"file,omitempty"`
+}
+
+// VulnDB handles GET /api/store/vulndb, describing the vulnerability
+// database, and DELETE /api/store/vulndb, emptying it.
+func (h *Handler) VulnDB(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		stats, err := h.Vulns.Stats(r.Context())
+		if err != nil {
+			http.Error(w, "Failed to read vulnerability database: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(stats)
+	case http.MethodDelete:
+		if err := h.Vulns.Clear(r.Context()); err != nil {
+			http.Error(w, "Failed to clear vulnerability database: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// VulnDBImport handles POST /api/store/vulndb/import, starting a job that
+// reads an OSV bundle into the vulnerability database.
+func (h *Handler) VulnDBImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var src, name string
+	var remove bool
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		_ = http.NewResponseController(w).SetReadDeadline(time.Now().Add(vulnDBUploadTimeout))
+		var err error
+		if src, name, err = h.spoolVulnDB(r); err != nil {
+			http.Error(w, "Failed to receive bundle: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		remove = true
+	} else {
+		var req VulnDBImportRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case req.Path != "":
+			p, err := h.resolveImportPath(req.Path)
+			if err == nil {
+				_, err = os.Stat(p)
+			}
+			if err != nil {
+				importPathError(w, err)
+				return
+			}
+			src, name = p, filepath.Base(p)
+		case req.File != "":
+			haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+			if err != nil {
+				http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			st, err := ocistore.Load(haul.StoreDir)
+			if err != nil {
+				http.Error(w, "Failed to read store: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			f, ok := st.FindFile(req.File)
+			if !ok {
+				http.Error(w, "No file "+req.File+" in haul "+haul.Name, http.StatusNotFound)
+				return
+			}
+			src, name = st.BlobPath(f.Digest), f.Name
+		default:
+			http.Error(w, "path, file or an upload is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	args := []string{"--name", name}
+	if remove {
+		args = append(args, "--remove")
+	}
+	args = append(args, src)
+	job, err := h.JobRunner.CreateJob(r.Context(), vulnDBImportTask, args, nil)
+	if err != nil {
+		if remove {
+			_ = os.Remove(src)
+		}
+		log.Printf("Error creating vulnerability database import job: %v", err)
+		http.Error(w, "Failed to create import job", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "Vulnerability database import started",
+		"source":  name,
+	})
+}
+
+// spoolVulnDB writes an uploaded bundle to a temporary file.
+func (h *Handler) spoolVulnDB(r *http.Request) (string, string, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", "", err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return "", "", fmt.Errorf("no file provided")
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		name := filepath.Base(part.FileName())
+		if err := os.MkdirAll(h.Cfg.HaulerTempDir, 0755); err != nil {
+			return "", "", err
+		}
+		f, err := os.CreateTemp(h.Cfg.HaulerTempDir, "vulndb-*")
+		if err != nil {
+			return "", "", err
+		}
+		_, err = io.Copy(f, part)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(f.Name())
+			return "", "", err
+		}
+		return f.Name(), name, nil
+	}
+}
+
+// runVulnDBImport is the vulndb-import task.
+func (h *Handler) runVulnDBImport(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(vulnDBImportTask, flag.ContinueOnError)
+	name := fs.String("name", "", "bundle name")
+	remove := fs.Bool("remove", false, "remove the bundle afterwards (an upload)")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		return "", fmt.Errorf("expected one bundle path")
+	}
+	src := fs.Arg(0)
+	if *remove {
+		defer os.Remove(src)
+	}
+	logf("Importing advisories from %s", *name)
+	imp, err := h.Vulns.Import(ctx, src, *name, job.ID, func(n int) {
+		logf("%d advisories read", n)
+	})
+	if err != nil {
+		return "", err
+	}
+	logf("Imported %d advisories (%d withdrawn, %d entries skipped)", imp.Advisories, imp.Withdrawn, imp.Skipped)
+	out, _ := json.Marshal(imp)
+	return string(out), nil
+}
+
+// VulnScan handles POST /api/store/vulnscan ({"haulId": N}), starting a job
+// that matches the haul's images against the vulnerability database.
+func (h *Handler) VulnScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		HaulID int64 `json:"haulId,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	haul, _, err := h.resolveHaul(r.Context(), req.HaulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	stats, err := h.Vulns.Stats(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to read vulnerability database: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if stats.Advisories == 0 {
+		http.Error(w, "The vulnerability database is empty; import an OSV bundle first", http.StatusConflict)
+		return
+	}
+	job, err := h.JobRunner.CreateJob(r.Context(), vulnScanTask, []string{"--haul", strconv.FormatInt(haul.ID, 10)}, nil)
+	if err != nil {
+		log.Printf("Error creating vulnerability scan job: %v", err)
+		http.Error(w, "Failed to create scan job", http.StatusInternalServerError)
+		return
+	}
+	h.tagJobHaul(r.Context(), job.ID, haul.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobId":   job.ID,
+		"message": "Vulnerability scan started",
+		"haulId":  haul.ID,
+	})
+}
+
+// runVulnScan is the store-vulnscan task. Images without an SBOM are
+// scanned first (and their inventories kept); the report replaces the
+// haul's previous one.
+func (h *Handler) runVulnScan(ctx context.Context, job *jobrunner.Job, logf func(string, ...interface{})) (string, error) {
+	fs := flag.NewFlagSet(vulnScanTask, flag.ContinueOnError)
+	haulID := fs.Int64("haul", 0, "haul id")
+	if err := fs.Parse(job.Args); err != nil {
+		return "", err
+	}
+	haul, err := h.Hauls.Get(ctx, *haulID)
+	if err != nil {
+		return "", fmt.Errorf("haul %d: %w", *haulID, err)
+	}
+	stats, err := h.Vulns.Stats(ctx)
+	if err != nil {
+		return "", err
+	}
+	st, err := ocistore.Load(haul.StoreDir)
+	if err != nil {
+		return "", err
+	}
+	images, err := imageManifests(st, ocistore.Selection{})
+	if err != nil {
+		return "", err
+	}
+	logf("Matching %d image manifest(s) in haul %s against %d advisories", len(images), haul.Slug, stats.Advisories)
+
+	matcher := h.Vulns.Matcher()
+	var reports []vulns.ImageReport
+	for i, img := range images {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		inv, err := sbom.Load(haul.SBOMDir(), img.Digest)
+		if err != nil {
+			if inv, err = sbom.Scan(ctx, st, img.Digest, h.Cfg.HaulerTempDir); err != nil {
+				logf("[%d/%d] %s %s: %v", i+1, len(images), img.Image, img.Platform, err)
+				continue
+			}
+			inv.Image, inv.Platform = img.Image, img.Platform
+			if err := sbom.Save(haul.SBOMDir(), inv); err != nil {
+				return "", err
+			}
+		}
+		findings, err := matcher.Match(ctx, inv)
+		if err != nil {
+			return "", err
+		}
+		logf("[%d/%d] %s %s: %d finding(s) in %d package(s)", i+1, len(images), img.Image, img.Platform, len(findings), len(inv.Packages))
+		reports = append(reports, vulns.ImageReport{
+			Image: img.Image, Digest: img.Digest, Platform: img.Platform, Distro: inv.Distro,
+			Packages: len(inv.Packages), Findings: findings,
+		})
+	}
+	report := vulns.NewReport(haul.ID, stats.Advisories, reports)
+	data, err := json.Marshal(report)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(haul.VulnReportPath(), data); err != nil {
+		return "", err
+	}
+	c := report.Counts
+	logf("%d vulnerabilities: %d critical, %d high, %d medium, %d low, %d unknown", c.Total, c.Critical, c.High, c.Medium, c.Low, c.Unknown)
+	out, _ := json.Marshal(map[string]interface{}{"haulId": haul.ID, "images": len(reports), "counts": c})
+	return string(out), nil
+}
+
+// Vulnerabilities handles GET /api/store/vulnerabilities?haulId=N, returning
+// the haul's latest vulnerability report. It can be narrowed with severity
+// (comma-separated), image, package, id and fixable=true, and exported with
+// format=csv.
+func (h *Handler) Vulnerabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	haulID, _ := strconv.ParseInt(q.Get("haulId"), 10, 64)
+	haul, _, err := h.resolveHaul(r.Context(), haulID)
+	if err != nil {
+		http.Error(w, "Failed to resolve haul: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	data, err := os.ReadFile(haul.VulnReportPath())
+	if os.IsNotExist(err) {
+		http.Error(w, "No vulnerability report for this haul; run a scan first", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to read report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var report vulns.Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		http.Error(w, "Failed to parse report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	f := vulns.Filter{Image: q.Get("image"), Package: q.Get("package"), ID: q.Get("id"), Fixable: q.Get("fixable") == "true"}
+	if s := q.Get("severity"); s != "" {
+		f.Severities = strings.Split(s, ",")
+	}
+	filtered := report.Filter(f)
+
+	switch q.Get("format") {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		if q.Get("format") == "json" {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-vulnerabilities.json"`, haul.Slug))
+		}
+		_ = json.NewEncoder(w).Encode(filtered)
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-vulnerabilities.csv"`, haul.Slug))
+		_ = filtered.WriteCSV(w)
+	default:
+		http.Error(w, "format must be json or csv", http.StatusBadRequest)
+	}
+}
+
+// writeFileAtomic replaces path with data via a temporary file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,496 @@
+package vulns
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+)
+
+// DB is the vulnerability database, kept in the application's SQLite
+// database (see migration 0014).
+type DB struct {
+	db *sql.DB
+}
+
+// New returns the vulnerability database stored in db.
+func New(db *sql.DB) *DB {
+	return &DB{db: db}
+}
+
+// Import is one imported bundle.
+type Import struct {
+	ID         int64     `json:"id"`
+	Source     string    `json:"source"`
+	Advisories int       `json:"advisories"`
+	Withdrawn  int       `json:"withdrawn"`
+	Skipped    int       `json:"skipped,omitempty"`
+	JobID      int64     `json:"jobId,omitempty"`
+	ImportedAt time.Time `json:"importedAt"`
+}
+
+// Stats summarizes the database.
+type Stats struct {
+	Advisories int            `json:"advisories"`
+	Ecosystems map[string]int `json:"ecosystems"` // affected packages per ecosystem
+	Imports    []Import       `json:"imports"`
+}
+
+// Import reads the OSV bundle at path into the database in one transaction.
+// Advisories replace earlier copies with the same ID and withdrawn ones are
+// removed, so bundles can be re-imported as they are refreshed. progress, if
+// set, is called every 10000 advisories.
+func (d *DB) Import(ctx context.Context, path, source string, jobID int64, progress func(n int)) (*Import, error) {
+	if source == "" {
+		source = filepath.Base(path)
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `INSERT INTO vuln_imports (source, job_id) VALUES (?, ?)`, source, sql.NullInt64{Int64: jobID, Valid: jobID > 0})
+	if err != nil {
+		return nil, err
+	}
+	imp := &Import{Source: source, JobID: jobID}
+	if imp.ID, err = res.LastInsertId(); err != nil {
+		return nil, err
+	}
+	delAffected, err := tx.PrepareContext(ctx, `DELETE FROM vuln_affected WHERE advisory_id = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer delAffected.Close()
+	delAdvisory, err := tx.PrepareContext(ctx, `DELETE FROM vuln_advisories WHERE id = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer delAdvisory.Close()
+	putAdvisory, err := tx.PrepareContext(ctx, `
+		INSERT INTO vuln_advisories (id, aliases, summary, severity, score, modified, published, import_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET aliases = excluded.aliases, summary = excluded.summary,
+			severity = excluded.severity, score = excluded.score, modified = excluded.modified,
+			published = excluded.published, import_id = excluded.import_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer putAdvisory.Close()
+	putAffected, err := tx.PrepareContext(ctx, `
+		INSERT INTO vuln_affected (advisory_id, ecosystem, release, package, ranges, versions)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer putAffected.Close()
+
+	imp.Skipped, err = ReadBundle(path, func(a *Advisory) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if _, err := delAffected.ExecContext(ctx, a.ID); err != nil {
+			return err
+		}
+		if a.Withdrawn {
+			imp.Withdrawn++
+			_, err := delAdvisory.ExecContext(ctx, a.ID)
+			return err
+		}
+		aliases, _ := json.Marshal(a.Aliases)
+		var score sql.NullFloat64
+		if a.Score > 0 {
+			score = sql.NullFloat64{Float64: a.Score, Valid: true}
+		}
+		if _, err := putAdvisory.ExecContext(ctx, a.ID, string(aliases), a.Summary, a.Severity, score, a.Modified, a.Published, imp.ID); err != nil {
+			return err
+		}
+		for _, af := range a.Affected {
+			ranges, _ := json.Marshal(af.Ranges)
+			versions, _ := json.Marshal(af.Versions)
+			if _, err := putAffected.ExecContext(ctx, a.ID, af.Ecosystem, af.Release, af.Package, string(ranges), string(versions)); err != nil {
+				return err
+			}
+		}
+		imp.Advisories++
+		if progress != nil && imp.Advisories%10000 == 0 {
+			progress(imp.Advisories)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", source, err)
+	}
+	if imp.Advisories == 0 && imp.Withdrawn == 0 {
+		return nil, fmt.Errorf("%s holds no OSV advisories", source)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE vuln_imports SET advisories = ?, withdrawn = ? WHERE id = ?`, imp.Advisories, imp.Withdrawn, imp.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	imp.ImportedAt = time.Now().UTC()
+	return imp, nil
+}
+
+// Stats counts the advisories and lists the imports, newest first.
+func (d *DB) Stats(ctx context.Context) (*Stats, error) {
+	s := &Stats{Ecosystems: map[string]int{}, Imports: []Import{}}
+	if err := d.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vuln_advisories`).Scan(&s.Advisories); err != nil {
+		return nil, err
+	}
+	rows, err := d.db.QueryContext(ctx, `SELECT ecosystem, COUNT(*) FROM vuln_affected GROUP BY ecosystem`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var eco string
+		var n int
+		if err := rows.Scan(&eco, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Ecosystems[eco] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows, err = d.db.QueryContext(ctx, `SELECT id, source, advisories, withdrawn, job_id, imported_at FROM vuln_imports ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var imp Import
+		var jobID sql.NullInt64
+		if err := rows.Scan(&imp.ID, &imp.Source, &imp.Advisories, &imp.Withdrawn, &jobID, &imp.ImportedAt); err != nil {
+			return nil, err
+		}
+		imp.JobID = jobID.Int64
+		s.Imports = append(s.Imports, imp)
+	}
+	return s, rows.Err()
+}
+
+// Clear removes every advisory and import record.
+func (d *DB) Clear(ctx context.Context) error {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, table := range []string{"vuln_affected", "vuln_advisories", "vuln_imports"} {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Finding is one advisory affecting one package of an image.
+type Finding struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"`
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity"`
+	Score    float64  `json:"score,omitempty"`
+	Package  string   `json:"package"`
+	Version  string   `json:"version"`
+	Type     string   `json:"type"` // sbom package type, e.g. "deb"
+	PURL     string   `json:"purl"`
+	Path     string   `json:"path"`
+	Fixed    string   `json:"fixed,omitempty"` // first fixed version, if any
+}
+
+// candidate is an affected-package row joined with its advisory.
+type candidate struct {
+	Affected
+	id, summary, severity string
+	aliases               []string
+	score                 float64
+}
+
+// Matcher matches inventories against the database, caching lookups so the
+// packages images share are only queried once.
+type Matcher struct {
+	db    *DB
+	cache map[string][]candidate
+}
+
+// Matcher returns a new matcher.
+func (d *DB) Matcher() *Matcher {
+	return &Matcher{db: d, cache: map[string][]candidate{}}
+}
+
+// Match returns the findings for an inventory's packages. An advisory known
+// under several IDs (e.g. a GHSA and its CVE) is reported once per package.
+func (m *Matcher) Match(ctx context.Context, inv *sbom.Inventory) ([]Finding, error) {
+	findings := []Finding{}
+	for _, p := range inv.Packages {
+		q, ok := lookupFor(p, inv.Distro)
+		if !ok {
+			continue
+		}
+		cmp := comparatorFor(q.ecosystem)
+		// seen maps advisory IDs and aliases to their finding, so a
+		// duplicate with a known severity can stand in for one without.
+		seen := map[string]int{}
+		for _, name := range q.names {
+			cands, err := m.candidates(ctx, q.ecosystem, name)
+			if err != nil {
+				return nil, err
+			}
+			for _, c := range cands {
+				if !releaseMatches(c.Release, q.release) {
+					continue
+				}
+				affected, fixed := c.affects(q.version, cmp)
+				if !affected {
+					continue
+				}
+				f := Finding{
+					ID: c.id, Aliases: c.aliases, Summary: c.summary, Severity: c.severity, Score: c.score,
+					Package: p.Name, Version: p.Version, Type: p.Type, PURL: p.PURL, Path: p.Path, Fixed: fixed,
+				}
+				i, dup := seen[c.id]
+				for _, alias := range c.aliases {
+					if j, ok := seen[alias]; ok && !dup {
+						i, dup = j, true
+					}
+				}
+				switch {
+				case !dup:
+					i = len(findings)
+					findings = append(findings, f)
+				case findings[i].Severity == SeverityUnknown && c.severity != SeverityUnknown:
+					findings[i] = f
+				}
+				seen[c.id] = i
+				for _, alias := range c.aliases {
+					seen[alias] = i
+				}
+			}
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := severityRank(findings[i].Severity), severityRank(findings[j].Severity)
+		if a != b {
+			return a < b
+		}
+		if findings[i].Package != findings[j].Package {
+			return findings[i].Package < findings[j].Package
+		}
+		return findings[i].ID < findings[j].ID
+	})
+	return findings, nil
+}
+
+func (m *Matcher) candidates(ctx context.Context, ecosystem, name string) ([]candidate, error) {
+	key := ecosystem + "|" + name
+	if c, ok := m.cache[key]; ok {
+		return c, nil
+	}
+	rows, err := m.db.db.QueryContext(ctx, `
+		SELECT a.id, a.aliases, a.summary, a.severity, a.score, f.release, f.ranges, f.versions
+		FROM vuln_affected f JOIN vuln_advisories a ON a.id = f.advisory_id
+		WHERE f.ecosystem = ? AND f.package = ?
+		ORDER BY a.id`, ecosystem, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []candidate
+	for rows.Next() {
+		var c candidate
+		var aliases, summary, ranges, versions sql.NullString
+		var score sql.NullFloat64
+		if err := rows.Scan(&c.id, &aliases, &summary, &c.severity, &score, &c.Release, &ranges, &versions); err != nil {
+			return nil, err
+		}
+		c.Ecosystem, c.Package, c.summary, c.score = ecosystem, name, summary.String, score.Float64
+		_ = json.Unmarshal([]byte(aliases.String), &c.aliases)
+		_ = json.Unmarshal([]byte(ranges.String), &c.Ranges)
+		_ = json.Unmarshal([]byte(versions.String), &c.Versions)
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	m.cache[key] = out
+	return out, nil
+}
+
+// affects reports whether version is affected, and the version that fixes
+// it when the range names one. Listed versions match exactly; ranges follow
+// the OSV evaluation: events in version order switch "affected" on at
+// introduced and off at fixed, or past last_affected.
+func (a *Affected) affects(version string, cmp comparator) (bool, string) {
+	for _, v := range a.Versions {
+		if v == version {
+			return true, ""
+		}
+	}
+	for _, r := range a.Ranges {
+		c := cmp
+		if r.Type == "SEMVER" {
+			c = compareSemver
+		}
+		events := append([]Event(nil), r.Events...)
+		at := func(e Event) string {
+			switch {
+			case e.Introduced != "":
+				return e.Introduced
+			case e.Fixed != "":
+				return e.Fixed
+			case e.LastAffected != "":
+				return e.LastAffected
+			}
+			return e.Limit
+		}
+		sort.SliceStable(events, func(i, j int) bool {
+			if events[i].Introduced == "0" {
+				return events[j].Introduced != "0"
+			}
+			if events[j].Introduced == "0" {
+				return false
+			}
+			return c(at(events[i]), at(events[j])) < 0
+		})
+		affected, fixed := false, ""
+		for _, e := range events {
+			switch {
+			case e.Introduced != "":
+				if e.Introduced == "0" || c(version, e.Introduced) >= 0 {
+					affected, fixed = true, ""
+				}
+			case e.Fixed != "":
+				if c(version, e.Fixed) >= 0 {
+					affected = false
+				} else if affected && fixed == "" {
+					fixed = e.Fixed
+				}
+			case e.LastAffected != "":
+				if c(version, e.LastAffected) > 0 {
+					affected = false
+				}
+			case e.Limit != "":
+				if c(version, e.Limit) >= 0 {
+					affected = false
+				}
+			}
+		}
+		if affected {
+			return true, fixed
+		}
+	}
+	return false, ""
+}
+
+// lookup is how one inventory package is looked up.
+type lookup struct {
+	ecosystem, release, version string
+	names                       []string
+}
+
+// distroEcosystems maps os-release IDs onto OSV ecosystems.
+var distroEcosystems = map[string]string{
+	"alpine": "alpine", "wolfi": "wolfi", "chainguard": "chainguard",
+	"debian": "debian", "ubuntu": "ubuntu",
+	"rhel": "red hat", "centos": "red hat", "rocky": "rocky linux", "almalinux": "almalinux",
+	"sles": "suse", "opensuse-leap": "opensuse", "opensuse-tumbleweed": "opensuse", "mageia": "mageia",
+}
+
+// languageEcosystems maps sbom package types onto OSV ecosystems.
+var languageEcosystems = map[string]string{
+	sbom.TypeNPM: "npm", sbom.TypePyPI: "pypi", sbom.TypeCargo: "crates.io",
+	sbom.TypeComposer: "packagist", sbom.TypeGem: "rubygems", sbom.TypeGolang: "go",
+}
+
+// lookupFor decides where to look a package up. OS advisories name source
+// packages (Debian, Ubuntu, Alpine) or binary ones (rpm distributions) and
+// are per release, so OS packages of an image whose distribution is unknown
+// are not matched.
+func lookupFor(p sbom.Package, d *sbom.Distro) (lookup, bool) {
+	if eco, ok := languageEcosystems[p.Type]; ok {
+		q := lookup{ecosystem: eco, version: p.Version, names: []string{NormalizeName(eco, p.Name)}}
+		if eco == "go" {
+			q.version, _, _ = strings.Cut(strings.TrimPrefix(p.Version, "v"), " ")
+		}
+		return q, true
+	}
+	if d == nil {
+		return lookup{}, false
+	}
+	eco, ok := distroEcosystems[d.ID]
+	if !ok {
+		return lookup{}, false
+	}
+	q := lookup{ecosystem: eco, release: d.VersionID, version: p.Version}
+	switch p.Type {
+	case sbom.TypeAPK, sbom.TypeDeb:
+		name := p.Source
+		if name == "" {
+			name = p.Name
+		}
+		q.names = []string{name}
+	case sbom.TypeRPM:
+		q.names = []string{p.Name}
+		if src := sourceRPMName(p.Source); src != "" && src != p.Name {
+			q.names = append(q.names, src)
+		}
+	default:
+		return lookup{}, false
+	}
+	return q, true
+}
+
+// sourceRPMName extracts the name from a source rpm filename such as
+// "openssl-3.0.7-27.el9.src.rpm".
+func sourceRPMName(src string) string {
+	src = strings.TrimSuffix(src, ".src.rpm")
+	for i := 0; i < 2; i++ {
+		j := strings.LastIndex(src, "-")
+		if j < 0 {
+			return ""
+		}
+		src = src[:j]
+	}
+	return src
+}
+
+// releaseMatches reports whether an advisory for release ("" for every
+// release) applies to a distribution version: "3.19" covers "3.19.1", "9"
+// covers "9.3".
+func releaseMatches(release, version string) bool {
+	if release == "" {
+		return true
+	}
+	rs, vs := strings.Split(release, "."), strings.Split(version, ".")
+	if version == "" || len(rs) > len(vs) {
+		return false
+	}
+	for i := range rs {
+		if cmpNum(rs[i], vs[i]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func severityRank(s string) int {
+	for i, v := range Severities {
+		if v == s {
+			return i
+		}
+	}
+	return len(Severities)
+}
@@ -0,0 +1,427 @@
+// Package vulns is an offline vulnerability database. Advisories are
+// imported from OSV bundles (the per-ecosystem zip exports, tarballs or plain
+// JSON) and matched against the package inventories the sbom package builds,
+// comparing versions the way each ecosystem orders them.
+package vulns
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+)
+
+// Severity levels, most severe first.
+const (
+	SeverityCritical = "CRITICAL"
+	SeverityHigh     = "HIGH"
+	SeverityMedium   = "MEDIUM"
+	SeverityLow      = "LOW"
+	SeverityUnknown  = "UNKNOWN"
+)
+
+// Severities lists the levels from most to least severe.
+var Severities = []string{SeverityCritical, SeverityHigh, SeverityMedium, SeverityLow, SeverityUnknown}
+
+// maxEntry bounds one advisory's JSON.
+const maxEntry = 16 << 20
+
+// Advisory is an OSV advisory reduced to what matching and reporting need.
+type Advisory struct {
+	ID        string
+	Aliases   []string
+	Summary   string
+	Severity  string
+	Score     float64 // CVSS v3 base score, 0 when unknown
+	Modified  string
+	Published string
+	Withdrawn bool
+	Affected  []Affected
+}
+
+// Affected is one package an advisory affects.
+type Affected struct {
+	Ecosystem string // lower-case, without the release, e.g. "debian"
+	Release   string // e.g. "12" for "Debian:12", "3.19" for "Alpine:v3.19"
+	Package   string
+	Ranges    []Range  `json:"ranges,omitempty"`
+	Versions  []string `json:"versions,omitempty"`
+}
+
+// Range is an OSV affected range: a sorted series of events over SEMVER or
+// ECOSYSTEM versions (GIT ranges are not evaluated).
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event is one OSV range event; exactly one field is set.
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+type osvSeverity struct {
+	Type  string `json:"type"`
+	Score string `json:"score"`
+}
+
+// osvEntry is the subset of the OSV schema that is read.
+type osvEntry struct {
+	ID        string        `json:"id"`
+	Modified  string        `json:"modified"`
+	Published string        `json:"published"`
+	Withdrawn string        `json:"withdrawn"`
+	Aliases   []string      `json:"aliases"`
+	Summary   string        `json:"summary"`
+	Details   string        `json:"details"`
+	Severity  []osvSeverity `json:"severity"`
+	Affected  []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Severity          []osvSeverity          `json:"severity"`
+		Ranges            []Range                `json:"ranges"`
+		Versions          []string               `json:"versions"`
+		EcosystemSpecific map[string]interface{} `json:"ecosystem_specific"`
+	} `json:"affected"`
+	DatabaseSpecific map[string]interface{} `json:"database_specific"`
+}
+
+// ReadBundle reads every advisory in an OSV bundle at path: a zip of JSON
+// files (as osv.dev exports each ecosystem), a tarball (optionally gzip or
+// zstd compressed) of JSON files, or a JSON document holding one advisory,
+// an array of them, or a stream of them. fn is called for each advisory,
+// including withdrawn ones; entries that are not advisories are counted and
+// skipped.
+func ReadBundle(path string, fn func(*Advisory) error) (skipped int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 1<<20)
+	magic, _ := br.Peek(4)
+	if bytes.HasPrefix(magic, []byte("PK\x03\x04")) {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return readZip(f, info.Size(), fn)
+	}
+	r, err := sbom.Decompress(br)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	rb := bufio.NewReaderSize(r, 1<<20)
+	if head, _ := rb.Peek(262); len(head) >= 262 && string(head[257:262]) == "ustar" {
+		return readTar(rb, fn)
+	}
+	return readJSON(rb, fn)
+}
+
+func readZip(r io.ReaderAt, size int64, fn func(*Advisory) error) (int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, err
+	}
+	skipped := 0
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() || path.Ext(zf.Name) != ".json" {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return skipped, err
+		}
+		n, err := readJSON(io.LimitReader(rc, maxEntry), fn)
+		rc.Close()
+		if err != nil {
+			return skipped, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+		skipped += n
+	}
+	return skipped, nil
+}
+
+func readTar(r io.Reader, fn func(*Advisory) error) (int, error) {
+	tr := tar.NewReader(r)
+	skipped := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+		if hdr.Typeflag != tar.TypeReg || path.Ext(hdr.Name) != ".json" {
+			continue
+		}
+		n, err := readJSON(io.LimitReader(tr, maxEntry), fn)
+		if err != nil {
+			return skipped, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		skipped += n
+	}
+}
+
+// readJSON reads one advisory, an array of advisories, or a stream of them.
+func readJSON(r io.Reader, fn func(*Advisory) error) (int, error) {
+	br := bufio.NewReader(r)
+	var first byte
+	for {
+		c, err := br.ReadByte()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			first = c
+			_ = br.UnreadByte()
+			break
+		}
+	}
+	skipped := 0
+	each := func(e *osvEntry) error {
+		a := e.advisory()
+		if a == nil {
+			skipped++
+			return nil
+		}
+		return fn(a)
+	}
+	dec := json.NewDecoder(br)
+	if first == '[' {
+		if _, err := dec.Token(); err != nil {
+			return 0, err
+		}
+		for dec.More() {
+			var e osvEntry
+			if err := dec.Decode(&e); err != nil {
+				return skipped, err
+			}
+			if err := each(&e); err != nil {
+				return skipped, err
+			}
+		}
+		return skipped, nil
+	}
+	for {
+		var e osvEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+		if err := each(&e); err != nil {
+			return skipped, err
+		}
+	}
+}
+
+// advisory normalizes an OSV entry, or returns nil if it is not one.
+func (e *osvEntry) advisory() *Advisory {
+	if e.ID == "" {
+		return nil
+	}
+	a := &Advisory{
+		ID: e.ID, Aliases: e.Aliases, Summary: e.Summary,
+		Modified: e.Modified, Published: e.Published, Withdrawn: e.Withdrawn != "",
+	}
+	if a.Summary == "" {
+		a.Summary, _, _ = strings.Cut(strings.TrimSpace(e.Details), "\n")
+	}
+	if len(a.Summary) > 300 {
+		a.Summary = a.Summary[:297] + "..."
+	}
+	for _, af := range e.Affected {
+		if af.Package.Name == "" || af.Package.Ecosystem == "" {
+			continue
+		}
+		eco, release := SplitEcosystem(af.Package.Ecosystem)
+		var ranges []Range
+		for _, r := range af.Ranges {
+			if r.Type == "SEMVER" || r.Type == "ECOSYSTEM" {
+				ranges = append(ranges, r)
+			}
+		}
+		if len(ranges) == 0 && len(af.Versions) == 0 {
+			continue
+		}
+		a.Affected = append(a.Affected, Affected{
+			Ecosystem: eco, Release: release, Package: NormalizeName(eco, af.Package.Name),
+			Ranges: ranges, Versions: af.Versions,
+		})
+	}
+	if len(a.Affected) == 0 && !a.Withdrawn {
+		return nil
+	}
+	a.Severity, a.Score = e.severity()
+	return a
+}
+
+// severity picks an advisory's severity: from a CVSS v3 vector when there is
+// one, otherwise the database's or ecosystem's own rating.
+func (e *osvEntry) severity() (string, float64) {
+	all := e.Severity
+	for _, af := range e.Affected {
+		all = append(all, af.Severity...)
+	}
+	for _, s := range all {
+		if s.Type == "CVSS_V3" {
+			if score, ok := cvss3(s.Score); ok {
+				return rating(score), score
+			}
+		}
+	}
+	for _, s := range all {
+		if s.Type == "Ubuntu" {
+			return normalizeSeverity(s.Score), 0
+		}
+	}
+	if s, ok := e.DatabaseSpecific["severity"].(string); ok {
+		return normalizeSeverity(s), 0
+	}
+	for _, af := range e.Affected {
+		for _, key := range []string{"severity", "urgency"} {
+			if s, ok := af.EcosystemSpecific[key].(string); ok {
+				return normalizeSeverity(s), 0
+			}
+		}
+	}
+	return SeverityUnknown, 0
+}
+
+// normalizeSeverity maps the ratings databases use onto the severity levels.
+func normalizeSeverity(s string) string {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "critical":
+		return SeverityCritical
+	case "high", "important":
+		return SeverityHigh
+	case "medium", "moderate":
+		return SeverityMedium
+	case "low", "negligible", "unimportant":
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
+
+// rating maps a CVSS base score onto a severity level.
+func rating(score float64) string {
+	switch {
+	case score >= 9:
+		return SeverityCritical
+	case score >= 7:
+		return SeverityHigh
+	case score >= 4:
+		return SeverityMedium
+	case score > 0:
+		return SeverityLow
+	}
+	return SeverityUnknown
+}
+
+// cvss3 computes the base score of a CVSS v3.x vector.
+func cvss3(vector string) (float64, bool) {
+	parts := strings.Split(vector, "/")
+	if len(parts) < 9 || !strings.HasPrefix(parts[0], "CVSS:3") {
+		return 0, false
+	}
+	m := map[string]string{}
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, ":")
+		m[k] = v
+	}
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	w := map[string]float64{}
+	for metric, values := range weights {
+		v, ok := values[m[metric]]
+		if !ok {
+			return 0, false
+		}
+		w[metric] = v
+	}
+	changed := m["S"] == "C"
+	if m["S"] != "U" && !changed {
+		return 0, false
+	}
+	pr := map[string]float64{"N": 0.85, "L": 0.62, "H": 0.27}
+	if changed {
+		pr["L"], pr["H"] = 0.68, 0.5
+	}
+	prw, ok := pr[m["PR"]]
+	if !ok {
+		return 0, false
+	}
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0, true
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * prw * w["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10)), true
+	}
+	return roundUp(math.Min(impact+exploitability, 10)), true
+}
+
+// roundUp is CVSS v3.1's round-up to one decimal.
+func roundUp(x float64) float64 {
+	i := int64(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// SplitEcosystem splits an OSV ecosystem like "Alpine:v3.19" or
+// "Red Hat:enterprise_linux:9::appstream" into the lower-case ecosystem and
+// its release number ("3.19", "9").
+func SplitEcosystem(s string) (string, string) {
+	eco, rest, _ := strings.Cut(s, ":")
+	for _, seg := range strings.Split(rest, ":") {
+		if strings.IndexFunc(seg, func(r rune) bool { return r >= '0' && r <= '9' }) >= 0 {
+			return strings.ToLower(eco), strings.TrimPrefix(seg, "v")
+		}
+	}
+	return strings.ToLower(eco), ""
+}
+
+// NormalizeName puts a package name in the form it is looked up by; only
+// PyPI names are case- and separator-insensitive.
+func NormalizeName(ecosystem, name string) string {
+	if ecosystem != "pypi" {
+		return name
+	}
+	name = strings.ToLower(name)
+	return strings.NewReplacer("_", "-", ".", "-").Replace(name)
+}
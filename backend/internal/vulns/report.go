@@ -0,0 +1,170 @@
+package vulns
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+)
+
+// Counts tallies findings by severity.
+type Counts struct {
+	Critical int `json:"critical"`
+	High     int `json:"high"`
+	Medium   int `json:"medium"`
+	Low      int `json:"low"`
+	Unknown  int `json:"unknown"`
+	Total    int `json:"total"`
+}
+
+// Add counts one finding of the given severity.
+func (c *Counts) Add(severity string) {
+	switch severity {
+	case SeverityCritical:
+		c.Critical++
+	case SeverityHigh:
+		c.High++
+	case SeverityMedium:
+		c.Medium++
+	case SeverityLow:
+		c.Low++
+	default:
+		c.Unknown++
+	}
+	c.Total++
+}
+
+// Report is a haul's vulnerability report.
+type Report struct {
+	HaulID      int64     `json:"haulId"`
+	GeneratedAt time.Time `json:"generatedAt"`
+	// Advisories is the size of the database the report was matched against.
+	Advisories int `json:"advisories"`
+	// Counts tallies distinct vulnerabilities across the haul: an advisory
+	// found in several images or packages counts once.
+	Counts Counts        `json:"counts"`
+	Images []ImageReport `json:"images"`
+}
+
+// ImageReport is the findings for one image manifest.
+type ImageReport struct {
+	Image    string       `json:"image"`
+	Digest   string       `json:"digest"`
+	Platform string       `json:"platform,omitempty"`
+	Distro   *sbom.Distro `json:"distro,omitempty"`
+	Packages int          `json:"packages"`
+	Counts   Counts       `json:"counts"` // findings by severity
+	Findings []Finding    `json:"findings"`
+}
+
+// Filter narrows a report. Empty fields match everything.
+type Filter struct {
+	Severities []string // e.g. CRITICAL, HIGH
+	Image      string   // substring of the image reference
+	Package    string   // substring of the package name
+	ID         string   // advisory ID or alias
+	Fixable    bool     // only findings with a fixed version
+}
+
+func (f Filter) match(im *ImageReport, fd *Finding) bool {
+	if len(f.Severities) > 0 {
+		ok := false
+		for _, s := range f.Severities {
+			ok = ok || strings.EqualFold(s, fd.Severity)
+		}
+		if !ok {
+			return false
+		}
+	}
+	if f.Image != "" && !strings.Contains(im.Image, f.Image) {
+		return false
+	}
+	if f.Package != "" && !strings.Contains(fd.Package, f.Package) {
+		return false
+	}
+	if f.Fixable && fd.Fixed == "" {
+		return false
+	}
+	if f.ID != "" && !strings.EqualFold(fd.ID, f.ID) {
+		ok := false
+		for _, a := range fd.Aliases {
+			ok = ok || strings.EqualFold(a, f.ID)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter returns a copy of the report holding only the matching findings,
+// with the counts recomputed. Images left without findings are dropped
+// unless the filter is empty.
+func (r *Report) Filter(f Filter) *Report {
+	empty := len(f.Severities) == 0 && f.Image == "" && f.Package == "" && f.ID == "" && !f.Fixable
+	out := &Report{HaulID: r.HaulID, GeneratedAt: r.GeneratedAt, Advisories: r.Advisories, Images: []ImageReport{}}
+	for _, im := range r.Images {
+		fim := im
+		fim.Counts, fim.Findings = Counts{}, []Finding{}
+		for _, fd := range im.Findings {
+			if f.match(&im, &fd) {
+				fim.Findings = append(fim.Findings, fd)
+			}
+		}
+		if len(fim.Findings) == 0 && !empty {
+			continue
+		}
+		out.Images = append(out.Images, fim)
+	}
+	out.tally()
+	return out
+}
+
+// tally recomputes the image and haul counts from the findings.
+func (r *Report) tally() {
+	r.Counts = Counts{}
+	seen := map[string]bool{}
+	for i := range r.Images {
+		im := &r.Images[i]
+		im.Counts = Counts{}
+		for _, fd := range im.Findings {
+			im.Counts.Add(fd.Severity)
+			if !seen[fd.ID] {
+				seen[fd.ID] = true
+				r.Counts.Add(fd.Severity)
+			}
+		}
+	}
+}
+
+// NewReport assembles a report from per-image results.
+func NewReport(haulID int64, advisories int, images []ImageReport) *Report {
+	r := &Report{HaulID: haulID, GeneratedAt: time.Now().UTC(), Advisories: advisories, Images: images}
+	if r.Images == nil {
+		r.Images = []ImageReport{}
+	}
+	r.tally()
+	return r
+}
+
+// WriteCSV writes one row per finding.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"image", "platform", "digest", "id", "aliases", "severity", "score",
+		"package", "type", "version", "fixed", "path", "purl", "summary"})
+	for _, im := range r.Images {
+		for _, fd := range im.Findings {
+			score := ""
+			if fd.Score > 0 {
+				score = fmt.Sprintf("%.1f", fd.Score)
+			}
+			_ = cw.Write([]string{im.Image, im.Platform, im.Digest, fd.ID, strings.Join(fd.Aliases, " "),
+				fd.Severity, score, fd.Package, fd.Type, fd.Version, fd.Fixed, fd.Path, fd.PURL, fd.Summary})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
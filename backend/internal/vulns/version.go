@@ -0,0 +1,490 @@
+package vulns
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// comparator orders two versions of one ecosystem, returning <0, 0 or >0.
+type comparator func(a, b string) int
+
+// comparatorFor returns the version ordering of an (lower-case) OSV
+// ecosystem. Ecosystems without a known ordering fall back to semver, which
+// is what most language registries use.
+func comparatorFor(ecosystem string) comparator {
+	switch ecosystem {
+	case "alpine", "wolfi", "chainguard":
+		return compareAPK
+	case "debian", "ubuntu":
+		return compareDpkg
+	case "red hat", "rocky linux", "almalinux", "suse", "opensuse", "mageia":
+		return compareRPM
+	case "pypi":
+		return comparePEP440
+	case "rubygems":
+		return compareGem
+	}
+	return compareSemver
+}
+
+// cmpNum compares two digit strings numerically, whatever their length.
+func cmpNum(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	return strings.Compare(a, b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// compareSemver orders semantic versions, tolerating a "v" prefix, missing or
+// extra components and build metadata.
+func compareSemver(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+	ar, apre, _ := strings.Cut(a, "-")
+	br, bpre, _ := strings.Cut(b, "-")
+	if c := compareDotted(ar, br); c != 0 {
+		return c
+	}
+	switch {
+	case apre == bpre:
+		return 0
+	case apre == "":
+		return 1
+	case bpre == "":
+		return -1
+	}
+	// Pre-release identifiers: numeric ones compare numerically and sort
+	// before alphanumeric ones; a shorter list sorts first.
+	as, bs := strings.Split(apre, "."), strings.Split(bpre, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, bn := allDigits(as[i]), allDigits(bs[i])
+		switch {
+		case an && bn:
+			if c := cmpNum(as[i], bs[i]); c != 0 {
+				return sign(c)
+			}
+		case an:
+			return -1
+		case bn:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(as) - len(bs))
+}
+
+// compareDotted compares dot-separated release numbers; missing components
+// count as zero, and a component's non-numeric tail breaks ties.
+func compareDotted(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xr := splitDigits(x)
+		yn, yr := splitDigits(y)
+		if c := cmpNum(xn, yn); c != 0 {
+			return sign(c)
+		}
+		if c := strings.Compare(xr, yr); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitDigits splits s into its leading digits and the rest.
+func splitDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareDpkg orders Debian versions ([epoch:]upstream[-revision]) the way
+// dpkg does.
+func compareDpkg(a, b string) int {
+	ae, av, ar := splitDpkg(a)
+	be, bv, br := splitDpkg(b)
+	if c := cmpNum(ae, be); c != 0 {
+		return sign(c)
+	}
+	if c := verrevcmp(av, bv); c != 0 {
+		return sign(c)
+	}
+	return sign(verrevcmp(ar, br))
+}
+
+func splitDpkg(v string) (epoch, upstream, revision string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok && allDigits(e) {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// verrevcmp is dpkg's comparison of an upstream version or revision: runs
+// of non-digits compare character by character, with '~' sorting before
+// everything (even the end of the string) and letters before other
+// characters; runs of digits compare numerically.
+func verrevcmp(a, b string) int {
+	order := func(s string, i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		switch {
+		case isDigit(c):
+			return 0
+		case isAlpha(c):
+			return int(c)
+		case c == '~':
+			return -1
+		}
+		return int(c) + 256
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := order(a, i), order(b, j)
+			if ac != bc {
+				return ac - bc
+			}
+			i++
+			j++
+		}
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = int(a[i]) - int(b[j])
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
+
+// compareRPM orders rpm versions ([epoch:]version[-release]) the way rpm
+// does.
+func compareRPM(a, b string) int {
+	ae, av, ar := splitRPM(a)
+	be, bv, br := splitRPM(b)
+	if c := cmpNum(ae, be); c != 0 {
+		return sign(c)
+	}
+	if c := rpmvercmp(av, bv); c != 0 {
+		return c
+	}
+	if ar == "" || br == "" {
+		return 0 // a version without a release matches any release
+	}
+	return rpmvercmp(ar, br)
+}
+
+func splitRPM(v string) (epoch, version, release string) {
+	epoch = "0"
+	if e, rest, ok := strings.Cut(v, ":"); ok && allDigits(e) {
+		epoch, v = e, rest
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// rpmvercmp is rpm's segment comparison: alphanumeric runs compare as
+// numbers or strings (numbers are newer), '~' sorts before anything and '^'
+// after the end of a version but before any further segment.
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+	alnum := func(c byte) bool { return isDigit(c) || isAlpha(c) }
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !alnum(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !alnum(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+		if (i < len(a) && a[i] == '~') || (j < len(b) && b[j] == '~') {
+			if i >= len(a) || a[i] != '~' {
+				return 1
+			}
+			if j >= len(b) || b[j] != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if (i < len(a) && a[i] == '^') || (j < len(b) && b[j] == '^') {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if a[i] != '^' {
+				return 1
+			}
+			if b[j] != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+		si, sj := i, j
+		numeric := isDigit(a[i])
+		class := isAlpha
+		if numeric {
+			class = isDigit
+		}
+		for i < len(a) && class(a[i]) {
+			i++
+		}
+		for j < len(b) && class(b[j]) {
+			j++
+		}
+		x, y := a[si:i], b[sj:j]
+		if y == "" {
+			// Segments of different types: numeric is newer.
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+		if numeric {
+			if c := cmpNum(x, y); c != 0 {
+				return sign(c)
+			}
+		} else if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i < len(a):
+		return 1
+	}
+	return -1
+}
+
+// apkSuffixes ranks Alpine version suffixes: pre-releases sort before a
+// plain version, the rest after it.
+var apkSuffixes = map[string]int{
+	"alpha": -4, "beta": -3, "pre": -2, "rc": -1,
+	"cvs": 1, "svn": 2, "git": 3, "hg": 4, "p": 5,
+}
+
+var apkVersion = regexp.MustCompile(`^(\d+(?:\.\d+)*)([a-z]?)((?:_[a-z]+\d*)*)(?:-r(\d+))?$`)
+
+// compareAPK orders Alpine package versions
+// (digits{.digits}[letter]{_suffix[N]}[-rN]).
+func compareAPK(a, b string) int {
+	am, bm := apkVersion.FindStringSubmatch(a), apkVersion.FindStringSubmatch(b)
+	if am == nil || bm == nil {
+		return compareDotted(a, b)
+	}
+	if c := compareDotted(am[1], bm[1]); c != 0 {
+		return c
+	}
+	if c := strings.Compare(am[2], bm[2]); c != 0 {
+		return c
+	}
+	as, bs := strings.Split(am[3], "_")[1:], strings.Split(bm[3], "_")[1:]
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xd := splitSuffix(x)
+		yn, yd := splitSuffix(y)
+		if xr, yr := apkSuffixes[xn], apkSuffixes[yn]; xr != yr {
+			return sign(xr - yr)
+		}
+		if c := cmpNum(xd, yd); c != 0 {
+			return sign(c)
+		}
+	}
+	return sign(cmpNum(am[4], bm[4]))
+}
+
+// splitSuffix splits an apk suffix like "rc2" into its name and number.
+func splitSuffix(s string) (string, string) {
+	i := 0
+	for i < len(s) && isAlpha(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+var pep440 = regexp.MustCompile(`(?i)^\s*v?(?:(\d+)!)?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|b|c|rc|alpha|beta|pre|preview)[-_.]?(\d*))?` +
+	`(?:-(\d+)|[-_.]?(post|rev|r)[-_.]?(\d*))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?(?:\+[a-z0-9]+(?:[-_.][a-z0-9]+)*)?\s*$`)
+
+// comparePEP440 orders Python package versions per PEP 440: epoch, release,
+// then dev < pre-release < final < post-release. Local versions are ignored.
+func comparePEP440(a, b string) int {
+	ak, aok := pep440Key(a)
+	bk, bok := pep440Key(b)
+	if !aok || !bok {
+		return compareSemver(a, b)
+	}
+	if c := cmpNum(ak.epoch, bk.epoch); c != 0 {
+		return sign(c)
+	}
+	if c := compareDotted(ak.release, bk.release); c != 0 {
+		return c
+	}
+	for i := range ak.rest {
+		if c := ak.rest[i] - bk.rest[i]; c != 0 {
+			return sign(c)
+		}
+	}
+	return 0
+}
+
+type pep440Version struct {
+	epoch, release string
+	rest           [5]int // pre phase, pre number, post, dev flag, dev number
+}
+
+func pep440Key(v string) (pep440Version, bool) {
+	m := pep440.FindStringSubmatch(v)
+	if m == nil {
+		return pep440Version{}, false
+	}
+	num := func(s string) int {
+		n, _ := strconv.Atoi(s)
+		return n
+	}
+	k := pep440Version{epoch: m[1], release: m[2]}
+	if k.epoch == "" {
+		k.epoch = "0"
+	}
+	const none = 1 << 30
+	pre, preN := none, 0 // a final release sorts after every pre-release
+	switch strings.ToLower(m[3]) {
+	case "a", "alpha":
+		pre = 0
+	case "b", "beta":
+		pre = 1
+	case "c", "rc", "pre", "preview":
+		pre = 2
+	}
+	if pre != none {
+		preN = num(m[4])
+	}
+	post := -1
+	switch {
+	case m[5] != "":
+		post = num(m[5])
+	case m[6] != "":
+		post = num(m[7])
+	}
+	dev, devN := 1, 0 // no dev segment sorts after any dev release
+	if m[8] != "" {
+		dev, devN = 0, num(m[9])
+		if pre == none && post < 0 {
+			pre = -1 // X.devN sorts before X's pre-releases
+		}
+	}
+	k.rest = [5]int{pre, preN, post, dev, devN}
+	return k, true
+}
+
+var gemSegment = regexp.MustCompile(`[0-9]+|[a-zA-Z]+`)
+
+// compareGem orders RubyGems versions: numeric segments compare
+// numerically, letters mark a pre-release that sorts before the numbers.
+func compareGem(a, b string) int {
+	as, bs := gemSegment.FindAllString(a, -1), gemSegment.FindAllString(b, -1)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, y := "0", "0"
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, yn := allDigits(x), allDigits(y)
+		switch {
+		case xn && yn:
+			if c := cmpNum(x, y); c != 0 {
+				return sign(c)
+			}
+		case xn:
+			return 1
+		case yn:
+			return -1
+		default:
+			if c := strings.Compare(x, y); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,44 @@
+package vulns
+
+import "testing"
+
+func TestComparators(t *testing.T) {
+	cases := []struct {
+		name string
+		cmp  comparator
+		a, b string
+		want int
+	}{
+		{"semver", compareSemver, "1.2.3", "1.2.10", -1},
+		{"semver prefix", compareSemver, "v1.22.0", "1.22.0", 0},
+		{"semver pre-release", compareSemver, "1.0.0-rc.1", "1.0.0", -1},
+		{"semver numeric pre", compareSemver, "1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"semver short", compareSemver, "2.0", "2.0.1", -1},
+		{"dpkg epoch", compareDpkg, "1:1.0-1", "2.0-1", 1},
+		{"dpkg tilde", compareDpkg, "3.0.11-1~deb12u2", "3.0.11-1", -1},
+		{"dpkg revision", compareDpkg, "3.0.11-1~deb12u2", "3.0.11-1~deb12u1", 1},
+		{"dpkg letters", compareDpkg, "1.2a", "1.2+", -1},
+		{"rpm release", compareRPM, "3.0.7-24.el9", "3.0.7-27.el9", -1},
+		{"rpm epoch", compareRPM, "1:3.0.7-24.el9", "3.0.8-1.el9", 1},
+		{"rpm tilde", compareRPM, "1.0~rc1-1", "1.0-1", -1},
+		{"rpm numeric beats alpha", compareRPM, "1.0.1", "1.0.a", 1},
+		{"apk revision", compareAPK, "1.2.4-r2", "1.2.4-r10", -1},
+		{"apk suffix", compareAPK, "1.0_rc1", "1.0", -1},
+		{"apk patch", compareAPK, "1.0_p1", "1.0", 1},
+		{"apk letter", compareAPK, "1.1.1w-r0", "1.1.1t-r3", 1},
+		{"pep440 pre", comparePEP440, "2.0.0rc1", "2.0.0", -1},
+		{"pep440 dev", comparePEP440, "2.0.0.dev1", "2.0.0a1", -1},
+		{"pep440 post", comparePEP440, "2.0.0.post1", "2.0.0", 1},
+		{"pep440 zeros", comparePEP440, "2.0", "2.0.0", 0},
+		{"gem prerelease", compareGem, "7.1.0.rc1", "7.1.0", -1},
+		{"gem numbers", compareGem, "3.0.10", "3.0.8", 1},
+	}
+	for _, c := range cases {
+		if got := sign(c.cmp(c.a, c.b)); got != c.want {
+			t.Errorf("%s: compare(%q, %q) = %d, want %d", c.name, c.a, c.b, got, c.want)
+		}
+		if got := sign(c.cmp(c.b, c.a)); got != -c.want {
+			t.Errorf("%s: compare(%q, %q) = %d, want %d", c.name, c.b, c.a, got, -c.want)
+		}
+	}
+}
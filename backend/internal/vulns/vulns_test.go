@@ -0,0 +1,234 @@
+package vulns
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hauler-ui/hauler-ui/backend/internal/sbom"
+	"github.com/hauler-ui/hauler-ui/backend/internal/sqlite"
+)
+
+// advisories is a small OSV bundle covering OS and language ecosystems.
+var advisories = map[string]string{
+	"ALPINE-1.json": `{"id":"CVE-2024-0001","summary":"musl overflow",
+		"severity":[{"type":"CVSS_V3","score":"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}],
+		"affected":[{"package":{"ecosystem":"Alpine:v3.19","name":"musl"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"},{"fixed":"1.2.4-r3"}]}]}]}`,
+	"ALPINE-2.json": `{"id":"CVE-2024-0002","summary":"other release",
+		"affected":[{"package":{"ecosystem":"Alpine:v3.18","name":"musl"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"},{"fixed":"1.2.5-r0"}]}]}]}`,
+	"DEBIAN-1.json": `{"id":"DSA-5000-1","aliases":["CVE-2024-0003"],
+		"affected":[{"package":{"ecosystem":"Debian:12","name":"openssl"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"0"},{"fixed":"3.0.11-1~deb12u3"}]}],
+			"ecosystem_specific":{"urgency":"high"}}]}`,
+	"GHSA-1.json": `{"id":"GHSA-aaaa-bbbb-cccc","aliases":["CVE-2021-23337"],"summary":"lodash command injection",
+		"database_specific":{"severity":"HIGH"},
+		"affected":[{"package":{"ecosystem":"npm","name":"lodash"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"4.17.21"}]}]}]}`,
+	"CVE-1.json": `{"id":"CVE-2021-23337","summary":"duplicate of the GHSA",
+		"affected":[{"package":{"ecosystem":"npm","name":"lodash"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"0"},{"fixed":"4.17.21"}]}]}]}`,
+	"PYSEC-1.json": `{"id":"PYSEC-2023-1","details":"requests leaks headers\nmore detail",
+		"affected":[{"package":{"ecosystem":"PyPI","name":"Requests"},
+			"ranges":[{"type":"ECOSYSTEM","events":[{"introduced":"2.3.0"},{"fixed":"2.31.0"}]}],
+			"versions":["2.30.0"]}]}`,
+	"GO-1.json": `{"id":"GO-2024-1","database_specific":{"severity":"MODERATE"},
+		"affected":[{"package":{"ecosystem":"Go","name":"stdlib"},
+			"ranges":[{"type":"SEMVER","events":[{"introduced":"1.22.0"},{"fixed":"1.22.2"},{"introduced":"1.21.0"},{"last_affected":"1.21.5"}]}]}]}`,
+	"OLD.json":    `{"id":"GHSA-gone","withdrawn":"2024-01-01T00:00:00Z","affected":[]}`,
+	"README.json": `{"not":"an advisory"}`,
+}
+
+func writeBundle(t *testing.T, files map[string]string) string {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := zw.Create(name)
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "all.zip")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db.DB)
+}
+
+func TestReadBundleFormats(t *testing.T) {
+	var ids []string
+	skipped, err := ReadBundle(writeBundle(t, advisories), func(a *Advisory) error {
+		ids = append(ids, a.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadBundle: %v", err)
+	}
+	if len(ids) != 8 || skipped != 1 {
+		t.Errorf("read %v, skipped %d; want 8 advisories and 1 skipped", ids, skipped)
+	}
+
+	// A JSON array, as some mirrors publish.
+	path := filepath.Join(t.TempDir(), "advisories.json")
+	_ = os.WriteFile(path, []byte("["+advisories["GHSA-1.json"]+","+advisories["GO-1.json"]+"]"), 0644)
+	ids = nil
+	if _, err := ReadBundle(path, func(a *Advisory) error { ids = append(ids, a.ID); return nil }); err != nil || len(ids) != 2 {
+		t.Errorf("array: read %v, %v", ids, err)
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	cases := map[string]float64{
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H": 9.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H": 10.0,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N": 6.1,
+		"CVSS:3.0/AV:L/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N": 1.8,
+		"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N": 0,
+	}
+	for vector, want := range cases {
+		if got, ok := cvss3(vector); !ok || got != want {
+			t.Errorf("cvss3(%s) = %v, %v; want %v", vector, got, ok, want)
+		}
+	}
+	if _, ok := cvss3("AV:N/AC:L"); ok {
+		t.Error("accepted a vector without a version")
+	}
+	if eco, rel := SplitEcosystem("Red Hat:enterprise_linux:9::appstream"); eco != "red hat" || rel != "9" {
+		t.Errorf("SplitEcosystem = %q, %q", eco, rel)
+	}
+}
+
+func TestImportAndMatch(t *testing.T) {
+	ctx := context.Background()
+	db := openDB(t)
+	imp, err := db.Import(ctx, writeBundle(t, advisories), "", 0, nil)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if imp.Advisories != 7 || imp.Withdrawn != 1 || imp.Source != "all.zip" {
+		t.Errorf("import = %+v", imp)
+	}
+	// Re-importing replaces rather than duplicates.
+	if _, err := db.Import(ctx, writeBundle(t, advisories), "again.zip", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.Stats(ctx)
+	if err != nil || stats.Advisories != 7 || len(stats.Imports) != 2 || stats.Ecosystems["alpine"] != 2 {
+		t.Errorf("stats = %+v, %v", stats, err)
+	}
+
+	inv := &sbom.Inventory{
+		Image: "docker.io/library/app:1", Digest: "sha256:" + strings.Repeat("a", 64),
+		Distro: &sbom.Distro{ID: "alpine", VersionID: "3.19.1"},
+		Packages: []sbom.Package{
+			{Type: sbom.TypeAPK, Name: "musl", Version: "1.2.4-r2", Source: "musl"},
+			{Type: sbom.TypeAPK, Name: "zlib", Version: "1.3.1-r0", Source: "zlib"},
+			{Type: sbom.TypeNPM, Name: "lodash", Version: "4.17.20"},
+			{Type: sbom.TypeNPM, Name: "lodash", Version: "4.17.21", Path: "/other"},
+			{Type: sbom.TypePyPI, Name: "requests", Version: "2.30.0"},
+			{Type: sbom.TypeGolang, Name: "stdlib", Version: "1.22.1"},
+			{Type: sbom.TypeGolang, Name: "stdlib", Version: "1.21.6", Path: "/other"},
+		},
+	}
+	findings, err := db.Matcher().Match(ctx, inv)
+	if err != nil {
+		t.Fatalf("Match: %v", err)
+	}
+	got := map[string]Finding{}
+	for _, f := range findings {
+		got[f.ID+" "+f.Version] = f
+	}
+	if len(findings) != 4 {
+		t.Errorf("findings = %+v, want 4", findings)
+	}
+	if f := got["CVE-2024-0001 1.2.4-r2"]; f.Severity != SeverityCritical || f.Score != 9.8 || f.Fixed != "1.2.4-r3" {
+		t.Errorf("musl finding = %+v", f)
+	}
+	if f := got["GHSA-aaaa-bbbb-cccc 4.17.20"]; f.Severity != SeverityHigh || f.Fixed != "4.17.21" {
+		t.Errorf("lodash finding = %+v", f)
+	}
+	if _, ok := got["PYSEC-2023-1 2.30.0"]; !ok {
+		t.Error("requests (matched case-insensitively) was not reported")
+	}
+	if f, ok := got["GO-2024-1 1.22.1"]; !ok || f.Severity != SeverityMedium || f.Fixed != "1.22.2" {
+		t.Errorf("stdlib finding = %+v", f)
+	}
+	if findings[0].Severity != SeverityCritical {
+		t.Errorf("findings should be ordered by severity, got %+v", findings[0])
+	}
+
+	// A Debian image matches by source package and release.
+	deb := &sbom.Inventory{
+		Distro:   &sbom.Distro{ID: "debian", VersionID: "12"},
+		Packages: []sbom.Package{{Type: sbom.TypeDeb, Name: "libssl3", Version: "3.0.11-1~deb12u2", Source: "openssl"}},
+	}
+	findings, _ = db.Matcher().Match(ctx, deb)
+	if len(findings) != 1 || findings[0].ID != "DSA-5000-1" || findings[0].Severity != SeverityHigh {
+		t.Errorf("debian findings = %+v", findings)
+	}
+	deb.Distro = nil
+	if findings, _ = db.Matcher().Match(ctx, deb); len(findings) != 0 {
+		t.Errorf("OS packages of an unknown distribution should not match, got %+v", findings)
+	}
+
+	if err := db.Clear(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if stats, _ := db.Stats(ctx); stats.Advisories != 0 || len(stats.Imports) != 0 {
+		t.Errorf("stats after clear = %+v", stats)
+	}
+}
+
+func TestReportFilterAndCSV(t *testing.T) {
+	report := NewReport(1, 10, []ImageReport{
+		{Image: "docker.io/library/app:1", Findings: []Finding{
+			{ID: "CVE-1", Severity: SeverityCritical, Package: "musl", Fixed: "1.2.5"},
+			{ID: "CVE-2", Aliases: []string{"GHSA-x"}, Severity: SeverityLow, Package: "zlib"},
+		}},
+		{Image: "docker.io/library/web:2", Findings: []Finding{
+			{ID: "CVE-1", Severity: SeverityCritical, Package: "musl"},
+		}},
+	})
+	if report.Counts.Critical != 1 || report.Counts.Low != 1 || report.Counts.Total != 2 {
+		t.Errorf("haul counts = %+v, want each vulnerability once", report.Counts)
+	}
+	if report.Images[0].Counts.Total != 2 {
+		t.Errorf("image counts = %+v", report.Images[0].Counts)
+	}
+
+	if r := report.Filter(Filter{Severities: []string{"critical"}}); len(r.Images) != 2 || r.Counts.Total != 1 {
+		t.Errorf("severity filter = %+v", r)
+	}
+	if r := report.Filter(Filter{Fixable: true}); len(r.Images) != 1 || len(r.Images[0].Findings) != 1 {
+		t.Errorf("fixable filter = %+v", r)
+	}
+	if r := report.Filter(Filter{ID: "ghsa-x", Image: "app"}); len(r.Images) != 1 || r.Images[0].Findings[0].ID != "CVE-2" {
+		t.Errorf("alias filter = %+v", r)
+	}
+
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "image,platform,digest,id") {
+		t.Errorf("csv = %s", buf.String())
+	}
+}
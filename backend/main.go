@@ -87,6 +87,72 @@ func startJobProcessor(runner *jobrunner.Runner, stopCh <-chan struct{}) {
 	log.Println("Job processor started")
 }
 
+// trashPurgeInterval is how often expired hauls are purged from the trash.
+const trashPurgeInterval = 1 * time.Hour
+
+// startTrashPurger starts a background goroutine that permanently removes
+// trashed hauls once their retention period has lapsed.
+func startTrashPurger(svc *hauls.Service, stopCh <-chan struct{}) {
+	ctx := context.Background()
+	purge := func() {
+		n, err := svc.PurgeExpired(ctx)
+		if err != nil {
+			log.Printf("Error purging trash: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Trash purger: permanently removed %d expired haul(s)", n)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
+
+// uploadPurgeInterval is how often expired partial uploads are removed.
+const uploadPurgeInterval = 15 * time.Minute
+
+// startUploadPurger starts a background goroutine that removes resumable
+// uploads (and their partial data) once they have sat idle past expiry.
+func startUploadPurger(h *store.Handler, stopCh <-chan struct{}) {
+	ctx := context.Background()
+	purge := func() {
+		n, err := h.PurgeExpiredUploads(ctx)
+		if err != nil {
+			log.Printf("Error purging uploads: %v", err)
+			return
+		}
+		if n > 0 {
+			log.Printf("Upload purger: removed %d expired upload(s)", n)
+		}
+	}
+
+	go func() {
+		purge()
+		ticker := time.NewTicker(uploadPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				purge()
+			}
+		}
+	}()
+}
+
 // cleanupOnBoot resets state left over from a previous run: jobs stuck in
 // "running" (the process died mid-job) are marked failed, and stale serve
 // process rows (dead PIDs) are marked stopped so the UI reflects reality.
@@ -143,6 +209,9 @@ func main() {
 
 	// Initialize store handler
 	storeHandler := store.NewHandler(jobRunner, cfg, haulService)
+	if err := storeHandler.OpenKeystore(); err != nil {
+		log.Fatalf("Failed to open cosign keystore: %v", err)
+	}
 
 	// Initialize manifests handler
 	manifestsHandler := manifests.NewHandler(db.DB, haulService)
@@ -155,6 +224,23 @@ func main() {
 	publishHandler := publish.NewHandler(publishManager, haulService)
 	publishManager.RestoreOnBoot(context.Background())
 
+	// Deleting a haul moves it to the trash; take it offline right away and
+	// purge it for good once the retention period lapses.
+	haulService.OnDelete(func(ctx context.Context, haul *hauls.Haul) {
+		if err := publishManager.Unpublish(ctx, haul.ID); err != nil {
+			log.Printf("Warning: failed to unpublish deleted haul %d: %v", haul.ID, err)
+		}
+	})
+	startTrashPurger(haulService, stopCh)
+	startUploadPurger(storeHandler, stopCh)
+
+	// Haul templates can sync their manifests and publish the new haul.
+	haulsHandler.SyncManifests = storeHandler.SyncManifests
+	haulsHandler.Publish = func(ctx context.Context, haul *hauls.Haul, hostname string) error {
+		_, err := publishManager.Publish(ctx, haul.ID, hostname)
+		return err
+	}
+
 	// Initialize settings handler
 	settingsHandler := settings.NewHandler(db.DB)
 